@@ -2,16 +2,48 @@ package main
 
 import (
 	"campaign/internal/server"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
 
 	server := server.NewServer()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		<-ctx.Done()
+
+		slog.Info("Shutting down server")
+
+		// stops the job workers too, jobs not handed back in time are
+		// picked up again once their lease expires
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Error shutting down server", "error", err)
+		}
+	}()
+
 	err := server.ListenAndServe()
 
-	if err != nil {
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		panic(fmt.Sprintf("cannot start server: %s", err))
 	}
+
+	<-done
 }
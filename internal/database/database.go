@@ -3,6 +3,7 @@ package database
 import (
 	"campaign/internal/models"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -69,6 +70,456 @@ func setupDBUniqueIndex(db *mongo.Database) {
 		slog.Error("Error creating index: ", "error", err)
 	}
 
+	assetIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "checksum", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("created_by_checksum"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_ids", Value: 1}},
+		Options: options.Index().SetName("campaign_ids"),
+	},
+	}
+
+	_, err = db.Collection(string(models.AssetsCollection)).Indexes().CreateMany(context.Background(), assetIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.CategoriesCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("created_by_name"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.CustomFieldsCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("created_by_key"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.CampaignsCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "tags", Value: 1}},
+		Options: options.Index().SetName("created_by_tags"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// landing pages are found by slug, campaigns made before slugs have none
+	_, err = db.Collection(string(models.CampaignsCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "slug", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("slug").SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.SpendCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "occurred_at", Value: 1}},
+		Options: options.Index().SetName("campaign_id_occurred_at"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.MetricEventsCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "metric", Value: 1}, {Key: "occurred_at", Value: 1}},
+		Options: options.Index().SetName("campaign_id_metric_occurred_at"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// contacts are de-duplicated by normalized email and msisdn, either may be missing
+	contactIndexes := []mongo.IndexModel{{
+		Keys: bson.D{{Key: "created_by", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("created_by_email").
+			SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}}),
+	}, {
+		Keys: bson.D{{Key: "created_by", Value: 1}, {Key: "msisdn", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("created_by_msisdn").
+			SetPartialFilterExpression(bson.M{"msisdn": bson.M{"$type": "string"}}),
+	}, {
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "list_ids", Value: 1}},
+		Options: options.Index().SetName("created_by_list_ids"),
+	},
+	}
+
+	_, err = db.Collection(string(models.ContactsCollection)).Indexes().CreateMany(context.Background(), contactIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// $merge into audience_members matches on these fields
+	_, err = db.Collection(string(models.AudienceMembersCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "contact_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("campaign_contact"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// a batch texts each contact once, the dispatcher claims due queued messages
+	smsIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "batch_id", Value: 1}, {Key: "contact_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("batch_contact"),
+	}, {
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		Options: options.Index().SetName("status_next_attempt_at"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "status", Value: 1}},
+		Options: options.Index().SetName("campaign_status"),
+	}, {
+		Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "provider_message_id", Value: 1}},
+		Options: options.Index().SetName("provider_message_id").SetSparse(true),
+	}, {
+		// experiment results count each variant's deliveries
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "variant", Value: 1}},
+		Options: options.Index().SetName("campaign_id_variant").SetPartialFilterExpression(bson.M{"variant": bson.M{"$exists": true}}),
+	},
+	}
+
+	_, err = db.Collection(string(models.SMSMessagesCollection)).Indexes().CreateMany(context.Background(), smsIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.SenderIdentitiesCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("created_by_email"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// bounces are matched back to a message by its Message-ID header
+	emailIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "batch_id", Value: 1}, {Key: "contact_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("batch_contact"),
+	}, {
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		Options: options.Index().SetName("status_next_attempt_at"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "status", Value: 1}},
+		Options: options.Index().SetName("campaign_status"),
+	}, {
+		Keys:    bson.D{{Key: "message_id", Value: 1}},
+		Options: options.Index().SetName("message_id").SetSparse(true),
+	}, {
+		// experiment results count each variant's deliveries
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "variant", Value: 1}},
+		Options: options.Index().SetName("campaign_id_variant").SetPartialFilterExpression(bson.M{"variant": bson.M{"$exists": true}}),
+	},
+	}
+
+	_, err = db.Collection(string(models.EmailMessagesCollection)).Indexes().CreateMany(context.Background(), emailIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// workers lease the oldest due job, expired leases are found on the same index
+	jobIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}},
+		Options: options.Index().SetName("status_run_at"),
+	}, {
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "lease_expires_at", Value: 1}},
+		Options: options.Index().SetName("status_lease_expires_at"),
+	}, {
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("created_by_created_at"),
+	},
+	}
+
+	_, err = db.Collection(string(models.JobsCollection)).Indexes().CreateMany(context.Background(), jobIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.TemplatesCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("created_by_name"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// providers retry callbacks, a receipt is processed once per event id
+	receiptIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "channel", Value: 1}, {Key: "provider", Value: 1}, {Key: "event_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("channel_provider_event"),
+	}, {
+		Keys:    bson.D{{Key: "channel", Value: 1}, {Key: "provider", Value: 1}, {Key: "message_id", Value: 1}, {Key: "applied", Value: 1}},
+		Options: options.Index().SetName("channel_provider_message_applied"),
+	},
+	}
+
+	_, err = db.Collection(string(models.DeliveryReceiptsCollection)).Indexes().CreateMany(context.Background(), receiptIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// an address is suppressed once per account and channel
+	_, err = db.Collection(string(models.SuppressionsCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "channel", Value: 1}, {Key: "address", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("created_by_channel_address"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// inbound keywords are matched to the accounts that texted the number
+	_, err = db.Collection(string(models.SMSMessagesCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "to", Value: 1}, {Key: "created_by", Value: 1}},
+		Options: options.Index().SetName("to_created_by"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// short link codes are global, they are all served from /r/{code}
+	linkIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("code"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "created_by", Value: 1}},
+		Options: options.Index().SetName("campaign_id_created_by"),
+	}, {
+		// one link of each kind per campaign, so printed qr codes keep working
+		Keys: bson.D{{Key: "campaign_id", Value: 1}, {Key: "kind", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("campaign_id_kind").
+			SetPartialFilterExpression(bson.M{"kind": bson.M{"$exists": true}}),
+	},
+	}
+
+	_, err = db.Collection(string(models.LinksCollection)).Indexes().CreateMany(context.Background(), linkIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	clickIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "link_id", Value: 1}, {Key: "clicked_at", Value: 1}},
+		Options: options.Index().SetName("link_id_clicked_at"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "clicked_at", Value: 1}},
+		Options: options.Index().SetName("campaign_id_clicked_at"),
+	}, {
+		// experiment results count each variant's clicks
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "variant", Value: 1}},
+		Options: options.Index().SetName("campaign_id_variant").SetPartialFilterExpression(bson.M{"variant": bson.M{"$exists": true}}),
+	},
+	}
+
+	_, err = db.Collection(string(models.ClicksCollection)).Indexes().CreateMany(context.Background(), clickIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// claim references are public handles, the counters hold one document
+	// per campaign and contact so limits are enforced by the unique index
+	claimIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "reference", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("reference"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("campaign_id_status_created_at"),
+	}, {
+		// max_claims eligibility rules count claims per msisdn, email or ip
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "msisdn", Value: 1}},
+		Options: options.Index().SetName("campaign_id_msisdn"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "email", Value: 1}},
+		Options: options.Index().SetName("campaign_id_email"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "ip", Value: 1}},
+		Options: options.Index().SetName("campaign_id_ip"),
+	}, {
+		// risk scoring counts recent claims sharing a device, inbox or prefix
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "device_id", Value: 1}},
+		Options: options.Index().SetName("campaign_id_device_id"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "email_key", Value: 1}},
+		Options: options.Index().SetName("campaign_id_email_key"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "msisdn_prefix", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("campaign_id_msisdn_prefix_created_at"),
+	}, {
+		// the review queue, riskiest first
+		Keys:    bson.D{{Key: "created_by", Value: 1}, {Key: "status", Value: 1}, {Key: "risk.score", Value: -1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("created_by_status_risk_score"),
+	}, {
+		// experiment results count each variant's claims
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "variant", Value: 1}},
+		Options: options.Index().SetName("campaign_id_variant").SetPartialFilterExpression(bson.M{"variant": bson.M{"$exists": true}}),
+	},
+	}
+
+	_, err = db.Collection(string(models.ClaimsCollection)).Indexes().CreateMany(context.Background(), claimIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.ClaimCountersCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "contact_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("campaign_id_contact_id"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// a code is unique in its pool, issuing takes the oldest available one
+	voucherIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "pool_id", Value: 1}, {Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("pool_id_code"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "status", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("campaign_id_status_id"),
+	}, {
+		// a claim holds at most one code even when two workers issue for it
+		Keys:    bson.D{{Key: "claim_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("claim_id_unique").SetPartialFilterExpression(bson.M{"claim_id": bson.M{"$type": "string"}}),
+	},
+	}
+
+	// the claim_id index was not unique at first, an index on the same key
+	// with other options cannot be created next to it
+	_, err = db.Collection(string(models.VouchersCollection)).Indexes().DropOne(context.Background(), "claim_id")
+
+	cmdErr := mongo.CommandError{}
+
+	if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Name == "IndexNotFound" || cmdErr.Name == "NamespaceNotFound")) {
+		slog.Error("Error dropping index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.VouchersCollection)).Indexes().CreateMany(context.Background(), voucherIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// one code per user and campaign, a user is attributed to one referrer
+	referralCodeIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("code"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("campaign_id_user_id"),
+	}, {
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("user_id_created_at"),
+	},
+	}
+
+	_, err = db.Collection(string(models.ReferralCodesCollection)).Indexes().CreateMany(context.Background(), referralCodeIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	referralIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("user_id"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("campaign_id_created_at"),
+	},
+	}
+
+	_, err = db.Collection(string(models.ReferralsCollection)).Indexes().CreateMany(context.Background(), referralIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// an entry with a reference is credited once, balances and daily limits
+	// read a user's entries
+	pointsLedgerIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "action", Value: 1}, {Key: "reference", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("campaign_id_user_id_action_reference").SetPartialFilterExpression(bson.M{"reference": bson.M{"$type": "string"}}),
+	}, {
+		// each slot of an action's daily limit is taken once a day
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "action", Value: 1}, {Key: "day", Value: 1}, {Key: "slot", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("campaign_id_user_id_action_day_slot").SetPartialFilterExpression(bson.M{"slot": bson.M{"$exists": true}}),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("campaign_id_user_id_created_at"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("campaign_id_created_at"),
+	},
+	}
+
+	_, err = db.Collection(string(models.PointsLedgerCollection)).Indexes().CreateMany(context.Background(), pointsLedgerIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// leaderboards are read in rank order and ranks are counted on the same
+	// index
+	pointsTotalIndexes := []mongo.IndexModel{{
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "period", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("campaign_id_period_user_id"),
+	}, {
+		Keys:    bson.D{{Key: "campaign_id", Value: 1}, {Key: "period", Value: 1}, {Key: "points", Value: -1}, {Key: "reached_at", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetName("campaign_id_period_rank"),
+	},
+	}
+
+	_, err = db.Collection(string(models.PointsTotalsCollection)).Indexes().CreateMany(context.Background(), pointsTotalIndexes)
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	_, err = db.Collection(string(models.CodePoolsCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "key_hash", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("key_hash"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
+	// an alert fires once per threshold and budget total, raising the budget re-arms it
+	_, err = db.Collection(string(models.BudgetAlertsCollection)).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "campaign_id", Value: 1},
+			{Key: "type", Value: 1},
+			{Key: "threshold", Value: 1},
+			{Key: "budget_total", Value: 1},
+			{Key: "day", Value: 1},
+		},
+		Options: options.Index().SetUnique(true).SetName("campaign_alert"),
+	})
+
+	if err != nil {
+		slog.Error("Error creating index: ", "error", err)
+	}
+
 }
 
 func (s *service) Health() map[string]string {
@@ -96,8 +547,14 @@ type Database interface {
 	InsertMany(documents []interface{}) error
 	FindOne(filter bson.M, result interface{}) error
 	FindMany(filter bson.M, result interface{}) error
+	FindManyWithOptions(filter bson.M, opts *options.FindOptions, result interface{}) error
 	AggregateMany(pipeline []bson.M, result interface{}) error
 	UpdateOne(filter bson.M, update bson.M) error
+	UpdateOneRaw(filter bson.M, update bson.M) error
+	UpdateManyRaw(filter bson.M, update bson.M) error
+	FindOneAndUpdate(filter bson.M, update bson.M, opts *options.FindOneAndUpdateOptions, result interface{}) error
+	CountDocuments(filter bson.M) (int64, error)
+	BulkWrite(writes []mongo.WriteModel) (*mongo.BulkWriteResult, error)
 	DeleteOne(filter bson.M) error
 }
 
@@ -152,6 +609,19 @@ func (s *databaseService) FindMany(filter bson.M, result interface{}) error {
 	return err
 }
 
+func (s *databaseService) FindManyWithOptions(filter bson.M, opts *options.FindOptions, result interface{}) error {
+	c := s.db.Collection(string(s.collection))
+	w, err := c.Find(s.ctx, filter, opts)
+
+	if err != nil {
+		return err
+	}
+
+	err = w.All(s.ctx, result)
+
+	return err
+}
+
 func (s *databaseService) UpdateOne(filter bson.M, update bson.M) error {
 	c := s.db.Collection(string(s.collection))
 
@@ -164,6 +634,42 @@ func (s *databaseService) UpdateOne(filter bson.M, update bson.M) error {
 	return err
 }
 
+// UpdateOneRaw applies update as given, use it for operators other than $set
+func (s *databaseService) UpdateOneRaw(filter bson.M, update bson.M) error {
+	c := s.db.Collection(string(s.collection))
+	_, err := c.UpdateOne(s.ctx, filter, update)
+
+	return err
+}
+
+func (s *databaseService) UpdateManyRaw(filter bson.M, update bson.M) error {
+	c := s.db.Collection(string(s.collection))
+	_, err := c.UpdateMany(s.ctx, filter, update)
+
+	return err
+}
+
+// FindOneAndUpdate atomically applies update as given and decodes the document,
+// it returns mongo.ErrNoDocuments when nothing matched
+func (s *databaseService) FindOneAndUpdate(filter bson.M, update bson.M, opts *options.FindOneAndUpdateOptions, result interface{}) error {
+	c := s.db.Collection(string(s.collection))
+
+	return c.FindOneAndUpdate(s.ctx, filter, update, opts).Decode(result)
+}
+
+func (s *databaseService) CountDocuments(filter bson.M) (int64, error) {
+	c := s.db.Collection(string(s.collection))
+
+	return c.CountDocuments(s.ctx, filter)
+}
+
+// BulkWrite runs writes unordered so one failing write does not stop the rest
+func (s *databaseService) BulkWrite(writes []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	c := s.db.Collection(string(s.collection))
+
+	return c.BulkWrite(s.ctx, writes, options.BulkWrite().SetOrdered(false))
+}
+
 func (s *databaseService) DeleteOne(filter bson.M) error {
 	c := s.db.Collection(string(s.collection))
 	_, err := c.DeleteOne(s.ctx, filter)
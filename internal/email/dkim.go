@@ -0,0 +1,89 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// signedHeaders are covered by the signature when present
+var signedHeaders = []string{"From", "To", "Reply-To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "List-Unsubscribe", "List-Unsubscribe-Post"}
+
+// DKIM signs messages sent from Domain or its subdomains with relaxed
+// canonicalization and rsa-sha256 or ed25519-sha256 depending on the key
+type DKIM struct {
+	Domain   string
+	Selector string
+	Key      crypto.Signer
+}
+
+// LoadDKIM reads a PEM encoded PKCS#1 or PKCS#8 private key from path
+func LoadDKIM(domain, selector, path string) (*DKIM, error) {
+	if domain == "" || selector == "" {
+		return nil, errors.New("DKIM_DOMAIN and DKIM_SELECTOR are required to sign")
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("dkim key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return &DKIM{Domain: strings.ToLower(domain), Selector: selector, Key: key}, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid dkim key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+
+	if !ok {
+		return nil, errors.New("dkim key can not sign")
+	}
+
+	return &DKIM{Domain: strings.ToLower(domain), Selector: selector, Key: signer}, nil
+}
+
+// Signs reports whether from is in the signing domain
+func (d *DKIM) Signs(from string) bool {
+	domain := Domain(from)
+
+	return domain == d.Domain || strings.HasSuffix(domain, "."+d.Domain)
+}
+
+// Sign returns raw with a DKIM-Signature header prepended
+func (d *DKIM) Sign(raw []byte) ([]byte, error) {
+	signed := bytes.Buffer{}
+
+	err := dkim.Sign(&signed, bytes.NewReader(raw), &dkim.SignOptions{
+		Domain:                 d.Domain,
+		Selector:               d.Selector,
+		Signer:                 d.Key,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		HeaderKeys:             signedHeaders,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error signing message: %w", err)
+	}
+
+	return signed.Bytes(), nil
+}
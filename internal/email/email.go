@@ -0,0 +1,146 @@
+package email
+
+import (
+	"campaign/internal/webhook"
+	"context"
+	"errors"
+	"log/slog"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// ErrPermanent marks a delivery failure that will not succeed on retry,
+// e.g. a 5xx reply from the smtp server
+var ErrPermanent = errors.New("permanent email failure")
+
+var (
+	driver  = os.Getenv("EMAIL_DRIVER")
+	logPath = os.Getenv("EMAIL_LOG_PATH")
+
+	smtpHost     = os.Getenv("SMTP_HOST")
+	smtpPort, _  = strconv.Atoi(os.Getenv("SMTP_PORT"))
+	smtpUsername = os.Getenv("SMTP_USERNAME")
+	smtpPassword = os.Getenv("SMTP_PASSWORD")
+	smtpTLS      = os.Getenv("SMTP_TLS")
+
+	dkimDomain   = os.Getenv("DKIM_DOMAIN")
+	dkimSelector = os.Getenv("DKIM_SELECTOR")
+	dkimKeyPath  = os.Getenv("DKIM_PRIVATE_KEY_PATH")
+
+	webhookSecret = os.Getenv("EMAIL_WEBHOOK_SECRET")
+)
+
+// EmailProvider hands a built message to a mail server. Errors wrapping
+// ErrPermanent are not retried, any other error is.
+type EmailProvider interface {
+	Name() string
+	Deliver(ctx context.Context, from, to string, raw []byte) error
+}
+
+// Mailer builds, signs and delivers messages
+type Mailer struct {
+	provider EmailProvider
+	dkim     *DKIM
+}
+
+func NewMailer(provider EmailProvider, dkim *DKIM) *Mailer {
+	return &Mailer{provider: provider, dkim: dkim}
+}
+
+// New returns a mailer for the provider configured through EMAIL_DRIVER,
+// "smtp" relays through SMTP_HOST and anything else writes .eml files to
+// EMAIL_LOG_PATH. Messages from DKIM_DOMAIN are signed when a key is set.
+func New() *Mailer {
+	var provider EmailProvider
+
+	switch driver {
+	case "smtp":
+		slog.Info("Using smtp email provider", "Host", smtpHost, "Port", smtpPort)
+
+		provider = NewSMTPProvider(SMTPConfig{
+			Host:     smtpHost,
+			Port:     smtpPort,
+			Username: smtpUsername,
+			Password: smtpPassword,
+			TLS:      smtpTLS,
+		})
+	default:
+		slog.Info("Using log email provider", "Path", logPath)
+
+		provider = NewLogProvider(logPath)
+	}
+
+	var dkim *DKIM
+
+	if dkimKeyPath != "" {
+		d, err := LoadDKIM(dkimDomain, dkimSelector, dkimKeyPath)
+
+		if err != nil {
+			slog.Error("Error loading dkim key, messages will not be signed", "error", err)
+		} else {
+			dkim = d
+		}
+	}
+
+	return NewMailer(provider, dkim)
+}
+
+func (m *Mailer) Name() string {
+	return m.provider.Name()
+}
+
+// Send builds msg, signs it when the from domain has a key and delivers it
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	raw, err := Build(msg)
+
+	if err != nil {
+		return err
+	}
+
+	if m.dkim != nil && m.dkim.Signs(msg.From.Address) {
+		raw, err = m.dkim.Sign(raw)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return m.provider.Deliver(ctx, msg.From.Address, msg.To.Address, raw)
+}
+
+// WebhookSecret authenticates bounce and complaint notifications
+func WebhookSecret() string {
+	return webhookSecret
+}
+
+// ReceiptVerifier authenticates delivery receipts from provider. Relays post
+// them with the same X-Webhook-Secret header as bounce notifications.
+func ReceiptVerifier(provider string) (webhook.Verifier, bool) {
+	switch provider {
+	case "smtp", "log":
+		return webhook.SecretVerifier{Secret: webhookSecret, Header: "X-Webhook-Secret"}, true
+	}
+
+	return nil, false
+}
+
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrPermanent)
+}
+
+// Domain returns the part of an address after the @
+func Domain(address string) string {
+	addr, err := mail.ParseAddress(address)
+
+	if err == nil {
+		address = addr.Address
+	}
+
+	_, domain, _ := strings.Cut(address, "@")
+
+	return strings.ToLower(domain)
+}
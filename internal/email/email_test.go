@@ -0,0 +1,296 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// sink is a minimal smtp server that keeps what it is sent
+type sink struct {
+	addr     string
+	mu       sync.Mutex
+	from, to []string
+	data     [][]byte
+}
+
+func newSink(t *testing.T) *sink {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+
+	s := &sink{addr: l.Addr().String()}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *sink) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+
+	reply("220 sink ready")
+
+	for {
+		line, err := r.ReadString('\n')
+
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = append(s.from, strings.TrimSpace(line[10:]))
+			s.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if strings.Contains(cmd, "NOBODY@") {
+				reply("550 no such user")
+				continue
+			}
+
+			if strings.Contains(cmd, "BUSY@") {
+				reply("451 try again later")
+				continue
+			}
+
+			s.mu.Lock()
+			s.to = append(s.to, strings.TrimSpace(line[8:]))
+			s.mu.Unlock()
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+
+			data := bytes.Buffer{}
+
+			for {
+				l, err := r.ReadString('\n')
+
+				if err != nil {
+					return
+				}
+
+				if l == ".\r\n" {
+					break
+				}
+
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+
+			s.mu.Lock()
+			s.data = append(s.data, data.Bytes())
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func sinkProvider(s *sink) *SMTPProvider {
+	host, port, _ := net.SplitHostPort(s.addr)
+	n, _ := strconv.Atoi(port)
+
+	return NewSMTPProvider(SMTPConfig{Host: host, Port: n, TLS: "none"})
+}
+
+func testMessage() Message {
+	return Message{
+		From:      mail.Address{Name: "Akwaaba Promos", Address: "promos@example.com"},
+		To:        mail.Address{Name: "Ama", Address: "ama@example.org"},
+		Subject:   "Your voucher is ready ✓",
+		Text:      "Hello Ama, use code SAVE10.",
+		HTML:      "<p>Hello Ama, use code <b>SAVE10</b>.</p>",
+		MessageID: "abc@example.com",
+	}
+}
+
+func TestBuildMultipart(t *testing.T) {
+	raw, err := Build(testMessage())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+
+	if subject != "Your voucher is ready ✓" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+
+	if msg.Header.Get("Message-ID") != "<abc@example.com>" {
+		t.Errorf("unexpected message id %q", msg.Header.Get("Message-ID"))
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative; got %s", mediaType)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	types := []string{}
+
+	for {
+		part, err := mr.NextPart()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		types = append(types, strings.Split(part.Header.Get("Content-Type"), ";")[0])
+	}
+
+	if strings.Join(types, ",") != "text/plain,text/html" {
+		t.Errorf("expected text then html parts; got %v", types)
+	}
+}
+
+func TestBuildRejectsHeaderInjection(t *testing.T) {
+	msg := testMessage()
+	msg.ReplyTo = "a@example.com\r\nBcc: victim@example.com"
+
+	if _, err := Build(msg); !IsPermanent(err) {
+		t.Errorf("expected a line break in a header to be rejected; got %v", err)
+	}
+}
+
+func TestSMTPProvider(t *testing.T) {
+	s := newSink(t)
+	p := sinkProvider(s)
+
+	raw, _ := Build(testMessage())
+
+	if err := p.Deliver(context.Background(), "promos@example.com", "ama@example.org", raw); err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	if len(s.data) != 1 || !bytes.Contains(s.data[0], []byte("Subject:")) {
+		t.Fatalf("expected the sink to receive the message; got %d messages", len(s.data))
+	}
+
+	if s.to[0] != "<ama@example.org>" {
+		t.Errorf("unexpected recipient %q", s.to[0])
+	}
+
+	err := p.Deliver(context.Background(), "promos@example.com", "nobody@example.org", raw)
+
+	if !IsPermanent(err) {
+		t.Errorf("expected a 550 to be permanent; got %v", err)
+	}
+
+	err = p.Deliver(context.Background(), "promos@example.com", "busy@example.org", raw)
+
+	if err == nil || IsPermanent(err) {
+		t.Errorf("expected a 451 to be retryable; got %v", err)
+	}
+}
+
+func TestMailerSignsWithDKIM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "dkim.pem")
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	if err := os.WriteFile(path, pemKey, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := LoadDKIM("example.com", "mail", path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newSink(t)
+	m := NewMailer(sinkProvider(s), d)
+
+	if err := m.Send(context.Background(), testMessage()); err != nil {
+		t.Fatal(err)
+	}
+
+	pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(s.data[0]), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(pub)}, nil
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(verifications) != 1 || verifications[0].Err != nil {
+		t.Fatalf("expected one valid signature; got %+v", verifications)
+	}
+
+	if verifications[0].Domain != "example.com" {
+		t.Errorf("expected signature for example.com; got %s", verifications[0].Domain)
+	}
+
+	if d.Signs("promos@other.com") {
+		t.Error("expected addresses outside the domain not to be signed")
+	}
+
+	if !d.Signs("news@mail.example.com") {
+		t.Error("expected subdomains to be signed")
+	}
+}
@@ -0,0 +1,42 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LogProvider does not deliver anything. It writes each message to an .eml
+// file under dir, or logs the envelope when no dir is set, for local development.
+type LogProvider struct {
+	dir string
+}
+
+func NewLogProvider(dir string) *LogProvider {
+	return &LogProvider{dir: dir}
+}
+
+func (p *LogProvider) Name() string {
+	return "log"
+}
+
+func (p *LogProvider) Deliver(ctx context.Context, from, to string, raw []byte) error {
+	if p.dir == "" {
+		slog.Info("Email", "from", from, "to", to, "size", len(raw))
+
+		return nil
+	}
+
+	if err := os.MkdirAll(p.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), primitive.NewObjectID().Hex())
+
+	return os.WriteFile(filepath.Join(p.dir, name), raw, 0o644)
+}
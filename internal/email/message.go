@@ -0,0 +1,136 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	From    mail.Address
+	To      mail.Address
+	ReplyTo string
+	Subject string
+	Text    string
+	HTML    string
+
+	// MessageID is used as the Message-ID header without the angle brackets
+	MessageID string
+
+	// Headers are added as given e.g. List-Unsubscribe
+	Headers map[string]string
+	Date    time.Time
+}
+
+// Build renders msg as an RFC 5322 message. With both bodies set it is a
+// multipart/alternative so clients without html show the text part.
+func Build(msg Message) ([]byte, error) {
+	if msg.Text == "" && msg.HTML == "" {
+		return nil, fmt.Errorf("%w: a text or html body is required", ErrPermanent)
+	}
+
+	if msg.Date.IsZero() {
+		msg.Date = time.Now()
+	}
+
+	headers := [][2]string{
+		{"From", msg.From.String()},
+		{"To", msg.To.String()},
+	}
+
+	if msg.ReplyTo != "" {
+		headers = append(headers, [2]string{"Reply-To", msg.ReplyTo})
+	}
+
+	headers = append(headers,
+		[2]string{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		[2]string{"Date", msg.Date.Format(time.RFC1123Z)},
+	)
+
+	if msg.MessageID != "" {
+		headers = append(headers, [2]string{"Message-ID", "<" + msg.MessageID + ">"})
+	}
+
+	headers = append(headers, [2]string{"MIME-Version", "1.0"})
+
+	extra := make([]string, 0, len(msg.Headers))
+
+	for key := range msg.Headers {
+		extra = append(extra, key)
+	}
+
+	sort.Strings(extra)
+
+	for _, key := range extra {
+		headers = append(headers, [2]string{textproto.CanonicalMIMEHeaderKey(key), msg.Headers[key]})
+	}
+
+	buf := bytes.Buffer{}
+
+	for _, h := range headers {
+		// a line break in a value would let it add headers of its own
+		if strings.ContainsAny(h[0]+h[1], "\r\n") {
+			return nil, fmt.Errorf("%w: header %s contains a line break", ErrPermanent, h[0])
+		}
+
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+
+	if msg.Text == "" || msg.HTML == "" {
+		contentType, body := "text/plain", msg.Text
+
+		if msg.HTML != "" {
+			contentType, body = "text/html", msg.HTML
+		}
+
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", contentType)
+
+		if err := writeQuotedPrintable(&buf, body); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+
+	for _, part := range [][2]string{{"text/plain", msg.Text}, {"text/html", msg.HTML}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part[0] + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := writeQuotedPrintable(w, part[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, body string) error {
+	qp := quotedprintable.NewWriter(w)
+
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+
+	return qp.Close()
+}
@@ -0,0 +1,135 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+
+	// TLS is "starttls" (the default), "tls" for implicit tls e.g. port 465
+	// or "none" for a local relay or sink
+	TLS string
+
+	Timeout time.Duration
+}
+
+type SMTPProvider struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPProvider(cfg SMTPConfig) *SMTPProvider {
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+
+	if cfg.TLS == "" {
+		cfg.TLS = "starttls"
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	return &SMTPProvider{cfg: cfg}
+}
+
+func (p *SMTPProvider) Name() string {
+	return "smtp"
+}
+
+func (p *SMTPProvider) Deliver(ctx context.Context, from, to string, raw []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(p.cfg.Host, strconv.Itoa(p.cfg.Port))
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{ServerName: p.cfg.Host}
+
+	if p.cfg.TLS == "tls" {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, p.cfg.Host)
+
+	if err != nil {
+		conn.Close()
+
+		return err
+	}
+
+	defer c.Close()
+
+	if p.cfg.TLS == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%w: %s does not support STARTTLS", ErrPermanent, p.cfg.Host)
+		}
+
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if p.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", p.cfg.Username, p.cfg.Password, p.cfg.Host)); err != nil {
+			return classify(err)
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return classify(err)
+	}
+
+	if err := c.Rcpt(to); err != nil {
+		return classify(err)
+	}
+
+	w, err := c.Data()
+
+	if err != nil {
+		return classify(err)
+	}
+
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return classify(err)
+	}
+
+	return c.Quit()
+}
+
+// classify marks 5xx replies as permanent, 4xx replies are transient
+func classify(err error) error {
+	tpErr := &textproto.Error{}
+
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+
+	return err
+}
@@ -0,0 +1,256 @@
+package asset
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	assetservice "campaign/internal/services/asset"
+	"campaign/internal/storage"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AssetHandler interface {
+	UploadAssetHandler(w http.ResponseWriter, r *http.Request)
+	GetAssetsHandler(w http.ResponseWriter, r *http.Request)
+	GetAssetByIDHandler(w http.ResponseWriter, r *http.Request)
+	GetFoldersHandler(w http.ResponseWriter, r *http.Request)
+	UpdateAssetHandler(w http.ResponseWriter, r *http.Request)
+	DeleteAssetHandler(w http.ResponseWriter, r *http.Request)
+	AttachAssetHandler(w http.ResponseWriter, r *http.Request)
+	DetachAssetHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type assetHandler struct {
+	db    *mongo.Database
+	store storage.BlobStore
+}
+
+func NewAssetHandler(db *mongo.Database, store storage.BlobStore) AssetHandler {
+	return &assetHandler{db: db, store: store}
+}
+
+func (a *assetHandler) service(r *http.Request) assetservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), a.db, models.AssetsCollection)
+
+	return assetservice.NewService(r.Context(), dbM, a.store)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, assetservice.ErrInvalidFile):
+		status = http.StatusBadRequest
+	case errors.Is(err, assetservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, assetservice.ErrInUse):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func (a *assetHandler) UploadAssetHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, assetservice.MaxAssetSize+(1<<20))
+	defer r.Body.Close()
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		res := utils.WrapInResponse(fmt.Sprintf("invalid multipart body. file must not be larger than %d bytes", assetservice.MaxAssetSize), nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+
+	if err != nil {
+		res := utils.WrapInResponse("file is required", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, assetservice.MaxAssetSize+1))
+
+	if err != nil {
+		res := utils.WrapInResponse("error reading file", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	name := r.FormValue("name")
+
+	if name == "" {
+		name = header.Filename
+	}
+
+	tags := []string{}
+
+	if t := r.FormValue("tags"); t != "" {
+		tags = strings.Split(t, ",")
+	}
+
+	asset, created, err := a.service(r).Upload(assetservice.UploadAsset{
+		Name:   name,
+		Folder: r.FormValue("folder"),
+		Tags:   tags,
+		Data:   data,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !created {
+		res := utils.WrapInResponse("asset already exists", asset)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	res := utils.WrapInResponse("asset uploaded successfully", asset)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (a *assetHandler) GetAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	assets, err := a.service(r).GetAssets(assetservice.AssetFilter{
+		Folder:     q.Get("folder"),
+		Tag:        q.Get("tag"),
+		Kind:       q.Get("kind"),
+		CampaignID: q.Get("campaign_id"),
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("assets retrieved successfully", assets)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (a *assetHandler) GetAssetByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	asset, err := a.service(r).GetAssetByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("asset retrieved successfully", asset)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (a *assetHandler) GetFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	folders, err := a.service(r).GetFolders()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("folders retrieved successfully", folders)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (a *assetHandler) UpdateAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := assetservice.UpdateAsset{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	if err := a.service(r).UpdateAsset(id, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("asset updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (a *assetHandler) DeleteAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := a.service(r).DeleteAsset(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("asset deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (a *assetHandler) AttachAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	campaignID := chi.URLParam(r, "campaignID")
+
+	if err := a.service(r).AttachToCampaign(id, campaignID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("asset attached successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (a *assetHandler) DetachAssetHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	campaignID := chi.URLParam(r, "campaignID")
+
+	if err := a.service(r).DetachFromCampaign(id, campaignID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("asset detached successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -4,8 +4,10 @@ import (
 	"campaign/internal/database"
 	"campaign/internal/models"
 	authservice "campaign/internal/services/auth"
+	referralservice "campaign/internal/services/referral"
 	"campaign/internal/utils"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/mail"
 
@@ -78,6 +80,9 @@ type Register struct {
 	Password string `json:"password"`
 	Msisdn   string `json:"msisdn"`
 	Name     string `json:"name"`
+
+	// ReferralCode attributes the signup to whoever shared it
+	ReferralCode string `json:"referral_code"`
 }
 
 func (a *authHandler) Signup(w http.ResponseWriter, r *http.Request) {
@@ -141,12 +146,18 @@ func (a *authHandler) Signup(w http.ResponseWriter, r *http.Request) {
 
 	authService := authservice.NewService(dbM)
 
-	err = authService.Register(reqBody.Name, reqBody.Email, reqBody.Password, reqBody.Msisdn)
+	err = authService.Register(reqBody.Name, reqBody.Email, reqBody.Password, reqBody.Msisdn, reqBody.ReferralCode)
 
 	if err != nil {
+		status := http.StatusUnauthorized
+
+		if errors.Is(err, referralservice.ErrInvalid) {
+			status = http.StatusBadRequest
+		}
+
 		res := utils.WrapInResponse(err.Error(), nil)
 
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(status)
 		_, _ = w.Write(res)
 		return
 	}
@@ -3,11 +3,24 @@ package campaign
 import (
 	"campaign/internal/database"
 	"campaign/internal/models"
+	"campaign/internal/sendwindow"
+	bannerservice "campaign/internal/services/banner"
 	campaignservice "campaign/internal/services/campaign"
+	customfieldservice "campaign/internal/services/customfield"
+	eligibilityservice "campaign/internal/services/eligibility"
+	pointsservice "campaign/internal/services/points"
+	referralservice "campaign/internal/services/referral"
+	riskservice "campaign/internal/services/risk"
+	segmentservice "campaign/internal/services/segment"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/storage"
 	"campaign/internal/utils"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -19,17 +32,21 @@ type CampaignHandler interface {
 	GetCampaignByIDHandler(w http.ResponseWriter, r *http.Request)
 	UpdateCampaignHandler(w http.ResponseWriter, r *http.Request)
 	DeleteCampaignHandler(w http.ResponseWriter, r *http.Request)
+	UploadBannerHandler(w http.ResponseWriter, r *http.Request)
 }
 
 type campaignHandler struct {
-	db *mongo.Database
+	db    *mongo.Database
+	store storage.BlobStore
 }
 
-func NewCampaignHandler(db *mongo.Database) CampaignHandler {
-	return &campaignHandler{db: db}
+func NewCampaignHandler(db *mongo.Database, store storage.BlobStore) CampaignHandler {
+	return &campaignHandler{db: db, store: store}
 }
 
-func validateCampaign(c models.Campaign) error {
+// validateCampaign also checks custom field values against the account
+// schema in fields and replaces c.CustomFields with the normalized values.
+func validateCampaign(c *models.Campaign, fields []models.CustomField) error {
 	if c.Name == "" {
 		return errors.New("name is required")
 	}
@@ -55,9 +72,136 @@ func validateCampaign(c models.Campaign) error {
 	// 	return errors.New("banner url is required")
 	// }
 
+	if err := validateBudget(c.Budget); err != nil {
+		return err
+	}
+
+	if err := validateClaims(c.Claims); err != nil {
+		return err
+	}
+
+	customFields, err := customfieldservice.Validate(fields, c.CustomFields)
+
+	if err != nil {
+		return err
+	}
+
+	c.CustomFields = customFields
+
+	return nil
+}
+
+func validateBudget(b *models.Budget) error {
+	if b == nil {
+		return nil
+	}
+
+	if b.Total < 0 || b.DailyCap < 0 {
+		return errors.New("budget amounts must not be negative")
+	}
+
+	if b.DailyCap > b.Total {
+		return errors.New("budget daily cap must not be more than the total")
+	}
+
+	b.Currency = strings.ToUpper(b.Currency)
+
+	if len(b.Currency) != 3 {
+		return errors.New("budget currency must be a 3 letter ISO 4217 code")
+	}
+
+	for _, t := range b.AlertThresholds {
+		if t <= 0 || t > 100 {
+			return errors.New("budget alert thresholds must be percentages between 1 and 100")
+		}
+	}
+
 	return nil
 }
 
+func validateClaims(cl *models.ClaimSettings) error {
+	if cl == nil {
+		return nil
+	}
+
+	if cl.MaxClaims < 0 || cl.PerContact < 0 {
+		return errors.New("claim limits must not be negative")
+	}
+
+	if cl.PerContact == 0 {
+		cl.PerContact = 1
+	}
+
+	if cl.HoldAbove < 0 || cl.HoldAbove > riskservice.MaxScore {
+		return fmt.Errorf("claims hold_above must be between 0 and %d", riskservice.MaxScore)
+	}
+
+	for i, host := range cl.CallbackHosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+
+		if host == "" || strings.ContainsAny(host, "/:@ ") {
+			return errors.New("claim callback hosts must be host names e.g. example.com")
+		}
+
+		cl.CallbackHosts[i] = host
+	}
+
+	return nil
+}
+
+func (c *campaignHandler) customFields(r *http.Request) ([]models.CustomField, error) {
+	dbM := database.NewDatabaseService(r.Context(), c.db, models.CustomFieldsCollection)
+
+	return customfieldservice.NewService(r.Context(), dbM).GetCustomFields()
+}
+
+// campaignFilter reads list filters from the query string e.g.
+// ?tag=summer&category_id=<id>&cf.region=GH&cf.budget.gte=100
+func campaignFilter(r *http.Request) campaignservice.CampaignFilter {
+	q := r.URL.Query()
+	f := campaignservice.CampaignFilter{CategoryID: q.Get("category_id")}
+
+	for _, tag := range q["tag"] {
+		f.Tags = append(f.Tags, strings.Split(tag, ",")...)
+	}
+
+	for param, values := range q {
+		key, ok := strings.CutPrefix(param, "cf.")
+
+		if !ok || len(values) == 0 {
+			continue
+		}
+
+		op := "eq"
+
+		if k, o, found := strings.Cut(key, "."); found {
+			key, op = k, o
+		}
+
+		f.CustomFields = append(f.CustomFields, campaignservice.CustomFieldFilter{Key: key, Op: op, Value: values[0]})
+	}
+
+	return f
+}
+
+func writeServiceError(w http.ResponseWriter, err error, status int) {
+	if errors.Is(err, campaignservice.ErrInvalidCategory) || errors.Is(err, campaignservice.ErrInvalidFilter) ||
+		errors.Is(err, segmentservice.ErrInvalid) || errors.Is(err, templateservice.ErrInvalid) ||
+		errors.Is(err, sendwindow.ErrInvalid) || errors.Is(err, eligibilityservice.ErrInvalid) ||
+		errors.Is(err, referralservice.ErrInvalid) || errors.Is(err, pointsservice.ErrInvalid) ||
+		errors.Is(err, campaignservice.ErrInvalidSlug) {
+		status = http.StatusBadRequest
+	}
+
+	if errors.Is(err, campaignservice.ErrSlugTaken) {
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
 func (c *campaignHandler) CreateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	reqBody := models.Campaign{}
 
@@ -72,7 +216,17 @@ func (c *campaignHandler) CreateCampaignHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := validateCampaign(reqBody); err != nil {
+	fields, err := c.customFields(r)
+
+	if err != nil {
+		res := utils.WrapInResponse(err.Error(), nil)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	if err := validateCampaign(&reqBody, fields); err != nil {
 		res := utils.WrapInResponse(err.Error(), nil)
 		w.WriteHeader(http.StatusBadRequest)
 		_, _ = w.Write(res)
@@ -87,9 +241,7 @@ func (c *campaignHandler) CreateCampaignHandler(w http.ResponseWriter, r *http.R
 	err = campaignService.CreateCampaign(reqBody)
 
 	if err != nil {
-		res := utils.WrapInResponse(err.Error(), nil)
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write(res)
+		writeServiceError(w, err, http.StatusInternalServerError)
 
 		return
 	}
@@ -105,12 +257,10 @@ func (c *campaignHandler) GetCampaignsHandler(w http.ResponseWriter, r *http.Req
 
 	campaignService := campaignservice.NewService(r.Context(), dbM)
 
-	campaigns, err := campaignService.GetCampaigns()
+	campaigns, err := campaignService.GetCampaigns(campaignFilter(r))
 
 	if err != nil {
-		res := utils.WrapInResponse(err.Error(), nil)
-		w.WriteHeader(http.StatusNotFound)
-		_, _ = w.Write(res)
+		writeServiceError(w, err, http.StatusNotFound)
 		return
 	}
 
@@ -157,7 +307,17 @@ func (c *campaignHandler) UpdateCampaignHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	if err := validateCampaign(reqBody); err != nil {
+	fields, err := c.customFields(r)
+
+	if err != nil {
+		res := utils.WrapInResponse(err.Error(), nil)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	if err := validateCampaign(&reqBody, fields); err != nil {
 		res := utils.WrapInResponse(err.Error(), nil)
 		w.WriteHeader(http.StatusBadRequest)
 		_, _ = w.Write(res)
@@ -172,9 +332,7 @@ func (c *campaignHandler) UpdateCampaignHandler(w http.ResponseWriter, r *http.R
 	err = campaignService.UpdateCampaign(id, reqBody)
 
 	if err != nil {
-		res := utils.WrapInResponse(err.Error(), nil)
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write(res)
+		writeServiceError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -205,3 +363,72 @@ func (c *campaignHandler) DeleteCampaignHandler(w http.ResponseWriter, r *http.R
 	_, _ = w.Write(res)
 
 }
+
+func (c *campaignHandler) UploadBannerHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	// leave some room for the multipart envelope around the file
+	r.Body = http.MaxBytesReader(w, r.Body, bannerservice.MaxBannerSize+(1<<20))
+	defer r.Body.Close()
+
+	if err := r.ParseMultipartForm(bannerservice.MaxBannerSize); err != nil {
+		res := utils.WrapInResponse(fmt.Sprintf("invalid multipart body. banner must not be larger than %d bytes", bannerservice.MaxBannerSize), nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("banner")
+
+	if err != nil {
+		res := utils.WrapInResponse("banner file is required", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, bannerservice.MaxBannerSize+1))
+
+	if err != nil {
+		res := utils.WrapInResponse("error reading banner file", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	dbM := database.NewDatabaseService(r.Context(), c.db, models.CampaignsCollection)
+
+	bannerService := bannerservice.NewService(r.Context(), dbM, c.store)
+
+	banner, err := bannerService.Upload(id, data)
+
+	if err != nil {
+		status := http.StatusInternalServerError
+
+		if errors.Is(err, bannerservice.ErrInvalidImage) {
+			status = http.StatusBadRequest
+		}
+
+		if errors.Is(err, bannerservice.ErrCampaignNotFound) {
+			status = http.StatusNotFound
+		}
+
+		res := utils.WrapInResponse(err.Error(), nil)
+		w.WriteHeader(status)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	res := utils.WrapInResponse("banner uploaded successfully", banner)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,163 @@
+package category
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	categoryservice "campaign/internal/services/category"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CategoryHandler interface {
+	CreateCategoryHandler(w http.ResponseWriter, r *http.Request)
+	GetCategoriesHandler(w http.ResponseWriter, r *http.Request)
+	GetCategoryByIDHandler(w http.ResponseWriter, r *http.Request)
+	UpdateCategoryHandler(w http.ResponseWriter, r *http.Request)
+	DeleteCategoryHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type categoryHandler struct {
+	db *mongo.Database
+}
+
+func NewCategoryHandler(db *mongo.Database) CategoryHandler {
+	return &categoryHandler{db: db}
+}
+
+func (c *categoryHandler) service(r *http.Request) categoryservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), c.db, models.CategoriesCollection)
+
+	return categoryservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, categoryservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, categoryservice.ErrExists):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func decodeCategory(w http.ResponseWriter, r *http.Request) (models.Category, bool) {
+	reqBody := models.Category{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+
+	if reqBody.Name == "" {
+		res := utils.WrapInResponse("name is required", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	return reqBody, true
+}
+
+func (c *categoryHandler) CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody, ok := decodeCategory(w, r)
+
+	if !ok {
+		return
+	}
+
+	category, err := c.service(r).CreateCategory(reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("category created successfully", category)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (c *categoryHandler) GetCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := c.service(r).GetCategories()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("categories retrieved successfully", categories)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (c *categoryHandler) GetCategoryByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	category, err := c.service(r).GetCategoryByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("category retrieved successfully", category)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (c *categoryHandler) UpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	reqBody, ok := decodeCategory(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := c.service(r).UpdateCategory(id, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("category updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (c *categoryHandler) DeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := c.service(r).DeleteCategory(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("category deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,296 @@
+package claim
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	claimservice "campaign/internal/services/claim"
+	contactservice "campaign/internal/services/contact"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ClaimHandler interface {
+	ClaimHandler(w http.ResponseWriter, r *http.Request)
+	ClaimStatusHandler(w http.ResponseWriter, r *http.Request)
+	GetClaimsHandler(w http.ResponseWriter, r *http.Request)
+	UpdateClaimHandler(w http.ResponseWriter, r *http.Request)
+	RotateCallbackSecretHandler(w http.ResponseWriter, r *http.Request)
+	EligibilityHandler(w http.ResponseWriter, r *http.Request)
+	GetReviewQueueHandler(w http.ResponseWriter, r *http.Request)
+	ReviewClaimHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type claimHandler struct {
+	db   *mongo.Database
+	jobs *queue.Queue
+}
+
+func NewClaimHandler(db *mongo.Database, jobs *queue.Queue) ClaimHandler {
+	return &claimHandler{db: db, jobs: jobs}
+}
+
+func (h *claimHandler) database(r *http.Request) database.Database {
+	return database.NewDatabaseService(r.Context(), h.db, models.ClaimsCollection)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, claimservice.ErrInvalid), errors.Is(err, contactservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, claimservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, claimservice.ErrUnavailable), errors.Is(err, claimservice.ErrLimitReached):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// ClaimHandler takes a reward claim from the public, the contact is named
+// by msisdn or email in the body. The claim is processed in the background,
+// the response points at its status.
+func (h *claimHandler) ClaimHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := claimservice.ClaimRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+		return
+	}
+
+	reqBody.IP, _, err = net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		reqBody.IP = r.RemoteAddr
+	}
+
+	reqBody.UserAgent = r.UserAgent()
+
+	claim, err := claimservice.Submit(r.Context(), h.database(r), h.jobs, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	status := claimservice.StatusOf(claim)
+
+	res := utils.WrapInResponse("claim received successfully", status)
+	w.Header().Set("Location", status.StatusURL)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write(res)
+
+}
+
+// ClaimStatusHandler reports a claim by its reference, from the path or a
+// {"reference": "..."} body. With ?wait=<seconds> it long polls, answering
+// once the status is no longer ?status= (received by default).
+func (h *claimHandler) ClaimStatusHandler(w http.ResponseWriter, r *http.Request) {
+	reference := chi.URLParam(r, "reference")
+
+	if reference == "" {
+		reqBody := struct {
+			Reference string `json:"reference"`
+		}{}
+
+		err := json.NewDecoder(r.Body).Decode(&reqBody)
+		defer r.Body.Close()
+
+		if err != nil || reqBody.Reference == "" {
+			res := utils.WrapInResponse("invalid request body. reference is required", nil)
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(res)
+			return
+		}
+
+		reference = reqBody.Reference
+	}
+
+	q := r.URL.Query()
+	wait, _ := strconv.Atoi(q.Get("wait"))
+
+	status, err := claimservice.Wait(r.Context(), h.database(r), reference, q.Get("status"), time.Duration(wait)*time.Second)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("claim retrieved successfully", status)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *claimHandler) GetClaimsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	claims, err := claimservice.NewService(r.Context(), h.database(r), h.jobs).GetClaims(id, claimservice.ClaimFilter{
+		Status: q.Get("status"),
+		Page:   page,
+		Limit:  limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("claims retrieved successfully", claims)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *claimHandler) UpdateClaimHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	claimID := chi.URLParam(r, "claimID")
+
+	reqBody := claimservice.StatusRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+		return
+	}
+
+	claim, err := claimservice.NewService(r.Context(), h.database(r), h.jobs).UpdateClaimStatus(id, claimID, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("claim updated successfully", claim)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// RotateCallbackSecretHandler returns a new secret for the campaign's claim
+// callbacks, it is only shown once
+func (h *claimHandler) RotateCallbackSecretHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	secret, err := claimservice.NewService(r.Context(), h.database(r), h.jobs).RotateCallbackSecret(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("callback secret rotated successfully. keep it, it is not shown again", map[string]string{"callback_secret": secret})
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// EligibilityHandler is a dry run of a claim for support: it lists every
+// check the person in the body would go through and which ones they fail
+func (h *claimHandler) EligibilityHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := claimservice.EligibilityRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+		return
+	}
+
+	result, err := claimservice.NewService(r.Context(), h.database(r), h.jobs).CheckEligibility(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("eligibility checked successfully", result)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// GetReviewQueueHandler lists claims held for review across the user's
+// campaigns, ?campaign_id= and ?min_score= narrow it down
+func (h *claimHandler) GetReviewQueueHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	minScore, _ := strconv.Atoi(q.Get("min_score"))
+
+	claims, err := claimservice.NewService(r.Context(), h.database(r), h.jobs).GetReviewQueue(claimservice.ReviewFilter{
+		CampaignID: q.Get("campaign_id"),
+		MinScore:   minScore,
+		Page:       page,
+		Limit:      limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("held claims retrieved successfully", claims)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// ReviewClaimHandler approves or rejects a held claim
+func (h *claimHandler) ReviewClaimHandler(w http.ResponseWriter, r *http.Request) {
+	claimID := chi.URLParam(r, "claimID")
+
+	reqBody := claimservice.StatusRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+		return
+	}
+
+	claim, err := claimservice.NewService(r.Context(), h.database(r), h.jobs).ReviewClaim(claimID, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("claim reviewed successfully", claim)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
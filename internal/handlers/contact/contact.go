@@ -0,0 +1,168 @@
+package contact
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	contactservice "campaign/internal/services/contact"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxImportSize is the largest csv upload accepted in bytes
+const MaxImportSize = 10 << 20
+
+type ContactHandler interface {
+	CreateContactHandler(w http.ResponseWriter, r *http.Request)
+	GetContactsHandler(w http.ResponseWriter, r *http.Request)
+	GetContactByIDHandler(w http.ResponseWriter, r *http.Request)
+	UpdateContactHandler(w http.ResponseWriter, r *http.Request)
+	DeleteContactHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type contactHandler struct {
+	db *mongo.Database
+}
+
+func NewContactHandler(db *mongo.Database) ContactHandler {
+	return &contactHandler{db: db}
+}
+
+func (c *contactHandler) service(r *http.Request) contactservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), c.db, models.ContactsCollection)
+
+	return contactservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, contactservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, contactservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, contactservice.ErrExists):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func decodeContact(w http.ResponseWriter, r *http.Request) (models.Contact, bool) {
+	reqBody := models.Contact{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	return reqBody, true
+}
+
+func (c *contactHandler) CreateContactHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody, ok := decodeContact(w, r)
+
+	if !ok {
+		return
+	}
+
+	contact, err := c.service(r).CreateContact(reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("contact created successfully", contact)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (c *contactHandler) GetContactsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	contacts, err := c.service(r).GetContacts(contactservice.ContactFilter{
+		ListID: q.Get("list_id"),
+		Query:  q.Get("q"),
+		Page:   page,
+		Limit:  limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("contacts retrieved successfully", contacts)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (c *contactHandler) GetContactByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	contact, err := c.service(r).GetContactByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("contact retrieved successfully", contact)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (c *contactHandler) UpdateContactHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	reqBody, ok := decodeContact(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := c.service(r).UpdateContact(id, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("contact updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (c *contactHandler) DeleteContactHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := c.service(r).DeleteContact(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("contact deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
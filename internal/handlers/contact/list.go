@@ -0,0 +1,294 @@
+package contact
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	contactservice "campaign/internal/services/contact"
+	"campaign/internal/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ListHandler interface {
+	CreateListHandler(w http.ResponseWriter, r *http.Request)
+	GetListsHandler(w http.ResponseWriter, r *http.Request)
+	GetListByIDHandler(w http.ResponseWriter, r *http.Request)
+	UpdateListHandler(w http.ResponseWriter, r *http.Request)
+	DeleteListHandler(w http.ResponseWriter, r *http.Request)
+	AddContactsHandler(w http.ResponseWriter, r *http.Request)
+	RemoveContactHandler(w http.ResponseWriter, r *http.Request)
+	ImportContactsHandler(w http.ResponseWriter, r *http.Request)
+	SetAudienceHandler(w http.ResponseWriter, r *http.Request)
+	GetAudienceHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type listHandler struct {
+	db *mongo.Database
+}
+
+func NewListHandler(db *mongo.Database) ListHandler {
+	return &listHandler{db: db}
+}
+
+func (l *listHandler) service(r *http.Request) contactservice.ListService {
+	dbM := database.NewDatabaseService(r.Context(), l.db, models.ContactListsCollection)
+
+	return contactservice.NewListService(r.Context(), dbM)
+}
+
+func decodeList(w http.ResponseWriter, r *http.Request) (models.ContactList, bool) {
+	reqBody := models.ContactList{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+
+	if reqBody.Name == "" {
+		res := utils.WrapInResponse("name is required", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	return reqBody, true
+}
+
+func (l *listHandler) CreateListHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody, ok := decodeList(w, r)
+
+	if !ok {
+		return
+	}
+
+	list, err := l.service(r).CreateList(reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("list created successfully", list)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (l *listHandler) GetListsHandler(w http.ResponseWriter, r *http.Request) {
+	lists, err := l.service(r).GetLists()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("lists retrieved successfully", lists)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (l *listHandler) GetListByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	list, err := l.service(r).GetListByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("list retrieved successfully", list)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (l *listHandler) UpdateListHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	reqBody, ok := decodeList(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := l.service(r).UpdateList(id, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("list updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (l *listHandler) DeleteListHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := l.service(r).DeleteList(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("list deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+type ListContacts struct {
+	ContactIDs []string `json:"contact_ids"`
+}
+
+func (l *listHandler) AddContactsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := ListContacts{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	if err := l.service(r).AddContacts(id, reqBody.ContactIDs); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("contacts added successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (l *listHandler) RemoveContactHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	contactID := chi.URLParam(r, "contactID")
+
+	if err := l.service(r).RemoveContact(id, contactID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("contact removed successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// ImportContactsHandler reads a csv from the "file" multipart field into the list
+func (l *listHandler) ImportContactsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize+(1<<20))
+	defer r.Body.Close()
+
+	if err := r.ParseMultipartForm(MaxImportSize); err != nil {
+		res := utils.WrapInResponse(fmt.Sprintf("invalid multipart body. file must not be larger than %d bytes", MaxImportSize), nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+
+	if err != nil {
+		res := utils.WrapInResponse("file is required", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	defer file.Close()
+
+	if _, err := l.service(r).GetListByID(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	dbM := database.NewDatabaseService(r.Context(), l.db, models.ContactsCollection)
+
+	result, err := contactservice.NewService(r.Context(), dbM).ImportCSV(id, file)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("contacts imported successfully", result)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+type SetAudience struct {
+	ListIDs    []string `json:"list_ids"`
+	SegmentIDs []string `json:"segment_ids"`
+}
+
+func (l *listHandler) SetAudienceHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := SetAudience{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	if err := l.service(r).SetCampaignAudience(id, reqBody.ListIDs, reqBody.SegmentIDs); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("audience updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (l *listHandler) GetAudienceHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	audience, err := l.service(r).GetCampaignAudience(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("audience retrieved successfully", audience)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,138 @@
+package customfield
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	customfieldservice "campaign/internal/services/customfield"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CustomFieldHandler interface {
+	CreateCustomFieldHandler(w http.ResponseWriter, r *http.Request)
+	GetCustomFieldsHandler(w http.ResponseWriter, r *http.Request)
+	UpdateCustomFieldHandler(w http.ResponseWriter, r *http.Request)
+	DeleteCustomFieldHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type customFieldHandler struct {
+	db *mongo.Database
+}
+
+func NewCustomFieldHandler(db *mongo.Database) CustomFieldHandler {
+	return &customFieldHandler{db: db}
+}
+
+func (c *customFieldHandler) service(r *http.Request) customfieldservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), c.db, models.CustomFieldsCollection)
+
+	return customfieldservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, customfieldservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, customfieldservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, customfieldservice.ErrExists):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func (c *customFieldHandler) CreateCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := models.CustomField{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	if err := customfieldservice.ValidateDefinition(reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	field, err := c.service(r).CreateCustomField(reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("custom field created successfully", field)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (c *customFieldHandler) GetCustomFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	fields, err := c.service(r).GetCustomFields()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("custom fields retrieved successfully", fields)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (c *customFieldHandler) UpdateCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := models.CustomField{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	if err := c.service(r).UpdateCustomField(id, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("custom field updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (c *customFieldHandler) DeleteCustomFieldHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := c.service(r).DeleteCustomField(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("custom field deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,182 @@
+package email
+
+import (
+	"bytes"
+	"campaign/internal/database"
+	"campaign/internal/email"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	emailservice "campaign/internal/services/email"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/utils"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxRequestSize leaves room for the html and text bodies as json strings
+const maxRequestSize = 3 * emailservice.MaxBodySize
+
+type EmailHandler interface {
+	SendCampaignHandler(w http.ResponseWriter, r *http.Request)
+	GetMessagesHandler(w http.ResponseWriter, r *http.Request)
+	FeedbackHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type emailHandler struct {
+	db   *mongo.Database
+	jobs *queue.Queue
+}
+
+func NewEmailHandler(db *mongo.Database, jobs *queue.Queue) EmailHandler {
+	return &emailHandler{db: db, jobs: jobs}
+}
+
+func (h *emailHandler) service(r *http.Request) emailservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.EmailMessagesCollection)
+
+	return emailservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, emailservice.ErrInvalid), errors.Is(err, templateservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, emailservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, emailservice.ErrExists):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// SendCampaignHandler queues the batch and a job to deliver it and returns
+// 202, delivery is followed through GetMessagesHandler or the job
+func (h *emailHandler) SendCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := emailservice.SendRequest{}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	batch, err := h.service(r).SendCampaign(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	job, err := h.jobs.Enqueue(r.Context(), emailservice.DispatchJob, map[string]interface{}{"batch_id": batch.ID}, queue.Options{})
+
+	if err != nil {
+		slog.Error("Error queueing dispatch job", "batch", batch.ID, "error", err)
+
+		writeError(w, errors.New("error queueing messages"))
+		return
+	}
+
+	batch.JobID = job.ID
+
+	res := utils.WrapInResponse("messages queued successfully", batch)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write(res)
+
+}
+
+func (h *emailHandler) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	messages, err := h.service(r).GetMessages(id, emailservice.MessageFilter{
+		BatchID: q.Get("batch_id"),
+		Status:  q.Get("status"),
+		Page:    page,
+		Limit:   limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("messages retrieved successfully", messages)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// FeedbackHandler ingests bounce and complaint notifications, one or an
+// array of them. The sender authenticates with the X-Webhook-Secret header.
+func (h *emailHandler) FeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	secret := email.WebhookSecret()
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Webhook-Secret")), []byte(secret)) != 1 {
+		res := utils.WrapInResponse("unauthorized", nil)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	defer r.Body.Close()
+
+	events := []emailservice.Feedback{}
+
+	if err == nil {
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(trimmed, &events)
+		} else {
+			event := emailservice.Feedback{}
+			err = json.Unmarshal(trimmed, &event)
+			events = append(events, event)
+		}
+	}
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.EmailMessagesCollection)
+
+	count, err := emailservice.RecordFeedback(dbM, events)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("feedback recorded successfully", map[string]int{"recorded": count})
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
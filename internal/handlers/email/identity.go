@@ -0,0 +1,136 @@
+package email
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	emailservice "campaign/internal/services/email"
+	"campaign/internal/utils"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type IdentityHandler interface {
+	CreateIdentityHandler(w http.ResponseWriter, r *http.Request)
+	GetIdentitiesHandler(w http.ResponseWriter, r *http.Request)
+	GetIdentityByIDHandler(w http.ResponseWriter, r *http.Request)
+	UpdateIdentityHandler(w http.ResponseWriter, r *http.Request)
+	DeleteIdentityHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type identityHandler struct {
+	db *mongo.Database
+}
+
+func NewIdentityHandler(db *mongo.Database) IdentityHandler {
+	return &identityHandler{db: db}
+}
+
+func (h *identityHandler) service(r *http.Request) emailservice.IdentityService {
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.SenderIdentitiesCollection)
+
+	return emailservice.NewIdentityService(r.Context(), dbM)
+}
+
+func decodeIdentity(w http.ResponseWriter, r *http.Request) (models.SenderIdentity, bool) {
+	reqBody := models.SenderIdentity{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	return reqBody, true
+}
+
+func (h *identityHandler) CreateIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody, ok := decodeIdentity(w, r)
+
+	if !ok {
+		return
+	}
+
+	identity, err := h.service(r).CreateIdentity(reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("sender identity created successfully", identity)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (h *identityHandler) GetIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	identities, err := h.service(r).GetIdentities()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("sender identities retrieved successfully", identities)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *identityHandler) GetIdentityByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	identity, err := h.service(r).GetIdentityByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("sender identity retrieved successfully", identity)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *identityHandler) UpdateIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	reqBody, ok := decodeIdentity(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := h.service(r).UpdateIdentity(id, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("sender identity updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *identityHandler) DeleteIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := h.service(r).DeleteIdentity(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("sender identity deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,144 @@
+package experiment
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	experimentservice "campaign/internal/services/experiment"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ExperimentHandler interface {
+	GetResultsHandler(w http.ResponseWriter, r *http.Request)
+	SetExperimentHandler(w http.ResponseWriter, r *http.Request)
+	DeleteExperimentHandler(w http.ResponseWriter, r *http.Request)
+	PromoteHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type experimentHandler struct {
+	db   *mongo.Database
+	jobs *queue.Queue
+}
+
+func NewExperimentHandler(db *mongo.Database, jobs *queue.Queue) ExperimentHandler {
+	return &experimentHandler{db: db, jobs: jobs}
+}
+
+func (h *experimentHandler) service(r *http.Request) experimentservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.CampaignsCollection)
+
+	return experimentservice.NewService(r.Context(), dbM, h.jobs)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, experimentservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, experimentservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, experimentservice.ErrUnavailable):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// GetResultsHandler returns the deliveries, clicks and claims of each
+// variant of the campaign's experiment and whether the leader is significant
+func (h *experimentHandler) GetResultsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	results, err := h.service(r).GetResults(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("experiment results retrieved successfully", results)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// SetExperimentHandler starts an experiment on the campaign, replacing the
+// one it runs
+func (h *experimentHandler) SetExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := models.Experiment{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+		return
+	}
+
+	experiment, err := h.service(r).SetExperiment(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("experiment saved successfully", experiment)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *experimentHandler) DeleteExperimentHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := h.service(r).DeleteExperiment(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("experiment deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// PromoteHandler makes a variant the winner, every contact gets it from then
+// on
+func (h *experimentHandler) PromoteHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := experimentservice.PromoteRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+		return
+	}
+
+	experiment, err := h.service(r).Promote(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("variant promoted successfully", experiment)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,88 @@
+package files
+
+import (
+	"campaign/internal/storage"
+	"campaign/internal/utils"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type FileHandler interface {
+	DownloadHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type fileHandler struct {
+	store storage.BlobStore
+}
+
+func NewFileHandler(store storage.BlobStore) FileHandler {
+	return &fileHandler{store: store}
+}
+
+// DownloadHandler serves blobs for urls produced by storage.SignURL
+func (f *fileHandler) DownloadHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := url.PathUnescape(chi.URLParam(r, "*"))
+
+	if err != nil {
+		res := utils.WrapInResponse("file not found", nil)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	q := r.URL.Query()
+
+	expires, err := storage.VerifySignature(key, q.Get("expires"), q.Get("signature"))
+
+	if err != nil {
+		res := utils.WrapInResponse(err.Error(), nil)
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	obj, err := f.store.Get(r.Context(), key)
+
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "error reading file"
+
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			status = http.StatusNotFound
+			message = "file not found"
+		} else {
+			slog.Error("Error reading blob", "error", err, "key", key)
+		}
+
+		res := utils.WrapInResponse(message, nil)
+		w.WriteHeader(status)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	defer obj.Body.Close()
+
+	maxAge := int(time.Until(expires).Seconds())
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if obj.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, obj.Body)
+}
@@ -0,0 +1,188 @@
+package goal
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	goalservice "campaign/internal/services/goal"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type GoalHandler interface {
+	CreateGoalHandler(w http.ResponseWriter, r *http.Request)
+	GetGoalsHandler(w http.ResponseWriter, r *http.Request)
+	UpdateGoalHandler(w http.ResponseWriter, r *http.Request)
+	DeleteGoalHandler(w http.ResponseWriter, r *http.Request)
+	RecordMetricsHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type goalHandler struct {
+	db *mongo.Database
+}
+
+func NewGoalHandler(db *mongo.Database) GoalHandler {
+	return &goalHandler{db: db}
+}
+
+func (g *goalHandler) service(r *http.Request) goalservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), g.db, models.GoalsCollection)
+
+	return goalservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, goalservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, goalservice.ErrNotFound):
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func decodeGoal(w http.ResponseWriter, r *http.Request) (models.Goal, bool) {
+	reqBody := models.Goal{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body. deadline must be an RFC3339 date", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	return reqBody, true
+}
+
+func (g *goalHandler) CreateGoalHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	reqBody, ok := decodeGoal(w, r)
+
+	if !ok {
+		return
+	}
+
+	goal, err := g.service(r).CreateGoal(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("goal created successfully", goal)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (g *goalHandler) GetGoalsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	goals, err := g.service(r).GetGoals(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("goals retrieved successfully", goals)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (g *goalHandler) UpdateGoalHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	goalID := chi.URLParam(r, "goalID")
+
+	reqBody, ok := decodeGoal(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := g.service(r).UpdateGoal(id, goalID, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("goal updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (g *goalHandler) DeleteGoalHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	goalID := chi.URLParam(r, "goalID")
+
+	if err := g.service(r).DeleteGoal(id, goalID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("goal deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+type RecordMetrics struct {
+	Events []models.MetricEvent `json:"events"`
+}
+
+// RecordMetricsHandler accepts a single event or {"events": [...]}
+func (g *goalHandler) RecordMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	raw := json.RawMessage{}
+
+	err := json.NewDecoder(r.Body).Decode(&raw)
+	defer r.Body.Close()
+
+	reqBody := RecordMetrics{}
+
+	if err == nil {
+		err = json.Unmarshal(raw, &reqBody)
+	}
+
+	if err == nil && reqBody.Events == nil {
+		event := models.MetricEvent{}
+		err = json.Unmarshal(raw, &event)
+		reqBody.Events = []models.MetricEvent{event}
+	}
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	count, err := g.service(r).RecordMetrics(id, reqBody.Events)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("metrics recorded successfully", map[string]int{"recorded": count})
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,106 @@
+package job
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	jobservice "campaign/internal/services/job"
+	"campaign/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type JobHandler interface {
+	GetJobsHandler(w http.ResponseWriter, r *http.Request)
+	GetJobByIDHandler(w http.ResponseWriter, r *http.Request)
+	RetryJobHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type jobHandler struct {
+	db *mongo.Database
+}
+
+func NewJobHandler(db *mongo.Database) JobHandler {
+	return &jobHandler{db: db}
+}
+
+func (h *jobHandler) service(r *http.Request) jobservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.JobsCollection)
+
+	return jobservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, jobservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, jobservice.ErrNotFound):
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func (h *jobHandler) GetJobsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	jobs, err := h.service(r).GetJobs(jobservice.JobFilter{
+		Type:   q.Get("type"),
+		Status: q.Get("status"),
+		Page:   page,
+		Limit:  limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("jobs retrieved successfully", jobs)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *jobHandler) GetJobByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	job, err := h.service(r).GetJobByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("job retrieved successfully", job)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// RetryJobHandler puts a dead-lettered job back on the queue
+func (h *jobHandler) RetryJobHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	job, err := h.service(r).RetryJob(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("job queued successfully", job)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write(res)
+
+}
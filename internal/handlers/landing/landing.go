@@ -0,0 +1,301 @@
+package landing
+
+import (
+	"bytes"
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	campaignservice "campaign/internal/services/campaign"
+	claimservice "campaign/internal/services/claim"
+	contactservice "campaign/internal/services/contact"
+	"campaign/internal/storage"
+	"campaign/internal/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxAge is how long browsers and proxies may reuse a landing page,
+	// short enough for edits and the claim form closing to show soon
+	maxAge = "public, max-age=60"
+
+	// bannerMaxAge stays well under storage.DefaultURLTTL so a cached
+	// redirect never points at an expired url
+	bannerMaxAge = "public, max-age=300"
+
+	maxFormSize = 16 << 10
+)
+
+type LandingHandler interface {
+	GetCampaignHandler(w http.ResponseWriter, r *http.Request)
+	GetBannerHandler(w http.ResponseWriter, r *http.Request)
+	PageHandler(w http.ResponseWriter, r *http.Request)
+	ClaimFormHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type landingHandler struct {
+	db   *mongo.Database
+	jobs *queue.Queue
+}
+
+func NewLandingHandler(db *mongo.Database, jobs *queue.Queue) LandingHandler {
+	return &landingHandler{db: db, jobs: jobs}
+}
+
+func (h *landingHandler) database(r *http.Request) database.Database {
+	return database.NewDatabaseService(r.Context(), h.db, models.CampaignsCollection)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	if errors.Is(err, campaignservice.ErrNotPublic) {
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// writeCached sends body with an etag of its content, answering 304 when
+// the client already has it
+func writeCached(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Cache-Control", maxAge)
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Vary", "Accept-Encoding")
+
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		if match = strings.TrimSpace(match); match == tag || match == "W/"+tag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+// GetCampaignHandler is the public view of an active campaign by slug,
+// without authentication
+func (h *landingHandler) GetCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	db := h.database(r)
+
+	campaign, err := campaignservice.FindBySlug(db, chi.URLParam(r, "slug"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	public, err := campaignservice.Vary(db, campaignservice.Public(campaign, time.Now()), campaign, r.URL.Query().Get(campaignservice.VariantParam))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("campaign retrieved successfully", public)
+	writeCached(w, r, "application/json", res)
+
+}
+
+// GetBannerHandler redirects to a fresh signed url of the campaign's banner
+// so public pages can link to it without their links expiring. With v it is
+// the banner of that experiment variant.
+func (h *landingHandler) GetBannerHandler(w http.ResponseWriter, r *http.Request) {
+	db := h.database(r)
+
+	campaign, err := campaignservice.FindBySlug(db, chi.URLParam(r, "slug"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	key, ok := campaignservice.BannerKey(campaign, query.Get("variant"))
+
+	if query.Has(campaignservice.VariantParam) {
+		key, err = campaignservice.VariantBannerKey(db, campaign, query.Get(campaignservice.VariantParam))
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		ok = true
+	}
+
+	if !ok {
+		writeError(w, campaignservice.ErrNotPublic)
+		return
+	}
+
+	w.Header().Set("Cache-Control", bannerMaxAge)
+	w.Header().Set("Location", storage.SignedURL(key))
+	w.WriteHeader(http.StatusFound)
+
+}
+
+// PageHandler renders the landing page of an active campaign
+func (h *landingHandler) PageHandler(w http.ResponseWriter, r *http.Request) {
+	db := h.database(r)
+
+	campaign, err := campaignservice.FindBySlug(db, chi.URLParam(r, "slug"))
+
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	public, err := campaignservice.Vary(db, campaignservice.Public(campaign, time.Now()), campaign, r.URL.Query().Get(campaignservice.VariantParam))
+
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	body, err := render(newPage(public))
+
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	writeCached(w, r, "text/html; charset=utf-8", body)
+
+}
+
+// ClaimFormHandler takes the claim form of a landing page. It is the html
+// counterpart of POST /api/claim and answers with the page showing the
+// claim reference or what was wrong.
+func (h *landingHandler) ClaimFormHandler(w http.ResponseWriter, r *http.Request) {
+	db := h.database(r)
+
+	campaign, err := campaignservice.FindBySlug(db, chi.URLParam(r, "slug"))
+
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+	defer r.Body.Close()
+
+	// the variant is read from the form first so the answer shows the same
+	// banner as the page the form was on
+	formErr := r.ParseForm()
+
+	public, err := campaignservice.Vary(db, campaignservice.Public(campaign, time.Now()), campaign, r.PostForm.Get(campaignservice.VariantParam))
+
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	p := newPage(public)
+
+	if formErr != nil {
+		p.Error = "the form could not be read, please try again"
+		writePage(w, http.StatusBadRequest, p)
+		return
+	}
+
+	p.Form = claimForm{
+		Name:   strings.TrimSpace(r.PostForm.Get("name")),
+		Msisdn: strings.TrimSpace(r.PostForm.Get("msisdn")),
+		Email:  strings.TrimSpace(r.PostForm.Get("email")),
+	}
+
+	req := claimservice.ClaimRequest{
+		CampaignID: campaign.ID,
+		Name:       p.Form.Name,
+		Msisdn:     p.Form.Msisdn,
+		Email:      p.Form.Email,
+		Variant:    public.Variant,
+		UserAgent:  r.UserAgent(),
+	}
+
+	req.IP, _, err = net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		req.IP = r.RemoteAddr
+	}
+
+	claim, err := claimservice.Submit(r.Context(), db, h.jobs, req)
+
+	switch {
+	case errors.Is(err, claimservice.ErrInvalid), errors.Is(err, contactservice.ErrInvalid):
+		p.Error = err.Error()
+		writePage(w, http.StatusBadRequest, p)
+	case errors.Is(err, claimservice.ErrUnavailable), errors.Is(err, claimservice.ErrLimitReached):
+		p.Error = err.Error()
+		writePage(w, http.StatusConflict, p)
+	case err != nil:
+		p.Error = "your claim could not be taken, please try again"
+		writePage(w, http.StatusInternalServerError, p)
+	default:
+		status := claimservice.StatusOf(claim)
+		p.Claim = &status
+		writePage(w, http.StatusOK, p)
+	}
+
+}
+
+func render(p page) ([]byte, error) {
+	buf := bytes.Buffer{}
+
+	if err := pageTemplate.Execute(&buf, p); err != nil {
+		slog.Error("Error rendering landing page", "slug", p.Campaign.Slug, "error", err)
+
+		return nil, errors.New("error rendering landing page")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writePage sends a page made for one request, such as the answer to a
+// claim, which is never cached
+func writePage(w http.ResponseWriter, status int, p page) {
+	body, err := render(p)
+
+	if err != nil {
+		writePageError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writePageError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	body := []byte("<!DOCTYPE html><title>Error</title><p>Something went wrong, please try again.</p>")
+
+	if errors.Is(err, campaignservice.ErrNotPublic) {
+		status = http.StatusNotFound
+		body = notFoundPage
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
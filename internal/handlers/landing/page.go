@@ -0,0 +1,129 @@
+package landing
+
+import (
+	campaignservice "campaign/internal/services/campaign"
+	claimservice "campaign/internal/services/claim"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// page is what the landing page template is rendered with. Claim is set
+// once the form was taken, Error when it was not.
+type page struct {
+	Campaign campaignservice.PublicCampaign
+	Srcset   string
+	Form     claimForm
+	Claim    *claimservice.ClaimStatus
+	Error    string
+}
+
+type claimForm struct {
+	Name   string
+	Msisdn string
+	Email  string
+}
+
+func newPage(c campaignservice.PublicCampaign) page {
+	p := page{Campaign: c}
+
+	if c.Banner != nil {
+		set := []string{}
+
+		for _, v := range c.Banner.Variants {
+			set = append(set, fmt.Sprintf("%s %dw", v.URL, v.Width))
+		}
+
+		p.Srcset = strings.Join(set, ", ")
+	}
+
+	return p
+}
+
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Format("2 January 2006")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Campaign.Name}}</title>
+<meta name="description" content="{{.Campaign.Description}}">
+<meta property="og:type" content="website">
+<meta property="og:title" content="{{.Campaign.Name}}">
+<meta property="og:description" content="{{.Campaign.Description}}">
+<meta property="og:url" content="{{.Campaign.PageURL}}">
+{{- with .Campaign.Banner}}
+<meta property="og:image" content="{{.URL}}">
+{{- end}}
+<link rel="canonical" href="{{.Campaign.PageURL}}">
+<style>
+body{margin:0;font-family:system-ui,-apple-system,"Segoe UI",Roboto,sans-serif;color:#1f2933;background:#f5f7fa}
+main{max-width:40rem;margin:0 auto;padding:1.5rem;background:#fff;min-height:100vh;box-sizing:border-box}
+img{display:block;width:100%;height:auto;border-radius:.5rem}
+h1{font-size:1.75rem;margin:1.25rem 0 .5rem}
+.dates{color:#616e7c;margin:0 0 1rem}
+.description{white-space:pre-line;line-height:1.5}
+form{display:grid;gap:.75rem;margin-top:1.5rem}
+label{display:grid;gap:.25rem;font-weight:600}
+input{font:inherit;padding:.6rem;border:1px solid #cbd2d9;border-radius:.375rem}
+button{font:inherit;font-weight:600;padding:.75rem;border:0;border-radius:.375rem;background:#2563eb;color:#fff;cursor:pointer}
+.note{color:#616e7c;font-size:.875rem;margin:0}
+.error{background:#fde8e8;color:#9b1c1c;padding:.75rem;border-radius:.375rem}
+.received{background:#e3f9e5;color:#05400a;padding:.75rem;border-radius:.375rem}
+</style>
+</head>
+<body>
+<main>
+{{- with .Campaign.Banner}}
+<img src="{{.URL}}"{{if $.Srcset}} srcset="{{$.Srcset}}" sizes="(max-width: 40rem) 100vw, 40rem"{{end}}{{if .Width}} width="{{.Width}}" height="{{.Height}}"{{end}} alt="{{$.Campaign.Name}}">
+{{- end}}
+<h1>{{.Campaign.Name}}</h1>
+<p class="dates">
+{{- if and (not .Campaign.StartDate.IsZero) (not .Campaign.EndDate.IsZero)}}{{date .Campaign.StartDate}} to {{date .Campaign.EndDate}}
+{{- else if not .Campaign.EndDate.IsZero}}Until {{date .Campaign.EndDate}}
+{{- else if not .Campaign.StartDate.IsZero}}From {{date .Campaign.StartDate}}{{end -}}
+</p>
+<p class="description">{{.Campaign.Description}}</p>
+{{- if .Claim}}
+<p class="received">Thank you, your claim was received. Your reference is <strong>{{.Claim.Reference}}</strong>. We will send you the result shortly.</p>
+{{- else if .Campaign.Claimable}}
+{{- if .Error}}
+<p class="error">{{.Error}}</p>
+{{- end}}
+<form method="post" action="{{.Campaign.PageURL}}">
+{{- if .Campaign.Variant}}
+<input type="hidden" name="v" value="{{.Campaign.Variant}}">
+{{- end}}
+<label>Name <input name="name" autocomplete="name" maxlength="100" value="{{.Form.Name}}"></label>
+<label>Phone number <input name="msisdn" type="tel" autocomplete="tel" maxlength="20" value="{{.Form.Msisdn}}"></label>
+<label>Email <input name="email" type="email" autocomplete="email" maxlength="254" value="{{.Form.Email}}"></label>
+<p class="note">Enter your phone number or your email, we use it to send you your reward.</p>
+<button type="submit">Claim</button>
+</form>
+{{- else}}
+<p class="note">This campaign is not taking claims at the moment.</p>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+var notFoundPage = []byte(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Campaign not found</title>
+</head>
+<body>
+<main style="max-width:40rem;margin:0 auto;padding:1.5rem;font-family:system-ui,sans-serif">
+<h1>Campaign not found</h1>
+<p>This campaign does not exist or is no longer running.</p>
+</main>
+</body>
+</html>
+`)
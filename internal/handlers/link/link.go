@@ -0,0 +1,222 @@
+package link
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	campaignservice "campaign/internal/services/campaign"
+	linkservice "campaign/internal/services/link"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type LinkHandler interface {
+	CreateLinkHandler(w http.ResponseWriter, r *http.Request)
+	GetLinksHandler(w http.ResponseWriter, r *http.Request)
+	UpdateLinkHandler(w http.ResponseWriter, r *http.Request)
+	DeleteLinkHandler(w http.ResponseWriter, r *http.Request)
+	GetLinkStatsHandler(w http.ResponseWriter, r *http.Request)
+	GetClickStatsHandler(w http.ResponseWriter, r *http.Request)
+	RedirectHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type linkHandler struct {
+	db *mongo.Database
+}
+
+func NewLinkHandler(db *mongo.Database) LinkHandler {
+	return &linkHandler{db: db}
+}
+
+func (h *linkHandler) service(r *http.Request) linkservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.LinksCollection)
+
+	return linkservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, linkservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, linkservice.ErrNotFound):
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func decodeLink(w http.ResponseWriter, r *http.Request) (linkservice.LinkRequest, bool) {
+	reqBody := linkservice.LinkRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	return reqBody, true
+}
+
+func (h *linkHandler) CreateLinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	reqBody, ok := decodeLink(w, r)
+
+	if !ok {
+		return
+	}
+
+	link, err := h.service(r).CreateLink(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("link created successfully", link)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (h *linkHandler) GetLinksHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	links, err := h.service(r).GetLinks(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("links retrieved successfully", links)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *linkHandler) UpdateLinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	linkID := chi.URLParam(r, "linkID")
+
+	reqBody, ok := decodeLink(w, r)
+
+	if !ok {
+		return
+	}
+
+	link, err := h.service(r).UpdateLink(id, linkID, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("link updated successfully", link)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *linkHandler) DeleteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	linkID := chi.URLParam(r, "linkID")
+
+	err := h.service(r).DeleteLink(id, linkID)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("link deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *linkHandler) GetLinkStatsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	linkID := chi.URLParam(r, "linkID")
+
+	stats, err := h.service(r).GetLinkStats(id, linkID)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("link stats retrieved successfully", stats)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *linkHandler) GetClickStatsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	stats, err := h.service(r).GetClickStats(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("click stats retrieved successfully", stats)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// RedirectHandler sends the visitor of a short link on to its destination.
+// Failing to record the click must not break the link, it is only logged.
+func (h *linkHandler) RedirectHandler(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.LinksCollection)
+
+	link, err := linkservice.Resolve(dbM, code)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	click, err := linkservice.RecordClick(dbM, link, linkservice.Visit{
+		Ref:       r.URL.Query().Get("c"),
+		UserAgent: r.UserAgent(),
+		Referrer:  r.Referer(),
+		IP:        ip,
+	})
+
+	if err != nil {
+		slog.Error("Error recording click", "code", code, "error", err)
+	}
+
+	// a landing page shows the banner of the visitor's variant
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", campaignservice.WithVariant(linkservice.Destination(link), click.Variant))
+	w.WriteHeader(http.StatusFound)
+
+}
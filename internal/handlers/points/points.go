@@ -0,0 +1,161 @@
+package points
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	pointsservice "campaign/internal/services/points"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type PointsHandler interface {
+	AwardHandler(w http.ResponseWriter, r *http.Request)
+	GetLedgerHandler(w http.ResponseWriter, r *http.Request)
+	GetBalanceHandler(w http.ResponseWriter, r *http.Request)
+	GetLeaderboardHandler(w http.ResponseWriter, r *http.Request)
+	GetRankHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type pointsHandler struct {
+	db *mongo.Database
+}
+
+func NewPointsHandler(db *mongo.Database) PointsHandler {
+	return &pointsHandler{db: db}
+}
+
+func (h *pointsHandler) database(r *http.Request) database.Database {
+	return database.NewDatabaseService(r.Context(), h.db, models.PointsLedgerCollection)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, pointsservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, pointsservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, pointsservice.ErrUnavailable), errors.Is(err, pointsservice.ErrLimitReached):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// AwardHandler lets a campaign owner credit a user for an action, or adjust
+// their points
+func (h *pointsHandler) AwardHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := pointsservice.AwardRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("invalid request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+		return
+	}
+
+	entry, err := pointsservice.NewService(r.Context(), h.database(r)).Award(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("points awarded successfully", entry)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (h *pointsHandler) GetLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	ledger, err := pointsservice.NewService(r.Context(), h.database(r)).GetLedger(id, pointsservice.LedgerFilter{
+		UserID: q.Get("user_id"),
+		Action: q.Get("action"),
+		Page:   page,
+		Limit:  limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("points ledger retrieved successfully", ledger)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// GetBalanceHandler returns the current user's points on a campaign
+func (h *pointsHandler) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID := chi.URLParam(r, "campaignID")
+
+	balance, err := pointsservice.NewService(r.Context(), h.database(r)).GetBalance(campaignID)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("points retrieved successfully", balance)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// GetLeaderboardHandler ranks a campaign's participants, ?period= is daily,
+// weekly or all_time
+func (h *pointsHandler) GetLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID := chi.URLParam(r, "campaignID")
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	board, err := pointsservice.NewService(r.Context(), h.database(r)).GetLeaderboard(campaignID, q.Get("period"), page, limit)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("leaderboard retrieved successfully", board)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *pointsHandler) GetRankHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID := chi.URLParam(r, "campaignID")
+
+	standing, err := pointsservice.NewService(r.Context(), h.database(r)).GetRank(campaignID, r.URL.Query().Get("period"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("rank retrieved successfully", standing)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
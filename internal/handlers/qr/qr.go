@@ -0,0 +1,88 @@
+package qr
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	qrservice "campaign/internal/services/qr"
+	"campaign/internal/storage"
+	"campaign/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type QRHandler interface {
+	GetQRHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type qrHandler struct {
+	db    *mongo.Database
+	store storage.BlobStore
+}
+
+func NewQRHandler(db *mongo.Database, store storage.BlobStore) QRHandler {
+	return &qrHandler{db: db, store: store}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, qrservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, qrservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, qrservice.ErrUnavailable):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// GetQRHandler returns a QR code of the campaign's tracked landing page link
+// for posters. ?format= is png or svg, ?size= the width in pixels, ?level=
+// the error correction level L, M, Q or H, ?logo=true draws the banner in
+// the middle, ?link_id= encodes another of the campaign's links and
+// ?download=true asks browsers to save the file.
+func (h *qrHandler) GetQRHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	q := r.URL.Query()
+
+	size, _ := strconv.Atoi(q.Get("size"))
+	logo, _ := strconv.ParseBool(q.Get("logo"))
+	download, _ := strconv.ParseBool(q.Get("download"))
+
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.LinksCollection)
+
+	qr, err := qrservice.NewService(r.Context(), dbM, h.store).GetQR(id, qrservice.Options{
+		Format: q.Get("format"),
+		Size:   size,
+		Level:  q.Get("level"),
+		Logo:   logo,
+		LinkID: q.Get("link_id"),
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	disposition := "inline"
+
+	if download {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Type", qr.ContentType)
+	w.Header().Set("Content-Disposition", disposition+`; filename="`+qr.Filename+`"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("X-QR-URL", qr.Link.ShortURL)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(qr.Data)
+
+}
@@ -0,0 +1,146 @@
+package receipt
+
+import (
+	"bytes"
+	"campaign/internal/database"
+	"campaign/internal/email"
+	"campaign/internal/models"
+	receiptservice "campaign/internal/services/receipt"
+	"campaign/internal/sms"
+	"campaign/internal/utils"
+	"campaign/internal/webhook"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ReceiptHandler interface {
+	SMSReceiptHandler(w http.ResponseWriter, r *http.Request)
+	EmailReceiptHandler(w http.ResponseWriter, r *http.Request)
+	GetDeliveryStatsHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type receiptHandler struct {
+	db *mongo.Database
+}
+
+func NewReceiptHandler(db *mongo.Database) ReceiptHandler {
+	return &receiptHandler{db: db}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, receiptservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, receiptservice.ErrNotFound):
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// SMSReceiptHandler ingests delivery receipts from an sms provider, one or
+// an array of them, signed as sms.ReceiptVerifier expects
+func (h *receiptHandler) SMSReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	verifier, ok := sms.ReceiptVerifier(provider)
+
+	h.record(w, r, models.ChannelSMS, provider, verifier, ok)
+}
+
+// EmailReceiptHandler ingests delivery receipts from an email relay, one or
+// an array of them, authenticated as email.ReceiptVerifier expects
+func (h *receiptHandler) EmailReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	verifier, ok := email.ReceiptVerifier(provider)
+
+	h.record(w, r, models.ChannelEmail, provider, verifier, ok)
+}
+
+func (h *receiptHandler) record(w http.ResponseWriter, r *http.Request, channel, provider string, verifier webhook.Verifier, ok bool) {
+	if !ok {
+		res := utils.WrapInResponse("unknown provider: "+provider, nil)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	// the signature covers the raw body so it is read before decoding
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error reading request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	if err := verifier.Verify(r, data); err != nil {
+		res := utils.WrapInResponse(webhook.ErrUnauthorized.Error(), nil)
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	receipts := []receiptservice.Receipt{}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &receipts)
+	} else {
+		receipt := receiptservice.Receipt{}
+		err = json.Unmarshal(trimmed, &receipt)
+		receipts = append(receipts, receipt)
+	}
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.DeliveryReceiptsCollection)
+
+	result, err := receiptservice.Record(dbM, channel, provider, receipts)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("receipts recorded successfully", result)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *receiptHandler) GetDeliveryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.CampaignsCollection)
+
+	stats, err := receiptservice.NewService(r.Context(), dbM).GetDeliveryStats(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("delivery stats retrieved successfully", stats)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,99 @@
+package referral
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	referralservice "campaign/internal/services/referral"
+	"campaign/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ReferralHandler interface {
+	GetCodesHandler(w http.ResponseWriter, r *http.Request)
+	GetCodeHandler(w http.ResponseWriter, r *http.Request)
+	GetReportHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type referralHandler struct {
+	db *mongo.Database
+}
+
+func NewReferralHandler(db *mongo.Database) ReferralHandler {
+	return &referralHandler{db: db}
+}
+
+func (h *referralHandler) database(r *http.Request) database.Database {
+	return database.NewDatabaseService(r.Context(), h.db, models.ReferralCodesCollection)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, referralservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, referralservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, referralservice.ErrUnavailable):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// GetCodesHandler lists the user's referral codes with what each earned
+func (h *referralHandler) GetCodesHandler(w http.ResponseWriter, r *http.Request) {
+	codes, err := referralservice.NewService(r.Context(), h.database(r)).GetCodes()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("referral codes retrieved successfully", codes)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// GetCodeHandler returns the user's code for a campaign, making one the
+// first time they ask
+func (h *referralHandler) GetCodeHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID := chi.URLParam(r, "campaignID")
+
+	code, err := referralservice.NewService(r.Context(), h.database(r)).GetCode(campaignID)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("referral code retrieved successfully", code)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// GetReportHandler shows a campaign owner who referred whom and what was
+// earned at each level
+func (h *referralHandler) GetReportHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	report, err := referralservice.NewService(r.Context(), h.database(r)).GetReport(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("referral report retrieved successfully", report)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,213 @@
+package segment
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	segmentservice "campaign/internal/services/segment"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SegmentHandler interface {
+	CreateSegmentHandler(w http.ResponseWriter, r *http.Request)
+	GetSegmentsHandler(w http.ResponseWriter, r *http.Request)
+	GetSegmentByIDHandler(w http.ResponseWriter, r *http.Request)
+	UpdateSegmentHandler(w http.ResponseWriter, r *http.Request)
+	DeleteSegmentHandler(w http.ResponseWriter, r *http.Request)
+	PreviewRuleHandler(w http.ResponseWriter, r *http.Request)
+	PreviewSegmentHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type segmentHandler struct {
+	db *mongo.Database
+}
+
+func NewSegmentHandler(db *mongo.Database) SegmentHandler {
+	return &segmentHandler{db: db}
+}
+
+func (sg *segmentHandler) service(r *http.Request) segmentservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), sg.db, models.SegmentsCollection)
+
+	return segmentservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, segmentservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, segmentservice.ErrNotFound):
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func decodeSegment(w http.ResponseWriter, r *http.Request) (models.Segment, bool) {
+	reqBody := models.Segment{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return reqBody, false
+	}
+
+	return reqBody, true
+}
+
+func (sg *segmentHandler) CreateSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody, ok := decodeSegment(w, r)
+
+	if !ok {
+		return
+	}
+
+	segment, err := sg.service(r).CreateSegment(reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("segment created successfully", segment)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (sg *segmentHandler) GetSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	segments, err := sg.service(r).GetSegments()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("segments retrieved successfully", segments)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (sg *segmentHandler) GetSegmentByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	segment, err := sg.service(r).GetSegmentByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("segment retrieved successfully", segment)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (sg *segmentHandler) UpdateSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	reqBody, ok := decodeSegment(w, r)
+
+	if !ok {
+		return
+	}
+
+	if err := sg.service(r).UpdateSegment(id, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("segment updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (sg *segmentHandler) DeleteSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := sg.service(r).DeleteSegment(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("segment deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+type PreviewRule struct {
+	Rule       models.SegmentRule `json:"rule"`
+	SampleSize int                `json:"sample_size"`
+}
+
+// PreviewRuleHandler resolves an unsaved rule so the builder can show the
+// audience size while it is being edited
+func (sg *segmentHandler) PreviewRuleHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := PreviewRule{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	preview, err := sg.service(r).Preview(reqBody.Rule, reqBody.SampleSize)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("segment previewed successfully", preview)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (sg *segmentHandler) PreviewSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	sampleSize, _ := strconv.Atoi(r.URL.Query().Get("sample_size"))
+
+	segment, err := sg.service(r).GetSegmentByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	preview, err := sg.service(r).Preview(segment.Rule, sampleSize)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("segment previewed successfully", preview)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,119 @@
+package sms
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	smsservice "campaign/internal/services/sms"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SMSHandler interface {
+	SendCampaignHandler(w http.ResponseWriter, r *http.Request)
+	GetMessagesHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type smsHandler struct {
+	db   *mongo.Database
+	jobs *queue.Queue
+}
+
+func NewSMSHandler(db *mongo.Database, jobs *queue.Queue) SMSHandler {
+	return &smsHandler{db: db, jobs: jobs}
+}
+
+func (h *smsHandler) service(r *http.Request) smsservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.SMSMessagesCollection)
+
+	return smsservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, smsservice.ErrInvalid), errors.Is(err, templateservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, smsservice.ErrNotFound):
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// SendCampaignHandler queues the batch and a job to deliver it and returns
+// 202, delivery is followed through GetMessagesHandler or the job
+func (h *smsHandler) SendCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := smsservice.SendRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	batch, err := h.service(r).SendCampaign(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	job, err := h.jobs.Enqueue(r.Context(), smsservice.DispatchJob, map[string]interface{}{"batch_id": batch.ID}, queue.Options{})
+
+	if err != nil {
+		slog.Error("Error queueing dispatch job", "batch", batch.ID, "error", err)
+
+		writeError(w, errors.New("error queueing messages"))
+		return
+	}
+
+	batch.JobID = job.ID
+
+	res := utils.WrapInResponse("messages queued successfully", batch)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write(res)
+
+}
+
+func (h *smsHandler) GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	messages, err := h.service(r).GetMessages(id, smsservice.MessageFilter{
+		BatchID: q.Get("batch_id"),
+		Status:  q.Get("status"),
+		Page:    page,
+		Limit:   limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("messages retrieved successfully", messages)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
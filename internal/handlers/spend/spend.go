@@ -0,0 +1,114 @@
+package spend
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	spendservice "campaign/internal/services/spend"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SpendHandler interface {
+	RecordSpendHandler(w http.ResponseWriter, r *http.Request)
+	GetSpendHandler(w http.ResponseWriter, r *http.Request)
+	GetBudgetAlertsHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type spendHandler struct {
+	db *mongo.Database
+}
+
+func NewSpendHandler(db *mongo.Database) SpendHandler {
+	return &spendHandler{db: db}
+}
+
+func (s *spendHandler) service(r *http.Request) spendservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), s.db, models.SpendCollection)
+
+	return spendservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, spendservice.ErrInvalidSpend):
+		status = http.StatusBadRequest
+	case errors.Is(err, spendservice.ErrCampaignNotFound):
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+type RecordSpendRes struct {
+	Entry  models.SpendEntry    `json:"entry"`
+	Alerts []models.BudgetAlert `json:"alerts"`
+}
+
+func (s *spendHandler) RecordSpendHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := models.SpendEntry{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	entry, alerts, err := s.service(r).RecordSpend(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("spend recorded successfully", RecordSpendRes{Entry: entry, Alerts: alerts})
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (s *spendHandler) GetSpendHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	entries, err := s.service(r).GetSpend(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("spend retrieved successfully", entries)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (s *spendHandler) GetBudgetAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	alerts, err := s.service(r).GetAlerts(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("budget alerts retrieved successfully", alerts)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
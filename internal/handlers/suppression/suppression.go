@@ -0,0 +1,228 @@
+package suppression
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	suppressionservice "campaign/internal/services/suppression"
+	"campaign/internal/sms"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SuppressionHandler interface {
+	GetSuppressionsHandler(w http.ResponseWriter, r *http.Request)
+	AddSuppressionHandler(w http.ResponseWriter, r *http.Request)
+	RemoveSuppressionHandler(w http.ResponseWriter, r *http.Request)
+	GetUnsubscribeHandler(w http.ResponseWriter, r *http.Request)
+	UnsubscribeHandler(w http.ResponseWriter, r *http.Request)
+	InboundSMSHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type suppressionHandler struct {
+	db       *mongo.Database
+	provider sms.SMSProvider
+}
+
+func NewSuppressionHandler(db *mongo.Database, provider sms.SMSProvider) SuppressionHandler {
+	return &suppressionHandler{db: db, provider: provider}
+}
+
+func (h *suppressionHandler) database(r *http.Request) database.Database {
+	return database.NewDatabaseService(r.Context(), h.db, models.SuppressionsCollection)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, suppressionservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, suppressionservice.ErrNotFound):
+		status = http.StatusNotFound
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func (h *suppressionHandler) GetSuppressionsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	suppressions, err := suppressionservice.NewService(r.Context(), h.database(r)).GetSuppressions(suppressionservice.SuppressionFilter{
+		Channel: q.Get("channel"),
+		Query:   q.Get("q"),
+		Page:    page,
+		Limit:   limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("suppressions retrieved successfully", suppressions)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *suppressionHandler) AddSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := suppressionservice.SuppressionRequest{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	suppression, err := suppressionservice.NewService(r.Context(), h.database(r)).AddSuppression(reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("address suppressed successfully", suppression)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (h *suppressionHandler) RemoveSuppressionHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	err := suppressionservice.NewService(r.Context(), h.database(r)).RemoveSuppression(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("suppression removed successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// GetUnsubscribeHandler describes an unsubscribe link without using it, so
+// link scanners that follow it do not opt anyone out
+func (h *suppressionHandler) GetUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	unsubscription, err := suppressionservice.LookupToken(h.database(r), chi.URLParam(r, "token"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("unsubscribe link retrieved successfully", unsubscription)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// UnsubscribeHandler opts the link address out. Mail clients post
+// "List-Unsubscribe=One-Click" here as RFC 8058 describes, the body is not
+// needed as the token says everything.
+func (h *suppressionHandler) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, 1<<10))
+	defer r.Body.Close()
+
+	unsubscription, err := suppressionservice.Unsubscribe(h.database(r), chi.URLParam(r, "token"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("unsubscribed successfully", unsubscription)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// InboundSMSHandler takes texts sent to our numbers, signed as
+// sms.ReceiptVerifier expects, and answers STOP, START and HELP
+func (h *suppressionHandler) InboundSMSHandler(w http.ResponseWriter, r *http.Request) {
+	verifier, ok := sms.ReceiptVerifier(chi.URLParam(r, "provider"))
+
+	if !ok {
+		res := utils.WrapInResponse("unknown provider: "+chi.URLParam(r, "provider"), nil)
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<16))
+	defer r.Body.Close()
+
+	if err == nil {
+		err = verifier.Verify(r, data)
+
+		if err != nil {
+			res := utils.WrapInResponse(err.Error(), nil)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write(res)
+
+			return
+		}
+	}
+
+	in := suppressionservice.Inbound{}
+
+	if err == nil {
+		err = json.Unmarshal(data, &in)
+	}
+
+	if err != nil {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	result, err := suppressionservice.HandleInbound(h.database(r), in)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if result.Reply != "" {
+		from := in.To
+
+		if from == "" {
+			from = sms.SenderID()
+		}
+
+		_, err = h.provider.Send(r.Context(), sms.Message{To: utils.NormalizeMsisdn(in.From), From: from, Body: result.Reply})
+
+		// the keyword took effect, a lost reply is not worth a provider retry
+		if err != nil {
+			slog.Error("Error sending keyword reply", "keyword", result.Keyword, "error", err)
+		}
+	}
+
+	res := utils.WrapInResponse("inbound message processed successfully", result)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
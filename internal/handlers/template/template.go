@@ -0,0 +1,274 @@
+package template
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/email"
+	"campaign/internal/models"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/sms"
+	"campaign/internal/utils"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/mail"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxRequestSize leaves room for every part of a template as json strings
+const maxRequestSize = 4 * templateservice.MaxTemplateSize
+
+type TemplateHandler interface {
+	CreateTemplateHandler(w http.ResponseWriter, r *http.Request)
+	GetTemplatesHandler(w http.ResponseWriter, r *http.Request)
+	GetTemplateByIDHandler(w http.ResponseWriter, r *http.Request)
+	UpdateTemplateHandler(w http.ResponseWriter, r *http.Request)
+	DeleteTemplateHandler(w http.ResponseWriter, r *http.Request)
+	PreviewDraftHandler(w http.ResponseWriter, r *http.Request)
+	PreviewTemplateHandler(w http.ResponseWriter, r *http.Request)
+	SendTestHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type templateHandler struct {
+	db       *mongo.Database
+	provider sms.SMSProvider
+	mailer   *email.Mailer
+}
+
+func NewTemplateHandler(db *mongo.Database, provider sms.SMSProvider, mailer *email.Mailer) TemplateHandler {
+	return &templateHandler{db: db, provider: provider, mailer: mailer}
+}
+
+// PreviewDraft renders an unsaved template
+type PreviewDraft struct {
+	Template models.Template `json:"template"`
+	templateservice.PreviewRequest
+}
+
+func (h *templateHandler) service(r *http.Request) templateservice.Service {
+	dbM := database.NewDatabaseService(r.Context(), h.db, models.TemplatesCollection)
+
+	return templateservice.NewService(r.Context(), dbM)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, templateservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, templateservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, templateservice.ErrExists):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+// decode reads the json body into v, an empty body leaves v as it is
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+
+	err := json.NewDecoder(r.Body).Decode(v)
+	defer r.Body.Close()
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		res := utils.WrapInResponse("error decoding request body", nil)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write(res)
+
+		return false
+	}
+
+	return true
+}
+
+func (h *templateHandler) CreateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := models.Template{}
+
+	if !decode(w, r, &reqBody) {
+		return
+	}
+
+	t, err := h.service(r).CreateTemplate(reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("template created successfully", t)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (h *templateHandler) GetTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.service(r).GetTemplates(r.URL.Query().Get("channel"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("templates retrieved successfully", templates)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *templateHandler) GetTemplateByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	t, err := h.service(r).GetTemplateByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("template retrieved successfully", t)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *templateHandler) UpdateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := models.Template{}
+
+	if !decode(w, r, &reqBody) {
+		return
+	}
+
+	if err := h.service(r).UpdateTemplate(id, reqBody); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("template updated successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *templateHandler) DeleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	if err := h.service(r).DeleteTemplate(id); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("template deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// PreviewDraftHandler renders a template while it is being edited
+func (h *templateHandler) PreviewDraftHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := PreviewDraft{}
+
+	if !decode(w, r, &reqBody) {
+		return
+	}
+
+	preview, err := h.service(r).Preview(reqBody.Template, reqBody.PreviewRequest)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("template rendered successfully", preview)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *templateHandler) PreviewTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := templateservice.PreviewRequest{}
+
+	if !decode(w, r, &reqBody) {
+		return
+	}
+
+	svc := h.service(r)
+
+	t, err := svc.GetTemplateByID(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	preview, err := svc.Preview(t, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("template rendered successfully", preview)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// SendTestHandler sends the rendered template to the signed in user's own
+// email address or phone number
+func (h *templateHandler) SendTestHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := templateservice.TestRequest{}
+
+	if !decode(w, r, &reqBody) {
+		return
+	}
+
+	message, err := h.service(r).TestMessage(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if message.Channel == models.TemplateChannelSMS {
+		message.To = utils.NormalizeMsisdn(message.To)
+
+		_, err = h.provider.Send(r.Context(), sms.Message{To: message.To, From: sms.SenderID(), Body: message.Rendered.Body})
+	} else {
+		err = h.mailer.Send(r.Context(), email.Message{
+			From:      mail.Address{Name: message.From.Name, Address: message.From.Email},
+			To:        mail.Address{Address: message.To},
+			ReplyTo:   message.From.ReplyTo,
+			Subject:   message.Rendered.Subject,
+			HTML:      message.Rendered.Body,
+			Text:      message.Rendered.Text,
+			MessageID: primitive.NewObjectID().Hex() + "@" + email.Domain(message.From.Email),
+		})
+	}
+
+	if err != nil {
+		slog.Error("Error sending test message", "template", id, "error", err)
+
+		res := utils.WrapInResponse("error sending test message", nil)
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write(res)
+
+		return
+	}
+
+	res := utils.WrapInResponse("test message sent successfully", message)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
@@ -0,0 +1,363 @@
+package voucher
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	voucherservice "campaign/internal/services/voucher"
+	"campaign/internal/utils"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxUploadSize bounds an uploaded csv of codes
+const MaxUploadSize = 10 << 20
+
+// KeyHeader carries a partner's redemption key
+const KeyHeader = "X-Redemption-Key"
+
+type VoucherHandler interface {
+	CreatePoolHandler(w http.ResponseWriter, r *http.Request)
+	GetPoolsHandler(w http.ResponseWriter, r *http.Request)
+	GetPoolByIDHandler(w http.ResponseWriter, r *http.Request)
+	DeletePoolHandler(w http.ResponseWriter, r *http.Request)
+	RotateKeyHandler(w http.ResponseWriter, r *http.Request)
+	GenerateCodesHandler(w http.ResponseWriter, r *http.Request)
+	UploadCodesHandler(w http.ResponseWriter, r *http.Request)
+	GetVouchersHandler(w http.ResponseWriter, r *http.Request)
+	LookupHandler(w http.ResponseWriter, r *http.Request)
+	RedeemHandler(w http.ResponseWriter, r *http.Request)
+}
+
+type voucherHandler struct {
+	db *mongo.Database
+}
+
+func NewVoucherHandler(db *mongo.Database) VoucherHandler {
+	return &voucherHandler{db: db}
+}
+
+func (h *voucherHandler) database(r *http.Request) database.Database {
+	return database.NewDatabaseService(r.Context(), h.db, models.CodePoolsCollection)
+}
+
+func (h *voucherHandler) service(r *http.Request) voucherservice.Service {
+	return voucherservice.NewService(r.Context(), h.database(r))
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, voucherservice.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, voucherservice.ErrUnauthorized):
+		status = http.StatusUnauthorized
+	case errors.Is(err, voucherservice.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, voucherservice.ErrInUse), errors.Is(err, voucherservice.ErrNotRedeemable):
+		status = http.StatusConflict
+	}
+
+	res := utils.WrapInResponse(err.Error(), nil)
+	w.WriteHeader(status)
+	_, _ = w.Write(res)
+}
+
+func badRequest(w http.ResponseWriter, message string) {
+	res := utils.WrapInResponse(message, nil)
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = w.Write(res)
+}
+
+func (h *voucherHandler) CreatePoolHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	reqBody := models.CodePool{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		badRequest(w, "invalid request body")
+		return
+	}
+
+	pool, err := h.service(r).CreatePool(id, reqBody)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("code pool created successfully. keep the redemption key, it is not shown again", pool)
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write(res)
+
+}
+
+func (h *voucherHandler) GetPoolsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	pools, err := h.service(r).GetPools(id)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("code pools retrieved successfully", pools)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *voucherHandler) GetPoolByIDHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	poolID := chi.URLParam(r, "poolID")
+
+	pool, err := h.service(r).GetPool(id, poolID)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("code pool retrieved successfully", pool)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *voucherHandler) DeletePoolHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	poolID := chi.URLParam(r, "poolID")
+
+	err := h.service(r).DeletePool(id, poolID)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("code pool deleted successfully", nil)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *voucherHandler) RotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	poolID := chi.URLParam(r, "poolID")
+
+	pool, err := h.service(r).RotateKey(id, poolID)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("redemption key rotated successfully. keep it, it is not shown again", pool)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+func (h *voucherHandler) GenerateCodesHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	poolID := chi.URLParam(r, "poolID")
+
+	reqBody := struct {
+		Count int `json:"count"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		badRequest(w, "invalid request body")
+		return
+	}
+
+	result, err := h.service(r).GenerateCodes(id, poolID, reqBody.Count)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("codes generated successfully", result)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// UploadCodesHandler adds third party codes from a {"codes": [...]} body or
+// the first column of a csv in the "file" multipart field
+func (h *voucherHandler) UploadCodesHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	poolID := chi.URLParam(r, "poolID")
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize+(1<<20))
+	defer r.Body.Close()
+
+	codes := []string{}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(MaxUploadSize); err != nil {
+			badRequest(w, fmt.Sprintf("invalid multipart body. file must not be larger than %d bytes", MaxUploadSize))
+			return
+		}
+
+		defer r.MultipartForm.RemoveAll()
+
+		file, _, err := r.FormFile("file")
+
+		if err != nil {
+			badRequest(w, "file is required")
+			return
+		}
+
+		defer file.Close()
+
+		codes, err = readCodes(file)
+
+		if err != nil {
+			badRequest(w, "invalid csv: "+err.Error())
+			return
+		}
+	} else {
+		reqBody := struct {
+			Codes []string `json:"codes"`
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			badRequest(w, "invalid request body")
+			return
+		}
+
+		codes = reqBody.Codes
+	}
+
+	result, err := h.service(r).UploadCodes(id, poolID, codes)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("codes uploaded successfully", result)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// readCodes takes the first column of every row, a "code" header is skipped
+func readCodes(r io.Reader) ([]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	codes := []string{}
+
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+
+		if errors.Is(err, io.EOF) {
+			return codes, nil
+		}
+
+		if err != nil {
+			return codes, err
+		}
+
+		if len(record) == 0 || (row == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "code")) {
+			continue
+		}
+
+		codes = append(codes, record[0])
+	}
+}
+
+func (h *voucherHandler) GetVouchersHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	poolID := chi.URLParam(r, "poolID")
+	q := r.URL.Query()
+
+	page, _ := strconv.Atoi(q.Get("page"))
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	vouchers, err := h.service(r).GetVouchers(id, poolID, voucherservice.VoucherFilter{
+		Status: q.Get("status"),
+		Page:   page,
+		Limit:  limit,
+	})
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("codes retrieved successfully", vouchers)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// LookupHandler lets a partner check a code before redeeming it
+func (h *voucherHandler) LookupHandler(w http.ResponseWriter, r *http.Request) {
+	code := chi.URLParam(r, "code")
+
+	redemption, err := voucherservice.Lookup(h.database(r), r.Header.Get(KeyHeader), code)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("code retrieved successfully", redemption)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
+
+// RedeemHandler marks a code as used by a partner, authenticated by the
+// redemption key of the code's pool
+func (h *voucherHandler) RedeemHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := struct {
+		Code     string `json:"code"`
+		Location string `json:"location"`
+	}{}
+
+	err := json.NewDecoder(r.Body).Decode(&reqBody)
+	defer r.Body.Close()
+
+	if err != nil {
+		badRequest(w, "invalid request body")
+		return
+	}
+
+	redemption, err := voucherservice.Redeem(h.database(r), r.Header.Get(KeyHeader), reqBody.Code, reqBody.Location)
+
+	if errors.Is(err, voucherservice.ErrNotRedeemable) {
+		res := utils.WrapInResponse(err.Error(), redemption)
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write(res)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := utils.WrapInResponse("code redeemed successfully", redemption)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(res)
+
+}
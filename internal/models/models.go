@@ -9,6 +9,58 @@ type Collections string
 const (
 	UsersCollection     Collections = "users"
 	CampaignsCollection Collections = "campaigns"
+	AssetsCollection    Collections = "assets"
+
+	CategoriesCollection   Collections = "categories"
+	CustomFieldsCollection Collections = "custom_fields"
+
+	SpendCollection        Collections = "spend"
+	BudgetAlertsCollection Collections = "budget_alerts"
+
+	GoalsCollection        Collections = "goals"
+	MetricEventsCollection Collections = "metric_events"
+
+	ContactsCollection     Collections = "contacts"
+	ContactListsCollection Collections = "contact_lists"
+
+	SegmentsCollection        Collections = "segments"
+	AudienceMembersCollection Collections = "audience_members"
+
+	SMSMessagesCollection Collections = "sms_messages"
+
+	SenderIdentitiesCollection Collections = "sender_identities"
+	EmailBatchesCollection     Collections = "email_batches"
+	EmailMessagesCollection    Collections = "email_messages"
+
+	JobsCollection Collections = "jobs"
+
+	TemplatesCollection Collections = "templates"
+
+	DeliveryReceiptsCollection Collections = "delivery_receipts"
+
+	SuppressionsCollection Collections = "suppressions"
+
+	LinksCollection  Collections = "links"
+	ClicksCollection Collections = "clicks"
+
+	ClaimsCollection        Collections = "claims"
+	ClaimCountersCollection Collections = "claim_counters"
+
+	CodePoolsCollection Collections = "code_pools"
+	VouchersCollection  Collections = "vouchers"
+
+	ReferralCodesCollection Collections = "referral_codes"
+	ReferralsCollection     Collections = "referrals"
+
+	PointsLedgerCollection Collections = "points_ledger"
+	PointsTotalsCollection Collections = "points_totals"
+)
+
+const (
+	CampaignStatusDraft  = "draft"
+	CampaignStatusActive = "active"
+	CampaignStatusPaused = "paused"
+	CampaignStatusEnded  = "ended"
 )
 
 type User struct {
@@ -16,6 +68,7 @@ type User struct {
 	Name      string    `json:"name"`
 	Email     string    `json:"email"`
 	Phone     string    `json:"phone_number"`
+	Msisdn    string    `json:"msisdn" bson:"msisdn"`
 	Address   string    `json:"address"`
 	Password  string    `json:"-"`
 	CreatedAt time.Time `json:"created_at" bson:"created_at"`
@@ -25,6 +78,7 @@ type User struct {
 type Campaign struct {
 	ID          string    `json:"id" bson:"_id"`
 	Name        string    `json:"name"`
+	Slug        string    `json:"slug" bson:"slug,omitempty"`
 	Description string    `json:"description"`
 	StartDate   time.Time `json:"start_date" bson:"start_date"`
 	EndDate     time.Time `json:"end_date" bson:"end_date"`
@@ -33,4 +87,885 @@ type Campaign struct {
 	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
 	Status      string    `json:"status"`
+	Banner      *Banner   `json:"banner,omitempty" bson:"banner,omitempty"`
+
+	Tags         []string               `json:"tags" bson:"tags"`
+	CategoryID   string                 `json:"category_id" bson:"category_id"`
+	CustomFields map[string]interface{} `json:"custom_fields" bson:"custom_fields"`
+
+	Budget       *Budget       `json:"budget,omitempty" bson:"budget,omitempty"`
+	Spend        *SpendSummary `json:"spend,omitempty" bson:"-"`
+	PausedReason string        `json:"paused_reason,omitempty" bson:"paused_reason,omitempty"`
+
+	AudienceListIDs    []string          `json:"audience_list_ids" bson:"audience_list_ids"`
+	AudienceSegmentIDs []string          `json:"audience_segment_ids" bson:"audience_segment_ids"`
+	AudienceSnapshot   *AudienceSnapshot `json:"audience_snapshot,omitempty" bson:"audience_snapshot,omitempty"`
+
+	TemplateIDs []string `json:"template_ids" bson:"template_ids"`
+
+	SendWindow *SendWindow `json:"send_window,omitempty" bson:"send_window,omitempty"`
+
+	Claims     *ClaimSettings `json:"claims,omitempty" bson:"claims,omitempty"`
+	ClaimCount int64          `json:"claim_count" bson:"claim_count"`
+
+	// Eligibility rules must all pass for a claim to be approved
+	Eligibility []EligibilityRule `json:"eligibility,omitempty" bson:"eligibility,omitempty"`
+
+	// CallbackSecret signs the results posted to claim callback urls
+	CallbackSecret string `json:"-" bson:"callback_secret,omitempty"`
+
+	Referrals *ReferralSettings `json:"referrals,omitempty" bson:"referrals,omitempty"`
+	Points    *PointsSettings   `json:"points,omitempty" bson:"points,omitempty"`
+
+	Experiment *Experiment `json:"experiment,omitempty" bson:"experiment,omitempty"`
+}
+
+// ClaimSettings limit the rewards a campaign gives out. MaxClaims is the
+// total across everyone, 0 for no limit. PerContact is how often one
+// contact may claim, 1 when not set. CallbackHosts are the hosts claim
+// results may be posted back to. Claims with a risk score above HoldAbove
+// are held for review, the default threshold applies when it is 0.
+type ClaimSettings struct {
+	MaxClaims     int64    `json:"max_claims" bson:"max_claims"`
+	PerContact    int64    `json:"per_contact" bson:"per_contact"`
+	CallbackHosts []string `json:"callback_hosts,omitempty" bson:"callback_hosts,omitempty"`
+	HoldAbove     int      `json:"hold_above,omitempty" bson:"hold_above,omitempty"`
+}
+
+// SendWindow limits the hours campaign messages go out in, "15:04" times in
+// the recipient's time zone. An End before Start runs past midnight. Days
+// limits sending to some weekdays, "mon" to "sun", empty means every day.
+// TimeZone is used for recipients whose zone is not known.
+type SendWindow struct {
+	Start    string   `json:"start" bson:"start"`
+	End      string   `json:"end" bson:"end"`
+	Days     []string `json:"days,omitempty" bson:"days,omitempty"`
+	TimeZone string   `json:"time_zone,omitempty" bson:"time_zone,omitempty"`
+}
+
+const PausedReasonBudgetExhausted = "budget_exhausted"
+
+// Budget amounts are in minor units of Currency e.g. pesewas for GHS
+type Budget struct {
+	Total           int64  `json:"total" bson:"total"`
+	DailyCap        int64  `json:"daily_cap" bson:"daily_cap"`
+	Currency        string `json:"currency" bson:"currency"`
+	AlertThresholds []int  `json:"alert_thresholds" bson:"alert_thresholds"`
+}
+
+// SpendSummary is aggregated from the spend ledger on read
+type SpendSummary struct {
+	Total       int64   `json:"total"`
+	Today       int64   `json:"today"`
+	Remaining   int64   `json:"remaining"`
+	PercentUsed float64 `json:"percent_used"`
+}
+
+type SpendEntry struct {
+	ID          string    `json:"id" bson:"_id"`
+	CampaignID  string    `json:"campaign_id" bson:"campaign_id"`
+	Amount      int64     `json:"amount" bson:"amount"`
+	Currency    string    `json:"currency" bson:"currency"`
+	Description string    `json:"description" bson:"description"`
+	OccurredAt  time.Time `json:"occurred_at" bson:"occurred_at"`
+	CreatedBy   string    `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+}
+
+const (
+	BudgetAlertThreshold = "threshold"
+	BudgetAlertDailyCap  = "daily_cap"
+	BudgetAlertExhausted = "exhausted"
+)
+
+type BudgetAlert struct {
+	ID          string    `json:"id" bson:"_id"`
+	CampaignID  string    `json:"campaign_id" bson:"campaign_id"`
+	Type        string    `json:"type" bson:"type"`
+	Threshold   int       `json:"threshold" bson:"threshold"`
+	BudgetTotal int64     `json:"budget_total" bson:"budget_total"`
+	Spent       int64     `json:"spent" bson:"spent"`
+	Day         string    `json:"day,omitempty" bson:"day,omitempty"`
+	CreatedBy   string    `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Banner is an image uploaded through the api for a campaign.
+// URL fields are signed on read and never stored.
+type Banner struct {
+	Key         string          `json:"-" bson:"key"`
+	URL         string          `json:"url" bson:"-"`
+	ContentType string          `json:"content_type" bson:"content_type"`
+	Size        int64           `json:"size" bson:"size"`
+	Width       int             `json:"width" bson:"width"`
+	Height      int             `json:"height" bson:"height"`
+	Variants    []BannerVariant `json:"variants" bson:"variants"`
+	UploadedAt  time.Time       `json:"uploaded_at" bson:"uploaded_at"`
+}
+
+type BannerVariant struct {
+	Name        string `json:"name" bson:"name"`
+	Key         string `json:"-" bson:"key"`
+	URL         string `json:"url" bson:"-"`
+	ContentType string `json:"content_type" bson:"content_type"`
+	Size        int64  `json:"size" bson:"size"`
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+}
+
+// Asset is a file in an account's asset library.
+// Files are de-duplicated by checksum within the account.
+type Asset struct {
+	ID          string    `json:"id" bson:"_id"`
+	Name        string    `json:"name" bson:"name"`
+	Folder      string    `json:"folder" bson:"folder"`
+	Kind        string    `json:"kind" bson:"kind"`
+	Key         string    `json:"-" bson:"key"`
+	URL         string    `json:"url" bson:"-"`
+	ContentType string    `json:"content_type" bson:"content_type"`
+	Size        int64     `json:"size" bson:"size"`
+	Checksum    string    `json:"checksum" bson:"checksum"`
+	Width       int       `json:"width,omitempty" bson:"width,omitempty"`
+	Height      int       `json:"height,omitempty" bson:"height,omitempty"`
+	Tags        []string  `json:"tags" bson:"tags"`
+	CampaignIDs []string  `json:"campaign_ids" bson:"campaign_ids"`
+	RefCount    int       `json:"ref_count" bson:"-"`
+	CreatedBy   string    `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type Category struct {
+	ID          string    `json:"id" bson:"_id"`
+	Name        string    `json:"name" bson:"name"`
+	Description string    `json:"description" bson:"description"`
+	CreatedBy   string    `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	CustomFieldText   = "text"
+	CustomFieldNumber = "number"
+	CustomFieldDate   = "date"
+	CustomFieldEnum   = "enum"
+)
+
+// CustomField defines an extra campaign field for an account.
+// Values are stored under Campaign.CustomFields using Key.
+type CustomField struct {
+	ID        string    `json:"id" bson:"_id"`
+	Key       string    `json:"key" bson:"key"`
+	Label     string    `json:"label" bson:"label"`
+	Type      string    `json:"type" bson:"type"`
+	Options   []string  `json:"options,omitempty" bson:"options,omitempty"`
+	Required  bool      `json:"required" bson:"required"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	// GoalTypeCount tracks the running total of Metric e.g. 10,000 claims
+	GoalTypeCount = "count"
+
+	// GoalTypeRate tracks Metric as a percentage of Denominator e.g. 5% conversion
+	GoalTypeRate = "rate"
+)
+
+type Goal struct {
+	ID          string        `json:"id" bson:"_id"`
+	CampaignID  string        `json:"campaign_id" bson:"campaign_id"`
+	Name        string        `json:"name" bson:"name"`
+	Type        string        `json:"type" bson:"type"`
+	Metric      string        `json:"metric" bson:"metric"`
+	Denominator string        `json:"denominator,omitempty" bson:"denominator,omitempty"`
+	Target      float64       `json:"target" bson:"target"`
+	Deadline    time.Time     `json:"deadline" bson:"deadline"`
+	Progress    *GoalProgress `json:"progress,omitempty" bson:"-"`
+	CreatedBy   string        `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at" bson:"updated_at"`
+}
+
+// GoalProgress is computed from metric events on read
+type GoalProgress struct {
+	Current             float64    `json:"current"`
+	PercentComplete     float64    `json:"percent_complete"`
+	Completed           bool       `json:"completed"`
+	RunRatePerDay       float64    `json:"run_rate_per_day,omitempty"`
+	ProjectedCompletion *time.Time `json:"projected_completion"`
+	OnTrack             bool       `json:"on_track"`
+}
+
+type MetricEvent struct {
+	ID         string    `json:"id" bson:"_id"`
+	CampaignID string    `json:"campaign_id" bson:"campaign_id"`
+	Metric     string    `json:"metric" bson:"metric"`
+	Value      float64   `json:"value" bson:"value"`
+	OccurredAt time.Time `json:"occurred_at" bson:"occurred_at"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Contact is a recipient in an account's audience.
+// Email is stored lower cased and Msisdn as digits with the country code.
+type Contact struct {
+	ID         string                 `json:"id" bson:"_id"`
+	Name       string                 `json:"name" bson:"name"`
+	Email      string                 `json:"email,omitempty" bson:"email,omitempty"`
+	Msisdn     string                 `json:"msisdn,omitempty" bson:"msisdn,omitempty"`
+	Attributes map[string]interface{} `json:"attributes" bson:"attributes"`
+	Consent    Consent                `json:"consent" bson:"consent"`
+	TimeZone   string                 `json:"time_zone,omitempty" bson:"time_zone,omitempty"`
+	ListIDs    []string               `json:"list_ids" bson:"list_ids"`
+	Activity   map[string]time.Time   `json:"activity,omitempty" bson:"activity,omitempty"`
+	CreatedBy  string                 `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at" bson:"updated_at"`
+
+	EmailUndeliverable *Undeliverable `json:"email_undeliverable,omitempty" bson:"email_undeliverable,omitempty"`
+	SMSUndeliverable   *Undeliverable `json:"sms_undeliverable,omitempty" bson:"sms_undeliverable,omitempty"`
+}
+
+// Undeliverable is set from a hard bounce, complaint or undeliverable
+// receipt, the address or number is skipped by sends until it changes
+type Undeliverable struct {
+	Type   string    `json:"type" bson:"type"`
+	Reason string    `json:"reason" bson:"reason"`
+	At     time.Time `json:"at" bson:"at"`
+}
+
+type Consent struct {
+	Email bool `json:"email" bson:"email"`
+	SMS   bool `json:"sms" bson:"sms"`
+}
+
+type ContactList struct {
+	ID           string    `json:"id" bson:"_id"`
+	Name         string    `json:"name" bson:"name"`
+	Description  string    `json:"description" bson:"description"`
+	ContactCount int64     `json:"contact_count" bson:"-"`
+	CreatedBy    string    `json:"created_by" bson:"created_by"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Segment is a saved audience rule, its members are resolved on read
+type Segment struct {
+	ID           string      `json:"id" bson:"_id"`
+	Name         string      `json:"name" bson:"name"`
+	Description  string      `json:"description" bson:"description"`
+	Rule         SegmentRule `json:"rule" bson:"rule"`
+	ContactCount int64       `json:"contact_count" bson:"-"`
+	CreatedBy    string      `json:"created_by" bson:"created_by"`
+	CreatedAt    time.Time   `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at" bson:"updated_at"`
+}
+
+// SegmentRule is either a group combining Rules with Combinator (and, or)
+// or a condition comparing Field to Value with Operator.
+type SegmentRule struct {
+	Combinator string        `json:"combinator,omitempty" bson:"combinator,omitempty"`
+	Rules      []SegmentRule `json:"rules,omitempty" bson:"rules,omitempty"`
+	Field      string        `json:"field,omitempty" bson:"field,omitempty"`
+	Operator   string        `json:"operator,omitempty" bson:"operator,omitempty"`
+	Value      interface{}   `json:"value,omitempty" bson:"value,omitempty"`
+}
+
+// AudienceSnapshot records the audience a campaign was resolved to when it went live
+type AudienceSnapshot struct {
+	TakenAt      time.Time `json:"taken_at" bson:"taken_at"`
+	ContactCount int64     `json:"contact_count" bson:"contact_count"`
+}
+
+type AudienceMember struct {
+	CampaignID string    `json:"campaign_id" bson:"campaign_id"`
+	ContactID  string    `json:"contact_id" bson:"contact_id"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+const (
+	SMSStatusQueued  = "queued"
+	SMSStatusSending = "sending"
+	SMSStatusSent    = "sent"
+	SMSStatusFailed  = "failed"
+
+	// set from delivery receipts once the message has left
+	SMSStatusDelivered     = "delivered"
+	SMSStatusUndeliverable = "undeliverable"
+
+	// the number opted out after the message was queued
+	SMSStatusSuppressed = "suppressed"
+
+	// waiting for the campaign send window to open for the recipient
+	SMSStatusDeferred = "deferred"
+)
+
+// SMSMessage is one outbound text to one contact. A campaign send creates a
+// batch of them sharing BatchID.
+type SMSMessage struct {
+	ID                string     `json:"id" bson:"_id"`
+	CampaignID        string     `json:"campaign_id" bson:"campaign_id"`
+	BatchID           string     `json:"batch_id" bson:"batch_id"`
+	ContactID         string     `json:"contact_id" bson:"contact_id"`
+	To                string     `json:"to" bson:"to"`
+	TimeZone          string     `json:"time_zone,omitempty" bson:"time_zone,omitempty"`
+	From              string     `json:"from" bson:"from"`
+	Body              string     `json:"body" bson:"body"`
+	TemplateID        string     `json:"template_id,omitempty" bson:"template_id,omitempty"`
+	Variant           string     `json:"variant,omitempty" bson:"variant,omitempty"`
+	Encoding          string     `json:"encoding" bson:"encoding"`
+	Segments          int        `json:"segments" bson:"segments"`
+	Status            string     `json:"status" bson:"status"`
+	Provider          string     `json:"provider,omitempty" bson:"provider,omitempty"`
+	ProviderMessageID string     `json:"provider_message_id,omitempty" bson:"provider_message_id,omitempty"`
+	Attempts          int        `json:"attempts" bson:"attempts"`
+	LastError         string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt     time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	SentAt            *time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	ReceiptAt         *time.Time `json:"receipt_at,omitempty" bson:"receipt_at,omitempty"`
+	ErrorCode         string     `json:"error_code,omitempty" bson:"error_code,omitempty"`
+	CreatedBy         string     `json:"created_by" bson:"created_by"`
+	CreatedAt         time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+// SenderIdentity is an address an account sends campaign email from
+type SenderIdentity struct {
+	ID        string    `json:"id" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	Email     string    `json:"email" bson:"email"`
+	ReplyTo   string    `json:"reply_to" bson:"reply_to"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	EmailStatusQueued     = "queued"
+	EmailStatusSending    = "sending"
+	EmailStatusSent       = "sent"
+	EmailStatusFailed     = "failed"
+	EmailStatusBounced    = "bounced"
+	EmailStatusComplained = "complained"
+
+	// set from delivery receipts once the message has left
+	EmailStatusDelivered     = "delivered"
+	EmailStatusUndeliverable = "undeliverable"
+
+	// the address unsubscribed after the message was queued
+	EmailStatusSuppressed = "suppressed"
+
+	// waiting for the campaign send window to open for the recipient
+	EmailStatusDeferred = "deferred"
+
+	FeedbackBounce    = "bounce"
+	FeedbackComplaint = "complaint"
+)
+
+// EmailBatch holds the content of one campaign send, its messages refer to it
+type EmailBatch struct {
+	ID               string    `json:"id" bson:"_id"`
+	CampaignID       string    `json:"campaign_id" bson:"campaign_id"`
+	SenderIdentityID string    `json:"sender_identity_id" bson:"sender_identity_id"`
+	FromName         string    `json:"from_name" bson:"from_name"`
+	FromEmail        string    `json:"from_email" bson:"from_email"`
+	ReplyTo          string    `json:"reply_to" bson:"reply_to"`
+	Subject          string    `json:"subject" bson:"subject"`
+	HTML             string    `json:"html" bson:"html"`
+	Text             string    `json:"text" bson:"text"`
+	TemplateID       string    `json:"template_id,omitempty" bson:"template_id,omitempty"`
+	CreatedBy        string    `json:"created_by" bson:"created_by"`
+	CreatedAt        time.Time `json:"created_at" bson:"created_at"`
+}
+
+type EmailMessage struct {
+	ID            string     `json:"id" bson:"_id"`
+	CampaignID    string     `json:"campaign_id" bson:"campaign_id"`
+	BatchID       string     `json:"batch_id" bson:"batch_id"`
+	ContactID     string     `json:"contact_id" bson:"contact_id"`
+	To            string     `json:"to" bson:"to"`
+	Name          string     `json:"name" bson:"name"`
+	TimeZone      string     `json:"time_zone,omitempty" bson:"time_zone,omitempty"`
+	Variant       string     `json:"variant,omitempty" bson:"variant,omitempty"`
+	Status        string     `json:"status" bson:"status"`
+	Provider      string     `json:"provider,omitempty" bson:"provider,omitempty"`
+	MessageID     string     `json:"message_id,omitempty" bson:"message_id,omitempty"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	LastError     string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	ReceiptAt     *time.Time `json:"receipt_at,omitempty" bson:"receipt_at,omitempty"`
+	ErrorCode     string     `json:"error_code,omitempty" bson:"error_code,omitempty"`
+	CreatedBy     string     `json:"created_by" bson:"created_by"`
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+)
+
+// Job is a unit of background work. A worker leases it until LeaseExpiresAt,
+// a job whose lease runs out is handed to another worker.
+type Job struct {
+	ID             string                 `json:"id" bson:"_id"`
+	Type           string                 `json:"type" bson:"type"`
+	Payload        map[string]interface{} `json:"payload" bson:"payload"`
+	Status         string                 `json:"status" bson:"status"`
+	Attempts       int                    `json:"attempts" bson:"attempts"`
+	MaxAttempts    int                    `json:"max_attempts" bson:"max_attempts"`
+	RunAt          time.Time              `json:"run_at" bson:"run_at"`
+	LeaseOwner     string                 `json:"lease_owner,omitempty" bson:"lease_owner,omitempty"`
+	LeaseExpiresAt *time.Time             `json:"lease_expires_at,omitempty" bson:"lease_expires_at,omitempty"`
+	LastError      string                 `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	StartedAt      *time.Time             `json:"started_at,omitempty" bson:"started_at,omitempty"`
+	FinishedAt     *time.Time             `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+	CreatedBy      string                 `json:"created_by" bson:"created_by"`
+	CreatedAt      time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	ChannelSMS   = "sms"
+	ChannelEmail = "email"
+
+	TemplateChannelSMS   = ChannelSMS
+	TemplateChannelEmail = ChannelEmail
+)
+
+// Template is reusable message content with variables such as
+// {{.contact.first_name}}. For email Body is the html part and Text the
+// plain one, sms only uses Body. Defaults are keyed by variable e.g.
+// "contact.first_name": "there".
+type Template struct {
+	ID        string            `json:"id" bson:"_id"`
+	Name      string            `json:"name" bson:"name"`
+	Channel   string            `json:"channel" bson:"channel"`
+	Subject   string            `json:"subject,omitempty" bson:"subject,omitempty"`
+	Body      string            `json:"body" bson:"body"`
+	Text      string            `json:"text,omitempty" bson:"text,omitempty"`
+	Defaults  map[string]string `json:"defaults" bson:"defaults"`
+	Variables []string          `json:"variables" bson:"variables"`
+	CreatedBy string            `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	ReceiptDelivered     = "delivered"
+	ReceiptFailed        = "failed"
+	ReceiptUndeliverable = "undeliverable"
+)
+
+// DeliveryReceipt is a status callback from a provider for a message that
+// has left. MessageID is the provider message id for sms and the Message-ID
+// header for email. Receipts that arrive before the send is recorded stay
+// unapplied until it is.
+type DeliveryReceipt struct {
+	ID         string    `json:"id" bson:"_id"`
+	Channel    string    `json:"channel" bson:"channel"`
+	Provider   string    `json:"provider" bson:"provider"`
+	EventID    string    `json:"event_id" bson:"event_id"`
+	MessageID  string    `json:"message_id" bson:"message_id"`
+	Status     string    `json:"status" bson:"status"`
+	ErrorCode  string    `json:"error_code,omitempty" bson:"error_code,omitempty"`
+	Reason     string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	OccurredAt time.Time `json:"occurred_at" bson:"occurred_at"`
+	Applied    bool      `json:"applied" bson:"applied"`
+	CampaignID string    `json:"campaign_id,omitempty" bson:"campaign_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+const (
+	SuppressionReasonUnsubscribe = "unsubscribe"
+	SuppressionReasonStop        = "stop"
+	SuppressionReasonManual      = "manual"
+)
+
+// Suppression blocks every send on Channel to Address for the account that
+// owns it, whichever contact holds the address. Address is normalized the
+// way contacts are so lookups match.
+type Suppression struct {
+	ID         string    `json:"id" bson:"_id"`
+	Channel    string    `json:"channel" bson:"channel"`
+	Address    string    `json:"address" bson:"address"`
+	Reason     string    `json:"reason" bson:"reason"`
+	Source     string    `json:"source,omitempty" bson:"source,omitempty"`
+	CampaignID string    `json:"campaign_id,omitempty" bson:"campaign_id,omitempty"`
+	CreatedBy  string    `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+// LinkKindQR marks the link a campaign's QR codes encode, a campaign has at
+// most one and it follows the campaign's landing page
+const LinkKindQR = "qr"
+
+// Link is a short link served from /r/{code} that redirects to URL with the
+// UTM parameters added
+type Link struct {
+	ID         string    `json:"id" bson:"_id"`
+	Code       string    `json:"code" bson:"code"`
+	URL        string    `json:"url" bson:"url"`
+	Name       string    `json:"name,omitempty" bson:"name,omitempty"`
+	CampaignID string    `json:"campaign_id" bson:"campaign_id"`
+	UTM        *UTM      `json:"utm,omitempty" bson:"utm,omitempty"`
+	Kind       string    `json:"kind,omitempty" bson:"kind,omitempty"`
+	ShortURL   string    `json:"short_url" bson:"-"`
+	Clicks     int64     `json:"clicks" bson:"clicks,omitempty"`
+	CreatedBy  string    `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+type UTM struct {
+	Source   string `json:"source,omitempty" bson:"source,omitempty"`
+	Medium   string `json:"medium,omitempty" bson:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty" bson:"campaign,omitempty"`
+	Term     string `json:"term,omitempty" bson:"term,omitempty"`
+	Content  string `json:"content,omitempty" bson:"content,omitempty"`
+}
+
+// Click is one visit to a short link. ContactID is set when the link was
+// sent to a contact, Visitor tells anonymous visitors apart for unique
+// counts without keeping their address.
+type Click struct {
+	ID         string    `json:"id" bson:"_id"`
+	LinkID     string    `json:"link_id" bson:"link_id"`
+	Code       string    `json:"code" bson:"code"`
+	CampaignID string    `json:"campaign_id" bson:"campaign_id"`
+	ContactID  string    `json:"contact_id,omitempty" bson:"contact_id,omitempty"`
+	Visitor    string    `json:"-" bson:"visitor"`
+	Variant    string    `json:"variant,omitempty" bson:"variant,omitempty"`
+	UserAgent  string    `json:"user_agent" bson:"user_agent"`
+	Referrer   string    `json:"referrer,omitempty" bson:"referrer,omitempty"`
+	Bot        bool      `json:"bot" bson:"bot"`
+	CreatedBy  string    `json:"created_by" bson:"created_by"`
+	ClickedAt  time.Time `json:"clicked_at" bson:"clicked_at"`
+}
+
+const (
+	// EligibilityNewContacts only lets contacts who joined the audience
+	// after the campaign started claim
+	EligibilityNewContacts = "new_contacts"
+
+	// EligibilityMaxClaims caps the claims on the campaign Per msisdn, email
+	// or ip at Max
+	EligibilityMaxClaims = "max_claims"
+
+	// EligibilitySegment only lets contacts in segment SegmentID claim
+	EligibilitySegment = "segment"
+
+	// EligibilityHours only takes claims while Hours is open
+	EligibilityHours = "hours"
+)
+
+// EligibilityRule is one condition a claimant must meet, Type decides
+// which of the other fields apply. Message replaces the built in reason
+// shown to claimants that fail it.
+type EligibilityRule struct {
+	Type      string      `json:"type" bson:"type"`
+	SegmentID string      `json:"segment_id,omitempty" bson:"segment_id,omitempty"`
+	Per       string      `json:"per,omitempty" bson:"per,omitempty"`
+	Max       int64       `json:"max,omitempty" bson:"max,omitempty"`
+	Hours     *SendWindow `json:"hours,omitempty" bson:"hours,omitempty"`
+	Message   string      `json:"message,omitempty" bson:"message,omitempty"`
+}
+
+// EligibilityCheck is the outcome of one check on a claimant. Rule is the
+// index of the campaign eligibility rule, -1 for the checks every claim
+// goes through.
+type EligibilityCheck struct {
+	Rule   int    `json:"rule" bson:"rule"`
+	Type   string `json:"type" bson:"type"`
+	Passed bool   `json:"passed" bson:"passed"`
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+const (
+	// ClaimStatusReceived claims are waiting for a worker to check and fulfil them
+	ClaimStatusReceived = "received"
+
+	// ClaimStatusPending claims scored too risky and are held for review
+	ClaimStatusPending   = "pending"
+	ClaimStatusApproved  = "approved"
+	ClaimStatusRejected  = "rejected"
+	ClaimStatusFulfilled = "fulfilled"
+)
+
+const (
+	RiskIPVelocity        = "ip_velocity"
+	RiskDeviceVelocity    = "device_velocity"
+	RiskPrefixVelocity    = "msisdn_prefix_velocity"
+	RiskDisposableEmail   = "disposable_email"
+	RiskDuplicateIdentity = "duplicate_identity"
+)
+
+// Risk is how likely a claim is abuse, Score is the sum of the scores of
+// its Signals capped at 100
+type Risk struct {
+	Score   int          `json:"score" bson:"score"`
+	Signals []RiskSignal `json:"signals" bson:"signals"`
+}
+
+type RiskSignal struct {
+	Type   string `json:"type" bson:"type"`
+	Score  int    `json:"score" bson:"score"`
+	Detail string `json:"detail" bson:"detail"`
+}
+
+const (
+	ClaimCallbackQueued    = "queued"
+	ClaimCallbackDelivered = "delivered"
+	ClaimCallbackFailed    = "failed"
+)
+
+// Claim is a reward claimed on a campaign by a contact of its owner.
+// Reference is the public handle claimants check the status with. The
+// result is posted to CallbackURL once the claim has been processed.
+type Claim struct {
+	ID         string `json:"id" bson:"_id"`
+	Reference  string `json:"reference" bson:"reference"`
+	CampaignID string `json:"campaign_id" bson:"campaign_id"`
+	ContactID  string `json:"contact_id" bson:"contact_id"`
+	Name       string `json:"name,omitempty" bson:"name,omitempty"`
+	Msisdn     string `json:"msisdn,omitempty" bson:"msisdn,omitempty"`
+	Email      string `json:"email,omitempty" bson:"email,omitempty"`
+	Status     string `json:"status" bson:"status"`
+	Reason     string `json:"reason,omitempty" bson:"reason,omitempty"`
+	Code       string `json:"code,omitempty" bson:"code,omitempty"`
+	VoucherID  string `json:"voucher_id,omitempty" bson:"voucher_id,omitempty"`
+	Variant    string `json:"variant,omitempty" bson:"variant,omitempty"`
+
+	// Reserved is set while the claim holds a place in its limits
+	Reserved bool `json:"-" bson:"reserved,omitempty"`
+
+	// Eligibility explains why the claim was rejected by a rule
+	Eligibility []EligibilityCheck `json:"eligibility,omitempty" bson:"eligibility,omitempty"`
+
+	CallbackURL    string     `json:"callback_url,omitempty" bson:"callback_url,omitempty"`
+	CallbackStatus string     `json:"callback_status,omitempty" bson:"callback_status,omitempty"`
+	NotifiedAt     *time.Time `json:"notified_at,omitempty" bson:"notified_at,omitempty"`
+	IP             string     `json:"ip,omitempty" bson:"ip,omitempty"`
+	DeviceID       string     `json:"device_id,omitempty" bson:"device_id,omitempty"`
+	EmailKey       string     `json:"-" bson:"email_key,omitempty"`
+	MsisdnPrefix   string     `json:"-" bson:"msisdn_prefix,omitempty"`
+	Risk           *Risk      `json:"risk,omitempty" bson:"risk,omitempty"`
+	UserAgent      string     `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	CreatedBy      string     `json:"created_by" bson:"created_by"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	CodePoolSourceGenerated = "generated"
+	CodePoolSourceUploaded  = "uploaded"
+)
+
+// CodePool holds the voucher codes a campaign gives out with its claims.
+// Generated pools use Alphabet, Length and CheckDigit, uploaded pools hold
+// third party codes as given. Partners redeem codes with RedemptionKey,
+// which is only returned when it is created.
+type CodePool struct {
+	ID            string         `json:"id" bson:"_id"`
+	CampaignID    string         `json:"campaign_id" bson:"campaign_id"`
+	Name          string         `json:"name" bson:"name"`
+	Source        string         `json:"source" bson:"source"`
+	Prefix        string         `json:"prefix,omitempty" bson:"prefix,omitempty"`
+	Alphabet      string         `json:"alphabet,omitempty" bson:"alphabet,omitempty"`
+	Length        int            `json:"length,omitempty" bson:"length,omitempty"`
+	CheckDigit    bool           `json:"check_digit" bson:"check_digit"`
+	KeyHash       string         `json:"-" bson:"key_hash"`
+	RedemptionKey string         `json:"redemption_key,omitempty" bson:"-"`
+	Counts        *VoucherCounts `json:"counts,omitempty" bson:"-"`
+	CreatedBy     string         `json:"created_by" bson:"created_by"`
+	CreatedAt     time.Time      `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" bson:"updated_at"`
+}
+
+type VoucherCounts struct {
+	Total     int64 `json:"total"`
+	Available int64 `json:"available"`
+	Issued    int64 `json:"issued"`
+	Redeemed  int64 `json:"redeemed"`
+	Void      int64 `json:"void"`
+}
+
+const (
+	VoucherStatusAvailable = "available"
+	VoucherStatusIssued    = "issued"
+	VoucherStatusRedeemed  = "redeemed"
+	VoucherStatusVoid      = "void"
+)
+
+// Voucher is one code of a pool. It is issued to at most one claim and
+// redeemed at most once.
+type Voucher struct {
+	ID         string     `json:"id" bson:"_id"`
+	PoolID     string     `json:"pool_id" bson:"pool_id"`
+	CampaignID string     `json:"campaign_id" bson:"campaign_id"`
+	Code       string     `json:"code" bson:"code"`
+	Status     string     `json:"status" bson:"status"`
+	ClaimID    string     `json:"claim_id,omitempty" bson:"claim_id,omitempty"`
+	ContactID  string     `json:"contact_id,omitempty" bson:"contact_id,omitempty"`
+	IssuedAt   *time.Time `json:"issued_at,omitempty" bson:"issued_at,omitempty"`
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty" bson:"redeemed_at,omitempty"`
+	Location   string     `json:"location,omitempty" bson:"location,omitempty"`
+	CreatedBy  string     `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+}
+
+// ReferralSettings make a campaign a referral programme. Users get a code
+// for it and whoever signs up with the code is attributed to them. Rewards
+// are earned up the chain of referrers, level 1 being the direct referrer,
+// and are credited as points when the campaign has points enabled.
+type ReferralSettings struct {
+	Enabled bool                 `json:"enabled" bson:"enabled"`
+	Rewards []ReferralRewardRule `json:"rewards" bson:"rewards"`
+}
+
+type ReferralRewardRule struct {
+	Level       int    `json:"level" bson:"level"`
+	Amount      int64  `json:"amount" bson:"amount"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+}
+
+// ReferralCode is a user's code for one campaign
+type ReferralCode struct {
+	ID         string    `json:"id" bson:"_id"`
+	CampaignID string    `json:"campaign_id" bson:"campaign_id"`
+	UserID     string    `json:"user_id" bson:"user_id"`
+	Code       string    `json:"code" bson:"code"`
+	Referrals  int64     `json:"referrals" bson:"referrals"`
+	Earned     int64     `json:"earned" bson:"earned"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Referral attributes a signup to the code it used. Chain holds the
+// referrers that earn from it, nearest first.
+type Referral struct {
+	ID         string           `json:"id" bson:"_id"`
+	CampaignID string           `json:"campaign_id" bson:"campaign_id"`
+	Code       string           `json:"code" bson:"code"`
+	ReferrerID string           `json:"referrer_id" bson:"referrer_id"`
+	UserID     string           `json:"user_id" bson:"user_id"`
+	Chain      []string         `json:"chain" bson:"chain"`
+	Rewards    []ReferralReward `json:"rewards" bson:"rewards"`
+	CreatedBy  string           `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time        `json:"created_at" bson:"created_at"`
+}
+
+// ReferralReward is what one referrer in the chain earned from a signup
+type ReferralReward struct {
+	Level       int    `json:"level" bson:"level"`
+	UserID      string `json:"user_id" bson:"user_id"`
+	Amount      int64  `json:"amount" bson:"amount"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+}
+
+const (
+	// PointsActionReferral credits referral rewards, PointsActionAdjustment
+	// is an owner's correction. Neither needs to be configured.
+	PointsActionReferral   = "referral"
+	PointsActionAdjustment = "adjustment"
+
+	LeaderboardDaily   = "daily"
+	LeaderboardWeekly  = "weekly"
+	LeaderboardAllTime = "all_time"
+)
+
+// PointsSettings make a campaign earn points for the actions it lists.
+// Daily and weekly leaderboards roll over at midnight in TimeZone, UTC when
+// not set, weeks start on Monday.
+type PointsSettings struct {
+	Enabled  bool          `json:"enabled" bson:"enabled"`
+	Actions  []PointAction `json:"actions" bson:"actions"`
+	TimeZone string        `json:"time_zone,omitempty" bson:"time_zone,omitempty"`
+}
+
+// PointAction is what one action is worth. DailyLimit caps how often a user
+// earns it a day, 0 for no cap.
+type PointAction struct {
+	Action      string `json:"action" bson:"action"`
+	Points      int64  `json:"points" bson:"points"`
+	DailyLimit  int64  `json:"daily_limit" bson:"daily_limit"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+}
+
+// PointsEntry is a line of the ledger. Entries are never changed, a
+// correction is an adjustment entry. Reference makes an award idempotent.
+type PointsEntry struct {
+	ID         string    `json:"id" bson:"_id"`
+	CampaignID string    `json:"campaign_id" bson:"campaign_id"`
+	UserID     string    `json:"user_id" bson:"user_id"`
+	Action     string    `json:"action" bson:"action"`
+	Points     int64     `json:"points" bson:"points"`
+	Reference  string    `json:"reference,omitempty" bson:"reference,omitempty"`
+	Note       string    `json:"note,omitempty" bson:"note,omitempty"`
+	CreatedBy  string    `json:"created_by" bson:"created_by"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+// PointsTotal is a user's score in one leaderboard period, kept up to date
+// as entries are added so rankings do not scan the ledger. ReachedAt breaks
+// ties: whoever got to the score first ranks higher.
+type PointsTotal struct {
+	ID         string    `json:"-" bson:"_id"`
+	CampaignID string    `json:"campaign_id" bson:"campaign_id"`
+	Period     string    `json:"period" bson:"period"`
+	UserID     string    `json:"user_id" bson:"user_id"`
+	Points     int64     `json:"points" bson:"points"`
+	ReachedAt  time.Time `json:"reached_at" bson:"reached_at"`
+}
+
+const (
+	// ExperimentMetricClicks is the share of delivered messages whose
+	// recipient clicked
+	ExperimentMetricClicks = "clicks"
+
+	// ExperimentMetricClaims is the share of delivered messages that led
+	// to a claim
+	ExperimentMetricClaims = "claims"
+
+	// ExperimentMetricConversion is the share of visitors who claimed, for
+	// testing landing page banners
+	ExperimentMetricConversion = "conversion"
+)
+
+// Experiment splits a campaign's contacts between variants by Weight and
+// compares them on Metric. Once Winner is set every contact gets it. With
+// AutoPromote the variant that wins at Confidence is promoted when every
+// variant has reached MinSample.
+type Experiment struct {
+	Enabled     bool                `json:"enabled" bson:"enabled"`
+	Metric      string              `json:"metric" bson:"metric"`
+	Variants    []ExperimentVariant `json:"variants" bson:"variants"`
+	Confidence  float64             `json:"confidence" bson:"confidence"`
+	MinSample   int64               `json:"min_sample" bson:"min_sample"`
+	AutoPromote bool                `json:"auto_promote" bson:"auto_promote"`
+	Winner      string              `json:"winner,omitempty" bson:"winner,omitempty"`
+	PromotedAt  *time.Time          `json:"promoted_at,omitempty" bson:"promoted_at,omitempty"`
+	StartedAt   time.Time           `json:"started_at" bson:"started_at"`
+
+	// JobID is the evaluation job that may promote the winner, older ones
+	// left queued by an earlier setup stop when they see it changed
+	JobID string `json:"-" bson:"job_id,omitempty"`
+}
+
+// ExperimentVariant is one arm of an experiment. The first variant is the
+// control the others are compared with. Empty fields keep the campaign's
+// own text or banner.
+type ExperimentVariant struct {
+	Key           string `json:"key" bson:"key"`
+	Name          string `json:"name,omitempty" bson:"name,omitempty"`
+	Weight        int    `json:"weight" bson:"weight"`
+	SMSBody       string `json:"sms_body,omitempty" bson:"sms_body,omitempty"`
+	EmailSubject  string `json:"email_subject,omitempty" bson:"email_subject,omitempty"`
+	BannerAssetID string `json:"banner_asset_id,omitempty" bson:"banner_asset_id,omitempty"`
 }
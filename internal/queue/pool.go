@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"campaign/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Handler runs one job. ctx is cancelled when the pool shuts down or the
+// lease is lost, a handler should stop and return ctx.Err() then. Returning
+// an error wrapping ErrPermanent dead-letters the job, any other error
+// retries it.
+type Handler func(ctx context.Context, job models.Job) error
+
+// store is the part of Queue the pool works against
+type store interface {
+	Lease(ctx context.Context, owner string, types []string) (models.Job, error)
+	Extend(ctx context.Context, job models.Job) error
+	Ack(ctx context.Context, job models.Job) error
+	Fail(ctx context.Context, job models.Job, err error) error
+	Release(ctx context.Context, job models.Job) error
+	Reap(ctx context.Context) error
+}
+
+// Pool runs registered handlers on leased jobs with Concurrency workers
+type Pool struct {
+	store    store
+	handlers map[string]Handler
+
+	Concurrency  int
+	PollInterval time.Duration
+	Heartbeat    time.Duration
+}
+
+func NewPool(q *Queue, concurrency int) *Pool {
+	return &Pool{
+		store:        q,
+		handlers:     map[string]Handler{},
+		Concurrency:  concurrency,
+		PollInterval: time.Second,
+		Heartbeat:    q.Visibility / 3,
+	}
+}
+
+// Register sets the handler for a job type, it must be called before Run
+func (p *Pool) Register(jobType string, h Handler) {
+	p.handlers[jobType] = h
+}
+
+// Run works the queue until ctx is cancelled and every running job has been
+// handed back
+func (p *Pool) Run(ctx context.Context) {
+	types := []string{}
+
+	for t := range p.handlers {
+		types = append(types, t)
+	}
+
+	host, _ := os.Hostname()
+	wg := sync.WaitGroup{}
+
+	slog.Info("Starting job workers", "Concurrency", p.Concurrency, "Types", types)
+
+	for i := 0; i < p.Concurrency; i++ {
+		owner := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), i)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			p.work(ctx, owner, types)
+		}()
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		p.reap(ctx)
+	}()
+
+	wg.Wait()
+
+	slog.Info("Job workers stopped")
+}
+
+func (p *Pool) work(ctx context.Context, owner string, types []string) {
+	for ctx.Err() == nil {
+		job, err := p.store.Lease(ctx, owner, types)
+
+		if err == nil {
+			p.run(ctx, job)
+			continue
+		}
+
+		if !errors.Is(err, mongo.ErrNoDocuments) && ctx.Err() == nil {
+			slog.Error("Error leasing job", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.PollInterval):
+		}
+	}
+}
+
+// run calls the job's handler while keeping its lease alive and settles the
+// job with the outcome
+func (p *Pool) run(ctx context.Context, job models.Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lost := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(p.Heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := p.store.Extend(context.Background(), job)
+
+				if errors.Is(err, ErrLeaseLost) {
+					close(lost)
+					cancel()
+
+					return
+				}
+
+				if err != nil {
+					slog.Error("Error extending job lease", "job", job.ID, "error", err)
+				}
+			}
+		}
+	}()
+
+	err := p.call(jobCtx, job)
+	close(done)
+
+	// settle with a fresh context, the job's may be cancelled by now
+	settleCtx := context.Background()
+
+	select {
+	case <-lost:
+		slog.Warn("Job lease lost", "job", job.ID, "type", job.Type)
+
+		return
+	default:
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		err = p.store.Release(settleCtx, job)
+	case err == nil:
+		err = p.store.Ack(settleCtx, job)
+	default:
+		slog.Error("Job failed", "job", job.ID, "type", job.Type, "attempt", job.Attempts, "error", err)
+
+		err = p.store.Fail(settleCtx, job, err)
+	}
+
+	if err != nil {
+		slog.Error("Error settling job", "job", job.ID, "error", err)
+	}
+}
+
+// call runs the handler, a panic fails the job rather than the process
+func (p *Pool) call(ctx context.Context, job models.Job) (err error) {
+	h, ok := p.handlers[job.Type]
+
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for job type %s", job.Type))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	return h(ctx, job)
+}
+
+func (p *Pool) reap(ctx context.Context) {
+	for {
+		if err := p.store.Reap(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Error reaping jobs", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.Heartbeat):
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package queue
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/joho/godotenv/autoload"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrPermanent marks a job failure that will not succeed on retry, the job
+// is dead-lettered straight away
+var ErrPermanent = errors.New("permanent job failure")
+
+// ErrLeaseLost is returned when a worker acks or fails a job it no longer
+// holds, another worker has taken it over after the lease expired
+var ErrLeaseLost = errors.New("job lease lost")
+
+var (
+	// workers is how many jobs run at once in this process
+	workers, _ = strconv.Atoi(os.Getenv("QUEUE_WORKERS"))
+
+	// visibility is how long a leased job stays hidden from other workers
+	// without a heartbeat, e.g. 5m
+	visibility, _ = time.ParseDuration(os.Getenv("QUEUE_VISIBILITY_TIMEOUT"))
+)
+
+const DefaultMaxAttempts = 5
+
+// Options tune a single job, zero values fall back to the queue defaults
+type Options struct {
+	MaxAttempts int
+	RunAt       time.Time
+
+	// CreatedBy owns the job when ctx carries no user, e.g. a job that a
+	// running job enqueues to carry on later
+	CreatedBy string
+}
+
+// Queue stores jobs in the jobs collection. Jobs are leased rather than
+// removed so a worker that dies mid-job only hides it until the lease expires.
+type Queue struct {
+	db *mongo.Database
+
+	Visibility  time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func New(db *mongo.Database) *Queue {
+	q := &Queue{
+		db:          db,
+		Visibility:  5 * time.Minute,
+		BaseBackoff: 10 * time.Second,
+		MaxBackoff:  10 * time.Minute,
+	}
+
+	if visibility > 0 {
+		q.Visibility = visibility
+	}
+
+	return q
+}
+
+// Workers is the configured pool size, QUEUE_WORKERS or 4
+func Workers() int {
+	if workers > 0 {
+		return workers
+	}
+
+	return 4
+}
+
+func Permanent(err error) error {
+	return errors.Join(ErrPermanent, err)
+}
+
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrPermanent)
+}
+
+func (q *Queue) collection(ctx context.Context) database.Database {
+	return database.NewDatabaseService(ctx, q.db, models.JobsCollection)
+}
+
+// Enqueue stores a job for the pool to pick up. The job is owned by the user
+// in ctx, if any, so it shows up in their job list.
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload map[string]interface{}, opts Options) (models.Job, error) {
+	now := time.Now().Local()
+
+	job := models.Job{
+		ID:          primitive.NewObjectID().Hex(),
+		Type:        jobType,
+		Payload:     payload,
+		Status:      models.JobStatusQueued,
+		MaxAttempts: opts.MaxAttempts,
+		RunAt:       opts.RunAt.Local(),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if user, err := jwt.GetAuthContext(ctx); err == nil {
+		job.CreatedBy = user.Sub
+	} else {
+		job.CreatedBy = opts.CreatedBy
+	}
+
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if opts.RunAt.IsZero() {
+		job.RunAt = now
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(job.ID)
+
+	err := q.collection(ctx).InsertOne(bson.M{
+		"_id":          objid,
+		"type":         job.Type,
+		"payload":      job.Payload,
+		"status":       job.Status,
+		"attempts":     0,
+		"max_attempts": job.MaxAttempts,
+		"run_at":       job.RunAt,
+		"created_by":   job.CreatedBy,
+		"created_at":   job.CreatedAt,
+		"updated_at":   job.UpdatedAt,
+	})
+
+	return job, err
+}
+
+// Lease claims the oldest due job of one of the given types for owner, or a
+// running one whose lease has expired. It returns mongo.ErrNoDocuments when
+// there is nothing to do.
+func (q *Queue) Lease(ctx context.Context, owner string, types []string) (models.Job, error) {
+	job := models.Job{}
+	now := time.Now().Local()
+
+	err := q.collection(ctx).FindOneAndUpdate(bson.M{
+		"type": bson.M{"$in": types},
+		"$or": []bson.M{
+			{"status": models.JobStatusQueued, "run_at": bson.M{"$lte": now}},
+			{"status": models.JobStatusRunning, "lease_expires_at": bson.M{"$lte": now}},
+		},
+		"$expr": bson.M{"$lt": []string{"$attempts", "$max_attempts"}},
+	}, bson.M{
+		"$set": bson.M{
+			"status":           models.JobStatusRunning,
+			"lease_owner":      owner,
+			"lease_expires_at": now.Add(q.Visibility),
+			"started_at":       now,
+			"updated_at":       now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After), &job)
+
+	return job, err
+}
+
+// Extend pushes the lease of a running job forward, long jobs call it as a
+// heartbeat so they are not handed to another worker
+func (q *Queue) Extend(ctx context.Context, job models.Job) error {
+	now := time.Now().Local()
+
+	return q.settle(ctx, job, bson.M{"lease_expires_at": now.Add(q.Visibility), "updated_at": now})
+}
+
+// Ack marks a job done
+func (q *Queue) Ack(ctx context.Context, job models.Job) error {
+	now := time.Now().Local()
+
+	return q.settle(ctx, job, bson.M{
+		"status":      models.JobStatusSucceeded,
+		"finished_at": now,
+		"last_error":  "",
+		"updated_at":  now,
+	}, "lease_owner", "lease_expires_at")
+}
+
+// Fail records err on the job and queues it again after a backoff, or
+// dead-letters it when err is permanent or it is out of attempts
+func (q *Queue) Fail(ctx context.Context, job models.Job, err error) error {
+	now := time.Now().Local()
+	update := bson.M{"last_error": err.Error(), "updated_at": now}
+
+	if dead, runAt := q.retry(job, err, now); dead {
+		update["status"] = models.JobStatusDead
+		update["finished_at"] = now
+	} else {
+		update["status"] = models.JobStatusQueued
+		update["run_at"] = runAt
+	}
+
+	return q.settle(ctx, job, update, "lease_owner", "lease_expires_at")
+}
+
+// Release hands a job back without counting the attempt, a worker that is
+// shutting down releases what it was running
+func (q *Queue) Release(ctx context.Context, job models.Job) error {
+	c := q.collection(ctx)
+	objid, _ := primitive.ObjectIDFromHex(job.ID)
+
+	err := c.FindOneAndUpdate(bson.M{"_id": objid, "status": models.JobStatusRunning, "lease_owner": job.LeaseOwner}, bson.M{
+		"$set":   bson.M{"status": models.JobStatusQueued, "run_at": time.Now().Local(), "updated_at": time.Now().Local()},
+		"$unset": bson.M{"lease_owner": "", "lease_expires_at": ""},
+		"$inc":   bson.M{"attempts": -1},
+	}, nil, &models.Job{})
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrLeaseLost
+	}
+
+	return err
+}
+
+// Reap dead-letters running jobs whose lease expired on their last attempt,
+// Lease will not hand them out again
+func (q *Queue) Reap(ctx context.Context) error {
+	now := time.Now().Local()
+
+	return q.collection(ctx).UpdateManyRaw(bson.M{
+		"status":           models.JobStatusRunning,
+		"lease_expires_at": bson.M{"$lte": now},
+		"$expr":            bson.M{"$gte": []string{"$attempts", "$max_attempts"}},
+	}, bson.M{
+		"$set": bson.M{
+			"status":      models.JobStatusDead,
+			"last_error":  "lease expired on the last attempt",
+			"finished_at": now,
+			"updated_at":  now,
+		},
+		"$unset": bson.M{"lease_owner": "", "lease_expires_at": ""},
+	})
+}
+
+// retry decides what happens to a failed job, a dead job is not run again
+func (q *Queue) retry(job models.Job, err error, now time.Time) (bool, time.Time) {
+	if IsPermanent(err) || job.Attempts >= job.MaxAttempts {
+		return true, time.Time{}
+	}
+
+	return false, now.Add(utils.Backoff(job.Attempts, q.BaseBackoff, q.MaxBackoff))
+}
+
+// settle updates a job only while owner still holds its lease
+func (q *Queue) settle(ctx context.Context, job models.Job, set bson.M, unset ...string) error {
+	c := q.collection(ctx)
+	objid, _ := primitive.ObjectIDFromHex(job.ID)
+	update := bson.M{"$set": set}
+
+	if len(unset) > 0 {
+		fields := bson.M{}
+
+		for _, f := range unset {
+			fields[f] = ""
+		}
+
+		update["$unset"] = fields
+	}
+
+	err := c.FindOneAndUpdate(bson.M{
+		"_id":         objid,
+		"status":      models.JobStatusRunning,
+		"lease_owner": job.LeaseOwner,
+	}, update, nil, &models.Job{})
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrLeaseLost
+	}
+
+	return err
+}
@@ -0,0 +1,217 @@
+package queue
+
+import (
+	"campaign/internal/models"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memStore keeps jobs in memory and records how each was settled
+type memStore struct {
+	mu       sync.Mutex
+	jobs     []models.Job
+	settled  map[string]string
+	errors   map[string]error
+	extended int
+}
+
+func newMemStore(jobs ...models.Job) *memStore {
+	return &memStore{jobs: jobs, settled: map[string]string{}, errors: map[string]error{}}
+}
+
+func (m *memStore) Lease(ctx context.Context, owner string, types []string) (models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.jobs) == 0 {
+		return models.Job{}, mongo.ErrNoDocuments
+	}
+
+	job := m.jobs[0]
+	m.jobs = m.jobs[1:]
+	job.LeaseOwner = owner
+	job.Attempts++
+
+	return job, nil
+}
+
+func (m *memStore) settle(job models.Job, how string, err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.settled[job.ID] = how
+	m.errors[job.ID] = err
+
+	return nil
+}
+
+func (m *memStore) Extend(ctx context.Context, job models.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.extended++
+
+	return nil
+}
+
+func (m *memStore) Ack(ctx context.Context, job models.Job) error {
+	return m.settle(job, "ack", nil)
+}
+
+func (m *memStore) Fail(ctx context.Context, job models.Job, err error) error {
+	return m.settle(job, "fail", err)
+}
+
+func (m *memStore) Release(ctx context.Context, job models.Job) error {
+	return m.settle(job, "release", nil)
+}
+
+func (m *memStore) Reap(ctx context.Context) error {
+	return nil
+}
+
+func (m *memStore) outcome(id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.settled[id], m.errors[id]
+}
+
+func testPool(s *memStore) *Pool {
+	return &Pool{
+		store:        s,
+		handlers:     map[string]Handler{},
+		Concurrency:  2,
+		PollInterval: 5 * time.Millisecond,
+		Heartbeat:    5 * time.Millisecond,
+	}
+}
+
+// runUntil runs the pool until every job has been settled
+func runUntil(t *testing.T, p *Pool, s *memStore, ids ...string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	go func() {
+		p.Run(ctx)
+		close(stopped)
+	}()
+
+	deadline := time.After(2 * time.Second)
+
+	for done := false; !done; {
+		done = true
+
+		for _, id := range ids {
+			if how, _ := s.outcome(id); how == "" {
+				done = false
+			}
+		}
+
+		select {
+		case <-deadline:
+			t.Fatal("jobs were not settled in time")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-stopped
+}
+
+func TestPoolSettlesJobs(t *testing.T) {
+	s := newMemStore(
+		models.Job{ID: "ok", Type: "test"},
+		models.Job{ID: "retry", Type: "test"},
+		models.Job{ID: "panic", Type: "test"},
+		models.Job{ID: "unknown", Type: "other"},
+	)
+
+	p := testPool(s)
+	p.Register("test", func(ctx context.Context, job models.Job) error {
+		switch job.ID {
+		case "retry":
+			return errors.New("provider unavailable")
+		case "panic":
+			panic("boom")
+		}
+
+		return nil
+	})
+
+	runUntil(t, p, s, "ok", "retry", "panic", "unknown")
+
+	if how, _ := s.outcome("ok"); how != "ack" {
+		t.Errorf("expected ok to be acked; got %s", how)
+	}
+
+	if how, err := s.outcome("retry"); how != "fail" || IsPermanent(err) {
+		t.Errorf("expected retry to fail with a retryable error; got %s %v", how, err)
+	}
+
+	if how, err := s.outcome("panic"); how != "fail" || err == nil {
+		t.Errorf("expected a panic to fail the job; got %s %v", how, err)
+	}
+
+	if how, err := s.outcome("unknown"); how != "fail" || !IsPermanent(err) {
+		t.Errorf("expected an unknown type to be dead-lettered; got %s %v", how, err)
+	}
+}
+
+func TestPoolReleasesOnShutdown(t *testing.T) {
+	s := newMemStore(models.Job{ID: "long", Type: "test"})
+	started := make(chan struct{})
+
+	p := testPool(s)
+	p.Register("test", func(ctx context.Context, job models.Job) error {
+		close(started)
+		<-ctx.Done()
+
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+
+	go func() {
+		p.Run(ctx)
+		close(stopped)
+	}()
+
+	<-started
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-stopped
+
+	if how, _ := s.outcome("long"); how != "release" {
+		t.Errorf("expected a job interrupted by shutdown to be released; got %s", how)
+	}
+
+	if s.extended == 0 {
+		t.Error("expected the lease of a long job to be extended")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	q := &Queue{BaseBackoff: time.Second, MaxBackoff: time.Minute}
+	now := time.Now()
+
+	dead, runAt := q.retry(models.Job{Attempts: 1, MaxAttempts: 3}, errors.New("timeout"), now)
+
+	if dead || !runAt.After(now) {
+		t.Errorf("expected a retry after a backoff; got dead=%v at %v", dead, runAt)
+	}
+
+	if dead, _ := q.retry(models.Job{Attempts: 3, MaxAttempts: 3}, errors.New("timeout"), now); !dead {
+		t.Error("expected a job out of attempts to be dead-lettered")
+	}
+
+	if dead, _ := q.retry(models.Job{Attempts: 1, MaxAttempts: 3}, Permanent(errors.New("bad payload")), now); !dead {
+		t.Error("expected a permanent error to dead-letter the job")
+	}
+}
@@ -0,0 +1,185 @@
+package sendwindow
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	// zones are looked up by name for every recipient, the host may not
+	// have a zoneinfo database
+	_ "time/tzdata"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+var ErrInvalid = errors.New("invalid send window")
+
+var defaultTimeZone = os.Getenv("DEFAULT_TIME_ZONE")
+
+// Days are the weekday names a window accepts, in time.Weekday order
+var Days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var locations sync.Map
+
+// Normalize checks w and returns it with its days lower cased and in week
+// order. A nil window stays nil, campaigns without one send at any hour.
+func Normalize(w *models.SendWindow) (*models.SendWindow, error) {
+	if w == nil {
+		return nil, nil
+	}
+
+	out := *w
+	out.Start = strings.TrimSpace(w.Start)
+	out.End = strings.TrimSpace(w.End)
+	out.TimeZone = strings.TrimSpace(w.TimeZone)
+
+	start, err := clock(out.Start)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: start must be a time like 09:00", ErrInvalid)
+	}
+
+	end, err := clock(out.End)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: end must be a time like 20:00", ErrInvalid)
+	}
+
+	if start == end {
+		return nil, fmt.Errorf("%w: start and end must differ", ErrInvalid)
+	}
+
+	days := []string{}
+
+	for _, d := range w.Days {
+		d = strings.ToLower(strings.TrimSpace(d))
+
+		if len(d) > 3 {
+			d = d[:3]
+		}
+
+		if !slices.Contains(Days, d) {
+			return nil, fmt.Errorf("%w: unknown day %q", ErrInvalid, d)
+		}
+
+		if !slices.Contains(days, d) {
+			days = append(days, d)
+		}
+	}
+
+	slices.SortFunc(days, func(a, b string) int {
+		return slices.Index(Days, a) - slices.Index(Days, b)
+	})
+
+	out.Days = days
+
+	if out.TimeZone != "" {
+		if _, err := time.LoadLocation(out.TimeZone); err != nil {
+			return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalid, out.TimeZone)
+		}
+	}
+
+	return &out, nil
+}
+
+// clock parses "15:04" into minutes after midnight
+func clock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Next returns when a message may go out at or after now: now itself while
+// the window is open, else the moment it next opens. A window whose end is
+// before its start runs past midnight and belongs to the day it starts on.
+func Next(w *models.SendWindow, loc *time.Location, now time.Time) time.Time {
+	if w == nil {
+		return now
+	}
+
+	start, err := clock(w.Start)
+
+	if err != nil {
+		return now
+	}
+
+	end, err := clock(w.End)
+
+	if err != nil {
+		return now
+	}
+
+	local := now.In(loc)
+	y, m, d := local.Date()
+
+	// yesterday first, its window may still be open past midnight
+	for day := -1; day <= 7; day++ {
+		date := time.Date(y, m, d+day, 0, 0, 0, 0, loc)
+
+		if len(w.Days) > 0 && !slices.Contains(w.Days, Days[date.Weekday()]) {
+			continue
+		}
+
+		open := at(date, start)
+		close := at(date, end)
+
+		if end < start {
+			close = at(date.AddDate(0, 0, 1), end)
+		}
+
+		if local.Before(open) {
+			return open
+		}
+
+		if local.Before(close) {
+			return now
+		}
+	}
+
+	return now
+}
+
+func at(date time.Time, minutes int) time.Time {
+	y, m, d := date.Date()
+
+	return time.Date(y, m, d, minutes/60, minutes%60, 0, 0, date.Location())
+}
+
+// Location is the zone a recipient is messaged in: their own, the one their
+// msisdn implies, the window's and lastly DEFAULT_TIME_ZONE or the server's
+func Location(w *models.SendWindow, timeZone, msisdn string) *time.Location {
+	candidates := []string{timeZone, FromMsisdn(msisdn)}
+
+	if w != nil {
+		candidates = append(candidates, w.TimeZone)
+	}
+
+	candidates = append(candidates, defaultTimeZone)
+
+	for _, name := range candidates {
+		if name == "" {
+			continue
+		}
+
+		if loc, ok := locations.Load(name); ok {
+			return loc.(*time.Location)
+		}
+
+		if loc, err := time.LoadLocation(name); err == nil {
+			locations.Store(name, loc)
+
+			return loc
+		}
+	}
+
+	return time.Local
+}
@@ -0,0 +1,122 @@
+package sendwindow
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	w, err := Normalize(&models.SendWindow{Start: "09:00", End: "20:00", Days: []string{"Friday", "mon", "MON"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(w.Days, []string{"mon", "fri"}) {
+		t.Errorf("expected days short, unique and in week order; got %v", w.Days)
+	}
+
+	invalid := []models.SendWindow{
+		{Start: "9am", End: "20:00"},
+		{Start: "09:00", End: "09:00"},
+		{Start: "09:00", End: "20:00", Days: []string{"someday"}},
+		{Start: "09:00", End: "20:00", TimeZone: "Mars/Olympus_Mons"},
+	}
+
+	for _, tt := range invalid {
+		if _, err := Normalize(&tt); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %+v to be invalid; got %v", tt, err)
+		}
+	}
+
+	if w, err := Normalize(nil); w != nil || err != nil {
+		t.Errorf("expected no window to stay nil; got %v %v", w, err)
+	}
+}
+
+func TestNext(t *testing.T) {
+	accra, _ := time.LoadLocation("Africa/Accra")
+	window := &models.SendWindow{Start: "09:00", End: "20:00"}
+
+	// Wednesday 3 April 2024
+	at := func(hour, minute int) time.Time { return time.Date(2024, 4, 3, hour, minute, 0, 0, accra) }
+
+	tests := []struct {
+		name     string
+		window   *models.SendWindow
+		now      time.Time
+		expected time.Time
+	}{
+		{"no window", nil, at(3, 0), at(3, 0)},
+		{"open", window, at(12, 0), at(12, 0)},
+		{"before opening", window, at(3, 0), at(9, 0)},
+		{"after closing", window, at(21, 0), at(9, 0).AddDate(0, 0, 1)},
+		{"at closing", window, at(20, 0), at(9, 0).AddDate(0, 0, 1)},
+		{"overnight open after midnight", &models.SendWindow{Start: "22:00", End: "02:00"}, at(1, 0), at(1, 0)},
+		{"overnight closed", &models.SendWindow{Start: "22:00", End: "02:00"}, at(3, 0), at(22, 0)},
+		{"skips days", &models.SendWindow{Start: "09:00", End: "20:00", Days: []string{"mon"}}, at(12, 0), at(9, 0).AddDate(0, 0, 5)},
+	}
+
+	for _, tt := range tests {
+		if got := Next(tt.window, accra, tt.now); !got.Equal(tt.expected) {
+			t.Errorf("%s: expected %v; got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestNextInRecipientZone(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	window := &models.SendWindow{Start: "09:00", End: "20:00"}
+
+	// noon in London is 9pm in Tokyo, the window there opens next morning
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	expected := time.Date(2024, 1, 11, 9, 0, 0, 0, tokyo)
+
+	if got := Next(window, tokyo, now); !got.Equal(expected) {
+		t.Errorf("expected %v; got %v", expected, got)
+	}
+}
+
+func TestFromMsisdn(t *testing.T) {
+	tests := map[string]string{
+		"233241234567":  "Africa/Accra",
+		"2348031234567": "Africa/Lagos",
+		"447911123456":  "Europe/London",
+		"12025550123":   "America/New_York",
+		"999123":        "",
+		"":              "",
+	}
+
+	for msisdn, expected := range tests {
+		if got := FromMsisdn(msisdn); got != expected {
+			t.Errorf("FromMsisdn(%q) expected %q; got %q", msisdn, expected, got)
+		}
+	}
+}
+
+func TestZonesLoad(t *testing.T) {
+	for code, zone := range zones {
+		if _, err := time.LoadLocation(zone); err != nil {
+			t.Errorf("zone %q for +%s does not load: %v", zone, code, err)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	window := &models.SendWindow{Start: "09:00", End: "20:00", TimeZone: "Europe/Paris"}
+
+	if got := Location(window, "Asia/Tokyo", "233241234567").String(); got != "Asia/Tokyo" {
+		t.Errorf("expected the contact zone first; got %s", got)
+	}
+
+	if got := Location(window, "", "233241234567").String(); got != "Africa/Accra" {
+		t.Errorf("expected the msisdn zone next; got %s", got)
+	}
+
+	if got := Location(window, "", "").String(); got != "Europe/Paris" {
+		t.Errorf("expected the window zone last; got %s", got)
+	}
+}
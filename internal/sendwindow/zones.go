@@ -0,0 +1,141 @@
+package sendwindow
+
+// zones maps country calling codes to the zone most of the country is in.
+// Countries spanning several zones get their most populous one, a contact's
+// own time zone should be set when that guess is wrong.
+var zones = map[string]string{
+	"1":  "America/New_York",
+	"7":  "Europe/Moscow",
+	"20": "Africa/Cairo",
+	"27": "Africa/Johannesburg",
+	"30": "Europe/Athens",
+	"31": "Europe/Amsterdam",
+	"32": "Europe/Brussels",
+	"33": "Europe/Paris",
+	"34": "Europe/Madrid",
+	"36": "Europe/Budapest",
+	"39": "Europe/Rome",
+	"40": "Europe/Bucharest",
+	"41": "Europe/Zurich",
+	"43": "Europe/Vienna",
+	"44": "Europe/London",
+	"45": "Europe/Copenhagen",
+	"46": "Europe/Stockholm",
+	"47": "Europe/Oslo",
+	"48": "Europe/Warsaw",
+	"49": "Europe/Berlin",
+	"51": "America/Lima",
+	"52": "America/Mexico_City",
+	"54": "America/Argentina/Buenos_Aires",
+	"55": "America/Sao_Paulo",
+	"56": "America/Santiago",
+	"57": "America/Bogota",
+	"58": "America/Caracas",
+	"60": "Asia/Kuala_Lumpur",
+	"61": "Australia/Sydney",
+	"62": "Asia/Jakarta",
+	"63": "Asia/Manila",
+	"64": "Pacific/Auckland",
+	"65": "Asia/Singapore",
+	"66": "Asia/Bangkok",
+	"81": "Asia/Tokyo",
+	"82": "Asia/Seoul",
+	"84": "Asia/Ho_Chi_Minh",
+	"86": "Asia/Shanghai",
+	"90": "Europe/Istanbul",
+	"91": "Asia/Kolkata",
+	"92": "Asia/Karachi",
+	"93": "Asia/Kabul",
+	"94": "Asia/Colombo",
+	"95": "Asia/Yangon",
+	"98": "Asia/Tehran",
+
+	"211": "Africa/Juba",
+	"212": "Africa/Casablanca",
+	"213": "Africa/Algiers",
+	"216": "Africa/Tunis",
+	"218": "Africa/Tripoli",
+	"220": "Africa/Banjul",
+	"221": "Africa/Dakar",
+	"222": "Africa/Nouakchott",
+	"223": "Africa/Bamako",
+	"224": "Africa/Conakry",
+	"225": "Africa/Abidjan",
+	"226": "Africa/Ouagadougou",
+	"227": "Africa/Niamey",
+	"228": "Africa/Lome",
+	"229": "Africa/Porto-Novo",
+	"230": "Indian/Mauritius",
+	"231": "Africa/Monrovia",
+	"232": "Africa/Freetown",
+	"233": "Africa/Accra",
+	"234": "Africa/Lagos",
+	"235": "Africa/Ndjamena",
+	"236": "Africa/Bangui",
+	"237": "Africa/Douala",
+	"238": "Atlantic/Cape_Verde",
+	"239": "Africa/Sao_Tome",
+	"240": "Africa/Malabo",
+	"241": "Africa/Libreville",
+	"242": "Africa/Brazzaville",
+	"243": "Africa/Kinshasa",
+	"244": "Africa/Luanda",
+	"245": "Africa/Bissau",
+	"248": "Indian/Mahe",
+	"249": "Africa/Khartoum",
+	"250": "Africa/Kigali",
+	"251": "Africa/Addis_Ababa",
+	"252": "Africa/Mogadishu",
+	"253": "Africa/Djibouti",
+	"254": "Africa/Nairobi",
+	"255": "Africa/Dar_es_Salaam",
+	"256": "Africa/Kampala",
+	"257": "Africa/Bujumbura",
+	"258": "Africa/Maputo",
+	"260": "Africa/Lusaka",
+	"261": "Indian/Antananarivo",
+	"263": "Africa/Harare",
+	"264": "Africa/Windhoek",
+	"265": "Africa/Blantyre",
+	"266": "Africa/Maseru",
+	"267": "Africa/Gaborone",
+	"268": "Africa/Mbabane",
+	"269": "Indian/Comoro",
+	"291": "Africa/Asmara",
+	"351": "Europe/Lisbon",
+	"352": "Europe/Luxembourg",
+	"353": "Europe/Dublin",
+	"354": "Atlantic/Reykjavik",
+	"358": "Europe/Helsinki",
+	"380": "Europe/Kyiv",
+	"420": "Europe/Prague",
+	"421": "Europe/Bratislava",
+	"852": "Asia/Hong_Kong",
+	"880": "Asia/Dhaka",
+	"886": "Asia/Taipei",
+	"961": "Asia/Beirut",
+	"962": "Asia/Amman",
+	"965": "Asia/Kuwait",
+	"966": "Asia/Riyadh",
+	"971": "Asia/Dubai",
+	"972": "Asia/Jerusalem",
+	"974": "Asia/Qatar",
+	"977": "Asia/Kathmandu",
+}
+
+// FromMsisdn guesses the zone of an international msisdn from its country
+// calling code, it returns "" for codes it does not know. Calling codes are
+// prefix free so the first match is the only one.
+func FromMsisdn(msisdn string) string {
+	for n := 3; n >= 1; n-- {
+		if len(msisdn) <= n {
+			continue
+		}
+
+		if zone, ok := zones[msisdn[:n]]; ok {
+			return zone
+		}
+	}
+
+	return ""
+}
@@ -1,13 +1,34 @@
 package server
 
 import (
+	"campaign/internal/handlers/asset"
 	"campaign/internal/handlers/auth"
 	"campaign/internal/handlers/campaign"
+	"campaign/internal/handlers/category"
+	"campaign/internal/handlers/claim"
+	"campaign/internal/handlers/contact"
+	"campaign/internal/handlers/customfield"
+	"campaign/internal/handlers/email"
+	"campaign/internal/handlers/experiment"
+	"campaign/internal/handlers/files"
+	"campaign/internal/handlers/goal"
+	"campaign/internal/handlers/job"
+	"campaign/internal/handlers/landing"
+	"campaign/internal/handlers/link"
+	"campaign/internal/handlers/points"
+	"campaign/internal/handlers/qr"
+	"campaign/internal/handlers/receipt"
+	"campaign/internal/handlers/referral"
+	"campaign/internal/handlers/segment"
+	"campaign/internal/handlers/sms"
+	"campaign/internal/handlers/spend"
+	"campaign/internal/handlers/suppression"
+	"campaign/internal/handlers/template"
+	"campaign/internal/handlers/voucher"
 	"campaign/internal/utils/jwt"
 	"encoding/json"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -22,7 +43,7 @@ func (s *Server) RegisterRoutes() http.Handler {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"https://*", "http://*"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Accept-Encoding"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Accept-Encoding", voucher.KeyHeader},
 	}))
 
 	r.Use(func(next http.Handler) http.Handler {
@@ -35,17 +56,40 @@ func (s *Server) RegisterRoutes() http.Handler {
 	})
 
 	r.Get("/", s.HelloWorldHandler)
+	r.Route("/files", s.fileController)
+	r.Route("/r", s.redirectController)
+	r.Route("/c", s.pageController)
+	r.Route("/public", s.publicController)
+
+	claimHandler := claim.NewClaimHandler(s.db.Database(), s.jobs)
 
 	r.Route("/api", func(api chi.Router) {
 		api.Get("/health", s.healthHandler)
-		api.Post("/claim", s.healthHandler)
-		api.Post("/claim-status", s.claimhealthHandler)
+		api.Post("/claim", claimHandler.ClaimHandler)
+		api.Post("/claim-status", claimHandler.ClaimStatusHandler)
+		api.Get("/claim-status/{reference}", claimHandler.ClaimStatusHandler)
 		api.Route("/", s.authController)
+		api.Route("/webhooks", s.webhookController)
+		api.Route("/unsubscribe", s.unsubscribeController)
+		api.Route("/redeem", s.redeemController)
 
 		api.Group(func(prot_api chi.Router) {
 			prot_api.Use(jwt.Authenticator())
 
 			prot_api.Route("/campaigns", s.campaignController)
+			prot_api.Route("/assets", s.assetController)
+			prot_api.Route("/categories", s.categoryController)
+			prot_api.Route("/custom-fields", s.customFieldController)
+			prot_api.Route("/contacts", s.contactController)
+			prot_api.Route("/lists", s.listController)
+			prot_api.Route("/segments", s.segmentController)
+			prot_api.Route("/sender-identities", s.senderIdentityController)
+			prot_api.Route("/jobs", s.jobController)
+			prot_api.Route("/templates", s.templateController)
+			prot_api.Route("/suppressions", s.suppressionController)
+			prot_api.Route("/claims", s.claimController)
+			prot_api.Route("/referrals", s.referralController)
+			prot_api.Route("/points", s.pointsController)
 
 		})
 
@@ -62,18 +106,303 @@ func (s *Server) authController(r chi.Router) {
 	r.Post("/create-account", handler.Signup)
 }
 
+func (s *Server) claimController(r chi.Router) {
+	handler := claim.NewClaimHandler(s.db.Database(), s.jobs)
+
+	r.Get("/review", handler.GetReviewQueueHandler)
+	r.Post("/review/{claimID}", handler.ReviewClaimHandler)
+}
+
+func (s *Server) referralController(r chi.Router) {
+	handler := referral.NewReferralHandler(s.db.Database())
+
+	r.Get("/", handler.GetCodesHandler)
+	r.Post("/{campaignID}/code", handler.GetCodeHandler)
+}
+
+func (s *Server) pointsController(r chi.Router) {
+	handler := points.NewPointsHandler(s.db.Database())
+
+	r.Get("/{campaignID}", handler.GetBalanceHandler)
+	r.Get("/{campaignID}/leaderboard", handler.GetLeaderboardHandler)
+	r.Get("/{campaignID}/rank", handler.GetRankHandler)
+}
+
 func (s *Server) campaignController(r chi.Router) {
 	client := s.db.Database()
-	handler := campaign.NewCampaignHandler(client)
+	handler := campaign.NewCampaignHandler(client, s.store)
+	spendHandler := spend.NewSpendHandler(client)
+	goalHandler := goal.NewGoalHandler(client)
+	listHandler := contact.NewListHandler(client)
+	smsHandler := sms.NewSMSHandler(client, s.jobs)
+	emailHandler := email.NewEmailHandler(client, s.jobs)
+	receiptHandler := receipt.NewReceiptHandler(client)
+	linkHandler := link.NewLinkHandler(client)
+	claimHandler := claim.NewClaimHandler(client, s.jobs)
+	voucherHandler := voucher.NewVoucherHandler(client)
+	referralHandler := referral.NewReferralHandler(client)
+	pointsHandler := points.NewPointsHandler(client)
+	qrHandler := qr.NewQRHandler(client, s.store)
+	experimentHandler := experiment.NewExperimentHandler(client, s.jobs)
 
 	r.Get("/", handler.GetCampaignsHandler)
 	r.Post("/", handler.CreateCampaignHandler)
 	r.Get("/{id}", handler.GetCampaignByIDHandler)
 	r.Put("/{id}", handler.UpdateCampaignHandler)
 	r.Delete("/{id}", handler.DeleteCampaignHandler)
+	r.Post("/{id}/banner", handler.UploadBannerHandler)
+
+	r.Get("/{id}/spend", spendHandler.GetSpendHandler)
+	r.Post("/{id}/spend", spendHandler.RecordSpendHandler)
+	r.Get("/{id}/budget-alerts", spendHandler.GetBudgetAlertsHandler)
+
+	r.Get("/{id}/goals", goalHandler.GetGoalsHandler)
+	r.Post("/{id}/goals", goalHandler.CreateGoalHandler)
+	r.Put("/{id}/goals/{goalID}", goalHandler.UpdateGoalHandler)
+	r.Delete("/{id}/goals/{goalID}", goalHandler.DeleteGoalHandler)
+	r.Post("/{id}/metrics", goalHandler.RecordMetricsHandler)
+
+	r.Get("/{id}/audience", listHandler.GetAudienceHandler)
+	r.Put("/{id}/audience", listHandler.SetAudienceHandler)
+
+	r.Get("/{id}/sms", smsHandler.GetMessagesHandler)
+	r.Post("/{id}/sms", smsHandler.SendCampaignHandler)
+
+	r.Get("/{id}/email", emailHandler.GetMessagesHandler)
+	r.Post("/{id}/email", emailHandler.SendCampaignHandler)
+
+	r.Get("/{id}/delivery", receiptHandler.GetDeliveryStatsHandler)
+
+	r.Get("/{id}/links", linkHandler.GetLinksHandler)
+	r.Post("/{id}/links", linkHandler.CreateLinkHandler)
+	r.Put("/{id}/links/{linkID}", linkHandler.UpdateLinkHandler)
+	r.Delete("/{id}/links/{linkID}", linkHandler.DeleteLinkHandler)
+	r.Get("/{id}/links/{linkID}/stats", linkHandler.GetLinkStatsHandler)
+	r.Get("/{id}/clicks", linkHandler.GetClickStatsHandler)
+	r.Get("/{id}/qr", qrHandler.GetQRHandler)
+
+	r.Get("/{id}/claims", claimHandler.GetClaimsHandler)
+	r.Put("/{id}/claims/{claimID}", claimHandler.UpdateClaimHandler)
+	r.Post("/{id}/claims/callback-secret", claimHandler.RotateCallbackSecretHandler)
+	r.Post("/{id}/eligibility", claimHandler.EligibilityHandler)
+
+	r.Get("/{id}/referrals", referralHandler.GetReportHandler)
+
+	r.Get("/{id}/points", pointsHandler.GetLedgerHandler)
+	r.Post("/{id}/points", pointsHandler.AwardHandler)
+
+	r.Get("/{id}/experiment", experimentHandler.GetResultsHandler)
+	r.Put("/{id}/experiment", experimentHandler.SetExperimentHandler)
+	r.Delete("/{id}/experiment", experimentHandler.DeleteExperimentHandler)
+	r.Post("/{id}/experiment/promote", experimentHandler.PromoteHandler)
+
+	r.Get("/{id}/pools", voucherHandler.GetPoolsHandler)
+	r.Post("/{id}/pools", voucherHandler.CreatePoolHandler)
+	r.Get("/{id}/pools/{poolID}", voucherHandler.GetPoolByIDHandler)
+	r.Delete("/{id}/pools/{poolID}", voucherHandler.DeletePoolHandler)
+	r.Post("/{id}/pools/{poolID}/key", voucherHandler.RotateKeyHandler)
+	r.Post("/{id}/pools/{poolID}/generate", voucherHandler.GenerateCodesHandler)
+	r.Post("/{id}/pools/{poolID}/upload", voucherHandler.UploadCodesHandler)
+	r.Get("/{id}/pools/{poolID}/codes", voucherHandler.GetVouchersHandler)
+
+}
+
+func (s *Server) assetController(r chi.Router) {
+	client := s.db.Database()
+	handler := asset.NewAssetHandler(client, s.store)
+
+	r.Get("/", handler.GetAssetsHandler)
+	r.Post("/", handler.UploadAssetHandler)
+	r.Get("/folders", handler.GetFoldersHandler)
+	r.Get("/{id}", handler.GetAssetByIDHandler)
+	r.Put("/{id}", handler.UpdateAssetHandler)
+	r.Delete("/{id}", handler.DeleteAssetHandler)
+	r.Post("/{id}/campaigns/{campaignID}", handler.AttachAssetHandler)
+	r.Delete("/{id}/campaigns/{campaignID}", handler.DetachAssetHandler)
+
+}
+
+func (s *Server) categoryController(r chi.Router) {
+	client := s.db.Database()
+	handler := category.NewCategoryHandler(client)
+
+	r.Get("/", handler.GetCategoriesHandler)
+	r.Post("/", handler.CreateCategoryHandler)
+	r.Get("/{id}", handler.GetCategoryByIDHandler)
+	r.Put("/{id}", handler.UpdateCategoryHandler)
+	r.Delete("/{id}", handler.DeleteCategoryHandler)
+
+}
+
+func (s *Server) customFieldController(r chi.Router) {
+	client := s.db.Database()
+	handler := customfield.NewCustomFieldHandler(client)
+
+	r.Get("/", handler.GetCustomFieldsHandler)
+	r.Post("/", handler.CreateCustomFieldHandler)
+	r.Put("/{id}", handler.UpdateCustomFieldHandler)
+	r.Delete("/{id}", handler.DeleteCustomFieldHandler)
+
+}
+
+func (s *Server) contactController(r chi.Router) {
+	client := s.db.Database()
+	handler := contact.NewContactHandler(client)
+
+	r.Get("/", handler.GetContactsHandler)
+	r.Post("/", handler.CreateContactHandler)
+	r.Get("/{id}", handler.GetContactByIDHandler)
+	r.Put("/{id}", handler.UpdateContactHandler)
+	r.Delete("/{id}", handler.DeleteContactHandler)
+
+}
+
+func (s *Server) listController(r chi.Router) {
+	client := s.db.Database()
+	handler := contact.NewListHandler(client)
+
+	r.Get("/", handler.GetListsHandler)
+	r.Post("/", handler.CreateListHandler)
+	r.Get("/{id}", handler.GetListByIDHandler)
+	r.Put("/{id}", handler.UpdateListHandler)
+	r.Delete("/{id}", handler.DeleteListHandler)
+	r.Post("/{id}/contacts", handler.AddContactsHandler)
+	r.Delete("/{id}/contacts/{contactID}", handler.RemoveContactHandler)
+	r.Post("/{id}/import", handler.ImportContactsHandler)
+
+}
+
+func (s *Server) segmentController(r chi.Router) {
+	client := s.db.Database()
+	handler := segment.NewSegmentHandler(client)
+
+	r.Get("/", handler.GetSegmentsHandler)
+	r.Post("/", handler.CreateSegmentHandler)
+	r.Post("/preview", handler.PreviewRuleHandler)
+	r.Get("/{id}", handler.GetSegmentByIDHandler)
+	r.Put("/{id}", handler.UpdateSegmentHandler)
+	r.Delete("/{id}", handler.DeleteSegmentHandler)
+	r.Get("/{id}/preview", handler.PreviewSegmentHandler)
+
+}
+
+func (s *Server) senderIdentityController(r chi.Router) {
+	client := s.db.Database()
+	handler := email.NewIdentityHandler(client)
+
+	r.Get("/", handler.GetIdentitiesHandler)
+	r.Post("/", handler.CreateIdentityHandler)
+	r.Get("/{id}", handler.GetIdentityByIDHandler)
+	r.Put("/{id}", handler.UpdateIdentityHandler)
+	r.Delete("/{id}", handler.DeleteIdentityHandler)
+
+}
+
+func (s *Server) templateController(r chi.Router) {
+	client := s.db.Database()
+	handler := template.NewTemplateHandler(client, s.sms, s.mailer)
+
+	r.Get("/", handler.GetTemplatesHandler)
+	r.Post("/", handler.CreateTemplateHandler)
+	r.Post("/preview", handler.PreviewDraftHandler)
+	r.Get("/{id}", handler.GetTemplateByIDHandler)
+	r.Put("/{id}", handler.UpdateTemplateHandler)
+	r.Delete("/{id}", handler.DeleteTemplateHandler)
+	r.Post("/{id}/preview", handler.PreviewTemplateHandler)
+	r.Post("/{id}/test", handler.SendTestHandler)
+
+}
+
+func (s *Server) jobController(r chi.Router) {
+	client := s.db.Database()
+	handler := job.NewJobHandler(client)
+
+	r.Get("/", handler.GetJobsHandler)
+	r.Get("/{id}", handler.GetJobByIDHandler)
+	r.Post("/{id}/retry", handler.RetryJobHandler)
 
 }
 
+// webhookController takes notifications from outside services, each handler
+// authenticates its caller
+func (s *Server) webhookController(r chi.Router) {
+	client := s.db.Database()
+	emailHandler := email.NewEmailHandler(client, s.jobs)
+	receiptHandler := receipt.NewReceiptHandler(client)
+	suppressionHandler := suppression.NewSuppressionHandler(client, s.sms)
+
+	r.Post("/email", emailHandler.FeedbackHandler)
+	r.Post("/receipts/sms/{provider}", receiptHandler.SMSReceiptHandler)
+	r.Post("/receipts/email/{provider}", receiptHandler.EmailReceiptHandler)
+	r.Post("/inbound/sms/{provider}", suppressionHandler.InboundSMSHandler)
+
+}
+
+func (s *Server) suppressionController(r chi.Router) {
+	client := s.db.Database()
+	handler := suppression.NewSuppressionHandler(client, s.sms)
+
+	r.Get("/", handler.GetSuppressionsHandler)
+	r.Post("/", handler.AddSuppressionHandler)
+	r.Delete("/{id}", handler.RemoveSuppressionHandler)
+
+}
+
+// unsubscribeController serves the links in campaign emails, the signed
+// token is the only credential
+func (s *Server) unsubscribeController(r chi.Router) {
+	client := s.db.Database()
+	handler := suppression.NewSuppressionHandler(client, s.sms)
+
+	r.Get("/{token}", handler.GetUnsubscribeHandler)
+	r.Post("/{token}", handler.UnsubscribeHandler)
+
+}
+
+// redeemController is used by partners accepting campaign codes, the
+// redemption key of a code pool is the only credential
+func (s *Server) redeemController(r chi.Router) {
+	client := s.db.Database()
+	handler := voucher.NewVoucherHandler(client)
+
+	r.Post("/", handler.RedeemHandler)
+	r.Get("/{code}", handler.LookupHandler)
+
+}
+
+// redirectController serves the short links in campaign messages, they
+// are public and kept short so they live outside /api
+func (s *Server) redirectController(r chi.Router) {
+	client := s.db.Database()
+	handler := link.NewLinkHandler(client)
+
+	r.Get("/{code}", handler.RedirectHandler)
+
+}
+
+// publicController serves what the public may see of active campaigns, no
+// authentication is needed
+func (s *Server) publicController(r chi.Router) {
+	handler := landing.NewLandingHandler(s.db.Database(), s.jobs)
+
+	r.Get("/campaigns/{slug}", handler.GetCampaignHandler)
+	r.Get("/campaigns/{slug}/banner", handler.GetBannerHandler)
+}
+
+// pageController serves campaign landing pages as html
+func (s *Server) pageController(r chi.Router) {
+	handler := landing.NewLandingHandler(s.db.Database(), s.jobs)
+
+	r.Get("/{slug}", handler.PageHandler)
+	r.Post("/{slug}", handler.ClaimFormHandler)
+}
+
+func (s *Server) fileController(r chi.Router) {
+	handler := files.NewFileHandler(s.store)
+
+	r.Get("/*", handler.DownloadHandler)
+}
+
 func (s *Server) HelloWorldHandler(w http.ResponseWriter, r *http.Request) {
 	resp := make(map[string]string)
 	resp["message"] = "Hello World"
@@ -90,10 +419,3 @@ func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	jsonResp, _ := json.Marshal(s.db.Health())
 	_, _ = w.Write(jsonResp)
 }
-
-func (s *Server) claimhealthHandler(w http.ResponseWriter, r *http.Request) {
-	time.Sleep(time.Second * 15)
-
-	jsonResp, _ := json.Marshal(s.db.Health())
-	_, _ = w.Write(jsonResp)
-}
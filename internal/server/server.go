@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -11,12 +12,24 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 
 	"campaign/internal/database"
+	"campaign/internal/email"
+	"campaign/internal/queue"
+	claimservice "campaign/internal/services/claim"
+	emailservice "campaign/internal/services/email"
+	experimentservice "campaign/internal/services/experiment"
+	smsservice "campaign/internal/services/sms"
+	"campaign/internal/sms"
+	"campaign/internal/storage"
 )
 
 type Server struct {
 	port int
 
-	db database.Service
+	db     database.Service
+	store  storage.BlobStore
+	sms    sms.SMSProvider
+	mailer *email.Mailer
+	jobs   *queue.Queue
 }
 
 func NewServer() *http.Server {
@@ -26,9 +39,14 @@ func NewServer() *http.Server {
 	NewServer := &Server{
 		port: port,
 
-		db: database.New(),
+		db:     database.New(),
+		store:  storage.New(),
+		sms:    sms.New(),
+		mailer: email.New(),
 	}
 
+	NewServer.jobs = queue.New(NewServer.db.Database())
+
 	// Declare Server config
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", NewServer.port),
@@ -38,6 +56,29 @@ func NewServer() *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// workers stop with the server, jobs they were running are handed back
+	workers, stop := context.WithCancel(context.Background())
+	server.RegisterOnShutdown(stop)
+
+	go NewServer.workers().Run(workers)
+
 	slog.Info("Server started", "Port", NewServer.port)
 	return server
 }
+
+// workers is the job pool with a handler for every job type
+func (s *Server) workers() *queue.Pool {
+	client := s.db.Database()
+	pool := queue.NewPool(s.jobs, queue.Workers())
+
+	pool.Register(smsservice.DispatchJob, smsservice.NewDispatcher(client, s.sms).Handle)
+	pool.Register(emailservice.DispatchJob, emailservice.NewDispatcher(client, s.mailer).Handle)
+
+	claims := claimservice.NewProcessor(client, s.jobs, s.sms, s.mailer)
+	pool.Register(claimservice.ProcessJob, claims.Handle)
+	pool.Register(claimservice.CallbackJob, claims.Deliver)
+
+	pool.Register(experimentservice.EvaluateJob, experimentservice.NewEvaluator(client, s.jobs).Handle)
+
+	return pool
+}
@@ -0,0 +1,558 @@
+package assetservice
+
+import (
+	"bytes"
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/storage"
+	"campaign/internal/utils"
+	"campaign/internal/utils/imaging"
+	"campaign/internal/utils/jwt"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxAssetSize is the largest asset upload accepted in bytes
+const MaxAssetSize = 25 << 20
+
+const (
+	KindImage    = "image"
+	KindVideo    = "video"
+	KindDocument = "document"
+)
+
+var (
+	ErrNotFound    = errors.New("asset not found")
+	ErrInvalidFile = errors.New("invalid file")
+	ErrInUse       = errors.New("asset is used by a live campaign")
+)
+
+// allowedTypes maps sniffed content types to the asset kind
+var allowedTypes = map[string]string{
+	"image/png":                 KindImage,
+	"image/jpeg":                KindImage,
+	"image/gif":                 KindImage,
+	"image/webp":                KindImage,
+	"video/mp4":                 KindVideo,
+	"video/webm":                KindVideo,
+	"application/pdf":           KindDocument,
+	"text/plain; charset=utf-8": KindDocument,
+}
+
+type UploadAsset struct {
+	Name   string
+	Folder string
+	Tags   []string
+	Data   []byte
+}
+
+type UpdateAsset struct {
+	Name   string   `json:"name"`
+	Folder string   `json:"folder"`
+	Tags   []string `json:"tags"`
+}
+
+type AssetFilter struct {
+	Folder     string
+	Tag        string
+	Kind       string
+	CampaignID string
+}
+
+type Service interface {
+	Upload(a UploadAsset) (models.Asset, bool, error)
+	GetAssets(f AssetFilter) ([]models.Asset, error)
+	GetAssetByID(id string) (models.Asset, error)
+	GetFolders() ([]string, error)
+	UpdateAsset(id string, a UpdateAsset) error
+	DeleteAsset(id string) error
+	AttachToCampaign(id, campaignID string) error
+	DetachFromCampaign(id, campaignID string) error
+}
+
+type service struct {
+	ctx   context.Context
+	db    database.Database
+	store storage.BlobStore
+}
+
+func NewService(ctx context.Context, db database.Database, store storage.BlobStore) Service {
+	return &service{ctx: ctx, db: db, store: store}
+}
+
+// Upload stores a new asset. When the account already has a file with the same
+// checksum the existing asset is returned and the second return value is false.
+func (s *service) Upload(a UploadAsset) (models.Asset, bool, error) {
+	asset := models.Asset{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return asset, false, errors.New("error uploading asset")
+	}
+
+	if len(a.Data) == 0 {
+		return asset, false, fmt.Errorf("%w: file is empty", ErrInvalidFile)
+	}
+
+	if len(a.Data) > MaxAssetSize {
+		return asset, false, fmt.Errorf("%w: file must not be larger than %d bytes", ErrInvalidFile, MaxAssetSize)
+	}
+
+	sniffed := http.DetectContentType(a.Data)
+	kind, ok := allowedTypes[sniffed]
+
+	if !ok {
+		return asset, false, fmt.Errorf("%w: unsupported file type %s", ErrInvalidFile, sniffed)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(sniffed)
+
+	sum := sha256.Sum256(a.Data)
+	checksum := hex.EncodeToString(sum[:])
+
+	s.db.SetCollection(models.AssetsCollection)
+
+	err = s.db.FindOne(bson.M{"created_by": user.Sub, "checksum": checksum}, &asset)
+
+	if err == nil {
+		return withURL(asset), false, nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error finding asset by checksum", "error", err)
+
+		return models.Asset{}, false, errors.New("error uploading asset")
+	}
+
+	width, height := 0, 0
+
+	if kind == KindImage {
+		width, height, err = imaging.Dimensions(a.Data, contentType)
+
+		if err != nil {
+			return models.Asset{}, false, fmt.Errorf("%w: %s", ErrInvalidFile, err)
+		}
+	}
+
+	key := fmt.Sprintf("assets/%s/%s%s", user.Sub, checksum, extension(contentType))
+
+	if err := s.store.Put(s.ctx, key, bytes.NewReader(a.Data), int64(len(a.Data)), contentType); err != nil {
+		slog.Error("Error storing asset", "error", err)
+
+		return models.Asset{}, false, errors.New("error storing asset")
+	}
+
+	name := strings.TrimSpace(a.Name)
+
+	if name == "" {
+		name = checksum[:12]
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	asset = models.Asset{
+		ID:          objid.Hex(),
+		Name:        name,
+		Folder:      NormalizeFolder(a.Folder),
+		Kind:        kind,
+		Key:         key,
+		ContentType: contentType,
+		Size:        int64(len(a.Data)),
+		Checksum:    checksum,
+		Width:       width,
+		Height:      height,
+		Tags:        utils.NormalizeTags(a.Tags),
+		CampaignIDs: []string{},
+		CreatedBy:   user.Sub,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err = s.db.InsertOne(bson.M{
+		"_id":          objid,
+		"name":         asset.Name,
+		"folder":       asset.Folder,
+		"kind":         asset.Kind,
+		"key":          asset.Key,
+		"content_type": asset.ContentType,
+		"size":         asset.Size,
+		"checksum":     asset.Checksum,
+		"width":        asset.Width,
+		"height":       asset.Height,
+		"tags":         asset.Tags,
+		"campaign_ids": asset.CampaignIDs,
+		"created_by":   asset.CreatedBy,
+		"created_at":   asset.CreatedAt,
+		"updated_at":   asset.UpdatedAt,
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		// a concurrent upload of the same file won, the blob key is shared so keep it
+		existing := models.Asset{}
+
+		if err := s.db.FindOne(bson.M{"created_by": user.Sub, "checksum": checksum}, &existing); err == nil {
+			return withURL(existing), false, nil
+		}
+	}
+
+	if err != nil {
+		slog.Error("Error creating asset", "error", err)
+
+		return models.Asset{}, false, errors.New("error creating asset")
+	}
+
+	return withURL(asset), true, nil
+}
+
+func (s *service) GetAssets(f AssetFilter) ([]models.Asset, error) {
+	assets := []models.Asset{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return assets, errors.New("error getting assets")
+	}
+
+	filter := bson.M{"created_by": user.Sub}
+
+	if f.Folder != "" {
+		filter["folder"] = NormalizeFolder(f.Folder)
+	}
+
+	if f.Tag != "" {
+		filter["tags"] = strings.ToLower(strings.TrimSpace(f.Tag))
+	}
+
+	if f.Kind != "" {
+		filter["kind"] = f.Kind
+	}
+
+	if f.CampaignID != "" {
+		filter["campaign_ids"] = f.CampaignID
+	}
+
+	s.db.SetCollection(models.AssetsCollection)
+
+	err = s.db.FindMany(filter, &assets)
+
+	if err != nil {
+		slog.Error("Error getting assets", "error", err)
+
+		return assets, errors.New("error getting assets")
+	}
+
+	for i := range assets {
+		assets[i] = withURL(assets[i])
+	}
+
+	return assets, nil
+}
+
+func (s *service) GetAssetByID(id string) (models.Asset, error) {
+	asset, err := s.findAsset(id)
+
+	if err != nil {
+		return asset, err
+	}
+
+	return withURL(asset), nil
+}
+
+// GetFolders lists every folder that holds at least one asset
+func (s *service) GetFolders() ([]string, error) {
+	folders := []string{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return folders, errors.New("error getting folders")
+	}
+
+	s.db.SetCollection(models.AssetsCollection)
+
+	result := []struct {
+		Folder string `bson:"_id"`
+	}{}
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"created_by": user.Sub}},
+		{"$group": bson.M{"_id": "$folder"}},
+		{"$sort": bson.M{"_id": 1}},
+	}, &result)
+
+	if err != nil {
+		slog.Error("Error getting folders", "error", err)
+
+		return folders, errors.New("error getting folders")
+	}
+
+	for _, r := range result {
+		folders = append(folders, r.Folder)
+	}
+
+	return folders, nil
+}
+
+func (s *service) UpdateAsset(id string, a UpdateAsset) error {
+	asset, err := s.findAsset(id)
+
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(a.Name)
+
+	if name == "" {
+		name = asset.Name
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": asset.CreatedBy}, bson.M{
+		"name":       name,
+		"folder":     NormalizeFolder(a.Folder),
+		"tags":       utils.NormalizeTags(a.Tags),
+		"updated_at": time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error updating asset", "error", err)
+
+		return fmt.Errorf("could not update asset with id: %s", id)
+	}
+
+	return nil
+}
+
+// DeleteAsset refuses to delete assets attached to an active campaign.
+// Links to campaigns that are not live are dropped with the asset.
+func (s *service) DeleteAsset(id string) error {
+	asset, err := s.findAsset(id)
+
+	if err != nil {
+		return err
+	}
+
+	if len(asset.CampaignIDs) > 0 {
+		ids := []primitive.ObjectID{}
+
+		for _, cid := range asset.CampaignIDs {
+			if objid, err := primitive.ObjectIDFromHex(cid); err == nil {
+				ids = append(ids, objid)
+			}
+		}
+
+		s.db.SetCollection(models.CampaignsCollection)
+
+		live, err := s.db.CountDocuments(bson.M{
+			"_id":    bson.M{"$in": ids},
+			"status": models.CampaignStatusActive,
+		})
+
+		if err != nil {
+			slog.Error("Error counting live campaigns", "error", err)
+
+			return fmt.Errorf("could not delete asset with id: %s", id)
+		}
+
+		if live > 0 {
+			return fmt.Errorf("%w: detach it from %d live campaign(s) first", ErrInUse, live)
+		}
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	if asset.CampaignIDs == nil {
+		asset.CampaignIDs = []string{}
+	}
+
+	s.db.SetCollection(models.AssetsCollection)
+
+	// the delete only matches while the asset is on the campaigns that were
+	// checked, one attached in the meantime keeps it
+	err = s.db.DeleteOne(bson.M{"_id": objid, "created_by": asset.CreatedBy, "campaign_ids": asset.CampaignIDs})
+
+	if err != nil {
+		slog.Error("Error deleting asset", "error", err)
+
+		return fmt.Errorf("could not delete asset with id: %s", id)
+	}
+
+	left, err := s.db.CountDocuments(bson.M{"_id": objid})
+
+	if err != nil {
+		slog.Error("Error checking deleted asset", "error", err)
+
+		return fmt.Errorf("could not delete asset with id: %s", id)
+	}
+
+	if left > 0 {
+		return fmt.Errorf("%w: it was attached to a campaign while being deleted, try again", ErrInUse)
+	}
+
+	if err := s.store.Delete(s.ctx, asset.Key); err != nil {
+		slog.Error("Error deleting asset file", "error", err, "key", asset.Key)
+	}
+
+	return nil
+}
+
+func (s *service) AttachToCampaign(id, campaignID string) error {
+	asset, err := s.findAsset(id)
+
+	if err != nil {
+		return err
+	}
+
+	campaignObjID, err := primitive.ObjectIDFromHex(campaignID)
+
+	if err != nil {
+		return fmt.Errorf("%w: invalid campaign id: %s", ErrNotFound, campaignID)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	count, err := s.db.CountDocuments(bson.M{"_id": campaignObjID, "created_by": asset.CreatedBy})
+
+	if err != nil || count == 0 {
+		return fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	s.db.SetCollection(models.AssetsCollection)
+
+	err = s.db.UpdateOneRaw(bson.M{"_id": objid, "created_by": asset.CreatedBy}, bson.M{
+		"$addToSet": bson.M{"campaign_ids": campaignID},
+		"$set":      bson.M{"updated_at": time.Now().Local()},
+	})
+
+	if err != nil {
+		slog.Error("Error attaching asset", "error", err)
+
+		return fmt.Errorf("could not attach asset with id: %s", id)
+	}
+
+	return nil
+}
+
+func (s *service) DetachFromCampaign(id, campaignID string) error {
+	asset, err := s.findAsset(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	err = s.db.UpdateOneRaw(bson.M{"_id": objid, "created_by": asset.CreatedBy}, bson.M{
+		"$pull": bson.M{"campaign_ids": campaignID},
+		"$set":  bson.M{"updated_at": time.Now().Local()},
+	})
+
+	if err != nil {
+		slog.Error("Error detaching asset", "error", err)
+
+		return fmt.Errorf("could not detach asset with id: %s", id)
+	}
+
+	return nil
+}
+
+func (s *service) findAsset(id string) (models.Asset, error) {
+	asset := models.Asset{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return asset, errors.New("error getting asset")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return asset, fmt.Errorf("%w: invalid asset id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.AssetsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &asset)
+
+	if err != nil {
+		slog.Error("Error getting asset", "error", err)
+
+		return asset, fmt.Errorf("%w: no assets with id: %s found", ErrNotFound, id)
+	}
+
+	return asset, nil
+}
+
+func withURL(a models.Asset) models.Asset {
+	a.URL = storage.SignedURL(a.Key)
+	a.RefCount = len(a.CampaignIDs)
+
+	if a.Tags == nil {
+		a.Tags = []string{}
+	}
+
+	if a.CampaignIDs == nil {
+		a.CampaignIDs = []string{}
+	}
+
+	return a
+}
+
+func extension(contentType string) string {
+	if ext := imaging.Extension(contentType); ext != "" {
+		return ext
+	}
+
+	switch contentType {
+	case "video/mp4":
+		return ".mp4"
+	case "video/webm":
+		return ".webm"
+	case "application/pdf":
+		return ".pdf"
+	case "text/plain":
+		return ".txt"
+	}
+
+	return ""
+}
+
+// NormalizeFolder turns user input into a clean absolute folder path e.g. "/summer/banners"
+func NormalizeFolder(folder string) string {
+	folder = strings.TrimSpace(folder)
+
+	if folder == "" {
+		return "/"
+	}
+
+	return path.Clean("/" + folder)
+}
@@ -0,0 +1,295 @@
+package assetservice
+
+import (
+	"bytes"
+	"campaign/internal/models"
+	"campaign/internal/storage"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fakeDB is a minimal in memory stand in for the database, filters match
+// on equality, $in and $ne
+type fakeDB struct {
+	collection models.Collections
+	docs       map[models.Collections][]bson.M
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{docs: map[models.Collections][]bson.M{}}
+}
+
+func (f *fakeDB) SetCollection(collection models.Collections) {
+	f.collection = collection
+}
+
+func (f *fakeDB) InsertOne(document bson.M) error {
+	f.docs[f.collection] = append(f.docs[f.collection], document)
+
+	return nil
+}
+
+func (f *fakeDB) FindOne(filter bson.M, result interface{}) error {
+	for _, doc := range f.docs[f.collection] {
+		if matches(doc, filter) {
+			data, err := bson.Marshal(doc)
+
+			if err != nil {
+				return err
+			}
+
+			return bson.Unmarshal(data, result)
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (f *fakeDB) CountDocuments(filter bson.M) (int64, error) {
+	n := int64(0)
+
+	for _, doc := range f.docs[f.collection] {
+		if matches(doc, filter) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (f *fakeDB) DeleteOne(filter bson.M) error {
+	docs := f.docs[f.collection]
+
+	for i, doc := range docs {
+		if matches(doc, filter) {
+			f.docs[f.collection] = append(docs[:i], docs[i+1:]...)
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeDB) InsertMany(documents []interface{}) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) FindMany(filter bson.M, result interface{}) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) FindManyWithOptions(filter bson.M, opts *options.FindOptions, result interface{}) error {
+	return errors.ErrUnsupported
+}
+
+func (f *fakeDB) AggregateMany(pipeline []bson.M, result interface{}) error {
+	return errors.ErrUnsupported
+}
+
+func (f *fakeDB) UpdateOne(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) UpdateOneRaw(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) UpdateManyRaw(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) FindOneAndUpdate(filter bson.M, update bson.M, opts *options.FindOneAndUpdateOptions, result interface{}) error {
+	return errors.ErrUnsupported
+}
+
+func (f *fakeDB) BulkWrite(writes []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func matches(doc, filter bson.M) bool {
+	for key, want := range filter {
+		op, ok := want.(bson.M)
+
+		if !ok {
+			if !reflect.DeepEqual(doc[key], want) {
+				return false
+			}
+
+			continue
+		}
+
+		if ne, ok := op["$ne"]; ok && reflect.DeepEqual(doc[key], ne) {
+			return false
+		}
+
+		if in, ok := op["$in"]; ok {
+			found := false
+			values := reflect.ValueOf(in)
+
+			for i := 0; i < values.Len(); i++ {
+				found = found || reflect.DeepEqual(doc[key], values.Index(i).Interface())
+			}
+
+			if !found {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func newTestService(t *testing.T) (Service, *fakeDB, string) {
+	root := t.TempDir()
+	db := newFakeDB()
+	ctx := context.WithValue(context.Background(), jwt.AUTH_CTX_KEY, gojwt.MapClaims{"sub": "user-1"})
+
+	return NewService(ctx, db, storage.NewLocalStore(root)), db, root
+}
+
+func testPNG(t *testing.T) []byte {
+	buf := bytes.Buffer{}
+
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestUploadDeduplicates(t *testing.T) {
+	svc, db, root := newTestService(t)
+	data := testPNG(t)
+
+	first, created, err := svc.Upload(UploadAsset{Name: "banner", Folder: "summer/", Tags: []string{" Sale ", "sale"}, Data: data})
+
+	if err != nil || !created {
+		t.Fatalf("expected the first upload to create an asset; got %v, %v", created, err)
+	}
+
+	if first.Kind != KindImage || first.Width != 4 || first.Height != 3 || first.Folder != "/summer" || !reflect.DeepEqual(first.Tags, []string{"sale"}) {
+		t.Errorf("expected a 4x3 image in /summer tagged sale; got %+v", first)
+	}
+
+	second, created, err := svc.Upload(UploadAsset{Name: "copy", Data: data})
+
+	if err != nil || created || second.ID != first.ID {
+		t.Errorf("expected the same file to return asset %s; got %s, %v, %v", first.ID, second.ID, created, err)
+	}
+
+	if n := len(db.docs[models.AssetsCollection]); n != 1 {
+		t.Errorf("expected one asset to be stored; got %d", n)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(first.Key))); err != nil {
+		t.Errorf("expected the file to be stored: %v", err)
+	}
+}
+
+func TestUploadRejectsUnsupportedFiles(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	for name, data := range map[string][]byte{
+		"empty":      {},
+		"executable": {0x7f, 'E', 'L', 'F', 2, 1, 1, 0},
+	} {
+		if _, _, err := svc.Upload(UploadAsset{Data: data}); !errors.Is(err, ErrInvalidFile) {
+			t.Errorf("expected %s to be rejected; got %v", name, err)
+		}
+	}
+}
+
+func TestNormalizeFolder(t *testing.T) {
+	tests := map[string]string{
+		"":                "/",
+		"  ":              "/",
+		"summer":          "/summer",
+		" summer/banners": "/summer/banners",
+		"/summer//2024/":  "/summer/2024",
+		"../../etc":       "/etc",
+		"a/./b/../c":      "/a/c",
+	}
+
+	for in, want := range tests {
+		if got := NormalizeFolder(in); got != want {
+			t.Errorf("expected %q to be %q; got %q", in, want, got)
+		}
+	}
+}
+
+func TestDeleteAssetInUse(t *testing.T) {
+	svc, db, root := newTestService(t)
+
+	asset, _, err := svc.Upload(UploadAsset{Data: testPNG(t)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	campaign := primitive.NewObjectID()
+	db.docs[models.CampaignsCollection] = []bson.M{{"_id": campaign, "status": models.CampaignStatusActive}}
+	db.docs[models.AssetsCollection][0]["campaign_ids"] = []string{campaign.Hex()}
+
+	if err := svc.DeleteAsset(asset.ID); !errors.Is(err, ErrInUse) {
+		t.Fatalf("expected an asset on a live campaign to be kept; got %v", err)
+	}
+
+	if n := len(db.docs[models.AssetsCollection]); n != 1 {
+		t.Fatalf("expected the asset to be kept; got %d assets", n)
+	}
+
+	db.docs[models.CampaignsCollection][0]["status"] = models.CampaignStatusPaused
+
+	if err := svc.DeleteAsset(asset.ID); err != nil {
+		t.Fatalf("expected an asset on a paused campaign to be deleted; got %v", err)
+	}
+
+	if n := len(db.docs[models.AssetsCollection]); n != 0 {
+		t.Errorf("expected the asset to be deleted; got %d assets", n)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(asset.Key))); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be deleted; got %v", err)
+	}
+}
+
+func TestDeleteAssetAttachedMeanwhile(t *testing.T) {
+	svc, db, _ := newTestService(t)
+
+	asset, _, err := svc.Upload(UploadAsset{Data: testPNG(t)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a campaign picks the asset up after it was checked, the conditional
+	// delete no longer matches
+	deleting := &attachingDB{fakeDB: db, campaignID: primitive.NewObjectID().Hex()}
+	svc = NewService(svc.(*service).ctx, deleting, svc.(*service).store)
+
+	if err := svc.DeleteAsset(asset.ID); !errors.Is(err, ErrInUse) {
+		t.Fatalf("expected the asset to be kept; got %v", err)
+	}
+
+	if n := len(db.docs[models.AssetsCollection]); n != 1 {
+		t.Errorf("expected the asset to be kept; got %d assets", n)
+	}
+}
+
+// attachingDB attaches the asset to a campaign just before it is deleted
+type attachingDB struct {
+	*fakeDB
+	campaignID string
+}
+
+func (a *attachingDB) DeleteOne(filter bson.M) error {
+	for _, doc := range a.docs[models.AssetsCollection] {
+		doc["campaign_ids"] = []string{a.campaignID}
+	}
+
+	return a.fakeDB.DeleteOne(filter)
+}
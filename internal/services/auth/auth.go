@@ -3,17 +3,19 @@ package authservice
 import (
 	"campaign/internal/database"
 	"campaign/internal/models"
+	referralservice "campaign/internal/services/referral"
 	"campaign/internal/utils/jwt"
 	"errors"
 	"log/slog"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Service interface {
 	Login(email, password string) (LoginRes, error)
-	Register(name, email, password, msisdn string) error
+	Register(name, email, password, msisdn, referralCode string) error
 }
 
 type service struct {
@@ -67,10 +69,26 @@ func (s *service) Login(email, password string) (LoginRes, error) {
 
 }
 
-func (s *service) Register(name, email, password, msisdn string) error {
+// Register creates an account. A referral code is checked before the
+// account is created and the signup is attributed to it afterwards.
+func (s *service) Register(name, email, password, msisdn, referralCode string) error {
+	var attribution *referralservice.Attribution
+
+	if referralCode != "" {
+		a, err := referralservice.Resolve(s.db, referralCode, models.User{Email: email, Msisdn: msisdn})
+
+		if err != nil {
+			return err
+		}
+
+		attribution = &a
+	}
+
+	id := primitive.NewObjectID()
+
 	s.db.SetCollection(models.UsersCollection)
 
-	err := s.db.InsertOne(bson.M{"name": name, "email": email, "password": password, "msisdn": msisdn, "created_at": time.Now().Local(), "updated_at": time.Now().Local()})
+	err := s.db.InsertOne(bson.M{"_id": id, "name": name, "email": email, "password": password, "msisdn": msisdn, "created_at": time.Now().Local(), "updated_at": time.Now().Local()})
 
 	if err != nil {
 		slog.Error("Error inserting user", "error", err)
@@ -78,5 +96,12 @@ func (s *service) Register(name, email, password, msisdn string) error {
 		return errors.New("error creating user. email already exists")
 	}
 
+	// the account stands even when the referral could not be recorded
+	if attribution != nil {
+		if _, err := referralservice.Record(s.db, *attribution, id.Hex()); err != nil {
+			slog.Error("Error attributing signup", "user", id.Hex(), "code", attribution.Code.Code, "error", err)
+		}
+	}
+
 	return nil
 }
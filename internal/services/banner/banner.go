@@ -0,0 +1,198 @@
+package bannerservice
+
+import (
+	"bytes"
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/storage"
+	"campaign/internal/utils/imaging"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxBannerSize is the largest banner upload accepted in bytes
+const MaxBannerSize = 5 << 20
+
+var (
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrInvalidImage     = errors.New("invalid image")
+)
+
+var sizes = []imaging.Size{
+	{Name: "thumbnail", MaxWidth: 320},
+	{Name: "medium", MaxWidth: 1024},
+}
+
+type Service interface {
+	Upload(campaignID string, data []byte) (models.Banner, error)
+}
+
+type service struct {
+	ctx   context.Context
+	db    database.Database
+	store storage.BlobStore
+}
+
+func NewService(ctx context.Context, db database.Database, store storage.BlobStore) Service {
+	return &service{ctx: ctx, db: db, store: store}
+}
+
+// Upload validates data as an image, stores it with its resized variants and
+// replaces the campaign banner. The previous banner files are removed.
+func (s *service) Upload(campaignID string, data []byte) (models.Banner, error) {
+	banner := models.Banner{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return banner, errors.New("error uploading banner")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(campaignID)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return banner, fmt.Errorf("%w: invalid campaign id: %s", ErrCampaignNotFound, campaignID)
+	}
+
+	if len(data) > MaxBannerSize {
+		return banner, fmt.Errorf("%w: banner must not be larger than %d bytes", ErrInvalidImage, MaxBannerSize)
+	}
+
+	contentType, err := imaging.Sniff(data)
+
+	if err != nil {
+		return banner, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+
+	img, err := imaging.Decode(data, contentType)
+
+	if err != nil {
+		return banner, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	existing := models.Campaign{}
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &existing)
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return banner, fmt.Errorf("%w: no campaigns with id: %s found", ErrCampaignNotFound, campaignID)
+	}
+
+	variants, err := imaging.Variants(img, contentType, sizes)
+
+	if err != nil {
+		slog.Error("Error generating banner variants", "error", err)
+
+		return banner, errors.New("error processing banner")
+	}
+
+	prefix := fmt.Sprintf("campaigns/%s/banner/%s/", campaignID, primitive.NewObjectID().Hex())
+	bounds := img.Bounds()
+
+	banner = models.Banner{
+		Key:         prefix + "original" + imaging.Extension(contentType),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Variants:    []models.BannerVariant{},
+		UploadedAt:  time.Now().Local(),
+	}
+
+	if err := s.store.Put(s.ctx, banner.Key, bytes.NewReader(data), banner.Size, contentType); err != nil {
+		slog.Error("Error storing banner", "error", err)
+
+		return models.Banner{}, errors.New("error storing banner")
+	}
+
+	stored := []string{banner.Key}
+
+	for _, v := range variants {
+		key := prefix + v.Name + imaging.Extension(v.ContentType)
+
+		if err := s.store.Put(s.ctx, key, bytes.NewReader(v.Data), int64(len(v.Data)), v.ContentType); err != nil {
+			slog.Error("Error storing banner variant", "error", err, "variant", v.Name)
+			s.deleteKeys(stored)
+
+			return models.Banner{}, errors.New("error storing banner")
+		}
+
+		stored = append(stored, key)
+
+		banner.Variants = append(banner.Variants, models.BannerVariant{
+			Name:        v.Name,
+			Key:         key,
+			ContentType: v.ContentType,
+			Size:        int64(len(v.Data)),
+			Width:       v.Width,
+			Height:      v.Height,
+		})
+	}
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": user.Sub}, bson.M{
+		"banner":     banner,
+		"updated_at": time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error updating campaign banner", "error", err)
+		s.deleteKeys(stored)
+
+		return models.Banner{}, errors.New("error updating campaign banner")
+	}
+
+	if existing.Banner != nil {
+		s.deleteKeys(bannerKeys(*existing.Banner))
+	}
+
+	return SignURLs(banner), nil
+}
+
+func (s *service) deleteKeys(keys []string) {
+	for _, key := range keys {
+		if err := s.store.Delete(s.ctx, key); err != nil {
+			slog.Error("Error deleting banner file", "error", err, "key", key)
+		}
+	}
+}
+
+func bannerKeys(b models.Banner) []string {
+	keys := []string{b.Key}
+
+	for _, v := range b.Variants {
+		keys = append(keys, v.Key)
+	}
+
+	return keys
+}
+
+// SignURLs fills in expiring download urls for the banner and its variants
+func SignURLs(b models.Banner) models.Banner {
+	b.URL = storage.SignedURL(b.Key)
+
+	variants := make([]models.BannerVariant, len(b.Variants))
+
+	for i, v := range b.Variants {
+		v.URL = storage.SignedURL(v.Key)
+		variants[i] = v
+	}
+
+	b.Variants = variants
+
+	return b
+}
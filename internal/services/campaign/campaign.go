@@ -3,6 +3,16 @@ package campaignservice
 import (
 	"campaign/internal/database"
 	"campaign/internal/models"
+	"campaign/internal/sendwindow"
+	bannerservice "campaign/internal/services/banner"
+	customfieldservice "campaign/internal/services/customfield"
+	eligibilityservice "campaign/internal/services/eligibility"
+	pointsservice "campaign/internal/services/points"
+	referralservice "campaign/internal/services/referral"
+	segmentservice "campaign/internal/services/segment"
+	spendservice "campaign/internal/services/spend"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/utils"
 	"campaign/internal/utils/jwt"
 	"context"
 	"errors"
@@ -12,11 +22,31 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var (
+	ErrInvalidCategory = errors.New("category not found")
+	ErrInvalidFilter   = errors.New("invalid filter")
+)
+
+// CampaignFilter narrows GetCampaigns. Campaigns must have every tag in Tags.
+type CampaignFilter struct {
+	Tags         []string
+	CategoryID   string
+	CustomFields []CustomFieldFilter
+}
+
+// CustomFieldFilter compares a custom field value, Op is one of eq, gte or lte
+type CustomFieldFilter struct {
+	Key   string
+	Op    string
+	Value string
+}
+
 type CampaignService interface {
 	CreateCampaign(c models.Campaign) error
-	GetCampaigns() ([]models.Campaign, error)
+	GetCampaigns(f CampaignFilter) ([]models.Campaign, error)
 	GetCampaignByID(id string) (models.Campaign, error)
 	UpdateCampaign(id string, c models.Campaign) error
 	DeleteCampaign(id string) error
@@ -41,10 +71,58 @@ func (s *service) CreateCampaign(c models.Campaign) error {
 		return errors.New("error creating campaign")
 	}
 
-	s.db.SetCollection(models.CampaignsCollection)
+	if err := s.checkCategory(userID.Sub, c.CategoryID); err != nil {
+		return err
+	}
+
+	if c.SendWindow, err = sendwindow.Normalize(c.SendWindow); err != nil {
+		return err
+	}
+
+	if c.Eligibility, err = eligibilityservice.Normalize(c.Eligibility); err != nil {
+		return err
+	}
+
+	if c.Referrals, err = referralservice.Normalize(c.Referrals); err != nil {
+		return err
+	}
+
+	if c.Points, err = pointsservice.Normalize(c.Points); err != nil {
+		return err
+	}
+
+	if c.TemplateIDs == nil {
+		c.TemplateIDs = []string{}
+	}
+
+	if c.Status == models.CampaignStatusActive {
+		if err := templateservice.ValidateCampaignTemplates(s.db, userID.Sub, c.TemplateIDs); err != nil {
+			return err
+		}
+	}
+
+	// a slug made from the name gets a random tail when it is taken, one
+	// asked for is refused
+	given := c.Slug != ""
+
+	if given {
+		if c.Slug, err = NormalizeSlug(c.Slug); err != nil {
+			return err
+		}
+	} else if c.Slug = Slugify(c.Name); c.Slug == "" {
+		if c.Slug, err = withSuffix(""); err != nil {
+			slog.Error("Error generating slug", "error", err)
 
-	err = s.db.InsertOne(bson.M{
+			return errors.New("error creating campaign")
+		}
+	}
+
+	objid := primitive.NewObjectID()
+
+	doc := bson.M{
+		"_id":         objid,
 		"name":        c.Name,
+		"slug":        c.Slug,
 		"description": c.Description,
 		"start_date":  c.StartDate.Local(),
 		"end_date":    c.EndDate.Local(),
@@ -53,7 +131,37 @@ func (s *service) CreateCampaign(c models.Campaign) error {
 		"status":      c.Status,
 		"created_at":  time.Now().Local(),
 		"updated_at":  time.Now().Local(),
-	})
+
+		"tags":          utils.NormalizeTags(c.Tags),
+		"category_id":   c.CategoryID,
+		"custom_fields": c.CustomFields,
+		"budget":        c.Budget,
+		"template_ids":  c.TemplateIDs,
+		"send_window":   c.SendWindow,
+		"claims":        c.Claims,
+		"claim_count":   0,
+		"eligibility":   c.Eligibility,
+		"referrals":     c.Referrals,
+		"points":        c.Points,
+	}
+
+	for attempt := 0; ; attempt++ {
+		s.db.SetCollection(models.CampaignsCollection)
+
+		err = s.db.InsertOne(doc)
+
+		if !mongo.IsDuplicateKeyError(err) || given || attempt == 2 {
+			break
+		}
+
+		if doc["slug"], err = withSuffix(Slugify(c.Name)); err != nil {
+			break
+		}
+	}
+
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrSlugTaken, doc["slug"])
+	}
 
 	if err != nil {
 		slog.Error("Error creating campaign", "error", err)
@@ -62,10 +170,24 @@ func (s *service) CreateCampaign(c models.Campaign) error {
 
 	}
 
+	// a campaign created live needs its audience before anything is sent,
+	// it is not kept without one
+	if c.Status == models.CampaignStatusActive {
+		if err := s.snapshotAudience(userID.Sub, objid); err != nil {
+			s.db.SetCollection(models.CampaignsCollection)
+
+			if err := s.db.DeleteOne(bson.M{"_id": objid}); err != nil {
+				slog.Error("Error deleting campaign", "campaign", objid.Hex(), "error", err)
+			}
+
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (s *service) GetCampaigns() ([]models.Campaign, error) {
+func (s *service) GetCampaigns(f CampaignFilter) ([]models.Campaign, error) {
 	campaigns := []models.Campaign{}
 
 	user, err := jwt.GetAuthContext(s.ctx)
@@ -76,9 +198,15 @@ func (s *service) GetCampaigns() ([]models.Campaign, error) {
 		return campaigns, errors.New("error getting campaigns")
 	}
 
+	filter, err := s.buildFilter(user.Sub, f)
+
+	if err != nil {
+		return campaigns, err
+	}
+
 	s.db.SetCollection(models.CampaignsCollection)
 
-	err = s.db.FindMany(bson.M{"created_by": user.Sub}, &campaigns)
+	err = s.db.FindMany(filter, &campaigns)
 
 	if err != nil {
 		slog.Error("Error getting campaigns", "error", err)
@@ -86,6 +214,12 @@ func (s *service) GetCampaigns() ([]models.Campaign, error) {
 		return campaigns, errors.New("error getting campaigns")
 	}
 
+	for i := range campaigns {
+		campaigns[i] = withBannerURLs(campaigns[i])
+	}
+
+	s.withSpend(campaigns)
+
 	return campaigns, nil
 }
 
@@ -121,7 +255,11 @@ func (s *service) GetCampaignByID(id string) (models.Campaign, error) {
 		return campaign, fmt.Errorf("no campaigns with id: %s found", id)
 	}
 
-	return campaign, nil
+	campaigns := []models.Campaign{withBannerURLs(campaign)}
+
+	s.withSpend(campaigns)
+
+	return campaigns[0], nil
 }
 
 func (s *service) UpdateCampaign(id string, c models.Campaign) error {
@@ -142,17 +280,81 @@ func (s *service) UpdateCampaign(id string, c models.Campaign) error {
 
 	}
 
+	if err := s.checkCategory(user.Sub, c.CategoryID); err != nil {
+		return err
+	}
+
+	if c.SendWindow, err = sendwindow.Normalize(c.SendWindow); err != nil {
+		return err
+	}
+
+	if c.Eligibility, err = eligibilityservice.Normalize(c.Eligibility); err != nil {
+		return err
+	}
+
+	if c.Referrals, err = referralservice.Normalize(c.Referrals); err != nil {
+		return err
+	}
+
+	if c.Points, err = pointsservice.Normalize(c.Points); err != nil {
+		return err
+	}
+
+	if c.TemplateIDs == nil {
+		c.TemplateIDs = []string{}
+	}
+
+	if c.Status == models.CampaignStatusActive {
+		if err := templateservice.ValidateCampaignTemplates(s.db, user.Sub, c.TemplateIDs); err != nil {
+			return err
+		}
+
+		if err := s.snapshotAudience(user.Sub, objid); err != nil {
+			return err
+		}
+	}
+
+	pausedReason := ""
+
+	if c.Status == models.CampaignStatusPaused {
+		pausedReason = c.PausedReason
+	}
+
 	s.db.SetCollection(models.CampaignsCollection)
 
-	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": user.Sub}, bson.M{
+	update := bson.M{
 		"name":        c.Name,
 		"description": c.Description,
-		"start_date":  c.StartDate.Unix(),
-		"end_date":    c.EndDate.Unix(),
-		"banner_url":  c.BannerURL,
+		"start_date":  c.StartDate.Local(),
+		"end_date":    c.EndDate.Local(),
 		"updated_at":  time.Now(),
 		"status":      c.Status,
-	})
+
+		"tags":          utils.NormalizeTags(c.Tags),
+		"category_id":   c.CategoryID,
+		"custom_fields": c.CustomFields,
+		"budget":        c.Budget,
+		"paused_reason": pausedReason,
+		"template_ids":  c.TemplateIDs,
+		"send_window":   c.SendWindow,
+		"claims":        c.Claims,
+		"eligibility":   c.Eligibility,
+		"referrals":     c.Referrals,
+		"points":        c.Points,
+	}
+
+	// the slug is kept when none is sent, links already shared keep working
+	if c.Slug != "" {
+		if update["slug"], err = NormalizeSlug(c.Slug); err != nil {
+			return err
+		}
+	}
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": user.Sub}, update)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrSlugTaken, update["slug"])
+	}
 
 	if err != nil {
 		slog.Error("Error updating campaign", "error", err)
@@ -160,6 +362,17 @@ func (s *service) UpdateCampaign(id string, c models.Campaign) error {
 		return fmt.Errorf("could not update campaign with id: %s", id)
 	}
 
+	// reads point banner_url at a signed url of an uploaded banner, it is
+	// only the client's own link while nothing was uploaded so an expiring
+	// url sent back is not saved
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": user.Sub, "banner": nil}, bson.M{"banner_url": c.BannerURL})
+
+	if err != nil {
+		slog.Error("Error updating campaign banner url", "error", err)
+
+		return fmt.Errorf("could not update campaign with id: %s", id)
+	}
+
 	return nil
 }
 
@@ -191,5 +404,192 @@ func (s *service) DeleteCampaign(id string) error {
 		return fmt.Errorf("could not delete campaign with id: %s", id)
 	}
 
+	// drop the deleted campaign from the reference lists of attached assets
+	s.db.SetCollection(models.AssetsCollection)
+
+	err = s.db.UpdateManyRaw(bson.M{"created_by": user.Sub, "campaign_ids": id}, bson.M{
+		"$pull": bson.M{"campaign_ids": id},
+	})
+
+	if err != nil {
+		slog.Error("Error detaching assets from deleted campaign", "error", err)
+	}
+
+	return nil
+}
+
+// withBannerURLs signs the uploaded banner files. banner_url is pointed at the
+// uploaded original so clients reading only that field keep working.
+func withBannerURLs(c models.Campaign) models.Campaign {
+	if c.Banner == nil {
+		return c
+	}
+
+	banner := bannerservice.SignURLs(*c.Banner)
+	c.Banner = &banner
+	c.BannerURL = banner.URL
+
+	return c
+}
+
+// withSpend fills in the spend summary of campaigns that have a budget
+func (s *service) withSpend(campaigns []models.Campaign) {
+	budgeted := []models.Campaign{}
+
+	for _, c := range campaigns {
+		if c.Budget != nil {
+			budgeted = append(budgeted, c)
+		}
+	}
+
+	if len(budgeted) == 0 {
+		return
+	}
+
+	summaries, err := spendservice.Summarize(s.db, budgeted)
+
+	if err != nil {
+		slog.Error("Error summarizing spend", "error", err)
+
+		return
+	}
+
+	for i := range campaigns {
+		if summary, ok := summaries[campaigns[i].ID]; ok {
+			campaigns[i].Spend = &summary
+		}
+	}
+}
+
+// snapshotAudience freezes the audience the first time a campaign goes live
+func (s *service) snapshotAudience(userID string, objid primitive.ObjectID) error {
+	existing := models.Campaign{}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err := s.db.FindOne(bson.M{"_id": objid, "created_by": userID}, &existing)
+
+	// a campaign that is not there is reported by the update
+	if errors.Is(err, mongo.ErrNoDocuments) || existing.AudienceSnapshot != nil {
+		return nil
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return errors.New("error snapshotting audience")
+	}
+
+	_, err = segmentservice.SnapshotAudience(s.db, existing, time.Now())
+
+	return err
+}
+
+func (s *service) checkCategory(userID, categoryID string) error {
+	if categoryID == "" {
+		return nil
+	}
+
+	objid, err := primitive.ObjectIDFromHex(categoryID)
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCategory, categoryID)
+	}
+
+	s.db.SetCollection(models.CategoriesCollection)
+
+	count, err := s.db.CountDocuments(bson.M{"_id": objid, "created_by": userID})
+
+	if err != nil {
+		slog.Error("Error checking category", "error", err)
+
+		return errors.New("error checking category")
+	}
+
+	if count == 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidCategory, categoryID)
+	}
+
 	return nil
 }
+
+// customFieldFilter turns custom field filters into a condition per field,
+// every operator on one field goes in the same condition so eq and a range
+// on it both apply
+func customFieldFilter(defs map[string]models.CustomField, filters []CustomFieldFilter) (bson.M, error) {
+	conds := bson.M{}
+
+	for _, cf := range filters {
+		def, ok := defs[cf.Key]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown custom field: %s", ErrInvalidFilter, cf.Key)
+		}
+
+		if cf.Op != "eq" && cf.Op != "gte" && cf.Op != "lte" {
+			return nil, fmt.Errorf("%w: unknown operator %s", ErrInvalidFilter, cf.Op)
+		}
+
+		value, err := customfieldservice.ParseFilterValue(def, cf.Value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFilter, err)
+		}
+
+		path := "custom_fields." + cf.Key
+		cond, _ := conds[path].(bson.M)
+
+		if cond == nil {
+			cond = bson.M{}
+		}
+
+		cond["$"+cf.Op] = value
+		conds[path] = cond
+	}
+
+	return conds, nil
+}
+
+func (s *service) buildFilter(userID string, f CampaignFilter) (bson.M, error) {
+	filter := bson.M{"created_by": userID}
+
+	if tags := utils.NormalizeTags(f.Tags); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+
+	if f.CategoryID != "" {
+		filter["category_id"] = f.CategoryID
+	}
+
+	if len(f.CustomFields) == 0 {
+		return filter, nil
+	}
+
+	fields := []models.CustomField{}
+
+	s.db.SetCollection(models.CustomFieldsCollection)
+
+	if err := s.db.FindMany(bson.M{"created_by": userID}, &fields); err != nil {
+		slog.Error("Error getting custom fields", "error", err)
+
+		return nil, errors.New("error getting campaigns")
+	}
+
+	defs := map[string]models.CustomField{}
+
+	for _, def := range fields {
+		defs[def.Key] = def
+	}
+
+	conds, err := customFieldFilter(defs, f.CustomFields)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for path, cond := range conds {
+		filter[path] = cond
+	}
+
+	return filter, nil
+}
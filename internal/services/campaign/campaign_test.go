@@ -0,0 +1,180 @@
+package campaignservice
+
+import (
+	"campaign/internal/models"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCustomFieldFilter(t *testing.T) {
+	defs := map[string]models.CustomField{
+		"budget": {Key: "budget", Type: models.CustomFieldNumber},
+		"region": {Key: "region", Type: models.CustomFieldText},
+	}
+
+	// every operator on a field is kept whatever order the filters come in
+	for _, filters := range [][]CustomFieldFilter{
+		{{Key: "budget", Op: "eq", Value: "1"}, {Key: "budget", Op: "gte", Value: "2"}, {Key: "region", Op: "eq", Value: "north"}},
+		{{Key: "region", Op: "eq", Value: "north"}, {Key: "budget", Op: "gte", Value: "2"}, {Key: "budget", Op: "eq", Value: "1"}},
+	} {
+		conds, err := customFieldFilter(defs, filters)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := bson.M{
+			"custom_fields.budget": bson.M{"$eq": 1.0, "$gte": 2.0},
+			"custom_fields.region": bson.M{"$eq": "north"},
+		}
+
+		if !reflect.DeepEqual(conds, want) {
+			t.Errorf("expected %v; got %v", want, conds)
+		}
+	}
+
+	invalid := map[string]CustomFieldFilter{
+		"unknown field":    {Key: "owner", Op: "eq", Value: "x"},
+		"unknown operator": {Key: "budget", Op: "gt", Value: "1"},
+		"not a number":     {Key: "budget", Op: "lte", Value: "lots"},
+	}
+
+	for name, cf := range invalid {
+		if _, err := customFieldFilter(defs, []CustomFieldFilter{cf}); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("expected %s to be invalid; got %v", name, err)
+		}
+	}
+}
+
+// fakeDB keeps documents in memory, filters match on equality
+type fakeDB struct {
+	collection models.Collections
+	docs       map[models.Collections][]bson.M
+}
+
+func (f *fakeDB) SetCollection(collection models.Collections) {
+	f.collection = collection
+}
+
+func (f *fakeDB) InsertOne(document bson.M) error {
+	f.docs[f.collection] = append(f.docs[f.collection], document)
+
+	return nil
+}
+
+func (f *fakeDB) FindOne(filter bson.M, result interface{}) error {
+	for _, doc := range f.docs[f.collection] {
+		if matches(doc, filter) {
+			return decode(doc, result)
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (f *fakeDB) FindMany(filter bson.M, result interface{}) error {
+	found := bson.A{}
+
+	for _, doc := range f.docs[f.collection] {
+		if matches(doc, filter) {
+			found = append(found, doc)
+		}
+	}
+
+	data, err := bson.Marshal(bson.M{"docs": found})
+
+	if err != nil {
+		return err
+	}
+
+	return bson.Raw(data).Lookup("docs").Unmarshal(result)
+}
+
+func (f *fakeDB) InsertMany(documents []interface{}) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) FindManyWithOptions(filter bson.M, opts *options.FindOptions, result interface{}) error {
+	return errors.ErrUnsupported
+}
+
+func (f *fakeDB) AggregateMany(pipeline []bson.M, result interface{}) error {
+	return errors.ErrUnsupported
+}
+
+func (f *fakeDB) UpdateOne(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) UpdateOneRaw(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) UpdateManyRaw(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (f *fakeDB) FindOneAndUpdate(filter bson.M, update bson.M, opts *options.FindOneAndUpdateOptions, result interface{}) error {
+	return errors.ErrUnsupported
+}
+
+func (f *fakeDB) CountDocuments(filter bson.M) (int64, error) { return 0, errors.ErrUnsupported }
+
+func (f *fakeDB) BulkWrite(writes []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (f *fakeDB) DeleteOne(filter bson.M) error { return errors.ErrUnsupported }
+
+func matches(doc, filter bson.M) bool {
+	for key, want := range filter {
+		if !reflect.DeepEqual(doc[key], want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func decode(doc bson.M, result interface{}) error {
+	data, err := bson.Marshal(doc)
+
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(data, result)
+}
+
+func TestCreateActiveCampaignChecksTemplates(t *testing.T) {
+	template := primitive.NewObjectID()
+	db := &fakeDB{docs: map[models.Collections][]bson.M{
+		models.TemplatesCollection: {{
+			"_id":        template,
+			"name":       "welcome",
+			"channel":    models.TemplateChannelSMS,
+			"body":       "Hi {{.contact.name}}, use {{.campaign.custom_fields.promo}}",
+			"created_by": "user-1",
+		}},
+	}}
+	ctx := context.WithValue(context.Background(), jwt.AUTH_CTX_KEY, gojwt.MapClaims{"sub": "user-1"})
+
+	err := NewService(ctx, db).CreateCampaign(models.Campaign{
+		Name:        "Summer",
+		Status:      models.CampaignStatusActive,
+		StartDate:   time.Now(),
+		EndDate:     time.Now().AddDate(0, 1, 0),
+		TemplateIDs: []string{template.Hex()},
+	})
+
+	if !errors.Is(err, templateservice.ErrInvalid) {
+		t.Errorf("expected a live campaign with an undefined variable to be refused; got %v", err)
+	}
+
+	if n := len(db.docs[models.CampaignsCollection]); n != 0 {
+		t.Errorf("expected no campaign to be created; got %d", n)
+	}
+}
@@ -0,0 +1,354 @@
+package campaignservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	experimentservice "campaign/internal/services/experiment"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// VariantParam is the query parameter landing pages take the experiment
+// variant of the visitor from
+const VariantParam = "v"
+
+const (
+	MinSlugLength = 3
+	MaxSlugLength = 64
+
+	// slugSuffixLength is the random tail added to a slug made from a name
+	// that another campaign already uses
+	slugSuffixLength = 4
+	slugAlphabet     = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var publicBaseURL = os.Getenv("PUBLIC_BASE_URL")
+
+var (
+	ErrInvalidSlug = errors.New("invalid slug")
+	ErrSlugTaken   = errors.New("slug is taken by another campaign")
+
+	// ErrNotPublic is returned for slugs of campaigns that are not active,
+	// they are not told apart from slugs that do not exist
+	ErrNotPublic = errors.New("campaign not found")
+
+	slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// PublicCampaign is what anyone may see of an active campaign on its
+// landing page
+type PublicCampaign struct {
+	ID          string        `json:"id"`
+	Slug        string        `json:"slug"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	StartDate   time.Time     `json:"start_date"`
+	EndDate     time.Time     `json:"end_date"`
+	Tags        []string      `json:"tags"`
+	Banner      *PublicBanner `json:"banner,omitempty"`
+	Claimable   bool          `json:"claimable"`
+	Referrals   bool          `json:"referrals"`
+	Points      bool          `json:"points"`
+	Variant     string        `json:"variant,omitempty"`
+	PageURL     string        `json:"page_url"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// PublicBanner points at the banner through the campaign's slug, the urls
+// do not expire so pages holding them can be cached
+type PublicBanner struct {
+	URL      string                `json:"url"`
+	Width    int                   `json:"width"`
+	Height   int                   `json:"height"`
+	Variants []PublicBannerVariant `json:"variants"`
+}
+
+type PublicBannerVariant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// NormalizeSlug lower cases slug and checks it is made of words of letters
+// and digits joined by single dashes
+func NormalizeSlug(slug string) (string, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+
+	if len(slug) < MinSlugLength || len(slug) > MaxSlugLength || !slugPattern.MatchString(slug) {
+		return "", fmt.Errorf("%w: slugs are %d to %d lower case letters, digits and single dashes e.g. summer-sale", ErrInvalidSlug, MinSlugLength, MaxSlugLength)
+	}
+
+	return slug, nil
+}
+
+// Slugify makes a slug from a campaign name, anything but ascii letters and
+// digits separates words. It is empty when nothing usable is left.
+func Slugify(name string) string {
+	b := strings.Builder{}
+	dash := false
+
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+
+	slug := b.String()
+
+	if len(slug) > MaxSlugLength-slugSuffixLength-1 {
+		slug = strings.TrimRight(slug[:MaxSlugLength-slugSuffixLength-1], "-")
+	}
+
+	if len(slug) < MinSlugLength {
+		return ""
+	}
+
+	return slug
+}
+
+// withSuffix adds a random tail to slug, base is made up when slug is empty
+func withSuffix(slug string) (string, error) {
+	tail := make([]byte, slugSuffixLength)
+	max := big.NewInt(int64(len(slugAlphabet)))
+
+	for i := range tail {
+		n, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		tail[i] = slugAlphabet[n.Int64()]
+	}
+
+	if slug == "" {
+		slug = "campaign"
+	}
+
+	return slug + "-" + string(tail), nil
+}
+
+// FindBySlug gets an active campaign by its slug
+func FindBySlug(db database.Database, slug string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	slug, err := NormalizeSlug(slug)
+
+	if err != nil {
+		return campaign, ErrNotPublic
+	}
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err = db.FindOne(bson.M{"slug": slug, "status": models.CampaignStatusActive}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return campaign, ErrNotPublic
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign by slug", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	return campaign, nil
+}
+
+// PagePath is where the landing page of the campaign with slug is served
+func PagePath(slug string) string {
+	return "/c/" + slug
+}
+
+// BannerPath redirects to the current banner of the campaign with slug,
+// variant names one of its resized copies
+func BannerPath(slug, variant string) string {
+	path := "/public/campaigns/" + slug + "/banner"
+
+	if variant != "" {
+		path += "?variant=" + url.QueryEscape(variant)
+	}
+
+	return path
+}
+
+// PageURL is the absolute url of the landing page of the campaign with slug
+func PageURL(slug string) string {
+	return absolute(PagePath(slug))
+}
+
+// WithVariant adds the experiment variant to dest when it is a landing
+// page, so the page shows the variant's banner and counts its claims
+func WithVariant(dest, variant string) string {
+	if variant == "" || !strings.HasPrefix(dest, PageURL("")) {
+		return dest
+	}
+
+	u, err := url.Parse(dest)
+
+	if err != nil {
+		return dest
+	}
+
+	query := u.Query()
+	query.Set(VariantParam, variant)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func absolute(path string) string {
+	return strings.TrimSuffix(publicBaseURL, "/") + path
+}
+
+// Public is the landing page view of c at now. Claimable says whether the
+// claim form is shown, it does not run eligibility rules.
+func Public(c models.Campaign, now time.Time) PublicCampaign {
+	p := PublicCampaign{
+		ID:          c.ID,
+		Slug:        c.Slug,
+		Name:        c.Name,
+		Description: c.Description,
+		StartDate:   c.StartDate,
+		EndDate:     c.EndDate,
+		Tags:        c.Tags,
+		Referrals:   c.Referrals != nil && c.Referrals.Enabled,
+		Points:      c.Points != nil && c.Points.Enabled,
+		PageURL:     PageURL(c.Slug),
+		UpdatedAt:   c.UpdatedAt,
+	}
+
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+
+	started := c.StartDate.IsZero() || !now.Before(c.StartDate)
+	ended := !c.EndDate.IsZero() && now.After(c.EndDate)
+	p.Claimable = c.Status == models.CampaignStatusActive && started && !ended
+
+	if c.Banner != nil {
+		p.Banner = &PublicBanner{
+			URL:      absolute(BannerPath(c.Slug, "")),
+			Width:    c.Banner.Width,
+			Height:   c.Banner.Height,
+			Variants: []PublicBannerVariant{},
+		}
+
+		for _, v := range c.Banner.Variants {
+			p.Banner.Variants = append(p.Banner.Variants, PublicBannerVariant{
+				Name:   v.Name,
+				URL:    absolute(BannerPath(c.Slug, v.Name)),
+				Width:  v.Width,
+				Height: v.Height,
+			})
+		}
+	}
+
+	return p
+}
+
+// BannerKey is the storage key of the banner of c or of its variant
+func BannerKey(c models.Campaign, variant string) (string, bool) {
+	if c.Banner == nil {
+		return "", false
+	}
+
+	if variant == "" {
+		return c.Banner.Key, true
+	}
+
+	for _, v := range c.Banner.Variants {
+		if v.Name == variant {
+			return v.Key, true
+		}
+	}
+
+	return "", false
+}
+
+// Vary shows p as the experiment variant key of c, the winner once there is
+// one. A variant with a banner of its own replaces the campaign's.
+func Vary(db database.Database, p PublicCampaign, c models.Campaign, key string) (PublicCampaign, error) {
+	p.Variant = experimentservice.Chosen(c, key)
+
+	asset, ok, err := variantBanner(db, c, p.Variant)
+
+	if err != nil || !ok {
+		return p, err
+	}
+
+	p.Banner = &PublicBanner{
+		URL:      absolute(BannerPath(c.Slug, "") + "?" + VariantParam + "=" + url.QueryEscape(p.Variant)),
+		Width:    asset.Width,
+		Height:   asset.Height,
+		Variants: []PublicBannerVariant{},
+	}
+
+	return p, nil
+}
+
+// VariantBannerKey is the storage key of the banner of the experiment
+// variant key of c
+func VariantBannerKey(db database.Database, c models.Campaign, key string) (string, error) {
+	asset, ok, err := variantBanner(db, c, experimentservice.Chosen(c, key))
+
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", ErrNotPublic
+	}
+
+	return asset.Key, nil
+}
+
+// variantBanner gets the asset the variant key of c shows as its banner, it
+// reports false when the variant has none or the asset was deleted
+func variantBanner(db database.Database, c models.Campaign, key string) (models.Asset, bool, error) {
+	asset := models.Asset{}
+	v, ok := experimentservice.Variant(c, key)
+
+	if !ok || v.BannerAssetID == "" {
+		return asset, false, nil
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(v.BannerAssetID)
+
+	db.SetCollection(models.AssetsCollection)
+
+	err := db.FindOne(bson.M{"_id": objid, "created_by": c.CreatedBy}, &asset)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return asset, false, nil
+	}
+
+	if err != nil {
+		slog.Error("Error getting variant banner", "campaign", c.ID, "error", err)
+
+		return asset, false, errors.New("error getting campaign")
+	}
+
+	return asset, true, nil
+}
@@ -0,0 +1,145 @@
+package campaignservice
+
+import (
+	"campaign/internal/models"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeSlug(t *testing.T) {
+	if slug, err := NormalizeSlug(" Summer-Sale-2024 "); err != nil || slug != "summer-sale-2024" {
+		t.Errorf("expected summer-sale-2024; got %s, %v", slug, err)
+	}
+
+	for _, slug := range []string{"", "ab", "summer sale", "summer--sale", "-sale", "sale-", "soldes_été", strings.Repeat("a", MaxSlugLength+1)} {
+		if _, err := NormalizeSlug(slug); !errors.Is(err, ErrInvalidSlug) {
+			t.Errorf("expected %q to be invalid; got %v", slug, err)
+		}
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	cases := map[string]string{
+		"Summer Sale 2024!":    "summer-sale-2024",
+		"  Back -- to School ": "back-to-school",
+		"Café Week":            "caf-week",
+		"!!":                   "",
+		"Go":                   "",
+	}
+
+	for name, want := range cases {
+		if got := Slugify(name); got != want {
+			t.Errorf("expected %q to be %q; got %q", name, want, got)
+		}
+	}
+
+	long := Slugify(strings.Repeat("word ", 30))
+
+	if len(long) > MaxSlugLength-slugSuffixLength-1 || strings.HasSuffix(long, "-") {
+		t.Errorf("expected a long name to be cut with room for a suffix; got %q", long)
+	}
+
+	slug, err := withSuffix(long)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NormalizeSlug(slug); err != nil {
+		t.Errorf("expected a suffixed slug to be valid; got %q, %v", slug, err)
+	}
+}
+
+func TestPublic(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	campaign := models.Campaign{
+		ID:        "c1",
+		Slug:      "summer-sale",
+		Name:      "Summer Sale",
+		Status:    models.CampaignStatusActive,
+		CreatedBy: "u1",
+		StartDate: now.Add(-time.Hour),
+		Banner: &models.Banner{
+			Key:      "banners/c1/original.png",
+			Variants: []models.BannerVariant{{Name: "small", Key: "banners/c1/small.png", Width: 320}},
+		},
+	}
+
+	p := Public(campaign, now)
+
+	if !p.Claimable {
+		t.Error("expected a started active campaign to be claimable")
+	}
+
+	if !strings.HasSuffix(p.PageURL, "/c/summer-sale") || !strings.HasSuffix(p.Banner.URL, "/public/campaigns/summer-sale/banner") {
+		t.Errorf("expected urls through the slug; got %s and %s", p.PageURL, p.Banner.URL)
+	}
+
+	if !strings.HasSuffix(p.Banner.Variants[0].URL, "/banner?variant=small") {
+		t.Errorf("expected the variant url to name it; got %s", p.Banner.Variants[0].URL)
+	}
+
+	body, err := json.Marshal(p)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, private := range []string{"u1", "banners/", "created_by", "status"} {
+		if strings.Contains(string(body), private) {
+			t.Errorf("expected %q not to be public; got %s", private, body)
+		}
+	}
+
+	if Public(campaign, now.Add(-2*time.Hour)).Claimable {
+		t.Error("expected a campaign that has not started not to be claimable")
+	}
+
+	campaign.EndDate = now.Add(-time.Minute)
+
+	if Public(campaign, now).Claimable {
+		t.Error("expected an ended campaign not to be claimable")
+	}
+}
+
+func TestBannerKey(t *testing.T) {
+	campaign := models.Campaign{Banner: &models.Banner{
+		Key:      "original",
+		Variants: []models.BannerVariant{{Name: "small", Key: "small"}},
+	}}
+
+	if key, ok := BannerKey(campaign, ""); !ok || key != "original" {
+		t.Errorf("expected the original banner; got %s", key)
+	}
+
+	if key, ok := BannerKey(campaign, "small"); !ok || key != "small" {
+		t.Errorf("expected the small variant; got %s", key)
+	}
+
+	if _, ok := BannerKey(campaign, "huge"); ok {
+		t.Error("expected an unknown variant not to be found")
+	}
+
+	if _, ok := BannerKey(models.Campaign{}, ""); ok {
+		t.Error("expected a campaign without a banner to have no key")
+	}
+}
+
+func TestWithVariant(t *testing.T) {
+	page := PageURL("summer-sale")
+
+	if dest := WithVariant(page+"?utm_source=sms", "b"); dest != page+"?utm_source=sms&v=b" {
+		t.Errorf("expected the variant on the landing page; got %s", dest)
+	}
+
+	if dest := WithVariant(page, ""); dest != page {
+		t.Errorf("expected no variant to leave the page alone; got %s", dest)
+	}
+
+	if dest := WithVariant("https://shop.example.com/sale", "b"); dest != "https://shop.example.com/sale" {
+		t.Errorf("expected other destinations to be left alone; got %s", dest)
+	}
+}
@@ -0,0 +1,194 @@
+package categoryservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNotFound = errors.New("category not found")
+	ErrExists   = errors.New("category already exists")
+)
+
+type Service interface {
+	CreateCategory(c models.Category) (models.Category, error)
+	GetCategories() ([]models.Category, error)
+	GetCategoryByID(id string) (models.Category, error)
+	UpdateCategory(id string, c models.Category) error
+	DeleteCategory(id string) error
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+func (s *service) CreateCategory(c models.Category) (models.Category, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return c, errors.New("error creating category")
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.CategoriesCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":         objid,
+		"name":        c.Name,
+		"description": c.Description,
+		"created_by":  user.Sub,
+		"created_at":  now,
+		"updated_at":  now,
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return c, fmt.Errorf("%w: %s", ErrExists, c.Name)
+	}
+
+	if err != nil {
+		slog.Error("Error creating category", "error", err)
+
+		return c, errors.New("error creating category")
+	}
+
+	c.ID = objid.Hex()
+	c.CreatedBy = user.Sub
+	c.CreatedAt = now
+	c.UpdatedAt = now
+
+	return c, nil
+}
+
+func (s *service) GetCategories() ([]models.Category, error) {
+	categories := []models.Category{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return categories, errors.New("error getting categories")
+	}
+
+	s.db.SetCollection(models.CategoriesCollection)
+
+	err = s.db.FindMany(bson.M{"created_by": user.Sub}, &categories)
+
+	if err != nil {
+		slog.Error("Error getting categories", "error", err)
+
+		return categories, errors.New("error getting categories")
+	}
+
+	return categories, nil
+}
+
+func (s *service) GetCategoryByID(id string) (models.Category, error) {
+	category := models.Category{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return category, errors.New("error getting category")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return category, fmt.Errorf("%w: invalid category id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CategoriesCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &category)
+
+	if err != nil {
+		slog.Error("Error getting category", "error", err)
+
+		return category, fmt.Errorf("%w: no categories with id: %s found", ErrNotFound, id)
+	}
+
+	return category, nil
+}
+
+func (s *service) UpdateCategory(id string, c models.Category) error {
+	existing, err := s.GetCategoryByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": existing.CreatedBy}, bson.M{
+		"name":        c.Name,
+		"description": c.Description,
+		"updated_at":  time.Now().Local(),
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrExists, c.Name)
+	}
+
+	if err != nil {
+		slog.Error("Error updating category", "error", err)
+
+		return fmt.Errorf("could not update category with id: %s", id)
+	}
+
+	return nil
+}
+
+// DeleteCategory removes the category and clears it from the campaigns using it
+func (s *service) DeleteCategory(id string) error {
+	existing, err := s.GetCategoryByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	err = s.db.DeleteOne(bson.M{"_id": objid, "created_by": existing.CreatedBy})
+
+	if err != nil {
+		slog.Error("Error deleting category", "error", err)
+
+		return fmt.Errorf("could not delete category with id: %s", id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.UpdateManyRaw(bson.M{"created_by": existing.CreatedBy, "category_id": id}, bson.M{
+		"$set": bson.M{"category_id": ""},
+	})
+
+	if err != nil {
+		slog.Error("Error clearing category from campaigns", "error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package claimservice
+
+import (
+	"bytes"
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	"campaign/internal/webhook"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// CallbackSecretPrefix starts every callback secret so they are
+	// recognisable in logs and secret scanners
+	CallbackSecretPrefix = "cs_"
+
+	// CallbackEvent names the payload posted to callback urls
+	CallbackEvent = "claim.processed"
+
+	CallbackAttempts = 8
+	callbackTimeout  = 10 * time.Second
+)
+
+// Callback is posted to a claim's callback url. It is signed like the
+// webhooks this service takes: X-Signature holds sha256= and the hex
+// HMAC-SHA256 of "<X-Signature-Timestamp>.<body>" keyed with the campaign's
+// callback secret.
+type Callback struct {
+	Event string      `json:"event"`
+	Claim ClaimStatus `json:"claim"`
+}
+
+// callbackClient does not follow redirects, they could lead away from the
+// hosts the campaign allowed
+var callbackClient = &http.Client{
+	Timeout: callbackTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// NewCallbackSecret returns a random secret to sign callbacks with
+func NewCallbackSecret() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return CallbackSecretPrefix + hex.EncodeToString(b), nil
+}
+
+// SignCallback returns the signature headers for body sent at ts
+func SignCallback(secret string, ts time.Time, body []byte) map[string]string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+
+	return map[string]string{
+		webhook.TimestampHeader: timestamp,
+		webhook.SignatureHeader: "sha256=" + hex.EncodeToString(webhook.Sign(secret, timestamp, body)),
+	}
+}
+
+// queueCallback queues the CallbackJob of a decided claim once
+func (p *Processor) queueCallback(ctx context.Context, db database.Database, claim models.Claim) error {
+	if claim.CallbackURL == "" || claim.CallbackStatus != "" || !Decided(claim.Status) {
+		return nil
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(claim.ID)
+
+	db.SetCollection(models.ClaimsCollection)
+
+	err := db.FindOneAndUpdate(
+		bson.M{"_id": objid, "callback_status": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"callback_status": models.ClaimCallbackQueued}},
+		nil,
+		&bson.M{},
+	)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = p.jobs.Enqueue(ctx, CallbackJob, map[string]interface{}{"claim_id": claim.ID}, queue.Options{
+		MaxAttempts: CallbackAttempts,
+		CreatedBy:   claim.CreatedBy,
+	})
+
+	if err != nil {
+		// unmarked so the retried ProcessJob queues it again
+		db.SetCollection(models.ClaimsCollection)
+
+		if err := db.UpdateOneRaw(bson.M{"_id": objid}, bson.M{"$unset": bson.M{"callback_status": ""}}); err != nil {
+			slog.Error("Error unmarking claim callback", "claim", claim.ID, "error", err)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Deliver runs a CallbackJob. Client errors other than timeouts and rate
+// limits are not retried, the callback is marked failed once the job gives
+// up.
+func (p *Processor) Deliver(ctx context.Context, job models.Job) error {
+	db := database.NewDatabaseService(ctx, p.db, models.ClaimsCollection)
+
+	claim, err := find(db, job.Payload["claim_id"])
+
+	if err != nil {
+		return err
+	}
+
+	err = p.deliver(ctx, db, claim)
+
+	status := models.ClaimCallbackDelivered
+
+	if err != nil {
+		if !queue.IsPermanent(err) && job.Attempts < job.MaxAttempts {
+			return err
+		}
+
+		status = models.ClaimCallbackFailed
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(claim.ID)
+
+	db.SetCollection(models.ClaimsCollection)
+
+	if err := db.UpdateOne(bson.M{"_id": objid}, bson.M{"callback_status": status}); err != nil {
+		slog.Error("Error updating claim callback", "claim", claim.ID, "error", err)
+	}
+
+	return err
+}
+
+func (p *Processor) deliver(ctx context.Context, db database.Database, claim models.Claim) error {
+	campaign := models.Campaign{}
+	objid, _ := primitive.ObjectIDFromHex(claim.CampaignID)
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err := db.FindOne(bson.M{"_id": objid}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return queue.Permanent(errors.New("campaign no longer exists"))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// checked again as the owner may have since removed the host
+	if _, err := CallbackURL(campaign, claim.CallbackURL); err != nil {
+		return queue.Permanent(err)
+	}
+
+	body, err := json.Marshal(Callback{Event: CallbackEvent, Claim: StatusOf(claim)})
+
+	if err != nil {
+		return queue.Permanent(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, claim.CallbackURL, bytes.NewReader(body))
+
+	if err != nil {
+		return queue.Permanent(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for k, v := range SignCallback(campaign.CallbackSecret, time.Now(), body) {
+		req.Header.Set(k, v)
+	}
+
+	res, err := callbackClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		return fmt.Errorf("callback returned %d", res.StatusCode)
+	default:
+		return queue.Permanent(fmt.Errorf("callback returned %d", res.StatusCode))
+	}
+}
@@ -0,0 +1,687 @@
+package claimservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	"campaign/internal/sendwindow"
+	contactservice "campaign/internal/services/contact"
+	experimentservice "campaign/internal/services/experiment"
+	riskservice "campaign/internal/services/risk"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ReferencePrefix starts every claim reference e.g. CL7K2M9QX4HB3D
+	ReferencePrefix = "CL"
+	ReferenceLength = 12
+
+	// ClaimMetric is the goal metric every accepted claim is recorded under
+	ClaimMetric = "claims"
+
+	referenceAttempts = 5
+
+	// StatusPath is the route prefix claim statuses are read from
+	StatusPath = "/api/claim-status/"
+
+	MaxCallbackURLLength = 2048
+	MaxDeviceIDLength    = 128
+
+	// MaxWait bounds a long polled status read, it stays under the server
+	// write timeout
+	MaxWait      = 25 * time.Second
+	PollInterval = time.Second
+)
+
+var publicBaseURL = os.Getenv("PUBLIC_BASE_URL")
+
+// referenceAlphabet is Crockford base32, references are read out over the
+// phone so there is no I, L, O or U
+const referenceAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+
+	// ErrUnavailable is returned for campaigns that are not taking claims
+	ErrUnavailable = errors.New("campaign is not accepting claims")
+
+	// ErrLimitReached is returned when the contact or the campaign has no
+	// claims left
+	ErrLimitReached = errors.New("claim limit reached")
+)
+
+// ClaimRequest is a claim as submitted by the public. IP and UserAgent are
+// filled in from the request.
+type ClaimRequest struct {
+	CampaignID string `json:"campaign_id"`
+	Name       string `json:"name"`
+	Msisdn     string `json:"msisdn"`
+	Email      string `json:"email"`
+
+	// CallbackURL is posted the result once the claim has been processed
+	CallbackURL string `json:"callback_url"`
+
+	// DeviceID is a fingerprint of the claimant's device from the client,
+	// claims sharing one raise the risk score
+	DeviceID string `json:"device_id"`
+
+	// Variant is the experiment variant of the landing page the claim was
+	// made on
+	Variant string `json:"variant"`
+
+	IP        string `json:"-"`
+	UserAgent string `json:"-"`
+}
+
+// ClaimStatus is what anyone holding a reference may see of the claim
+type ClaimStatus struct {
+	Reference  string    `json:"reference"`
+	CampaignID string    `json:"campaign_id"`
+	Status     string    `json:"status"`
+	Reason     string    `json:"reason,omitempty"`
+	Code       string    `json:"code,omitempty"`
+	StatusURL  string    `json:"status_url"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// StatusURL is where the status of the claim with reference can be read
+func StatusURL(reference string) string {
+	return strings.TrimRight(publicBaseURL, "/") + StatusPath + reference
+}
+
+// StatusOf is the public view of c, the code is only shown once the claim
+// has been approved
+func StatusOf(c models.Claim) ClaimStatus {
+	if c.Status != models.ClaimStatusApproved && c.Status != models.ClaimStatusFulfilled {
+		c.Code = ""
+	}
+
+	return ClaimStatus{
+		Reference:  c.Reference,
+		CampaignID: c.CampaignID,
+		Status:     c.Status,
+		Reason:     c.Reason,
+		Code:       c.Code,
+		StatusURL:  StatusURL(c.Reference),
+		CreatedAt:  c.CreatedAt,
+		UpdatedAt:  c.UpdatedAt,
+	}
+}
+
+// Limits are the claim settings of c with their defaults filled in
+func Limits(c models.Campaign) models.ClaimSettings {
+	limits := models.ClaimSettings{PerContact: 1}
+
+	if c.Claims != nil {
+		limits.MaxClaims = c.Claims.MaxClaims
+
+		if c.Claims.PerContact > 0 {
+			limits.PerContact = c.Claims.PerContact
+		}
+	}
+
+	return limits
+}
+
+// Open checks c takes claims at now: it must be active and between its
+// start and end dates
+func Open(c models.Campaign, now time.Time) error {
+	if c.Status != models.CampaignStatusActive {
+		return ErrUnavailable
+	}
+
+	if !c.StartDate.IsZero() && now.Before(c.StartDate) {
+		return fmt.Errorf("%w: campaign has not started", ErrUnavailable)
+	}
+
+	if !c.EndDate.IsZero() && now.After(c.EndDate) {
+		return fmt.Errorf("%w: campaign has ended", ErrUnavailable)
+	}
+
+	return nil
+}
+
+// NewReference returns a random claim reference
+func NewReference() (string, error) {
+	ref := make([]byte, ReferenceLength)
+	max := big.NewInt(int64(len(referenceAlphabet)))
+
+	for i := range ref {
+		n, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		ref[i] = referenceAlphabet[n.Int64()]
+	}
+
+	return ReferencePrefix + string(ref), nil
+}
+
+// NormalizeReference undoes the ways people retype a reference: lower case,
+// spaces and dashes
+func NormalizeReference(ref string) string {
+	ref = strings.ToUpper(ref)
+
+	return strings.NewReplacer(" ", "", "-", "").Replace(ref)
+}
+
+// Submit accepts a claim on a campaign for the contact in req and queues
+// it for processing. Only what can be told without touching the limits is
+// checked here, the claim is approved or rejected by the ProcessJob.
+func Submit(ctx context.Context, db database.Database, jobs *queue.Queue, req ClaimRequest) (models.Claim, error) {
+	claim := models.Claim{}
+
+	objid, err := primitive.ObjectIDFromHex(req.CampaignID)
+
+	if err != nil {
+		return claim, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, req.CampaignID)
+	}
+
+	campaign := models.Campaign{}
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err = db.FindOne(bson.M{"_id": objid}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return claim, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, req.CampaignID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return claim, errors.New("error submitting claim")
+	}
+
+	now := time.Now().Local()
+
+	if err := Open(campaign, now); err != nil {
+		return claim, err
+	}
+
+	contact, err := contactservice.NormalizeContact(models.Contact{Name: req.Name, Msisdn: req.Msisdn, Email: req.Email})
+
+	if err != nil {
+		return claim, err
+	}
+
+	callbackURL, err := CallbackURL(campaign, req.CallbackURL)
+
+	if err != nil {
+		return claim, err
+	}
+
+	deviceID := strings.TrimSpace(req.DeviceID)
+
+	if len(deviceID) > MaxDeviceIDLength {
+		return claim, fmt.Errorf("%w: device_id must not be longer than %d characters", ErrInvalid, MaxDeviceIDLength)
+	}
+
+	claim = models.Claim{
+		ID:           primitive.NewObjectID().Hex(),
+		CampaignID:   objid.Hex(),
+		Name:         contact.Name,
+		Msisdn:       contact.Msisdn,
+		Email:        contact.Email,
+		Status:       models.ClaimStatusReceived,
+		CallbackURL:  callbackURL,
+		IP:           req.IP,
+		DeviceID:     deviceID,
+		EmailKey:     riskservice.EmailKey(contact.Email),
+		MsisdnPrefix: riskservice.MsisdnPrefix(contact.Msisdn),
+		UserAgent:    req.UserAgent,
+		Variant:      experimentservice.Chosen(campaign, req.Variant),
+		CreatedBy:    campaign.CreatedBy,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := insert(db, &claim); err != nil {
+		return claim, err
+	}
+
+	_, err = jobs.Enqueue(ctx, ProcessJob, map[string]interface{}{"claim_id": claim.ID}, queue.Options{CreatedBy: claim.CreatedBy})
+
+	if err != nil {
+		slog.Error("Error queueing claim", "claim", claim.ID, "error", err)
+
+		// nothing will pick the claim up, it is dropped so it does not sit
+		// received forever
+		cid, _ := primitive.ObjectIDFromHex(claim.ID)
+
+		db.SetCollection(models.ClaimsCollection)
+
+		if err := db.DeleteOne(bson.M{"_id": cid}); err != nil {
+			slog.Error("Error removing unqueued claim", "claim", claim.ID, "error", err)
+		}
+
+		return claim, errors.New("error submitting claim")
+	}
+
+	return claim, nil
+}
+
+// CallbackURL checks a client supplied callback url. Results are only
+// posted over https to a host the campaign owner allowed and when the
+// campaign has a secret to sign them with.
+func CallbackURL(c models.Campaign, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+
+	if raw == "" {
+		return "", nil
+	}
+
+	if c.CallbackSecret == "" || c.Claims == nil || len(c.Claims.CallbackHosts) == 0 {
+		return "", fmt.Errorf("%w: this campaign does not take claim callbacks", ErrInvalid)
+	}
+
+	u, err := url.Parse(raw)
+
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || len(raw) > MaxCallbackURLLength {
+		return "", fmt.Errorf("%w: callback_url must be an https url", ErrInvalid)
+	}
+
+	if !slices.Contains(c.Claims.CallbackHosts, strings.ToLower(u.Hostname())) {
+		return "", fmt.Errorf("%w: callback_url host %s is not allowed for this campaign", ErrInvalid, u.Hostname())
+	}
+
+	return u.String(), nil
+}
+
+// existing finds the contact of the campaign owner with the msisdn or,
+// failing that, the email of c
+func existing(db database.Database, createdBy string, c models.Contact) (models.Contact, error) {
+	db.SetCollection(models.ContactsCollection)
+
+	err := mongo.ErrNoDocuments
+
+	for _, f := range [][2]string{{"msisdn", c.Msisdn}, {"email", c.Email}} {
+		if f[1] == "" {
+			continue
+		}
+
+		contact := models.Contact{}
+
+		err = db.FindOne(bson.M{"created_by": createdBy, f[0]: f[1]}, &contact)
+
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return contact, err
+		}
+	}
+
+	return models.Contact{}, err
+}
+
+// claimant finds the contact of the campaign owner with the msisdn or,
+// failing that, the email of c and creates them when there is none
+func claimant(db database.Database, createdBy string, c models.Contact) (string, error) {
+	contact, err := existing(db, createdBy, c)
+
+	if err == nil {
+		return contact.ID, nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error getting contact", "error", err)
+
+		return "", errors.New("error submitting claim")
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	doc := bson.M{
+		"_id":        objid,
+		"name":       c.Name,
+		"attributes": map[string]interface{}{},
+		"consent":    models.Consent{},
+		"list_ids":   []string{},
+		"created_by": createdBy,
+		"created_at": now,
+		"updated_at": now,
+	}
+
+	if c.Email != "" {
+		doc["email"] = c.Email
+	}
+
+	if c.Msisdn != "" {
+		doc["msisdn"] = c.Msisdn
+
+		if zone := sendwindow.FromMsisdn(c.Msisdn); zone != "" {
+			doc["time_zone"] = zone
+		}
+	}
+
+	err = db.InsertOne(doc)
+
+	// a concurrent claim created the contact first
+	if mongo.IsDuplicateKeyError(err) {
+		contact, err = existing(db, createdBy, c)
+	} else {
+		contact.ID = objid.Hex()
+	}
+
+	if err != nil {
+		slog.Error("Error creating contact", "error", err)
+
+		return "", errors.New("error submitting claim")
+	}
+
+	return contact.ID, nil
+}
+
+// reserve takes one claim off the contact's and then the campaign's
+// allowance. The contact counter is unique per campaign and contact, an
+// upsert that finds it used up collides with it instead of inserting.
+//
+// The claim is marked reserved before the counters are taken and a claim
+// already marked is not counted again, so a retried job cannot take a
+// second place. A worker lost between the two leaves the claim without its
+// places, one claim too many may then get through rather than one place
+// being lost for good.
+func reserve(db database.Database, claim models.Claim, limits models.ClaimSettings) error {
+	objid, _ := primitive.ObjectIDFromHex(claim.ID)
+
+	db.SetCollection(models.ClaimsCollection)
+
+	err := db.FindOneAndUpdate(
+		bson.M{"_id": objid, "status": models.ClaimStatusReceived, "reserved": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"reserved": true, "contact_id": claim.ContactID}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1}),
+		&bson.M{},
+	)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+
+	if err != nil {
+		slog.Error("Error reserving claim", "claim", claim.ID, "error", err)
+
+		return errors.New("error submitting claim")
+	}
+
+	db.SetCollection(models.ClaimCountersCollection)
+
+	err = db.FindOneAndUpdate(
+		bson.M{"campaign_id": claim.CampaignID, "contact_id": claim.ContactID, "count": bson.M{"$lt": limits.PerContact}},
+		bson.M{"$inc": bson.M{"count": 1}, "$set": bson.M{"updated_at": claim.CreatedAt}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		&bson.M{},
+	)
+
+	if err != nil {
+		unmark(db, claim)
+	}
+
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: this campaign can be claimed %d time(s) per person", ErrLimitReached, limits.PerContact)
+	}
+
+	if err != nil {
+		slog.Error("Error reserving contact claim", "error", err)
+
+		return errors.New("error submitting claim")
+	}
+
+	campaignID, _ := primitive.ObjectIDFromHex(claim.CampaignID)
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err = db.FindOneAndUpdate(
+		bson.M{
+			"_id":    campaignID,
+			"status": models.CampaignStatusActive,
+			"$expr": bson.M{"$or": bson.A{
+				bson.M{"$lte": bson.A{bson.M{"$ifNull": bson.A{"$claims.max_claims", 0}}, 0}},
+				bson.M{"$lt": bson.A{bson.M{"$ifNull": bson.A{"$claim_count", 0}}, "$claims.max_claims"}},
+			}},
+		},
+		bson.M{"$inc": bson.M{"claim_count": 1}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1}),
+		&bson.M{},
+	)
+
+	if err == nil {
+		return nil
+	}
+
+	releaseContact(db, claim)
+	unmark(db, claim)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: all rewards of this campaign have been claimed", ErrLimitReached)
+	}
+
+	slog.Error("Error reserving campaign claim", "error", err)
+
+	return errors.New("error submitting claim")
+}
+
+// release gives back what reserve took, for claims that fail or are
+// rejected. Only a claim still marked reserved gives its places back so a
+// second release does nothing.
+func release(db database.Database, claim models.Claim) {
+	reserved, ok := unmark(db, claim)
+
+	if !ok {
+		return
+	}
+
+	// the contact the places were reserved for, the claim may not know it
+	// when an earlier attempt reserved them
+	if reserved.ContactID != "" {
+		claim.ContactID = reserved.ContactID
+	}
+
+	releaseContact(db, claim)
+
+	objid, _ := primitive.ObjectIDFromHex(claim.CampaignID)
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err := db.UpdateOneRaw(bson.M{"_id": objid, "claim_count": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"claim_count": -1}})
+
+	if err != nil {
+		slog.Error("Error releasing campaign claim", "campaign", claim.CampaignID, "error", err)
+	}
+}
+
+// unmark clears the reserved mark of claim and returns the claim as it was
+// reserved, it reports whether the mark was set
+func unmark(db database.Database, claim models.Claim) (models.Claim, bool) {
+	reserved := models.Claim{}
+	objid, _ := primitive.ObjectIDFromHex(claim.ID)
+
+	db.SetCollection(models.ClaimsCollection)
+
+	err := db.FindOneAndUpdate(
+		bson.M{"_id": objid, "reserved": true},
+		bson.M{"$unset": bson.M{"reserved": ""}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1, "contact_id": 1}),
+		&reserved,
+	)
+
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error releasing claim", "claim", claim.ID, "error", err)
+	}
+
+	return reserved, err == nil
+}
+
+func releaseContact(db database.Database, claim models.Claim) {
+	db.SetCollection(models.ClaimCountersCollection)
+
+	err := db.UpdateOneRaw(
+		bson.M{"campaign_id": claim.CampaignID, "contact_id": claim.ContactID, "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}},
+	)
+
+	if err != nil {
+		slog.Error("Error releasing contact claim", "campaign", claim.CampaignID, "contact", claim.ContactID, "error", err)
+	}
+}
+
+func insert(db database.Database, claim *models.Claim) error {
+	db.SetCollection(models.ClaimsCollection)
+
+	var err error
+
+	objid, _ := primitive.ObjectIDFromHex(claim.ID)
+
+	for attempt := 0; attempt < referenceAttempts; attempt++ {
+		claim.Reference, err = NewReference()
+
+		if err != nil {
+			slog.Error("Error generating claim reference", "error", err)
+
+			return errors.New("error submitting claim")
+		}
+
+		doc := bson.M{
+			"_id":          objid,
+			"reference":    claim.Reference,
+			"campaign_id":  claim.CampaignID,
+			"contact_id":   claim.ContactID,
+			"name":         claim.Name,
+			"msisdn":       claim.Msisdn,
+			"email":        claim.Email,
+			"status":       claim.Status,
+			"code":         claim.Code,
+			"voucher_id":   claim.VoucherID,
+			"callback_url": claim.CallbackURL,
+			"ip":           claim.IP,
+			"user_agent":   claim.UserAgent,
+			"created_by":   claim.CreatedBy,
+			"created_at":   claim.CreatedAt,
+			"updated_at":   claim.UpdatedAt,
+		}
+
+		// the risk signals and variant are only stored when known so claims
+		// without them never match each other
+		for field, value := range map[string]string{
+			"device_id":     claim.DeviceID,
+			"email_key":     claim.EmailKey,
+			"msisdn_prefix": claim.MsisdnPrefix,
+			"variant":       claim.Variant,
+		} {
+			if value != "" {
+				doc[field] = value
+			}
+		}
+
+		err = db.InsertOne(doc)
+
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		slog.Error("Error creating claim", "error", err)
+
+		return errors.New("error submitting claim")
+	}
+
+	return nil
+}
+
+// recordActivity counts the claim toward the campaign claims metric and
+// sets the contact last_claim_at activity, failures are only logged
+func recordActivity(db database.Database, claim models.Claim) {
+	db.SetCollection(models.MetricEventsCollection)
+
+	err := db.InsertOne(bson.M{
+		"campaign_id": claim.CampaignID,
+		"metric":      ClaimMetric,
+		"value":       1.0,
+		"occurred_at": claim.CreatedAt,
+		"created_at":  claim.CreatedAt,
+	})
+
+	if err != nil {
+		slog.Error("Error recording claim metric", "error", err)
+	}
+
+	contactID, _ := primitive.ObjectIDFromHex(claim.ContactID)
+
+	db.SetCollection(models.ContactsCollection)
+
+	err = db.UpdateOne(bson.M{"_id": contactID, "created_by": claim.CreatedBy}, bson.M{"activity.last_claim_at": claim.CreatedAt})
+
+	if err != nil {
+		slog.Error("Error updating contact activity", "error", err)
+	}
+}
+
+// Status looks a claim up by its reference
+func Status(db database.Database, reference string) (ClaimStatus, error) {
+	claim := models.Claim{}
+	reference = NormalizeReference(reference)
+
+	if !strings.HasPrefix(reference, ReferencePrefix) || len(reference) != len(ReferencePrefix)+ReferenceLength {
+		return ClaimStatus{}, fmt.Errorf("%w: no claims with reference: %s found", ErrNotFound, reference)
+	}
+
+	db.SetCollection(models.ClaimsCollection)
+
+	err := db.FindOne(bson.M{"reference": reference}, &claim)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ClaimStatus{}, fmt.Errorf("%w: no claims with reference: %s found", ErrNotFound, reference)
+	}
+
+	if err != nil {
+		slog.Error("Error getting claim", "error", err)
+
+		return ClaimStatus{}, errors.New("error getting claim")
+	}
+
+	return StatusOf(claim), nil
+}
+
+// Wait reads a claim like Status but holds on while its status is still
+// seen, received when empty, checking again every PollInterval until it
+// changes, ctx is done or wait has passed. wait is capped at MaxWait.
+func Wait(ctx context.Context, db database.Database, reference, seen string, wait time.Duration) (ClaimStatus, error) {
+	if seen == "" {
+		seen = models.ClaimStatusReceived
+	}
+
+	wait = min(wait, MaxWait)
+	deadline := time.Now().Add(wait)
+
+	for {
+		status, err := Status(db, reference)
+
+		if err != nil || status.Status != seen || time.Now().Add(PollInterval).After(deadline) {
+			return status, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, nil
+		case <-time.After(PollInterval):
+		}
+	}
+}
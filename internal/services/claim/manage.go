@@ -0,0 +1,517 @@
+package claimservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	contactservice "campaign/internal/services/contact"
+	eligibilityservice "campaign/internal/services/eligibility"
+	voucherservice "campaign/internal/services/voucher"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// transitions are the statuses a claim may move to from each status,
+// rejected and fulfilled claims are final
+var transitions = map[string][]string{
+	models.ClaimStatusPending:  {models.ClaimStatusApproved, models.ClaimStatusRejected},
+	models.ClaimStatusApproved: {models.ClaimStatusFulfilled, models.ClaimStatusRejected},
+}
+
+type ClaimFilter struct {
+	Status string
+	Page   int
+	Limit  int
+}
+
+type ClaimPage struct {
+	Claims []models.Claim `json:"claims"`
+	Total  int64          `json:"total"`
+	Page   int            `json:"page"`
+	Limit  int            `json:"limit"`
+}
+
+// ReviewFilter narrows the review queue to a campaign or to claims scoring
+// at least MinScore
+type ReviewFilter struct {
+	CampaignID string
+	MinScore   int
+	Page       int
+	Limit      int
+}
+
+type StatusRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+const (
+	// CheckOpen, CheckContactLimit and CheckCampaignLimit name the checks
+	// every claim goes through before the campaign's eligibility rules
+	CheckOpen          = "open"
+	CheckContactLimit  = "contact_limit"
+	CheckCampaignLimit = "campaign_limit"
+)
+
+// EligibilityRequest names who to check and, optionally, when
+type EligibilityRequest struct {
+	Msisdn string     `json:"msisdn"`
+	Email  string     `json:"email"`
+	IP     string     `json:"ip"`
+	At     *time.Time `json:"at"`
+}
+
+type Service interface {
+	GetClaims(campaignID string, f ClaimFilter) (ClaimPage, error)
+	UpdateClaimStatus(campaignID, claimID string, req StatusRequest) (models.Claim, error)
+	RotateCallbackSecret(campaignID string) (string, error)
+	CheckEligibility(campaignID string, req EligibilityRequest) (eligibilityservice.Result, error)
+	GetReviewQueue(f ReviewFilter) (ClaimPage, error)
+	ReviewClaim(claimID string, req StatusRequest) (models.Claim, error)
+}
+
+type service struct {
+	ctx  context.Context
+	db   database.Database
+	jobs *queue.Queue
+}
+
+// NewService takes the job queue held claims are handed back to once they
+// are reviewed, so the claimant is told and the callback is posted
+func NewService(ctx context.Context, db database.Database, jobs *queue.Queue) Service {
+	return &service{ctx: ctx, db: db, jobs: jobs}
+}
+
+// CanTransition tells whether a claim in status from may be moved to status to
+func CanTransition(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+func (s *service) GetClaims(campaignID string, f ClaimFilter) (ClaimPage, error) {
+	page := ClaimPage{Claims: []models.Claim{}}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return page, err
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageSize
+	}
+
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+
+	page.Page, page.Limit = f.Page, f.Limit
+
+	filter := bson.M{"campaign_id": campaign.ID, "created_by": campaign.CreatedBy}
+
+	if f.Status != "" {
+		filter["status"] = strings.ToLower(f.Status)
+	}
+
+	s.db.SetCollection(models.ClaimsCollection)
+
+	page.Total, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting claims", "error", err)
+
+		return page, errors.New("error getting claims")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((f.Page - 1) * f.Limit)).
+		SetLimit(int64(f.Limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &page.Claims)
+
+	if err != nil {
+		slog.Error("Error getting claims", "error", err)
+
+		return page, errors.New("error getting claims")
+	}
+
+	return page, nil
+}
+
+// UpdateClaimStatus moves a claim along its lifecycle. A rejected claim
+// gives its place back to the contact and campaign limits and its code is
+// voided, or put back when it was held and the claimant never saw it.
+func (s *service) UpdateClaimStatus(campaignID, claimID string, req StatusRequest) (models.Claim, error) {
+	claim := models.Claim{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return claim, err
+	}
+
+	objid, err := primitive.ObjectIDFromHex(claimID)
+
+	if err != nil {
+		return claim, fmt.Errorf("%w: no claims with id: %s found", ErrNotFound, claimID)
+	}
+
+	filter := bson.M{"_id": objid, "campaign_id": campaign.ID, "created_by": campaign.CreatedBy}
+
+	s.db.SetCollection(models.ClaimsCollection)
+
+	err = s.db.FindOne(filter, &claim)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return claim, fmt.Errorf("%w: no claims with id: %s found", ErrNotFound, claimID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting claim", "error", err)
+
+		return claim, errors.New("error updating claim")
+	}
+
+	status := strings.ToLower(strings.TrimSpace(req.Status))
+
+	if !CanTransition(claim.Status, status) {
+		return claim, fmt.Errorf("%w: a %s claim cannot be %s", ErrInvalid, claim.Status, status)
+	}
+
+	// the current status is part of the filter so two reviewers cannot both
+	// reject a claim and release it twice
+	filter["status"] = claim.Status
+	now := time.Now().Local()
+
+	err = s.db.FindOneAndUpdate(filter, bson.M{"$set": bson.M{
+		"status":     status,
+		"reason":     strings.TrimSpace(req.Reason),
+		"updated_at": now,
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After), &claim)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return claim, fmt.Errorf("%w: the claim was updated by someone else, reload it", ErrInvalid)
+	}
+
+	if err != nil {
+		slog.Error("Error updating claim", "error", err)
+
+		return claim, errors.New("error updating claim")
+	}
+
+	held := filter["status"] == models.ClaimStatusPending
+
+	switch {
+	case status == models.ClaimStatusRejected && held:
+		release(s.db, claim)
+		voucherservice.Unissue(s.db, claim.VoucherID)
+	case status == models.ClaimStatusRejected:
+		release(s.db, claim)
+		voucherservice.Void(s.db, claim.VoucherID)
+	}
+
+	if held {
+		_, err = s.jobs.Enqueue(s.ctx, ProcessJob, map[string]interface{}{"claim_id": claim.ID}, queue.Options{CreatedBy: claim.CreatedBy})
+
+		if err != nil {
+			slog.Error("Error queueing reviewed claim, the claimant is not told", "claim", claim.ID, "error", err)
+		}
+	}
+
+	return claim, nil
+}
+
+// GetReviewQueue lists the held claims across the user's campaigns, the
+// riskiest first
+func (s *service) GetReviewQueue(f ReviewFilter) (ClaimPage, error) {
+	page := ClaimPage{Claims: []models.Claim{}}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return page, errors.New("error getting claims")
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageSize
+	}
+
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+
+	page.Page, page.Limit = f.Page, f.Limit
+
+	filter := bson.M{"created_by": user.Sub, "status": models.ClaimStatusPending}
+
+	if f.CampaignID != "" {
+		filter["campaign_id"] = f.CampaignID
+	}
+
+	if f.MinScore > 0 {
+		filter["risk.score"] = bson.M{"$gte": f.MinScore}
+	}
+
+	s.db.SetCollection(models.ClaimsCollection)
+
+	page.Total, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting held claims", "error", err)
+
+		return page, errors.New("error getting claims")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "risk.score", Value: -1}, {Key: "created_at", Value: 1}}).
+		SetSkip(int64((f.Page - 1) * f.Limit)).
+		SetLimit(int64(f.Limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &page.Claims)
+
+	if err != nil {
+		slog.Error("Error getting held claims", "error", err)
+
+		return page, errors.New("error getting claims")
+	}
+
+	return page, nil
+}
+
+// ReviewClaim approves or rejects a held claim of any of the user's
+// campaigns
+func (s *service) ReviewClaim(claimID string, req StatusRequest) (models.Claim, error) {
+	claim := models.Claim{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return claim, errors.New("error updating claim")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(claimID)
+
+	if err != nil {
+		return claim, fmt.Errorf("%w: no claims with id: %s found", ErrNotFound, claimID)
+	}
+
+	s.db.SetCollection(models.ClaimsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &claim)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return claim, fmt.Errorf("%w: no claims with id: %s found", ErrNotFound, claimID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting claim", "error", err)
+
+		return claim, errors.New("error updating claim")
+	}
+
+	if claim.Status != models.ClaimStatusPending {
+		return claim, fmt.Errorf("%w: only held claims are reviewed, this one is %s", ErrInvalid, claim.Status)
+	}
+
+	return s.UpdateClaimStatus(claim.CampaignID, claimID, req)
+}
+
+// RotateCallbackSecret replaces the secret claim callbacks of the campaign
+// are signed with, callbacks already queued are signed with the new one
+func (s *service) RotateCallbackSecret(campaignID string) (string, error) {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := NewCallbackSecret()
+
+	if err != nil {
+		slog.Error("Error generating callback secret", "error", err)
+
+		return "", errors.New("error rotating callback secret")
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(campaign.ID)
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": campaign.CreatedBy}, bson.M{
+		"callback_secret": secret,
+		"updated_at":      time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error rotating callback secret", "error", err)
+
+		return "", errors.New("error rotating callback secret")
+	}
+
+	return secret, nil
+}
+
+// CheckEligibility is a dry run of a claim: it tells whether the person in
+// req could claim at req.At, now by default, and which checks they fail.
+// Nothing is reserved or recorded.
+func (s *service) CheckEligibility(campaignID string, req EligibilityRequest) (eligibilityservice.Result, error) {
+	result := eligibilityservice.Result{Eligible: true, Checks: []models.EligibilityCheck{}}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return result, err
+	}
+
+	contact, err := contactservice.NormalizeContact(models.Contact{Msisdn: req.Msisdn, Email: req.Email})
+
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now().Local()
+
+	if req.At != nil {
+		now = req.At.Local()
+	}
+
+	open := models.EligibilityCheck{Rule: -1, Type: CheckOpen, Passed: true}
+
+	if err := Open(campaign, now); err != nil {
+		open.Passed, open.Reason = false, err.Error()
+	}
+
+	result.Add(open)
+
+	limits := Limits(campaign)
+	claimed := models.EligibilityCheck{Rule: -1, Type: CheckCampaignLimit, Passed: true}
+
+	if limits.MaxClaims > 0 && campaign.ClaimCount >= limits.MaxClaims {
+		claimed.Passed, claimed.Reason = false, "all rewards of this campaign have been claimed"
+	}
+
+	result.Add(claimed)
+
+	used, err := s.claimsBy(campaign, contact)
+
+	if err != nil {
+		return result, err
+	}
+
+	perContact := models.EligibilityCheck{Rule: -1, Type: CheckContactLimit, Passed: used < limits.PerContact}
+
+	if !perContact.Passed {
+		perContact.Reason = fmt.Sprintf("this campaign can be claimed %d time(s) per person", limits.PerContact)
+	}
+
+	result.Add(perContact)
+
+	rules, err := eligibility(s.db, campaign, contact, strings.TrimSpace(req.IP), "", now)
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, check := range rules.Checks {
+		result.Add(check)
+	}
+
+	return result, nil
+}
+
+// claimsBy is how many claims of the campaign the contact c holds against
+// the per contact limit
+func (s *service) claimsBy(campaign models.Campaign, c models.Contact) (int64, error) {
+	contact, err := existing(s.db, campaign.CreatedBy, c)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+
+	if err != nil {
+		slog.Error("Error getting contact", "error", err)
+
+		return 0, errors.New("error checking eligibility")
+	}
+
+	counter := struct {
+		Count int64 `bson:"count"`
+	}{}
+
+	s.db.SetCollection(models.ClaimCountersCollection)
+
+	err = s.db.FindOne(bson.M{"campaign_id": campaign.ID, "contact_id": contact.ID}, &counter)
+
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error getting claim counter", "error", err)
+
+		return 0, errors.New("error checking eligibility")
+	}
+
+	return counter.Count, nil
+}
+
+func (s *service) findCampaign(id string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	campaign.ID = objid.Hex()
+	campaign.CreatedBy = user.Sub
+
+	return campaign, nil
+}
@@ -0,0 +1,384 @@
+package claimservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/email"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	eligibilityservice "campaign/internal/services/eligibility"
+	experimentservice "campaign/internal/services/experiment"
+	riskservice "campaign/internal/services/risk"
+	suppressionservice "campaign/internal/services/suppression"
+	voucherservice "campaign/internal/services/voucher"
+	"campaign/internal/sms"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ProcessJob checks and fulfils one received claim, its payload holds
+	// the claim_id
+	ProcessJob = "claim.process"
+
+	// CallbackJob posts the result of one claim to its callback url
+	CallbackJob = "claim.callback"
+)
+
+var (
+	// emailFrom sends claim results to claimants who gave no msisdn, they
+	// are not emailed when it is empty
+	emailFrom     = os.Getenv("CLAIM_EMAIL_FROM")
+	emailFromName = os.Getenv("CLAIM_EMAIL_FROM_NAME")
+)
+
+// errSettled is returned by settle when another worker decided the claim
+var errSettled = errors.New("claim was settled by another worker")
+
+// Processor runs the claim jobs: it checks a received claim against its
+// campaign, reserves the limits, issues a code, tells the claimant and
+// queues the callback
+type Processor struct {
+	db       *mongo.Database
+	jobs     *queue.Queue
+	provider sms.SMSProvider
+	mailer   *email.Mailer
+}
+
+func NewProcessor(db *mongo.Database, jobs *queue.Queue, provider sms.SMSProvider, mailer *email.Mailer) *Processor {
+	return &Processor{db: db, jobs: jobs, provider: provider, mailer: mailer}
+}
+
+// Handle runs a ProcessJob. Every step is safe to repeat so a retried job
+// picks up where the last attempt stopped. A claim that still fails on the
+// last attempt is rejected rather than left received.
+func (p *Processor) Handle(ctx context.Context, job models.Job) error {
+	db := database.NewDatabaseService(ctx, p.db, models.ClaimsCollection)
+
+	claim, err := find(db, job.Payload["claim_id"])
+
+	if err != nil {
+		return err
+	}
+
+	if claim.Status == models.ClaimStatusReceived {
+		claim, err = process(db, claim)
+
+		if err != nil && job.Attempts < job.MaxAttempts {
+			return err
+		}
+
+		// an earlier attempt may have reserved places before it stopped,
+		// release only gives back places the claim holds
+		if err != nil {
+			release(db, claim)
+
+			claim, err = settle(db, claim, models.ClaimStatusRejected, "claim could not be processed, please try again")
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	p.notify(ctx, db, claim)
+
+	return p.queueCallback(ctx, db, claim)
+}
+
+func find(db database.Database, id interface{}) (models.Claim, error) {
+	claim := models.Claim{}
+	claimID, _ := id.(string)
+	objid, err := primitive.ObjectIDFromHex(claimID)
+
+	if err != nil {
+		return claim, queue.Permanent(errors.New("claim_id is required"))
+	}
+
+	db.SetCollection(models.ClaimsCollection)
+
+	err = db.FindOne(bson.M{"_id": objid}, &claim)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return claim, queue.Permanent(fmt.Errorf("no claims with id: %s found", claimID))
+	}
+
+	return claim, err
+}
+
+// process decides a received claim. Claims on campaigns that closed since
+// or with no allowance left are rejected with the reason, other errors are
+// returned for the job to retry.
+func process(db database.Database, claim models.Claim) (models.Claim, error) {
+	campaign := models.Campaign{}
+	objid, _ := primitive.ObjectIDFromHex(claim.CampaignID)
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err := db.FindOne(bson.M{"_id": objid}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return settle(db, claim, models.ClaimStatusRejected, "campaign no longer exists")
+	}
+
+	if err != nil {
+		return claim, err
+	}
+
+	now := time.Now().Local()
+
+	if err := Open(campaign, now); err != nil {
+		return settle(db, claim, models.ClaimStatusRejected, err.Error())
+	}
+
+	contact := models.Contact{Name: claim.Name, Msisdn: claim.Msisdn, Email: claim.Email}
+
+	result, err := eligibility(db, campaign, contact, claim.IP, claim.ID, now)
+
+	if err != nil {
+		return claim, err
+	}
+
+	if failed := result.Failed(); failed != nil {
+		claim.Eligibility = result.Checks
+
+		return settle(db, claim, models.ClaimStatusRejected, failed.Reason)
+	}
+
+	risk, err := riskservice.Assess(db, claim, now)
+
+	if err != nil {
+		slog.Error("Error assessing claim risk", "claim", claim.ID, "error", err)
+
+		return claim, err
+	}
+
+	claim.Risk = &risk
+
+	claim.ContactID, err = claimant(db, campaign.CreatedBy, contact)
+
+	if err != nil {
+		return claim, err
+	}
+
+	// a claim made through the api is counted under its contact's variant
+	if claim.Variant == "" {
+		claim.Variant = experimentservice.Assign(campaign, claim.ContactID)
+	}
+
+	// a retry after the limits were reserved keeps the places it has
+	err = reserve(db, claim, Limits(campaign))
+
+	if errors.Is(err, ErrLimitReached) {
+		return settle(db, claim, models.ClaimStatusRejected, err.Error())
+	}
+
+	if err != nil {
+		return claim, err
+	}
+
+	voucher, err := voucherservice.Issue(db, claim)
+
+	if errors.Is(err, voucherservice.ErrSoldOut) {
+		release(db, claim)
+
+		return settle(db, claim, models.ClaimStatusRejected, "all codes of this campaign have been claimed")
+	}
+
+	if err != nil {
+		release(db, claim)
+
+		return claim, err
+	}
+
+	claim.Code, claim.VoucherID = voucher.Code, voucher.ID
+
+	// a held claim keeps its place and code until it is reviewed
+	status, reason := models.ClaimStatusApproved, ""
+
+	if risk.Score > riskservice.HoldAbove(campaign) {
+		status, reason = models.ClaimStatusPending, "held for review"
+	}
+
+	settled, err := settle(db, claim, status, reason)
+
+	// the other worker's outcome stands with the places the claim reserved,
+	// the code this one took goes back unless the claim was settled with it
+	if errors.Is(err, errSettled) {
+		current, findErr := find(db, claim.ID)
+
+		if findErr == nil && current.VoucherID != claim.VoucherID {
+			voucherservice.Unissue(db, claim.VoucherID)
+		}
+
+		return claim, err
+	}
+
+	if err != nil {
+		release(db, claim)
+		voucherservice.Unissue(db, claim.VoucherID)
+
+		return claim, err
+	}
+
+	recordActivity(db, settled)
+
+	return settled, nil
+}
+
+// eligibility runs the campaign's rules on the claimant c, who may not be
+// a contact yet
+func eligibility(db database.Database, campaign models.Campaign, c models.Contact, ip, claimID string, now time.Time) (eligibilityservice.Result, error) {
+	subject := eligibilityservice.Subject{Msisdn: c.Msisdn, Email: c.Email, IP: ip, ClaimID: claimID}
+
+	contact, err := existing(db, campaign.CreatedBy, c)
+
+	if err == nil {
+		subject.Contact = &contact
+	}
+
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error getting contact", "error", err)
+
+		return eligibilityservice.Result{}, errors.New("error checking eligibility")
+	}
+
+	return eligibilityservice.Evaluate(db, campaign, subject, now)
+}
+
+// settle moves a received claim to status. It only matches while the claim
+// is received so two workers holding the same job cannot both decide it.
+func settle(db database.Database, claim models.Claim, status, reason string) (models.Claim, error) {
+	objid, _ := primitive.ObjectIDFromHex(claim.ID)
+
+	set := bson.M{
+		"status":     status,
+		"reason":     reason,
+		"contact_id": claim.ContactID,
+		"code":       claim.Code,
+		"voucher_id": claim.VoucherID,
+		"updated_at": time.Now().Local(),
+	}
+
+	if claim.Eligibility != nil {
+		set["eligibility"] = claim.Eligibility
+	}
+
+	if claim.Risk != nil {
+		set["risk"] = claim.Risk
+	}
+
+	if claim.Variant != "" {
+		set["variant"] = claim.Variant
+	}
+
+	db.SetCollection(models.ClaimsCollection)
+
+	err := db.FindOneAndUpdate(
+		bson.M{"_id": objid, "status": models.ClaimStatusReceived},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+		&claim,
+	)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return claim, fmt.Errorf("%w: %s", errSettled, claim.ID)
+	}
+
+	if err != nil {
+		slog.Error("Error settling claim", "claim", claim.ID, "error", err)
+
+		return claim, err
+	}
+
+	return claim, nil
+}
+
+// Decided reports whether a claim in status has its outcome, received and
+// held claims do not
+func Decided(status string) bool {
+	return status == models.ClaimStatusApproved || status == models.ClaimStatusRejected || status == models.ClaimStatusFulfilled
+}
+
+// Notification is the message telling a claimant the outcome of claim
+func Notification(claim models.Claim) string {
+	switch {
+	case claim.Status == models.ClaimStatusRejected:
+		return fmt.Sprintf("Your claim %s was not successful: %s", claim.Reference, claim.Reason)
+	case claim.Code != "":
+		return fmt.Sprintf("Your claim %s has been approved. Your code is %s", claim.Reference, claim.Code)
+	default:
+		return fmt.Sprintf("Your claim %s has been approved.", claim.Reference)
+	}
+}
+
+// notify tells the claimant the outcome once, by sms when they gave an
+// msisdn and by email otherwise. Suppressed addresses are skipped and
+// failures are only logged, the claim itself is decided.
+func (p *Processor) notify(ctx context.Context, db database.Database, claim models.Claim) {
+	if claim.NotifiedAt != nil || !Decided(claim.Status) {
+		return
+	}
+
+	channel, address := models.ChannelSMS, claim.Msisdn
+
+	if address == "" {
+		channel, address = models.ChannelEmail, claim.Email
+	}
+
+	if channel == models.ChannelEmail && emailFrom == "" {
+		return
+	}
+
+	suppressed, err := suppressionservice.IsSuppressed(db, claim.CreatedBy, channel, address)
+
+	if err != nil || suppressed {
+		return
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(claim.ID)
+
+	db.SetCollection(models.ClaimsCollection)
+
+	// marked before sending so a retry does not message them twice
+	err = db.FindOneAndUpdate(
+		bson.M{"_id": objid, "notified_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"notified_at": time.Now().Local()}},
+		nil,
+		&bson.M{},
+	)
+
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Error("Error marking claim notified", "claim", claim.ID, "error", err)
+		}
+
+		return
+	}
+
+	body := Notification(claim)
+
+	if channel == models.ChannelSMS {
+		_, err = p.provider.Send(ctx, sms.Message{To: address, From: sms.SenderID(), Body: body})
+	} else {
+		err = p.mailer.Send(ctx, email.Message{
+			From:    mail.Address{Name: emailFromName, Address: emailFrom},
+			To:      mail.Address{Name: claim.Name, Address: address},
+			Subject: "Your claim " + claim.Reference,
+			Text:    body,
+		})
+	}
+
+	if err != nil {
+		slog.Error("Error notifying claimant", "claim", claim.ID, "channel", channel, "error", err)
+	}
+}
@@ -0,0 +1,610 @@
+package contactservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/sendwindow"
+	"campaign/internal/utils"
+	"campaign/internal/utils/jwt"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+
+	// importBatchSize is the number of csv rows sent per bulk write
+	importBatchSize = 500
+
+	// maxImportErrors caps the row errors returned from an import
+	maxImportErrors = 100
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("a contact with this email or msisdn already exists")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+var attributePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+type ContactFilter struct {
+	ListID string
+	Query  string
+	Page   int
+	Limit  int
+}
+
+type ContactPage struct {
+	Contacts []models.Contact `json:"contacts"`
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	Limit    int              `json:"limit"`
+}
+
+type ImportError struct {
+	Row     int    `json:"row"`
+	Message string `json:"message"`
+}
+
+type ImportResult struct {
+	Rows       int           `json:"rows"`
+	Created    int64         `json:"created"`
+	Updated    int64         `json:"updated"`
+	Duplicates int           `json:"duplicates"`
+	Invalid    int           `json:"invalid"`
+	Errors     []ImportError `json:"errors"`
+}
+
+type Service interface {
+	CreateContact(c models.Contact) (models.Contact, error)
+	GetContacts(f ContactFilter) (ContactPage, error)
+	GetContactByID(id string) (models.Contact, error)
+	UpdateContact(id string, c models.Contact) error
+	DeleteContact(id string) error
+	ImportCSV(listID string, r io.Reader) (ImportResult, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// NormalizeContact cleans up the identifiers and checks the contact can be reached
+func NormalizeContact(c models.Contact) (models.Contact, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Email = utils.NormalizeEmail(c.Email)
+	c.Msisdn = utils.NormalizeMsisdn(c.Msisdn)
+
+	if c.Email == "" && c.Msisdn == "" {
+		return c, fmt.Errorf("%w: email or msisdn is required", ErrInvalid)
+	}
+
+	if c.Email != "" {
+		if _, err := mail.ParseAddress(c.Email); err != nil {
+			return c, fmt.Errorf("%w: invalid email address %s", ErrInvalid, c.Email)
+		}
+	}
+
+	if c.Msisdn != "" && (len(c.Msisdn) < 8 || len(c.Msisdn) > 15) {
+		return c, fmt.Errorf("%w: msisdn must have between 8 and 15 digits", ErrInvalid)
+	}
+
+	c.TimeZone = strings.TrimSpace(c.TimeZone)
+
+	if c.TimeZone != "" {
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			return c, fmt.Errorf("%w: unknown time zone %q", ErrInvalid, c.TimeZone)
+		}
+	}
+
+	if c.Attributes == nil {
+		c.Attributes = map[string]interface{}{}
+	}
+
+	for key := range c.Attributes {
+		if !attributePattern.MatchString(key) {
+			return c, fmt.Errorf("%w: attribute %q must start with a letter and only contain lower case letters, digits and underscores", ErrInvalid, key)
+		}
+	}
+
+	return c, nil
+}
+
+func (s *service) CreateContact(c models.Contact) (models.Contact, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return c, errors.New("error creating contact")
+	}
+
+	c, err = NormalizeContact(c)
+
+	if err != nil {
+		return c, err
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	c.ID = objid.Hex()
+	c.ListIDs = []string{}
+	c.CreatedBy = user.Sub
+	c.CreatedAt = now
+	c.UpdatedAt = now
+
+	if c.TimeZone == "" {
+		c.TimeZone = sendwindow.FromMsisdn(c.Msisdn)
+	}
+
+	doc := bson.M{
+		"_id":        objid,
+		"name":       c.Name,
+		"attributes": c.Attributes,
+		"consent":    c.Consent,
+		"list_ids":   c.ListIDs,
+		"created_by": c.CreatedBy,
+		"created_at": c.CreatedAt,
+		"updated_at": c.UpdatedAt,
+	}
+
+	// missing identifiers are left out so the partial unique indexes ignore them
+	if c.Email != "" {
+		doc["email"] = c.Email
+	}
+
+	if c.Msisdn != "" {
+		doc["msisdn"] = c.Msisdn
+	}
+
+	if c.TimeZone != "" {
+		doc["time_zone"] = c.TimeZone
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	err = s.db.InsertOne(doc)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return c, ErrExists
+	}
+
+	if err != nil {
+		slog.Error("Error creating contact", "error", err)
+
+		return c, errors.New("error creating contact")
+	}
+
+	return c, nil
+}
+
+func (s *service) GetContacts(f ContactFilter) (ContactPage, error) {
+	page := ContactPage{Contacts: []models.Contact{}}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return page, errors.New("error getting contacts")
+	}
+
+	if f.Page < 1 {
+		f.Page = 1
+	}
+
+	if f.Limit < 1 {
+		f.Limit = DefaultPageSize
+	}
+
+	f.Limit = min(f.Limit, MaxPageSize)
+
+	filter := bson.M{"created_by": user.Sub}
+
+	if f.ListID != "" {
+		filter["list_ids"] = f.ListID
+	}
+
+	if q := strings.TrimSpace(f.Query); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+
+		filter["$or"] = bson.A{
+			bson.M{"name": pattern},
+			bson.M{"email": pattern},
+			bson.M{"msisdn": pattern},
+		}
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	page.Total, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting contacts", "error", err)
+
+		return page, errors.New("error getting contacts")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(int64((f.Page - 1) * f.Limit)).
+		SetLimit(int64(f.Limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &page.Contacts)
+
+	if err != nil {
+		slog.Error("Error getting contacts", "error", err)
+
+		return page, errors.New("error getting contacts")
+	}
+
+	page.Page = f.Page
+	page.Limit = f.Limit
+
+	return page, nil
+}
+
+func (s *service) GetContactByID(id string) (models.Contact, error) {
+	contact := models.Contact{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return contact, errors.New("error getting contact")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return contact, fmt.Errorf("%w: invalid contact id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &contact)
+
+	if err != nil {
+		slog.Error("Error getting contact", "error", err)
+
+		return contact, fmt.Errorf("%w: no contacts with id: %s found", ErrNotFound, id)
+	}
+
+	return contact, nil
+}
+
+func (s *service) UpdateContact(id string, c models.Contact) error {
+	existing, err := s.GetContactByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	c, err = NormalizeContact(c)
+
+	if err != nil {
+		return err
+	}
+
+	set := bson.M{
+		"name":       c.Name,
+		"attributes": c.Attributes,
+		"consent":    c.Consent,
+		"updated_at": time.Now().Local(),
+	}
+
+	unset := bson.M{}
+
+	if c.TimeZone == "" {
+		c.TimeZone = sendwindow.FromMsisdn(c.Msisdn)
+	}
+
+	for field, value := range map[string]string{"email": c.Email, "msisdn": c.Msisdn, "time_zone": c.TimeZone} {
+		if value == "" {
+			unset[field] = ""
+		} else {
+			set[field] = value
+		}
+	}
+
+	// a new address or number has not bounced yet
+	if c.Email != existing.Email {
+		unset["email_undeliverable"] = ""
+	}
+
+	if c.Msisdn != existing.Msisdn {
+		unset["sms_undeliverable"] = ""
+	}
+
+	update := bson.M{"$set": set}
+
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	err = s.db.UpdateOneRaw(bson.M{"_id": objid, "created_by": existing.CreatedBy}, update)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrExists
+	}
+
+	if err != nil {
+		slog.Error("Error updating contact", "error", err)
+
+		return fmt.Errorf("could not update contact with id: %s", id)
+	}
+
+	return nil
+}
+
+func (s *service) DeleteContact(id string) error {
+	existing, err := s.GetContactByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	err = s.db.DeleteOne(bson.M{"_id": objid, "created_by": existing.CreatedBy})
+
+	if err != nil {
+		slog.Error("Error deleting contact", "error", err)
+
+		return fmt.Errorf("could not delete contact with id: %s", id)
+	}
+
+	return nil
+}
+
+// ImportCSV upserts contacts from a csv file with a header row. name, email
+// and msisdn map to the contact, email_consent and sms_consent to its consent
+// flags and any other column becomes an attribute. Rows are matched to existing
+// contacts by normalized email or msisdn and added to listID when it is set.
+func (s *service) ImportCSV(listID string, r io.Reader) (ImportResult, error) {
+	result := ImportResult{Errors: []ImportError{}}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return result, errors.New("error importing contacts")
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return result, fmt.Errorf("%w: could not read csv header", ErrInvalid)
+	}
+
+	columns := make([]string, len(header))
+
+	for i, h := range header {
+		columns[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+
+		if !isKnownColumn(columns[i]) && !attributePattern.MatchString(columns[i]) {
+			return result, fmt.Errorf("%w: invalid column name %q", ErrInvalid, h)
+		}
+	}
+
+	seen := map[string]bool{}
+	batch := []mongo.WriteModel{}
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		res, err := s.db.BulkWrite(batch)
+
+		if res != nil {
+			result.Created += res.UpsertedCount
+			result.Updated += res.MatchedCount
+		}
+
+		if err != nil {
+			slog.Error("Error importing contacts", "error", err)
+			result.addError(0, "some rows could not be saved: "+err.Error())
+		}
+
+		batch = batch[:0]
+	}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			result.Invalid++
+			result.addError(row, err.Error())
+
+			continue
+		}
+
+		result.Rows++
+
+		contact, consent := parseRecord(columns, record)
+
+		contact, err = NormalizeContact(contact)
+
+		if err != nil {
+			result.Invalid++
+			result.addError(row, err.Error())
+
+			continue
+		}
+
+		if (contact.Email != "" && seen["e:"+contact.Email]) || (contact.Msisdn != "" && seen["m:"+contact.Msisdn]) {
+			result.Duplicates++
+
+			continue
+		}
+
+		seen["e:"+contact.Email] = contact.Email != ""
+		seen["m:"+contact.Msisdn] = contact.Msisdn != ""
+
+		batch = append(batch, upsertModel(user.Sub, listID, contact, consent, now))
+
+		if len(batch) >= importBatchSize {
+			flush()
+		}
+	}
+
+	flush()
+
+	return result, nil
+}
+
+func (r *ImportResult) addError(row int, message string) {
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, ImportError{Row: row, Message: message})
+	}
+}
+
+func isKnownColumn(column string) bool {
+	switch column {
+	case "name", "email", "msisdn", "phone", "email_consent", "sms_consent", "time_zone":
+		return true
+	}
+
+	return false
+}
+
+// parseRecord maps a csv row onto a contact. The returned map only has the
+// consent flags that were present in the file.
+func parseRecord(columns, record []string) (models.Contact, map[string]bool) {
+	contact := models.Contact{Attributes: map[string]interface{}{}}
+	consent := map[string]bool{}
+
+	for i, value := range record {
+		if i >= len(columns) {
+			break
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch columns[i] {
+		case "name":
+			contact.Name = value
+		case "email":
+			contact.Email = value
+		case "msisdn", "phone":
+			contact.Msisdn = value
+		case "email_consent":
+			consent["email"] = parseBool(value)
+		case "sms_consent":
+			consent["sms"] = parseBool(value)
+		case "time_zone":
+			contact.TimeZone = value
+		default:
+			if value != "" {
+				contact.Attributes[columns[i]] = value
+			}
+		}
+	}
+
+	return contact, consent
+}
+
+func parseBool(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "y":
+		return true
+	}
+
+	return false
+}
+
+func upsertModel(userID, listID string, c models.Contact, consent map[string]bool, now time.Time) mongo.WriteModel {
+	match := bson.A{}
+	set := bson.M{"updated_at": now}
+	setOnInsert := bson.M{"created_at": now}
+
+	if c.Email != "" {
+		match = append(match, bson.M{"email": c.Email})
+		set["email"] = c.Email
+	}
+
+	if c.Msisdn != "" {
+		match = append(match, bson.M{"msisdn": c.Msisdn})
+		set["msisdn"] = c.Msisdn
+	}
+
+	if c.Name != "" {
+		set["name"] = c.Name
+	} else {
+		setOnInsert["name"] = ""
+	}
+
+	// a guessed zone must not replace one set before
+	if c.TimeZone != "" {
+		set["time_zone"] = c.TimeZone
+	} else if zone := sendwindow.FromMsisdn(c.Msisdn); zone != "" {
+		setOnInsert["time_zone"] = zone
+	}
+
+	if len(c.Attributes) == 0 {
+		setOnInsert["attributes"] = bson.M{}
+	}
+
+	for key, value := range c.Attributes {
+		set["attributes."+key] = value
+	}
+
+	for _, channel := range []string{"email", "sms"} {
+		if v, ok := consent[channel]; ok {
+			set["consent."+channel] = v
+		} else {
+			setOnInsert["consent."+channel] = false
+		}
+	}
+
+	update := bson.M{"$set": set, "$setOnInsert": setOnInsert}
+
+	if listID != "" {
+		update["$addToSet"] = bson.M{"list_ids": listID}
+	} else {
+		setOnInsert["list_ids"] = bson.A{}
+	}
+
+	return mongo.NewUpdateOneModel().
+		SetFilter(bson.M{"created_by": userID, "$or": match}).
+		SetUpdate(update).
+		SetUpsert(true)
+}
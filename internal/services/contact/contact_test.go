@@ -0,0 +1,47 @@
+package contactservice
+
+import (
+	"campaign/internal/models"
+	"campaign/internal/utils"
+	"errors"
+	"testing"
+)
+
+func TestNormalizeContact(t *testing.T) {
+	utils.DEFAULT_COUNTRY_CODE = "233"
+	defer func() { utils.DEFAULT_COUNTRY_CODE = "" }()
+
+	c, err := NormalizeContact(models.Contact{Name: " Ama ", Email: " Ama@Example.COM ", Msisdn: "024 123 4567"})
+
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	if c.Email != "ama@example.com" {
+		t.Errorf("expected email to be lower cased; got %q", c.Email)
+	}
+
+	if c.Msisdn != "233241234567" {
+		t.Errorf("expected msisdn with country code; got %q", c.Msisdn)
+	}
+
+	if c.Name != "Ama" {
+		t.Errorf("expected trimmed name; got %q", c.Name)
+	}
+}
+
+func TestNormalizeContactInvalid(t *testing.T) {
+	tests := []models.Contact{
+		{Name: "no channel"},
+		{Email: "not-an-email"},
+		{Msisdn: "1234"},
+		{Email: "a@b.co", Attributes: map[string]interface{}{"Bad Key": 1}},
+		{Email: "a@b.co", TimeZone: "Mars/Olympus_Mons"},
+	}
+
+	for _, tt := range tests {
+		if _, err := NormalizeContact(tt); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected invalid error for %+v; got %v", tt, err)
+		}
+	}
+}
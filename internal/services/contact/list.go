@@ -0,0 +1,506 @@
+package contactservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	segmentservice "campaign/internal/services/segment"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Audience is the union of a campaign's lists and segments. ContactCount is
+// resolved live, Snapshot is what the campaign was frozen to when it went live.
+type Audience struct {
+	ListIDs      []string                 `json:"list_ids"`
+	Lists        []models.ContactList     `json:"lists"`
+	SegmentIDs   []string                 `json:"segment_ids"`
+	Segments     []models.Segment         `json:"segments"`
+	ContactCount int64                    `json:"contact_count"`
+	Snapshot     *models.AudienceSnapshot `json:"snapshot,omitempty"`
+}
+
+type ListService interface {
+	CreateList(l models.ContactList) (models.ContactList, error)
+	GetLists() ([]models.ContactList, error)
+	GetListByID(id string) (models.ContactList, error)
+	UpdateList(id string, l models.ContactList) error
+	DeleteList(id string) error
+	AddContacts(id string, contactIDs []string) error
+	RemoveContact(id, contactID string) error
+	SetCampaignAudience(campaignID string, listIDs, segmentIDs []string) error
+	GetCampaignAudience(campaignID string) (Audience, error)
+}
+
+type listService struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewListService(ctx context.Context, db database.Database) ListService {
+	return &listService{ctx: ctx, db: db}
+}
+
+func (s *listService) CreateList(l models.ContactList) (models.ContactList, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return l, errors.New("error creating list")
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.ContactListsCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":         objid,
+		"name":        l.Name,
+		"description": l.Description,
+		"created_by":  user.Sub,
+		"created_at":  now,
+		"updated_at":  now,
+	})
+
+	if err != nil {
+		slog.Error("Error creating list", "error", err)
+
+		return l, errors.New("error creating list")
+	}
+
+	l.ID = objid.Hex()
+	l.CreatedBy = user.Sub
+	l.CreatedAt = now
+	l.UpdatedAt = now
+
+	return l, nil
+}
+
+func (s *listService) GetLists() ([]models.ContactList, error) {
+	lists := []models.ContactList{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return lists, errors.New("error getting lists")
+	}
+
+	s.db.SetCollection(models.ContactListsCollection)
+
+	err = s.db.FindMany(bson.M{"created_by": user.Sub}, &lists)
+
+	if err != nil {
+		slog.Error("Error getting lists", "error", err)
+
+		return lists, errors.New("error getting lists")
+	}
+
+	counts := []struct {
+		ListID string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}{}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"created_by": user.Sub}},
+		{"$unwind": "$list_ids"},
+		{"$group": bson.M{"_id": "$list_ids", "count": bson.M{"$sum": 1}}},
+	}, &counts)
+
+	if err != nil {
+		slog.Error("Error counting list contacts", "error", err)
+
+		return lists, errors.New("error getting lists")
+	}
+
+	byList := map[string]int64{}
+
+	for _, c := range counts {
+		byList[c.ListID] = c.Count
+	}
+
+	for i := range lists {
+		lists[i].ContactCount = byList[lists[i].ID]
+	}
+
+	return lists, nil
+}
+
+func (s *listService) GetListByID(id string) (models.ContactList, error) {
+	list := models.ContactList{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return list, errors.New("error getting list")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return list, fmt.Errorf("%w: invalid list id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.ContactListsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &list)
+
+	if err != nil {
+		slog.Error("Error getting list", "error", err)
+
+		return list, fmt.Errorf("%w: no lists with id: %s found", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	list.ContactCount, err = s.db.CountDocuments(bson.M{"created_by": user.Sub, "list_ids": id})
+
+	if err != nil {
+		slog.Error("Error counting list contacts", "error", err)
+	}
+
+	return list, nil
+}
+
+func (s *listService) UpdateList(id string, l models.ContactList) error {
+	existing, err := s.GetListByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	s.db.SetCollection(models.ContactListsCollection)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": existing.CreatedBy}, bson.M{
+		"name":        l.Name,
+		"description": l.Description,
+		"updated_at":  time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error updating list", "error", err)
+
+		return fmt.Errorf("could not update list with id: %s", id)
+	}
+
+	return nil
+}
+
+// DeleteList removes the list, its memberships and any campaign audience using it.
+// The contacts themselves are kept.
+func (s *listService) DeleteList(id string) error {
+	existing, err := s.GetListByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	s.db.SetCollection(models.ContactListsCollection)
+
+	err = s.db.DeleteOne(bson.M{"_id": objid, "created_by": existing.CreatedBy})
+
+	if err != nil {
+		slog.Error("Error deleting list", "error", err)
+
+		return fmt.Errorf("could not delete list with id: %s", id)
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	err = s.db.UpdateManyRaw(bson.M{"created_by": existing.CreatedBy, "list_ids": id}, bson.M{
+		"$pull": bson.M{"list_ids": id},
+	})
+
+	if err != nil {
+		slog.Error("Error removing list from contacts", "error", err)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.UpdateManyRaw(bson.M{"created_by": existing.CreatedBy, "audience_list_ids": id}, bson.M{
+		"$pull": bson.M{"audience_list_ids": id},
+	})
+
+	if err != nil {
+		slog.Error("Error removing list from campaign audiences", "error", err)
+	}
+
+	return nil
+}
+
+func (s *listService) AddContacts(id string, contactIDs []string) error {
+	existing, err := s.GetListByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	ids := []primitive.ObjectID{}
+
+	for _, cid := range contactIDs {
+		objid, err := primitive.ObjectIDFromHex(cid)
+
+		if err != nil {
+			return fmt.Errorf("%w: invalid contact id: %s", ErrInvalid, cid)
+		}
+
+		ids = append(ids, objid)
+	}
+
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: contact_ids is required", ErrInvalid)
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	err = s.db.UpdateManyRaw(bson.M{"_id": bson.M{"$in": ids}, "created_by": existing.CreatedBy}, bson.M{
+		"$addToSet": bson.M{"list_ids": id},
+		"$set":      bson.M{"updated_at": time.Now().Local()},
+	})
+
+	if err != nil {
+		slog.Error("Error adding contacts to list", "error", err)
+
+		return fmt.Errorf("could not add contacts to list with id: %s", id)
+	}
+
+	return nil
+}
+
+func (s *listService) RemoveContact(id, contactID string) error {
+	existing, err := s.GetListByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, err := primitive.ObjectIDFromHex(contactID)
+
+	if err != nil {
+		return fmt.Errorf("%w: invalid contact id: %s", ErrNotFound, contactID)
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	err = s.db.UpdateOneRaw(bson.M{"_id": objid, "created_by": existing.CreatedBy}, bson.M{
+		"$pull": bson.M{"list_ids": id},
+		"$set":  bson.M{"updated_at": time.Now().Local()},
+	})
+
+	if err != nil {
+		slog.Error("Error removing contact from list", "error", err)
+
+		return fmt.Errorf("could not remove contact from list with id: %s", id)
+	}
+
+	return nil
+}
+
+// SetCampaignAudience replaces the lists and segments a campaign is sent to
+func (s *listService) SetCampaignAudience(campaignID string, listIDs, segmentIDs []string) error {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return errors.New("error updating audience")
+	}
+
+	campaignObjID, err := primitive.ObjectIDFromHex(campaignID)
+
+	if err != nil {
+		return fmt.Errorf("%w: invalid campaign id: %s", ErrNotFound, campaignID)
+	}
+
+	lists, err := s.checkOwned(user.Sub, models.ContactListsCollection, "list", listIDs)
+
+	if err != nil {
+		return err
+	}
+
+	segments, err := s.checkOwned(user.Sub, models.SegmentsCollection, "segment", segmentIDs)
+
+	if err != nil {
+		return err
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	count, err := s.db.CountDocuments(bson.M{"_id": campaignObjID, "created_by": user.Sub})
+
+	if err != nil || count == 0 {
+		return fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	err = s.db.UpdateOne(bson.M{"_id": campaignObjID, "created_by": user.Sub}, bson.M{
+		"audience_list_ids":    lists,
+		"audience_segment_ids": segments,
+		"updated_at":           time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error updating campaign audience", "error", err)
+
+		return errors.New("error updating audience")
+	}
+
+	return nil
+}
+
+// checkOwned de-duplicates ids and checks each one is a document in
+// collection created by userID
+func (s *listService) checkOwned(userID string, collection models.Collections, kind string, ids []string) ([]string, error) {
+	unique := []string{}
+	objids := []primitive.ObjectID{}
+	seen := map[string]bool{}
+
+	for _, id := range ids {
+		objid, err := primitive.ObjectIDFromHex(id)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid %s id: %s", ErrInvalid, kind, id)
+		}
+
+		if seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		unique = append(unique, id)
+		objids = append(objids, objid)
+	}
+
+	if len(objids) == 0 {
+		return unique, nil
+	}
+
+	s.db.SetCollection(collection)
+
+	count, err := s.db.CountDocuments(bson.M{"_id": bson.M{"$in": objids}, "created_by": userID})
+
+	if err != nil {
+		slog.Error("Error checking audience "+kind+"s", "error", err)
+
+		return nil, errors.New("error updating audience")
+	}
+
+	if count != int64(len(objids)) {
+		return nil, fmt.Errorf("%w: one or more %ss were not found", ErrInvalid, kind)
+	}
+
+	return unique, nil
+}
+
+// GetCampaignAudience returns the campaign lists and segments and the number
+// of distinct contacts across them, a contact in two lists is counted once.
+func (s *listService) GetCampaignAudience(campaignID string) (Audience, error) {
+	audience := Audience{
+		ListIDs:    []string{},
+		Lists:      []models.ContactList{},
+		SegmentIDs: []string{},
+		Segments:   []models.Segment{},
+	}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return audience, errors.New("error getting audience")
+	}
+
+	campaignObjID, err := primitive.ObjectIDFromHex(campaignID)
+
+	if err != nil {
+		return audience, fmt.Errorf("%w: invalid campaign id: %s", ErrNotFound, campaignID)
+	}
+
+	campaign := models.Campaign{}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": campaignObjID, "created_by": user.Sub}, &campaign)
+
+	if err != nil {
+		return audience, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	audience.Snapshot = campaign.AudienceSnapshot
+
+	if len(campaign.AudienceListIDs) > 0 {
+		audience.ListIDs = campaign.AudienceListIDs
+
+		s.db.SetCollection(models.ContactListsCollection)
+
+		err = s.db.FindMany(bson.M{"_id": bson.M{"$in": objectIDs(campaign.AudienceListIDs)}, "created_by": user.Sub}, &audience.Lists)
+
+		if err != nil {
+			slog.Error("Error getting audience lists", "error", err)
+
+			return audience, errors.New("error getting audience")
+		}
+	}
+
+	if len(campaign.AudienceSegmentIDs) > 0 {
+		audience.SegmentIDs = campaign.AudienceSegmentIDs
+
+		s.db.SetCollection(models.SegmentsCollection)
+
+		err = s.db.FindMany(bson.M{"_id": bson.M{"$in": objectIDs(campaign.AudienceSegmentIDs)}, "created_by": user.Sub}, &audience.Segments)
+
+		if err != nil {
+			slog.Error("Error getting audience segments", "error", err)
+
+			return audience, errors.New("error getting audience")
+		}
+	}
+
+	filter, err := segmentservice.AudienceFilter(s.db, campaign, time.Now())
+
+	if err != nil || filter == nil {
+		return audience, err
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	audience.ContactCount, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting audience", "error", err)
+
+		return audience, errors.New("error getting audience")
+	}
+
+	return audience, nil
+}
+
+func objectIDs(ids []string) []primitive.ObjectID {
+	objids := []primitive.ObjectID{}
+
+	for _, id := range ids {
+		if objid, err := primitive.ObjectIDFromHex(id); err == nil {
+			objids = append(objids, objid)
+		}
+	}
+
+	return objids
+}
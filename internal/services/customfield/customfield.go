@@ -0,0 +1,352 @@
+package customfieldservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrNotFound = errors.New("custom field not found")
+	ErrExists   = errors.New("custom field already exists")
+	ErrInvalid  = errors.New("invalid custom field")
+)
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// dateLayouts are accepted for date fields, in order
+var dateLayouts = []string{time.RFC3339, "2006-01-02"}
+
+type Service interface {
+	CreateCustomField(f models.CustomField) (models.CustomField, error)
+	GetCustomFields() ([]models.CustomField, error)
+	UpdateCustomField(id string, f models.CustomField) error
+	DeleteCustomField(id string) error
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// ValidateDefinition checks a custom field definition sent by a client
+func ValidateDefinition(f models.CustomField) error {
+	if !keyPattern.MatchString(f.Key) {
+		return fmt.Errorf("%w: key must start with a letter and only contain lower case letters, digits and underscores", ErrInvalid)
+	}
+
+	if f.Label == "" {
+		return fmt.Errorf("%w: label is required", ErrInvalid)
+	}
+
+	switch f.Type {
+	case models.CustomFieldText, models.CustomFieldNumber, models.CustomFieldDate:
+		if len(f.Options) > 0 {
+			return fmt.Errorf("%w: options are only allowed on enum fields", ErrInvalid)
+		}
+	case models.CustomFieldEnum:
+		if len(f.Options) == 0 {
+			return fmt.Errorf("%w: enum fields need at least one option", ErrInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: type must be one of text, number, date or enum", ErrInvalid)
+	}
+
+	return nil
+}
+
+// Validate checks campaign custom field values against the account schema and
+// returns them normalized: numbers as float64 and dates as time.Time.
+func Validate(fields []models.CustomField, values map[string]interface{}) (map[string]interface{}, error) {
+	normalized := map[string]interface{}{}
+	defs := map[string]models.CustomField{}
+
+	for _, f := range fields {
+		defs[f.Key] = f
+	}
+
+	for key, value := range values {
+		f, ok := defs[key]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown custom field: %s", key)
+		}
+
+		if value == nil || value == "" {
+			continue
+		}
+
+		v, err := normalize(f, value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		normalized[key] = v
+	}
+
+	for _, f := range fields {
+		if _, ok := normalized[f.Key]; f.Required && !ok {
+			return nil, fmt.Errorf("custom field %s is required", f.Key)
+		}
+	}
+
+	return normalized, nil
+}
+
+func normalize(f models.CustomField, value interface{}) (interface{}, error) {
+	switch f.Type {
+	case models.CustomFieldText:
+		v, ok := value.(string)
+
+		if !ok {
+			return nil, fmt.Errorf("custom field %s must be text", f.Key)
+		}
+
+		return v, nil
+	case models.CustomFieldNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int:
+			return float64(v), nil
+		case json.Number:
+			return v.Float64()
+		}
+
+		return nil, fmt.Errorf("custom field %s must be a number", f.Key)
+	case models.CustomFieldDate:
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case primitive.DateTime:
+			return v.Time(), nil
+		case string:
+			if t, err := parseDate(v); err == nil {
+				return t, nil
+			}
+		}
+
+		return nil, fmt.Errorf("custom field %s must be a date (YYYY-MM-DD or RFC3339)", f.Key)
+	case models.CustomFieldEnum:
+		v, ok := value.(string)
+
+		if !ok || !slices.Contains(f.Options, v) {
+			return nil, fmt.Errorf("custom field %s must be one of %s", f.Key, strings.Join(f.Options, ", "))
+		}
+
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("custom field %s has unknown type %s", f.Key, f.Type)
+}
+
+// ParseFilterValue converts a query string value into the stored type of the field
+func ParseFilterValue(f models.CustomField, raw string) (interface{}, error) {
+	switch f.Type {
+	case models.CustomFieldNumber:
+		v, err := strconv.ParseFloat(raw, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("custom field %s must be a number", f.Key)
+		}
+
+		return v, nil
+	case models.CustomFieldDate:
+		t, err := parseDate(raw)
+
+		if err != nil {
+			return nil, fmt.Errorf("custom field %s must be a date (YYYY-MM-DD or RFC3339)", f.Key)
+		}
+
+		return t, nil
+	}
+
+	return raw, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	var err error
+
+	for _, layout := range dateLayouts {
+		var t time.Time
+
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, err
+}
+
+func (s *service) CreateCustomField(f models.CustomField) (models.CustomField, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return f, errors.New("error creating custom field")
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.CustomFieldsCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":        objid,
+		"key":        f.Key,
+		"label":      f.Label,
+		"type":       f.Type,
+		"options":    f.Options,
+		"required":   f.Required,
+		"created_by": user.Sub,
+		"created_at": now,
+		"updated_at": now,
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return f, fmt.Errorf("%w: %s", ErrExists, f.Key)
+	}
+
+	if err != nil {
+		slog.Error("Error creating custom field", "error", err)
+
+		return f, errors.New("error creating custom field")
+	}
+
+	f.ID = objid.Hex()
+	f.CreatedBy = user.Sub
+	f.CreatedAt = now
+	f.UpdatedAt = now
+
+	return f, nil
+}
+
+func (s *service) GetCustomFields() ([]models.CustomField, error) {
+	fields := []models.CustomField{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return fields, errors.New("error getting custom fields")
+	}
+
+	s.db.SetCollection(models.CustomFieldsCollection)
+
+	err = s.db.FindMany(bson.M{"created_by": user.Sub}, &fields)
+
+	if err != nil {
+		slog.Error("Error getting custom fields", "error", err)
+
+		return fields, errors.New("error getting custom fields")
+	}
+
+	return fields, nil
+}
+
+// UpdateCustomField changes the label, options and required flag.
+// The key and type are fixed once created since campaigns store values under them.
+func (s *service) UpdateCustomField(id string, f models.CustomField) error {
+	existing, err := s.findCustomField(id)
+
+	if err != nil {
+		return err
+	}
+
+	f.Key = existing.Key
+	f.Type = existing.Type
+
+	if err := ValidateDefinition(f); err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": existing.CreatedBy}, bson.M{
+		"label":      f.Label,
+		"options":    f.Options,
+		"required":   f.Required,
+		"updated_at": time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error updating custom field", "error", err)
+
+		return fmt.Errorf("could not update custom field with id: %s", id)
+	}
+
+	return nil
+}
+
+func (s *service) DeleteCustomField(id string) error {
+	existing, err := s.findCustomField(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	err = s.db.DeleteOne(bson.M{"_id": objid, "created_by": existing.CreatedBy})
+
+	if err != nil {
+		slog.Error("Error deleting custom field", "error", err)
+
+		return fmt.Errorf("could not delete custom field with id: %s", id)
+	}
+
+	return nil
+}
+
+func (s *service) findCustomField(id string) (models.CustomField, error) {
+	field := models.CustomField{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return field, errors.New("error getting custom field")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return field, fmt.Errorf("%w: invalid custom field id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CustomFieldsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &field)
+
+	if err != nil {
+		slog.Error("Error getting custom field", "error", err)
+
+		return field, fmt.Errorf("%w: no custom fields with id: %s found", ErrNotFound, id)
+	}
+
+	return field, nil
+}
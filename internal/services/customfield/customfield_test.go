@@ -0,0 +1,51 @@
+package customfieldservice
+
+import (
+	"campaign/internal/models"
+	"testing"
+	"time"
+)
+
+var fields = []models.CustomField{
+	{Key: "region", Type: models.CustomFieldText, Required: true},
+	{Key: "cost", Type: models.CustomFieldNumber},
+	{Key: "launch", Type: models.CustomFieldDate},
+	{Key: "line", Type: models.CustomFieldEnum, Options: []string{"retail", "wholesale"}},
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		wantErr bool
+	}{
+		{"valid", map[string]interface{}{"region": "GH", "cost": 12.5, "launch": "2024-08-01", "line": "retail"}, false},
+		{"missing required", map[string]interface{}{"cost": 12.5}, true},
+		{"unknown field", map[string]interface{}{"region": "GH", "owner": "me"}, true},
+		{"wrong number", map[string]interface{}{"region": "GH", "cost": "twelve"}, true},
+		{"wrong date", map[string]interface{}{"region": "GH", "launch": "01/08/2024"}, true},
+		{"wrong option", map[string]interface{}{"region": "GH", "line": "online"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Validate(fields, tt.values)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNormalizesDates(t *testing.T) {
+	values, err := Validate(fields, map[string]interface{}{"region": "GH", "launch": "2024-08-01"})
+
+	if err != nil {
+		t.Fatalf("Validate() returned error: %v", err)
+	}
+
+	if _, ok := values["launch"].(time.Time); !ok {
+		t.Errorf("expected launch to be a time.Time; got %T", values["launch"])
+	}
+}
@@ -0,0 +1,288 @@
+package eligibilityservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/sendwindow"
+	segmentservice "campaign/internal/services/segment"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxRules bounds the rules of one campaign, each one may cost a query per
+// claim
+const MaxRules = 20
+
+var ErrInvalid = errors.New("invalid eligibility rules")
+
+// per maps what max_claims rules count by to the claim field holding it
+var per = map[string]string{
+	"msisdn": "msisdn",
+	"email":  "email",
+	"ip":     "ip",
+}
+
+// Subject is who is being checked. Contact is nil for someone who is not
+// in the owner's audience yet, ClaimID is left out of max_claims counts.
+type Subject struct {
+	Contact *models.Contact
+	Msisdn  string
+	Email   string
+	IP      string
+	ClaimID string
+}
+
+// Result lists every check made, the subject is eligible when all passed
+type Result struct {
+	Eligible bool                      `json:"eligible"`
+	Checks   []models.EligibilityCheck `json:"checks"`
+}
+
+// Add records a check, a result starts out eligible until one fails
+func (r *Result) Add(check models.EligibilityCheck) {
+	r.Checks = append(r.Checks, check)
+	r.Eligible = r.Eligible && check.Passed
+}
+
+// Failed is the first check that did not pass, nil when eligible
+func (r Result) Failed() *models.EligibilityCheck {
+	for i := range r.Checks {
+		if !r.Checks[i].Passed {
+			return &r.Checks[i]
+		}
+	}
+
+	return nil
+}
+
+// Normalize checks rules and returns them with their fields cleaned up
+func Normalize(rules []models.EligibilityRule) ([]models.EligibilityRule, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("%w: a campaign must not have more than %d eligibility rules", ErrInvalid, MaxRules)
+	}
+
+	out := []models.EligibilityRule{}
+
+	for i, rule := range rules {
+		rule.Type = strings.ToLower(strings.TrimSpace(rule.Type))
+		rule.Message = strings.TrimSpace(rule.Message)
+
+		switch rule.Type {
+		case models.EligibilityNewContacts:
+		case models.EligibilityMaxClaims:
+			rule.Per = strings.ToLower(strings.TrimSpace(rule.Per))
+
+			if _, ok := per[rule.Per]; !ok {
+				return nil, fmt.Errorf("%w: rule %d must count per msisdn, email or ip", ErrInvalid, i)
+			}
+
+			if rule.Max <= 0 {
+				return nil, fmt.Errorf("%w: rule %d must allow at least one claim", ErrInvalid, i)
+			}
+		case models.EligibilitySegment:
+			if _, err := primitive.ObjectIDFromHex(rule.SegmentID); err != nil {
+				return nil, fmt.Errorf("%w: rule %d needs a segment_id", ErrInvalid, i)
+			}
+		case models.EligibilityHours:
+			if rule.Hours == nil {
+				return nil, fmt.Errorf("%w: rule %d needs hours e.g. {\"start\": \"08:00\", \"end\": \"20:00\"}", ErrInvalid, i)
+			}
+
+			hours, err := sendwindow.Normalize(rule.Hours)
+
+			if err != nil {
+				return nil, fmt.Errorf("%w: rule %d: %s", ErrInvalid, i, err.Error())
+			}
+
+			rule.Hours = hours
+		default:
+			return nil, fmt.Errorf("%w: rule %d has unknown type %q", ErrInvalid, i, rule.Type)
+		}
+
+		out = append(out, rule)
+	}
+
+	return out, nil
+}
+
+// Evaluate runs every eligibility rule of c on s at now. Rules that cannot
+// be decided because of a database error fail the evaluation rather than
+// the subject, so a claim is retried instead of rejected.
+func Evaluate(db database.Database, c models.Campaign, s Subject, now time.Time) (Result, error) {
+	result := Result{Eligible: true, Checks: []models.EligibilityCheck{}}
+
+	for i, rule := range c.Eligibility {
+		check := models.EligibilityCheck{Rule: i, Type: rule.Type, Passed: true}
+
+		reason, err := evaluate(db, c, rule, s, now)
+
+		if err != nil {
+			slog.Error("Error evaluating eligibility rule", "campaign", c.ID, "rule", i, "error", err)
+
+			return result, errors.New("error checking eligibility")
+		}
+
+		if reason != "" {
+			check.Passed = false
+			check.Reason = reason
+
+			if rule.Message != "" {
+				check.Reason = rule.Message
+			}
+		}
+
+		result.Add(check)
+	}
+
+	return result, nil
+}
+
+// evaluate returns why s fails rule, empty when it passes
+func evaluate(db database.Database, c models.Campaign, rule models.EligibilityRule, s Subject, now time.Time) (string, error) {
+	switch rule.Type {
+	case models.EligibilityNewContacts:
+		return newContact(c, s), nil
+	case models.EligibilityMaxClaims:
+		return maxClaims(db, c, rule, s)
+	case models.EligibilitySegment:
+		return inSegment(db, c, rule, s, now)
+	case models.EligibilityHours:
+		return hours(rule, s, now), nil
+	}
+
+	return fmt.Sprintf("unknown rule type %s", rule.Type), nil
+}
+
+// newContact passes people who are not in the audience yet and contacts
+// created since the campaign started, or since it was created when it has
+// no start date
+func newContact(c models.Campaign, s Subject) string {
+	if s.Contact == nil {
+		return ""
+	}
+
+	since := c.StartDate
+
+	if since.IsZero() {
+		since = c.CreatedAt
+	}
+
+	if s.Contact.CreatedAt.Before(since) {
+		return "only new contacts can claim this campaign"
+	}
+
+	return ""
+}
+
+func maxClaims(db database.Database, c models.Campaign, rule models.EligibilityRule, s Subject) (string, error) {
+	value := map[string]string{"msisdn": s.Msisdn, "email": s.Email, "ip": s.IP}[rule.Per]
+
+	// nothing to count by, e.g. a claim by email on a per msisdn rule
+	if value == "" {
+		return "", nil
+	}
+
+	// claims still waiting in the queue have not taken anything yet, only
+	// those that reserved their places or were decided with them count
+	filter := bson.M{
+		"campaign_id": c.ID,
+		per[rule.Per]: value,
+		"$or": bson.A{
+			bson.M{"status": models.ClaimStatusReceived, "reserved": true},
+			bson.M{"status": bson.M{"$in": bson.A{models.ClaimStatusApproved, models.ClaimStatusPending, models.ClaimStatusFulfilled}}},
+		},
+	}
+
+	if objid, err := primitive.ObjectIDFromHex(s.ClaimID); err == nil {
+		filter["_id"] = bson.M{"$ne": objid}
+	}
+
+	db.SetCollection(models.ClaimsCollection)
+
+	n, err := db.CountDocuments(filter)
+
+	if err != nil {
+		return "", err
+	}
+
+	if n >= rule.Max {
+		return fmt.Sprintf("this campaign can be claimed %d time(s) per %s", rule.Max, rule.Per), nil
+	}
+
+	return "", nil
+}
+
+func inSegment(db database.Database, c models.Campaign, rule models.EligibilityRule, s Subject, now time.Time) (string, error) {
+	if s.Contact == nil {
+		return "only selected contacts can claim this campaign", nil
+	}
+
+	segment := models.Segment{}
+	objid, _ := primitive.ObjectIDFromHex(rule.SegmentID)
+
+	db.SetCollection(models.SegmentsCollection)
+
+	err := db.FindOne(bson.M{"_id": objid, "created_by": c.CreatedBy}, &segment)
+
+	// a deleted segment matches nobody, like an audience built from it
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "only selected contacts can claim this campaign", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	filter, err := segmentservice.Compile(segment.Rule, now)
+
+	if err != nil {
+		return "", err
+	}
+
+	contactID, _ := primitive.ObjectIDFromHex(s.Contact.ID)
+
+	db.SetCollection(models.ContactsCollection)
+
+	n, err := db.CountDocuments(bson.M{"$and": bson.A{filter, bson.M{"_id": contactID, "created_by": c.CreatedBy}}})
+
+	if err != nil {
+		return "", err
+	}
+
+	if n == 0 {
+		return "only selected contacts can claim this campaign", nil
+	}
+
+	return "", nil
+}
+
+// hours checks now against the rule's window in the claimant's zone, the
+// same one messages to them are sent in
+func hours(rule models.EligibilityRule, s Subject, now time.Time) string {
+	zone := ""
+
+	if s.Contact != nil {
+		zone = s.Contact.TimeZone
+	}
+
+	loc := sendwindow.Location(rule.Hours, zone, s.Msisdn)
+
+	if sendwindow.Next(rule.Hours, loc, now).After(now) {
+		reason := fmt.Sprintf("claims are only taken between %s and %s", rule.Hours.Start, rule.Hours.End)
+
+		if len(rule.Hours.Days) > 0 {
+			reason += " on " + strings.Join(rule.Hours.Days, ", ")
+		}
+
+		return reason
+	}
+
+	return ""
+}
@@ -0,0 +1,217 @@
+package eligibilityservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNormalize(t *testing.T) {
+	rules, err := Normalize([]models.EligibilityRule{
+		{Type: " Max_Claims ", Per: "MSISDN", Max: 1},
+		{Type: "hours", Hours: &models.SendWindow{Start: "08:00", End: "20:00", Days: []string{"Friday", "mon"}}},
+		{Type: "segment", SegmentID: "65f0c2a1e4b0a1b2c3d4e5f6"},
+		{Type: "new_contacts", Message: " Welcome offer for new customers only "},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rules[0].Type != models.EligibilityMaxClaims || rules[0].Per != "msisdn" {
+		t.Errorf("expected the rule type and per to be normalized; got %+v", rules[0])
+	}
+
+	if days := rules[1].Hours.Days; len(days) != 2 || days[0] != "mon" || days[1] != "fri" {
+		t.Errorf("expected the hours to be normalized like a send window; got %v", days)
+	}
+
+	if rules[3].Message != "Welcome offer for new customers only" {
+		t.Errorf("expected the message to be trimmed; got %q", rules[3].Message)
+	}
+
+	invalid := map[string]models.EligibilityRule{
+		"unknown type":        {Type: "vip"},
+		"max without per":     {Type: "max_claims", Max: 1},
+		"max per device":      {Type: "max_claims", Per: "device", Max: 1},
+		"max of nothing":      {Type: "max_claims", Per: "ip"},
+		"segment without id":  {Type: "segment"},
+		"hours without hours": {Type: "hours"},
+		"hours in 12h format": {Type: "hours", Hours: &models.SendWindow{Start: "8am", End: "8pm"}},
+	}
+
+	for name, rule := range invalid {
+		if _, err := Normalize([]models.EligibilityRule{rule}); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %s to be invalid; got %v", name, err)
+		}
+	}
+
+	if _, err := Normalize(make([]models.EligibilityRule, MaxRules+1)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected more than %d rules to be refused; got %v", MaxRules, err)
+	}
+}
+
+func TestNewContact(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	campaign := models.Campaign{StartDate: start}
+
+	if reason := newContact(campaign, Subject{}); reason != "" {
+		t.Errorf("expected someone not in the audience yet to be new; got %q", reason)
+	}
+
+	if reason := newContact(campaign, Subject{Contact: &models.Contact{CreatedAt: start.Add(time.Hour)}}); reason != "" {
+		t.Errorf("expected a contact created after the start to be new; got %q", reason)
+	}
+
+	if reason := newContact(campaign, Subject{Contact: &models.Contact{CreatedAt: start.Add(-time.Hour)}}); reason == "" {
+		t.Error("expected a contact created before the start not to be new")
+	}
+}
+
+func TestHours(t *testing.T) {
+	rule := models.EligibilityRule{
+		Type:  models.EligibilityHours,
+		Hours: &models.SendWindow{Start: "08:00", End: "20:00", TimeZone: "UTC"},
+	}
+
+	// a contact's own zone wins over the window's
+	accra := &models.Contact{TimeZone: "Africa/Accra"}
+	lagos := &models.Contact{TimeZone: "Africa/Lagos"}
+	now := time.Date(2024, 6, 3, 19, 30, 0, 0, time.UTC)
+
+	if reason := hours(rule, Subject{Contact: accra}, now); reason != "" {
+		t.Errorf("expected 19:30 in Accra to be within hours; got %q", reason)
+	}
+
+	if reason := hours(rule, Subject{Contact: lagos}, now); reason == "" {
+		t.Error("expected 20:30 in Lagos to be outside hours")
+	}
+}
+
+func TestResult(t *testing.T) {
+	result := Result{Eligible: true}
+
+	result.Add(models.EligibilityCheck{Rule: 0, Type: models.EligibilityHours, Passed: true})
+	result.Add(models.EligibilityCheck{Rule: 1, Type: models.EligibilityMaxClaims, Reason: "limit"})
+	result.Add(models.EligibilityCheck{Rule: 2, Type: models.EligibilityNewContacts, Reason: "not new"})
+
+	if result.Eligible {
+		t.Error("expected a failed check to make the result ineligible")
+	}
+
+	if failed := result.Failed(); failed == nil || failed.Rule != 1 {
+		t.Errorf("expected the first failed check to be reported; got %+v", failed)
+	}
+}
+
+// claimsDB counts claims in memory, filters match on equality, $ne, $in
+// and $or. Other calls are not used by max_claims.
+type claimsDB struct {
+	database.Database
+	claims []bson.M
+}
+
+func (c *claimsDB) SetCollection(collection models.Collections) {}
+
+func (c *claimsDB) CountDocuments(filter bson.M) (int64, error) {
+	n := int64(0)
+
+	for _, claim := range c.claims {
+		if matches(claim, filter) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func matches(doc, filter bson.M) bool {
+	for key, want := range filter {
+		if key == "$or" {
+			matched := false
+
+			for _, f := range want.(bson.A) {
+				matched = matched || matches(doc, f.(bson.M))
+			}
+
+			if !matched {
+				return false
+			}
+
+			continue
+		}
+
+		op, ok := want.(bson.M)
+
+		if !ok {
+			if !reflect.DeepEqual(doc[key], want) {
+				return false
+			}
+
+			continue
+		}
+
+		if ne, ok := op["$ne"]; ok && reflect.DeepEqual(doc[key], ne) {
+			return false
+		}
+
+		if in, ok := op["$in"]; ok {
+			found := false
+
+			for _, v := range in.(bson.A) {
+				found = found || reflect.DeepEqual(doc[key], v)
+			}
+
+			if !found {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func TestMaxClaimsCountsOnlyTakenClaims(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	db := &claimsDB{claims: []bson.M{
+		{"_id": first, "campaign_id": "c1", "msisdn": "233201234567", "status": models.ClaimStatusReceived},
+		{"_id": second, "campaign_id": "c1", "msisdn": "233201234567", "status": models.ClaimStatusReceived},
+	}}
+	c := models.Campaign{ID: "c1"}
+	rule := models.EligibilityRule{Type: models.EligibilityMaxClaims, Per: "msisdn", Max: 1}
+
+	// two claims waiting in the queue do not hold each other back
+	for _, id := range []primitive.ObjectID{first, second} {
+		reason, err := maxClaims(db, c, rule, Subject{Msisdn: "233201234567", ClaimID: id.Hex()})
+
+		if err != nil || reason != "" {
+			t.Errorf("expected claim %s to pass while the other is received; got %q, %v", id.Hex(), reason, err)
+		}
+	}
+
+	// once one has reserved its place the other is over the limit
+	db.claims[0]["reserved"] = true
+
+	if reason, _ := maxClaims(db, c, rule, Subject{Msisdn: "233201234567", ClaimID: second.Hex()}); reason == "" {
+		t.Error("expected a reserved claim to count")
+	}
+
+	db.claims[0]["status"] = models.ClaimStatusRejected
+	delete(db.claims[0], "reserved")
+
+	if reason, _ := maxClaims(db, c, rule, Subject{Msisdn: "233201234567", ClaimID: second.Hex()}); reason != "" {
+		t.Errorf("expected a rejected claim not to count; got %q", reason)
+	}
+
+	db.claims[0]["status"] = models.ClaimStatusApproved
+
+	if reason, _ := maxClaims(db, c, rule, Subject{Msisdn: "233201234567", ClaimID: second.Hex()}); reason == "" {
+		t.Error("expected an approved claim to count")
+	}
+}
@@ -0,0 +1,350 @@
+package emailservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/email"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	"campaign/internal/sendwindow"
+	experimentservice "campaign/internal/services/experiment"
+	receiptservice "campaign/internal/services/receipt"
+	suppressionservice "campaign/internal/services/suppression"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DispatchJob delivers one batch, its payload holds the batch_id
+const DispatchJob = "email.dispatch"
+
+// Dispatcher delivers queued messages of a batch through a mailer. It works
+// like the sms dispatcher: messages are claimed atomically and failures that
+// are not permanent are re-queued with exponential backoff.
+type Dispatcher struct {
+	db     *mongo.Database
+	mailer *email.Mailer
+
+	Workers     int
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	idle time.Duration
+}
+
+func NewDispatcher(db *mongo.Database, mailer *email.Mailer) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		mailer:      mailer,
+		Workers:     4,
+		MaxAttempts: 5,
+		BaseBackoff: time.Minute,
+		MaxBackoff:  time.Hour,
+		idle:        time.Second,
+	}
+}
+
+// MessageID is the Message-ID header of a message, bounces are matched on it
+func MessageID(messageID, fromEmail string) string {
+	return messageID + "@" + email.Domain(fromEmail)
+}
+
+// Handle runs a DispatchJob. Messages left sending by an earlier run of the
+// job were interrupted, they are queued again and may be sent twice.
+func (d *Dispatcher) Handle(ctx context.Context, job models.Job) error {
+	batchID, _ := job.Payload["batch_id"].(string)
+
+	if batchID == "" {
+		return queue.Permanent(errors.New("batch_id is required"))
+	}
+
+	dbM := database.NewDatabaseService(ctx, d.db, models.EmailMessagesCollection)
+
+	err := dbM.UpdateManyRaw(bson.M{"batch_id": batchID, "status": models.EmailStatusSending}, bson.M{
+		"$set": bson.M{"status": models.EmailStatusQueued, "updated_at": time.Now().Local()},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := d.Run(ctx, batchID); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return d.resume(ctx, batchID)
+}
+
+// Run delivers the batch and returns once no message in it is due before
+// MaxBackoff has passed, messages deferred past that are left to resume
+func (d *Dispatcher) Run(ctx context.Context, batchID string) error {
+	batch := models.EmailBatch{}
+	objid, _ := primitive.ObjectIDFromHex(batchID)
+
+	dbM := database.NewDatabaseService(ctx, d.db, models.EmailBatchesCollection)
+
+	err := dbM.FindOne(bson.M{"_id": objid}, &batch)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return queue.Permanent(fmt.Errorf("no email batch with id: %s found", batchID))
+	}
+
+	if err != nil {
+		slog.Error("Error getting email batch", "batch", batchID, "error", err)
+
+		return err
+	}
+
+	// the send window and experiment are read once per run so a change
+	// applies from the next one
+	campaign := models.Campaign{}
+	campaignID, _ := primitive.ObjectIDFromHex(batch.CampaignID)
+
+	dbM.SetCollection(models.CampaignsCollection)
+
+	err = dbM.FindOne(bson.M{"_id": campaignID}, &campaign)
+
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error getting send window", "batch", batchID, "error", err)
+
+		return err
+	}
+
+	renderer := templateservice.NewRenderer(d.db)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < d.Workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			d.work(ctx, batch, campaign, renderer)
+		}()
+	}
+
+	wg.Wait()
+
+	slog.Info("Email batch dispatched", "batch", batchID)
+
+	return nil
+}
+
+// resume queues another DispatchJob for when the earliest message left in
+// the batch is due, rather than holding a worker until a window opens
+func (d *Dispatcher) resume(ctx context.Context, batchID string) error {
+	pending := []models.EmailMessage{}
+	dbM := database.NewDatabaseService(ctx, d.db, models.EmailMessagesCollection)
+
+	err := dbM.FindManyWithOptions(bson.M{
+		"batch_id": batchID,
+		"status":   bson.M{"$in": bson.A{models.EmailStatusQueued, models.EmailStatusDeferred}},
+	}, options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(1), &pending)
+
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+
+	message := pending[0]
+
+	job, err := queue.New(d.db).Enqueue(ctx, DispatchJob, map[string]interface{}{"batch_id": batchID}, queue.Options{
+		RunAt:     message.NextAttemptAt,
+		CreatedBy: message.CreatedBy,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Email batch resumes later", "batch", batchID, "job", job.ID, "at", job.RunAt)
+
+	return nil
+}
+
+func (d *Dispatcher) work(ctx context.Context, batch models.EmailBatch, campaign models.Campaign, renderer *templateservice.Renderer) {
+	dbM := database.NewDatabaseService(ctx, d.db, models.EmailMessagesCollection)
+
+	for ctx.Err() == nil {
+		claimed, err := d.next(ctx, dbM, batch, campaign, renderer)
+
+		if err != nil {
+			slog.Error("Error dispatching email", "batch", batch.ID, "error", err)
+		}
+
+		if claimed {
+			continue
+		}
+
+		dbM.SetCollection(models.EmailMessagesCollection)
+
+		pending, err := dbM.CountDocuments(bson.M{
+			"batch_id":        batch.ID,
+			"status":          bson.M{"$in": bson.A{models.EmailStatusQueued, models.EmailStatusDeferred}},
+			"next_attempt_at": bson.M{"$lte": time.Now().Add(d.MaxBackoff).Local()},
+		})
+
+		if err != nil || pending == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(d.idle):
+		}
+	}
+}
+
+// next claims and sends one due message, it reports false when none was due
+func (d *Dispatcher) next(ctx context.Context, dbM database.Database, batch models.EmailBatch, campaign models.Campaign, renderer *templateservice.Renderer) (bool, error) {
+	message := models.EmailMessage{}
+	now := time.Now().Local()
+
+	dbM.SetCollection(models.EmailMessagesCollection)
+
+	err := dbM.FindOneAndUpdate(bson.M{
+		"batch_id":        batch.ID,
+		"status":          bson.M{"$in": bson.A{models.EmailStatusQueued, models.EmailStatusDeferred}},
+		"next_attempt_at": bson.M{"$lte": now},
+	}, bson.M{
+		"$set": bson.M{"status": models.EmailStatusSending, "provider": d.mailer.Name(), "updated_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After), &message)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	// the address may have unsubscribed since the batch was queued, a failed
+	// lookup is retried like a failed send
+	suppressed, err := suppressionservice.IsSuppressed(dbM, message.CreatedBy, models.ChannelEmail, message.To)
+
+	if suppressed {
+		return true, d.skip(message.ID)
+	}
+
+	loc := sendwindow.Location(campaign.SendWindow, message.TimeZone, "")
+
+	if at := sendwindow.Next(campaign.SendWindow, loc, now); at.After(now) {
+		return true, d.postpone(message.ID, at)
+	}
+
+	messageID := MessageID(message.ID, batch.FromEmail)
+	content := templateservice.Rendered{Subject: batch.Subject, Body: batch.HTML, Text: batch.Text}
+
+	if err == nil && batch.TemplateID != "" {
+		content, err = renderer.Render(ctx, batch.TemplateID, batch.CampaignID, message.ContactID)
+
+		// a template that fails to execute will not on retry either
+		if errors.Is(err, templateservice.ErrInvalid) {
+			err = errors.Join(email.ErrPermanent, err)
+		}
+	}
+
+	// the subject of the contact's experiment variant replaces the batch's
+	variant := experimentservice.Assign(campaign, message.ContactID)
+
+	if v, ok := experimentservice.Variant(campaign, variant); ok && v.EmailSubject != "" {
+		content.Subject = v.EmailSubject
+	}
+
+	if err == nil {
+		err = d.mailer.Send(ctx, email.Message{
+			From:      mail.Address{Name: batch.FromName, Address: batch.FromEmail},
+			To:        mail.Address{Name: message.Name, Address: message.To},
+			ReplyTo:   batch.ReplyTo,
+			Subject:   content.Subject,
+			HTML:      content.Body,
+			Text:      content.Text,
+			MessageID: messageID,
+			Headers: suppressionservice.ListUnsubscribeHeaders(suppressionservice.Token{
+				CreatedBy:  message.CreatedBy,
+				Channel:    models.ChannelEmail,
+				Address:    message.To,
+				CampaignID: batch.CampaignID,
+			}),
+		})
+	}
+
+	update := bson.M{"updated_at": time.Now().Local(), "message_id": messageID}
+
+	if variant != "" {
+		update["variant"] = variant
+	}
+
+	switch {
+	case err == nil:
+		update["status"] = models.EmailStatusSent
+		update["sent_at"] = time.Now().Local()
+		update["last_error"] = ""
+	case email.IsPermanent(err) || message.Attempts >= d.MaxAttempts:
+		update["status"] = models.EmailStatusFailed
+		update["last_error"] = err.Error()
+	default:
+		update["status"] = models.EmailStatusQueued
+		update["last_error"] = err.Error()
+		update["next_attempt_at"] = time.Now().Add(utils.Backoff(message.Attempts, d.BaseBackoff, d.MaxBackoff)).Local()
+	}
+
+	// the send already happened, record it even if the batch was cancelled
+	record := database.NewDatabaseService(context.Background(), d.db, models.EmailMessagesCollection)
+
+	objid, _ := primitive.ObjectIDFromHex(message.ID)
+
+	if err := record.UpdateOne(bson.M{"_id": objid}, update); err != nil {
+		return true, err
+	}
+
+	// a fast provider may have called back before the send was recorded
+	if err == nil {
+		if err := receiptservice.ApplyPending(record, models.ChannelEmail, d.mailer.Name(), messageID); err != nil {
+			slog.Error("Error applying pending receipts", "message", message.ID, "error", err)
+		}
+	}
+
+	return true, nil
+}
+
+// postpone defers a message until the send window opens for its recipient,
+// the claim that found it outside the window is not an attempt
+func (d *Dispatcher) postpone(id string, at time.Time) error {
+	record := database.NewDatabaseService(context.Background(), d.db, models.EmailMessagesCollection)
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	return record.UpdateOneRaw(bson.M{"_id": objid}, bson.M{
+		"$set": bson.M{"status": models.EmailStatusDeferred, "next_attempt_at": at.Local(), "updated_at": time.Now().Local()},
+		"$inc": bson.M{"attempts": -1},
+	})
+}
+
+// skip marks a message to a suppressed address as never to be sent
+func (d *Dispatcher) skip(id string) error {
+	record := database.NewDatabaseService(context.Background(), d.db, models.EmailMessagesCollection)
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	return record.UpdateOne(bson.M{"_id": objid}, bson.M{
+		"status":     models.EmailStatusSuppressed,
+		"last_error": "recipient is suppressed",
+		"updated_at": time.Now().Local(),
+	})
+}
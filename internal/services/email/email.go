@@ -0,0 +1,342 @@
+package emailservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	suppressionservice "campaign/internal/services/suppression"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxBodySize caps the html and text bodies of a campaign email, in bytes
+	MaxBodySize = 512 << 10
+
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("already exists")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+// SendRequest carries the content to send, or a template rendered for each
+// contact when TemplateID is set
+type SendRequest struct {
+	SenderIdentityID string `json:"sender_identity_id"`
+	Subject          string `json:"subject"`
+	HTML             string `json:"html"`
+	Text             string `json:"text"`
+	TemplateID       string `json:"template_id"`
+}
+
+// Batch is one campaign send, its messages are delivered in the background
+type Batch struct {
+	ID         string `json:"id"`
+	CampaignID string `json:"campaign_id"`
+	Queued     int64  `json:"queued"`
+	JobID      string `json:"job_id,omitempty"`
+}
+
+type MessageFilter struct {
+	BatchID string
+	Status  string
+	Page    int
+	Limit   int
+}
+
+type MessagePage struct {
+	Messages []models.EmailMessage `json:"messages"`
+	Counts   map[string]int64      `json:"counts"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	Limit    int                   `json:"limit"`
+}
+
+type Service interface {
+	SendCampaign(campaignID string, req SendRequest) (Batch, error)
+	GetMessages(campaignID string, f MessageFilter) (MessagePage, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+func validateSend(req SendRequest) error {
+	if strings.TrimSpace(req.Subject) == "" {
+		return fmt.Errorf("%w: subject is required", ErrInvalid)
+	}
+
+	if strings.ContainsAny(req.Subject, "\r\n") {
+		return fmt.Errorf("%w: subject must be a single line", ErrInvalid)
+	}
+
+	if req.HTML == "" && req.Text == "" {
+		return fmt.Errorf("%w: an html or text body is required", ErrInvalid)
+	}
+
+	if len(req.HTML) > MaxBodySize || len(req.Text) > MaxBodySize {
+		return fmt.Errorf("%w: bodies must not be larger than %d bytes", ErrInvalid, MaxBodySize)
+	}
+
+	return nil
+}
+
+// SendCampaign queues an email to every contact in the campaign audience
+// snapshot that has an address, has consented to email, has not bounced or
+// complained and is not suppressed. The campaign must be live so the
+// snapshot exists.
+func (s *service) SendCampaign(campaignID string, req SendRequest) (Batch, error) {
+	batch := Batch{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return batch, err
+	}
+
+	if campaign.Status != models.CampaignStatusActive || campaign.AudienceSnapshot == nil {
+		return batch, fmt.Errorf("%w: campaign must be active to send", ErrInvalid)
+	}
+
+	if req.TemplateID != "" {
+		t, err := templateservice.ForSend(s.db, campaign.CreatedBy, req.TemplateID, models.TemplateChannelEmail)
+
+		if err != nil {
+			return batch, err
+		}
+
+		req.Subject, req.HTML, req.Text = t.Subject, t.Body, t.Text
+	}
+
+	if err := validateSend(req); err != nil {
+		return batch, err
+	}
+
+	identity, err := NewIdentityService(s.ctx, s.db).GetIdentityByID(req.SenderIdentityID)
+
+	if errors.Is(err, ErrNotFound) {
+		return batch, fmt.Errorf("%w: sender identity not found", ErrInvalid)
+	}
+
+	if err != nil {
+		return batch, err
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	batch = Batch{ID: objid.Hex(), CampaignID: campaign.ID}
+
+	s.db.SetCollection(models.EmailBatchesCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":                objid,
+		"campaign_id":        campaign.ID,
+		"sender_identity_id": identity.ID,
+		"from_name":          identity.Name,
+		"from_email":         identity.Email,
+		"reply_to":           identity.ReplyTo,
+		"subject":            strings.TrimSpace(req.Subject),
+		"html":               req.HTML,
+		"text":               req.Text,
+		"template_id":        req.TemplateID,
+		"created_by":         campaign.CreatedBy,
+		"created_at":         now,
+	})
+
+	if err != nil {
+		slog.Error("Error creating email batch", "error", err)
+
+		return batch, errors.New("error queueing messages")
+	}
+
+	s.db.SetCollection(models.AudienceMembersCollection)
+
+	pipeline := []bson.M{
+		{"$match": bson.M{"campaign_id": campaign.ID}},
+		{"$lookup": bson.M{
+			"from": string(models.ContactsCollection),
+			"let":  bson.M{"contact_id": bson.M{"$toObjectId": "$contact_id"}},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$_id", "$$contact_id"}}}},
+				bson.M{"$project": bson.M{"name": 1, "email": 1, "consent": 1, "time_zone": 1, "email_undeliverable": 1}},
+			},
+			"as": "contact",
+		}},
+		{"$unwind": "$contact"},
+		{"$match": bson.M{
+			"contact.email":               bson.M{"$type": "string", "$ne": ""},
+			"contact.consent.email":       true,
+			"contact.email_undeliverable": bson.M{"$exists": false},
+		}},
+	}
+
+	// suppressed addresses are dropped here and checked again before each send
+	pipeline = append(pipeline, suppressionservice.Exclude(campaign.CreatedBy, models.ChannelEmail, "contact.email")...)
+	pipeline = append(pipeline, []bson.M{
+		{"$project": bson.M{
+			"_id":             0,
+			"campaign_id":     campaign.ID,
+			"batch_id":        batch.ID,
+			"contact_id":      "$contact_id",
+			"to":              "$contact.email",
+			"time_zone":       "$contact.time_zone",
+			"name":            "$contact.name",
+			"status":          models.EmailStatusQueued,
+			"attempts":        0,
+			"next_attempt_at": now,
+			"created_by":      campaign.CreatedBy,
+			"created_at":      now,
+			"updated_at":      now,
+		}},
+		{"$merge": bson.M{
+			"into":           string(models.EmailMessagesCollection),
+			"on":             bson.A{"batch_id", "contact_id"},
+			"whenMatched":    "keepExisting",
+			"whenNotMatched": "insert",
+		}},
+	}...)
+
+	err = s.db.AggregateMany(pipeline, &[]bson.M{})
+
+	if err != nil {
+		slog.Error("Error queueing email batch", "error", err)
+
+		return batch, errors.New("error queueing messages")
+	}
+
+	s.db.SetCollection(models.EmailMessagesCollection)
+
+	batch.Queued, err = s.db.CountDocuments(bson.M{"batch_id": batch.ID})
+
+	if err != nil {
+		slog.Error("Error counting email batch", "error", err)
+
+		return batch, errors.New("error queueing messages")
+	}
+
+	return batch, nil
+}
+
+// GetMessages pages through the campaign messages and counts them by status
+func (s *service) GetMessages(campaignID string, f MessageFilter) (MessagePage, error) {
+	page := MessagePage{Messages: []models.EmailMessage{}, Counts: map[string]int64{}}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return page, err
+	}
+
+	if f.Page < 1 {
+		f.Page = 1
+	}
+
+	if f.Limit < 1 {
+		f.Limit = DefaultPageSize
+	}
+
+	f.Limit = min(f.Limit, MaxPageSize)
+
+	filter := bson.M{"campaign_id": campaign.ID}
+
+	if f.BatchID != "" {
+		filter["batch_id"] = f.BatchID
+	}
+
+	counts := []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}{}
+
+	s.db.SetCollection(models.EmailMessagesCollection)
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": filter},
+		{"$group": bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}},
+	}, &counts)
+
+	if err != nil {
+		slog.Error("Error counting email messages", "error", err)
+
+		return page, errors.New("error getting messages")
+	}
+
+	for _, c := range counts {
+		page.Counts[c.Status] = c.Count
+		page.Total += c.Count
+	}
+
+	if f.Status != "" {
+		filter["status"] = f.Status
+		page.Total = page.Counts[f.Status]
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(int64((f.Page - 1) * f.Limit)).
+		SetLimit(int64(f.Limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &page.Messages)
+
+	if err != nil {
+		slog.Error("Error getting email messages", "error", err)
+
+		return page, errors.New("error getting messages")
+	}
+
+	page.Page = f.Page
+	page.Limit = f.Limit
+
+	return page, nil
+}
+
+func (s *service) findCampaign(id string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return campaign, fmt.Errorf("%w: invalid campaign id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &campaign)
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	return campaign, nil
+}
@@ -0,0 +1,159 @@
+package emailservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MaxFeedbackPerRequest caps a single notification batch
+const MaxFeedbackPerRequest = 500
+
+// Feedback is a bounce or complaint notification from the mail server or
+// relay. MessageID is the Message-ID header of the original message, Email
+// is used on its own when the notification can not be tied to a message.
+type Feedback struct {
+	Type       string    `json:"type"`
+	BounceType string    `json:"bounce_type"`
+	Email      string    `json:"email"`
+	MessageID  string    `json:"message_id"`
+	Reason     string    `json:"reason"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Undeliverable reports whether f means the address should not be mailed
+// again. Soft bounces such as a full mailbox are only recorded on the message.
+func (f Feedback) Undeliverable() bool {
+	return f.Type == models.FeedbackComplaint || f.BounceType != "soft"
+}
+
+func validateFeedback(f Feedback) (Feedback, error) {
+	f.Type = strings.ToLower(strings.TrimSpace(f.Type))
+	f.BounceType = strings.ToLower(strings.TrimSpace(f.BounceType))
+	f.Email = utils.NormalizeEmail(f.Email)
+	f.MessageID = strings.Trim(strings.TrimSpace(f.MessageID), "<>")
+
+	if f.Type != models.FeedbackBounce && f.Type != models.FeedbackComplaint {
+		return f, fmt.Errorf("%w: type must be bounce or complaint", ErrInvalid)
+	}
+
+	if f.Type == models.FeedbackBounce && f.BounceType != "hard" && f.BounceType != "soft" {
+		return f, fmt.Errorf("%w: bounce_type must be hard or soft", ErrInvalid)
+	}
+
+	if f.Email == "" && f.MessageID == "" {
+		return f, fmt.Errorf("%w: email or message_id is required", ErrInvalid)
+	}
+
+	if f.OccurredAt.IsZero() {
+		f.OccurredAt = time.Now()
+	}
+
+	return f, nil
+}
+
+// RecordFeedback marks the messages the notifications refer to as bounced or
+// complained and flags their contacts as undeliverable. A notification with
+// only an address flags every contact with that address.
+func RecordFeedback(db database.Database, events []Feedback) (int, error) {
+	if len(events) == 0 {
+		return 0, fmt.Errorf("%w: at least one notification is required", ErrInvalid)
+	}
+
+	if len(events) > MaxFeedbackPerRequest {
+		return 0, fmt.Errorf("%w: at most %d notifications are accepted per request", ErrInvalid, MaxFeedbackPerRequest)
+	}
+
+	for i := range events {
+		f, err := validateFeedback(events[i])
+
+		if err != nil {
+			return 0, fmt.Errorf("notification %d: %w", i, err)
+		}
+
+		events[i] = f
+	}
+
+	for _, f := range events {
+		if err := recordFeedback(db, f); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(events), nil
+}
+
+func recordFeedback(db database.Database, f Feedback) error {
+	message := models.EmailMessage{}
+	contactFilter := bson.M{"email": f.Email}
+
+	if f.MessageID != "" {
+		db.SetCollection(models.EmailMessagesCollection)
+
+		err := db.FindOne(bson.M{"message_id": f.MessageID}, &message)
+
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Error("Error getting email message", "error", err)
+
+			return errors.New("error recording feedback")
+		}
+	}
+
+	if message.ID != "" {
+		status := models.EmailStatusBounced
+
+		if f.Type == models.FeedbackComplaint {
+			status = models.EmailStatusComplained
+		}
+
+		objid, _ := primitive.ObjectIDFromHex(message.ID)
+
+		err := db.UpdateOne(bson.M{"_id": objid}, bson.M{
+			"status":     status,
+			"last_error": f.Reason,
+			"updated_at": time.Now().Local(),
+		})
+
+		if err != nil {
+			slog.Error("Error updating email message", "error", err)
+
+			return errors.New("error recording feedback")
+		}
+
+		contactID, _ := primitive.ObjectIDFromHex(message.ContactID)
+		contactFilter = bson.M{"_id": contactID, "created_by": message.CreatedBy}
+	} else if f.Email == "" {
+		// nothing to tie an unknown message id to
+		slog.Warn("Email feedback for unknown message", "message_id", f.MessageID)
+
+		return nil
+	}
+
+	if !f.Undeliverable() {
+		return nil
+	}
+
+	db.SetCollection(models.ContactsCollection)
+
+	err := db.UpdateManyRaw(contactFilter, bson.M{"$set": bson.M{
+		"email_undeliverable": models.Undeliverable{Type: f.Type, Reason: f.Reason, At: f.OccurredAt.Local()},
+		"updated_at":          time.Now().Local(),
+	}})
+
+	if err != nil {
+		slog.Error("Error marking contact undeliverable", "error", err)
+
+		return errors.New("error recording feedback")
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package emailservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type IdentityService interface {
+	CreateIdentity(i models.SenderIdentity) (models.SenderIdentity, error)
+	GetIdentities() ([]models.SenderIdentity, error)
+	GetIdentityByID(id string) (models.SenderIdentity, error)
+	UpdateIdentity(id string, i models.SenderIdentity) error
+	DeleteIdentity(id string) error
+}
+
+type identityService struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewIdentityService(ctx context.Context, db database.Database) IdentityService {
+	return &identityService{ctx: ctx, db: db}
+}
+
+func NormalizeIdentity(i models.SenderIdentity) (models.SenderIdentity, error) {
+	i.Name = strings.TrimSpace(i.Name)
+	i.Email = utils.NormalizeEmail(i.Email)
+	i.ReplyTo = utils.NormalizeEmail(i.ReplyTo)
+
+	if strings.ContainsAny(i.Name, "\r\n") {
+		return i, fmt.Errorf("%w: name must be a single line", ErrInvalid)
+	}
+
+	if _, err := mail.ParseAddress(i.Email); err != nil {
+		return i, fmt.Errorf("%w: invalid email address %s", ErrInvalid, i.Email)
+	}
+
+	if i.ReplyTo != "" {
+		if _, err := mail.ParseAddress(i.ReplyTo); err != nil {
+			return i, fmt.Errorf("%w: invalid reply to address %s", ErrInvalid, i.ReplyTo)
+		}
+	}
+
+	return i, nil
+}
+
+func (s *identityService) CreateIdentity(i models.SenderIdentity) (models.SenderIdentity, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return i, errors.New("error creating sender identity")
+	}
+
+	i, err = NormalizeIdentity(i)
+
+	if err != nil {
+		return i, err
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.SenderIdentitiesCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":        objid,
+		"name":       i.Name,
+		"email":      i.Email,
+		"reply_to":   i.ReplyTo,
+		"created_by": user.Sub,
+		"created_at": now,
+		"updated_at": now,
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return i, fmt.Errorf("%w: a sender identity for %s already exists", ErrExists, i.Email)
+	}
+
+	if err != nil {
+		slog.Error("Error creating sender identity", "error", err)
+
+		return i, errors.New("error creating sender identity")
+	}
+
+	i.ID = objid.Hex()
+	i.CreatedBy = user.Sub
+	i.CreatedAt = now
+	i.UpdatedAt = now
+
+	return i, nil
+}
+
+func (s *identityService) GetIdentities() ([]models.SenderIdentity, error) {
+	identities := []models.SenderIdentity{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return identities, errors.New("error getting sender identities")
+	}
+
+	s.db.SetCollection(models.SenderIdentitiesCollection)
+
+	err = s.db.FindMany(bson.M{"created_by": user.Sub}, &identities)
+
+	if err != nil {
+		slog.Error("Error getting sender identities", "error", err)
+
+		return identities, errors.New("error getting sender identities")
+	}
+
+	return identities, nil
+}
+
+func (s *identityService) GetIdentityByID(id string) (models.SenderIdentity, error) {
+	identity := models.SenderIdentity{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return identity, errors.New("error getting sender identity")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return identity, fmt.Errorf("%w: invalid sender identity id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.SenderIdentitiesCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &identity)
+
+	if err != nil {
+		slog.Error("Error getting sender identity", "error", err)
+
+		return identity, fmt.Errorf("%w: no sender identities with id: %s found", ErrNotFound, id)
+	}
+
+	return identity, nil
+}
+
+func (s *identityService) UpdateIdentity(id string, i models.SenderIdentity) error {
+	existing, err := s.GetIdentityByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	i, err = NormalizeIdentity(i)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	s.db.SetCollection(models.SenderIdentitiesCollection)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": existing.CreatedBy}, bson.M{
+		"name":       i.Name,
+		"email":      i.Email,
+		"reply_to":   i.ReplyTo,
+		"updated_at": time.Now().Local(),
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: a sender identity for %s already exists", ErrExists, i.Email)
+	}
+
+	if err != nil {
+		slog.Error("Error updating sender identity", "error", err)
+
+		return fmt.Errorf("could not update sender identity with id: %s", id)
+	}
+
+	return nil
+}
+
+func (s *identityService) DeleteIdentity(id string) error {
+	existing, err := s.GetIdentityByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	s.db.SetCollection(models.SenderIdentitiesCollection)
+
+	err = s.db.DeleteOne(bson.M{"_id": objid, "created_by": existing.CreatedBy})
+
+	if err != nil {
+		slog.Error("Error deleting sender identity", "error", err)
+
+		return fmt.Errorf("could not delete sender identity with id: %s", id)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package experimentservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EvaluateJob checks an experiment with auto promotion and promotes its
+// winner, its payload holds the campaign_id
+const EvaluateJob = "experiment.evaluate"
+
+// EvaluateEvery is how often an experiment is checked for a winner
+const EvaluateEvery = 30 * time.Minute
+
+// Evaluator runs EvaluateJobs. A job that finds no winner queues the next
+// one and hands it the experiment, so one chain runs per experiment.
+type Evaluator struct {
+	db   *mongo.Database
+	jobs *queue.Queue
+}
+
+func NewEvaluator(db *mongo.Database, jobs *queue.Queue) *Evaluator {
+	return &Evaluator{db: db, jobs: jobs}
+}
+
+func (ev *Evaluator) Handle(ctx context.Context, job models.Job) error {
+	campaignID, _ := job.Payload["campaign_id"].(string)
+	objid, err := primitive.ObjectIDFromHex(campaignID)
+
+	if err != nil {
+		return queue.Permanent(errors.New("campaign_id is required"))
+	}
+
+	campaign := models.Campaign{}
+	db := database.NewDatabaseService(ctx, ev.db, models.CampaignsCollection)
+
+	err = db.FindOne(bson.M{"_id": objid}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	campaign.ID = objid.Hex()
+	e := campaign.Experiment
+
+	// the experiment was replaced, ended or decided since the job was queued
+	if !Active(campaign) || !e.AutoPromote || e.Winner != "" || e.JobID != job.ID || campaign.Status == models.CampaignStatusEnded {
+		return nil
+	}
+
+	res, err := results(db, campaign)
+
+	if err != nil {
+		return err
+	}
+
+	if res.Significant {
+		_, err = promote(db, campaign, res.Leader)
+
+		return err
+	}
+
+	next, err := ev.jobs.Enqueue(ctx, EvaluateJob, job.Payload, queue.Options{
+		RunAt:     time.Now().Add(EvaluateEvery),
+		CreatedBy: campaign.CreatedBy,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	db.SetCollection(models.CampaignsCollection)
+
+	return db.UpdateOne(bson.M{"_id": objid, "experiment.job_id": job.ID}, bson.M{"experiment.job_id": next.ID})
+}
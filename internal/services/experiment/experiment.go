@@ -0,0 +1,440 @@
+package experimentservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	"campaign/internal/sms"
+	"campaign/internal/utils/jwt"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	MinVariants = 2
+	MaxVariants = 5
+	MaxWeight   = 1000
+
+	DefaultConfidence = 0.95
+	MinConfidence     = 0.8
+	MaxConfidence     = 0.999
+	DefaultMinSample  = 100
+
+	MaxNameLength         = 100
+	MaxEmailSubjectLength = 200
+
+	// maxSMSSegments is smsservice.MaxSegments, which cannot be imported
+	// here as the sms dispatcher uses this package
+	maxSMSSegments = 6
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrInvalid     = errors.New("invalid request")
+	ErrUnavailable = errors.New("experiment unavailable")
+
+	keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,19}$`)
+
+	metrics = []string{models.ExperimentMetricClicks, models.ExperimentMetricClaims, models.ExperimentMetricConversion}
+)
+
+type PromoteRequest struct {
+	Variant string `json:"variant"`
+}
+
+type Service interface {
+	SetExperiment(campaignID string, e models.Experiment) (models.Experiment, error)
+	DeleteExperiment(campaignID string) error
+	GetResults(campaignID string) (Results, error)
+	Promote(campaignID string, req PromoteRequest) (models.Experiment, error)
+}
+
+type service struct {
+	ctx  context.Context
+	db   database.Database
+	jobs *queue.Queue
+}
+
+func NewService(ctx context.Context, db database.Database, jobs *queue.Queue) Service {
+	return &service{ctx: ctx, db: db, jobs: jobs}
+}
+
+// Normalize fills in defaults and checks e. The winner and start are kept
+// for the caller to set, they are not taken from requests.
+func Normalize(e models.Experiment) (models.Experiment, error) {
+	e.Metric = strings.ToLower(strings.TrimSpace(e.Metric))
+
+	if e.Metric == "" {
+		e.Metric = models.ExperimentMetricClicks
+	}
+
+	valid := false
+
+	for _, m := range metrics {
+		valid = valid || e.Metric == m
+	}
+
+	if !valid {
+		return e, fmt.Errorf("%w: metric must be one of %s", ErrInvalid, strings.Join(metrics, ", "))
+	}
+
+	if e.Confidence == 0 {
+		e.Confidence = DefaultConfidence
+	}
+
+	if e.Confidence < MinConfidence || e.Confidence > MaxConfidence {
+		return e, fmt.Errorf("%w: confidence must be between %g and %g", ErrInvalid, MinConfidence, MaxConfidence)
+	}
+
+	if e.MinSample == 0 {
+		e.MinSample = DefaultMinSample
+	}
+
+	if e.MinSample < 0 {
+		return e, fmt.Errorf("%w: min_sample must not be negative", ErrInvalid)
+	}
+
+	if len(e.Variants) < MinVariants || len(e.Variants) > MaxVariants {
+		return e, fmt.Errorf("%w: an experiment has %d to %d variants", ErrInvalid, MinVariants, MaxVariants)
+	}
+
+	seen := map[string]bool{}
+
+	for i, v := range e.Variants {
+		v.Key = strings.ToLower(strings.TrimSpace(v.Key))
+		v.Name = strings.TrimSpace(v.Name)
+		v.SMSBody = strings.TrimSpace(v.SMSBody)
+		v.EmailSubject = strings.TrimSpace(v.EmailSubject)
+		v.BannerAssetID = strings.TrimSpace(v.BannerAssetID)
+
+		if !keyPattern.MatchString(v.Key) {
+			return e, fmt.Errorf("%w: variant %d key must be 1 to 20 lower case letters, digits, dashes or underscores", ErrInvalid, i+1)
+		}
+
+		if seen[v.Key] {
+			return e, fmt.Errorf("%w: variant key %s is used twice", ErrInvalid, v.Key)
+		}
+
+		seen[v.Key] = true
+
+		if v.Weight == 0 {
+			v.Weight = 1
+		}
+
+		if v.Weight < 0 || v.Weight > MaxWeight {
+			return e, fmt.Errorf("%w: variant %s weight must be between 1 and %d", ErrInvalid, v.Key, MaxWeight)
+		}
+
+		if len(v.Name) > MaxNameLength {
+			return e, fmt.Errorf("%w: variant %s name must be at most %d characters", ErrInvalid, v.Key, MaxNameLength)
+		}
+
+		if encoding, segments := sms.Segments(v.SMSBody); segments > maxSMSSegments {
+			return e, fmt.Errorf("%w: variant %s sms_body is %d %s parts, at most %d are allowed", ErrInvalid, v.Key, segments, encoding, maxSMSSegments)
+		}
+
+		if len(v.EmailSubject) > MaxEmailSubjectLength || strings.ContainsAny(v.EmailSubject, "\r\n") {
+			return e, fmt.Errorf("%w: variant %s email_subject must be one line of at most %d characters", ErrInvalid, v.Key, MaxEmailSubjectLength)
+		}
+
+		if v.BannerAssetID != "" && !primitive.IsValidObjectID(v.BannerAssetID) {
+			return e, fmt.Errorf("%w: variant %s banner_asset_id is not an asset id", ErrInvalid, v.Key)
+		}
+
+		e.Variants[i] = v
+	}
+
+	return e, nil
+}
+
+// Active reports whether c splits its contacts between variants
+func Active(c models.Campaign) bool {
+	return c.Experiment != nil && c.Experiment.Enabled
+}
+
+// Assign picks the variant of c for subject, a contact id or an anonymous
+// visitor. The pick is a hash of both so it is the same on every send and
+// click without being stored, changing the weights moves some subjects.
+// It is "" when c runs no experiment or there is no subject.
+func Assign(c models.Campaign, subject string) string {
+	if !Active(c) {
+		return ""
+	}
+
+	if c.Experiment.Winner != "" {
+		return c.Experiment.Winner
+	}
+
+	if subject == "" {
+		return ""
+	}
+
+	total := 0
+
+	for _, v := range c.Experiment.Variants {
+		total += v.Weight
+	}
+
+	if total <= 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(c.ID + "|" + subject))
+	n := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+
+	for _, v := range c.Experiment.Variants {
+		if n < v.Weight {
+			return v.Key
+		}
+
+		n -= v.Weight
+	}
+
+	return ""
+}
+
+// Variant looks up the variant key of c's experiment
+func Variant(c models.Campaign, key string) (models.ExperimentVariant, bool) {
+	if !Active(c) || key == "" {
+		return models.ExperimentVariant{}, false
+	}
+
+	for _, v := range c.Experiment.Variants {
+		if v.Key == key {
+			return v, true
+		}
+	}
+
+	return models.ExperimentVariant{}, false
+}
+
+// Chosen is the variant a claimant who came through a landing page showing
+// key is counted under, the winner once there is one
+func Chosen(c models.Campaign, key string) string {
+	if !Active(c) {
+		return ""
+	}
+
+	if c.Experiment.Winner != "" {
+		return c.Experiment.Winner
+	}
+
+	if _, ok := Variant(c, key); ok {
+		return key
+	}
+
+	return ""
+}
+
+// SetExperiment starts an experiment on the campaign, replacing any earlier
+// one and its winner. With auto promotion an evaluation job is queued.
+func (s *service) SetExperiment(campaignID string, e models.Experiment) (models.Experiment, error) {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return e, err
+	}
+
+	e, err = Normalize(e)
+
+	if err != nil {
+		return e, err
+	}
+
+	for _, v := range e.Variants {
+		if v.BannerAssetID == "" {
+			continue
+		}
+
+		if err := s.findAsset(campaign, v.BannerAssetID); err != nil {
+			return e, err
+		}
+	}
+
+	e.Winner = ""
+	e.PromotedAt = nil
+	e.StartedAt = time.Now().Local()
+	e.JobID = ""
+
+	if e.Enabled && e.AutoPromote {
+		job, err := s.jobs.Enqueue(s.ctx, EvaluateJob, map[string]interface{}{"campaign_id": campaign.ID}, queue.Options{
+			RunAt:     e.StartedAt.Add(EvaluateEvery),
+			CreatedBy: campaign.CreatedBy,
+		})
+
+		if err != nil {
+			slog.Error("Error queueing experiment evaluation", "campaign", campaign.ID, "error", err)
+
+			return e, errors.New("error saving experiment")
+		}
+
+		e.JobID = job.ID
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(campaign.ID)
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": campaign.CreatedBy}, bson.M{
+		"experiment": e,
+		"updated_at": time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error saving experiment", "error", err)
+
+		return e, errors.New("error saving experiment")
+	}
+
+	return e, nil
+}
+
+// DeleteExperiment ends the experiment, every contact gets the campaign's
+// own text and banner again. Recorded variants are kept on messages.
+func (s *service) DeleteExperiment(campaignID string) error {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return err
+	}
+
+	if campaign.Experiment == nil {
+		return fmt.Errorf("%w: the campaign has no experiment", ErrNotFound)
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(campaign.ID)
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.UpdateOneRaw(bson.M{"_id": objid, "created_by": campaign.CreatedBy}, bson.M{
+		"$unset": bson.M{"experiment": ""},
+		"$set":   bson.M{"updated_at": time.Now().Local()},
+	})
+
+	if err != nil {
+		slog.Error("Error deleting experiment", "error", err)
+
+		return errors.New("error deleting experiment")
+	}
+
+	return nil
+}
+
+// Promote makes a variant the winner by hand, every contact gets it from
+// then on
+func (s *service) Promote(campaignID string, req PromoteRequest) (models.Experiment, error) {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return models.Experiment{}, err
+	}
+
+	if !Active(campaign) {
+		return models.Experiment{}, fmt.Errorf("%w: the campaign runs no experiment", ErrUnavailable)
+	}
+
+	key := strings.ToLower(strings.TrimSpace(req.Variant))
+
+	if _, ok := Variant(campaign, key); !ok {
+		return *campaign.Experiment, fmt.Errorf("%w: no variant with key: %s", ErrInvalid, req.Variant)
+	}
+
+	return promote(s.db, campaign, key)
+}
+
+// promote sets the winner of the campaign's experiment
+func promote(db database.Database, campaign models.Campaign, key string) (models.Experiment, error) {
+	e := *campaign.Experiment
+	now := time.Now().Local()
+
+	e.Winner = key
+	e.PromotedAt = &now
+
+	objid, _ := primitive.ObjectIDFromHex(campaign.ID)
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err := db.UpdateOne(bson.M{"_id": objid}, bson.M{
+		"experiment.winner":      e.Winner,
+		"experiment.promoted_at": e.PromotedAt,
+		"updated_at":             now,
+	})
+
+	if err != nil {
+		slog.Error("Error promoting variant", "campaign", campaign.ID, "error", err)
+
+		return e, errors.New("error promoting variant")
+	}
+
+	slog.Info("Experiment variant promoted", "campaign", campaign.ID, "variant", key)
+
+	return e, nil
+}
+
+func (s *service) findAsset(campaign models.Campaign, id string) error {
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	s.db.SetCollection(models.AssetsCollection)
+
+	count, err := s.db.CountDocuments(bson.M{"_id": objid, "created_by": campaign.CreatedBy, "content_type": bson.M{"$regex": "^image/"}})
+
+	if err != nil {
+		slog.Error("Error getting asset", "error", err)
+
+		return errors.New("error getting asset")
+	}
+
+	if count == 0 {
+		return fmt.Errorf("%w: no image assets with id: %s found", ErrInvalid, id)
+	}
+
+	return nil
+}
+
+func (s *service) findCampaign(id string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	campaign.ID = objid.Hex()
+	campaign.CreatedBy = user.Sub
+
+	return campaign, nil
+}
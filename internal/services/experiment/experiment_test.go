@@ -0,0 +1,219 @@
+package experimentservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func experiment(weights ...int) models.Campaign {
+	e := &models.Experiment{Enabled: true, Confidence: DefaultConfidence}
+
+	for i, w := range weights {
+		e.Variants = append(e.Variants, models.ExperimentVariant{Key: fmt.Sprintf("v%d", i), Weight: w})
+	}
+
+	return models.Campaign{ID: "65f0c0ffee0000000000abcd", Experiment: e}
+}
+
+func TestNormalize(t *testing.T) {
+	e, err := Normalize(models.Experiment{Variants: []models.ExperimentVariant{
+		{Key: " Control "},
+		{Key: "short", Weight: 3, SMSBody: " Hi! "},
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Metric != models.ExperimentMetricClicks || e.Confidence != DefaultConfidence || e.MinSample != DefaultMinSample {
+		t.Errorf("expected the default metric, confidence and sample; got %+v", e)
+	}
+
+	if e.Variants[0].Key != "control" || e.Variants[0].Weight != 1 || e.Variants[1].SMSBody != "Hi!" {
+		t.Errorf("expected trimmed keys and bodies and a default weight; got %+v", e.Variants)
+	}
+
+	two := []models.ExperimentVariant{{Key: "a"}, {Key: "b"}}
+
+	invalid := map[string]models.Experiment{
+		"one variant":      {Variants: two[:1]},
+		"unknown metric":   {Metric: "opens", Variants: two},
+		"low confidence":   {Confidence: 0.5, Variants: two},
+		"negative sample":  {MinSample: -1, Variants: two},
+		"duplicate key":    {Variants: []models.ExperimentVariant{{Key: "a"}, {Key: "A"}}},
+		"bad key":          {Variants: []models.ExperimentVariant{{Key: "a b"}, {Key: "b"}}},
+		"negative weight":  {Variants: []models.ExperimentVariant{{Key: "a", Weight: -1}, {Key: "b"}}},
+		"two line subject": {Variants: []models.ExperimentVariant{{Key: "a", EmailSubject: "a\nb"}, {Key: "b"}}},
+		"long sms":         {Variants: []models.ExperimentVariant{{Key: "a", SMSBody: strings.Repeat("x", 160*maxSMSSegments)}, {Key: "b"}}},
+		"bad asset":        {Variants: []models.ExperimentVariant{{Key: "a", BannerAssetID: "banner"}, {Key: "b"}}},
+	}
+
+	for name, e := range invalid {
+		if _, err := Normalize(e); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %s to be invalid; got %v", name, err)
+		}
+	}
+}
+
+func TestAssign(t *testing.T) {
+	c := experiment(1, 3)
+	counts := map[string]int{}
+
+	for i := 0; i < 4000; i++ {
+		subject := fmt.Sprintf("contact-%d", i)
+		key := Assign(c, subject)
+
+		if Assign(c, subject) != key {
+			t.Fatalf("expected %s to get the same variant every time", subject)
+		}
+
+		counts[key]++
+	}
+
+	// a quarter of 4000 with a few standard deviations to spare
+	if counts["v0"] < 880 || counts["v0"] > 1120 || counts["v0"]+counts["v1"] != 4000 {
+		t.Errorf("expected a 1:3 split; got %v", counts)
+	}
+
+	if key := Assign(c, ""); key != "" {
+		t.Errorf("expected no variant without a subject; got %s", key)
+	}
+
+	c.Experiment.Winner = "v1"
+
+	if key := Assign(c, "contact-1"); key != "v1" {
+		t.Errorf("expected everyone to get the winner; got %s", key)
+	}
+
+	c.Experiment.Enabled = false
+
+	if key := Assign(c, "contact-1"); key != "" {
+		t.Errorf("expected no variant from a disabled experiment; got %s", key)
+	}
+}
+
+func TestChosen(t *testing.T) {
+	c := experiment(1, 1)
+
+	if key := Chosen(c, "v1"); key != "v1" {
+		t.Errorf("expected the variant shown to be kept; got %s", key)
+	}
+
+	if key := Chosen(c, "v9"); key != "" {
+		t.Errorf("expected an unknown variant to be dropped; got %s", key)
+	}
+
+	c.Experiment.Winner = "v0"
+
+	if key := Chosen(c, "v1"); key != "v0" {
+		t.Errorf("expected the winner once there is one; got %s", key)
+	}
+
+	if key := Chosen(models.Campaign{}, "v1"); key != "" {
+		t.Errorf("expected no variant without an experiment; got %s", key)
+	}
+}
+
+func TestZTest(t *testing.T) {
+	// 10% against 15% of 1000 each: z = 0.05 / sqrt(0.125 * 0.875 * 0.002)
+	z, p := ZTest(100, 1000, 150, 1000)
+
+	if math.Abs(z-3.381) > 0.001 || math.Abs(p-0.00072) > 0.00002 {
+		t.Errorf("expected z 3.381 and p 0.00072; got %f and %f", z, p)
+	}
+
+	if z, _ := ZTest(150, 1000, 100, 1000); z >= 0 {
+		t.Errorf("expected z to be negative when the second is lower; got %f", z)
+	}
+
+	if z, p := ZTest(0, 0, 10, 100); z != 0 || p != 1 {
+		t.Errorf("expected an empty sample to test nothing; got %f and %f", z, p)
+	}
+}
+
+func TestChiSquared(t *testing.T) {
+	// for two samples chi-squared is the square of the z statistic
+	chi2, df, p := ChiSquared([]int64{100, 150}, []int64{1000, 1000})
+	z, zp := ZTest(100, 1000, 150, 1000)
+
+	if df != 1 || math.Abs(chi2-z*z) > 1e-9 || math.Abs(p-zp) > 1e-9 {
+		t.Errorf("expected chi-squared %f with p %f; got %f, df %d and p %f", z*z, zp, chi2, df, p)
+	}
+
+	survival := map[string]struct {
+		x  float64
+		df int
+		p  float64
+	}{
+		"df 1":  {3.841, 1, 0.05},
+		"df 2":  {5.991, 2, 0.05},
+		"df 4":  {13.277, 4, 0.01},
+		"small": {0.455, 1, 0.5},
+	}
+
+	for name, s := range survival {
+		if p := ChiSquaredSurvival(s.x, s.df); math.Abs(p-s.p) > 0.0005 {
+			t.Errorf("expected %s to have p %f; got %f", name, s.p, p)
+		}
+	}
+
+	if _, df, p := ChiSquared([]int64{5, 0}, []int64{10, 0}); df != 0 || p != 1 {
+		t.Errorf("expected one sample with trials to test nothing; got df %d and p %f", df, p)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	e := models.Experiment{Metric: models.ExperimentMetricClicks, Confidence: DefaultConfidence, MinSample: 500}
+
+	res := Evaluate(e, []VariantResult{
+		{Key: "a", Deliveries: 1000, Clicks: 100},
+		{Key: "b", Deliveries: 1000, Clicks: 150},
+		{Key: "c", Deliveries: 1000, Clicks: 105},
+	})
+
+	if !res.Significant || res.Leader != "b" || !res.SampleReached || res.DF != 2 {
+		t.Errorf("expected b to lead significantly; got %+v", res)
+	}
+
+	if !res.Variants[0].Control || math.Abs(res.Variants[1].Lift-0.5) > 1e-9 || res.Variants[1].Rate != 0.15 {
+		t.Errorf("expected b to be 50%% above the control; got %+v", res.Variants)
+	}
+
+	// the leader is well ahead of the control but not of the runner up
+	res = Evaluate(e, []VariantResult{
+		{Key: "a", Deliveries: 1000, Clicks: 100},
+		{Key: "b", Deliveries: 1000, Clicks: 150},
+		{Key: "c", Deliveries: 1000, Clicks: 145},
+	})
+
+	if res.Significant || res.Leader != "b" {
+		t.Errorf("expected b to lead without significance; got %+v", res)
+	}
+
+	e.MinSample = 2000
+
+	res = Evaluate(e, []VariantResult{
+		{Key: "a", Deliveries: 1000, Clicks: 100},
+		{Key: "b", Deliveries: 1000, Clicks: 150},
+	})
+
+	if res.Significant || res.SampleReached {
+		t.Errorf("expected no winner before the sample is reached; got %+v", res)
+	}
+
+	e.Metric = models.ExperimentMetricConversion
+	e.MinSample = 0
+
+	res = Evaluate(e, []VariantResult{
+		{Key: "a", Clicks: 10, Claims: 12},
+		{Key: "b", Clicks: 0},
+	})
+
+	if res.Variants[0].Rate != 1 || res.Variants[1].Rate != 0 || res.Leader != "a" || res.Significant {
+		t.Errorf("expected claims to be capped at clicks and no winner without trials; got %+v", res)
+	}
+}
@@ -0,0 +1,268 @@
+package experimentservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// VariantResult is how one variant did. Trials and Successes are what the
+// experiment metric compares, Z and PValue test the variant against the
+// control.
+type VariantResult struct {
+	Key        string  `json:"key"`
+	Name       string  `json:"name,omitempty"`
+	Weight     int     `json:"weight"`
+	Control    bool    `json:"control"`
+	Deliveries int64   `json:"deliveries"`
+	Clicks     int64   `json:"clicks"`
+	Claims     int64   `json:"claims"`
+	Trials     int64   `json:"trials"`
+	Successes  int64   `json:"successes"`
+	Rate       float64 `json:"rate"`
+	Lift       float64 `json:"lift"`
+	Z          float64 `json:"z"`
+	PValue     float64 `json:"p_value"`
+}
+
+// Results compares the variants of an experiment. The chi-squared test is
+// over every variant. Leader has the best rate, it is Significant when the
+// sample is reached and it beats both the others together and the runner up
+// at the experiment's confidence.
+type Results struct {
+	Experiment    models.Experiment `json:"experiment"`
+	Variants      []VariantResult   `json:"variants"`
+	ChiSquared    float64           `json:"chi_squared"`
+	DF            int               `json:"df"`
+	PValue        float64           `json:"p_value"`
+	SampleReached bool              `json:"sample_reached"`
+	Leader        string            `json:"leader,omitempty"`
+	Significant   bool              `json:"significant"`
+}
+
+type variantCount struct {
+	Key   string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// Evaluate fills in the rates and tests of r from its counts
+func Evaluate(e models.Experiment, r []VariantResult) Results {
+	res := Results{Experiment: e, Variants: r}
+	successes, trials := make([]int64, len(r)), make([]int64, len(r))
+
+	res.SampleReached = len(r) >= MinVariants
+
+	for i := range r {
+		switch e.Metric {
+		case models.ExperimentMetricClaims:
+			r[i].Trials, r[i].Successes = r[i].Deliveries, r[i].Claims
+		case models.ExperimentMetricConversion:
+			r[i].Trials, r[i].Successes = r[i].Clicks, r[i].Claims
+		default:
+			r[i].Trials, r[i].Successes = r[i].Deliveries, r[i].Clicks
+		}
+
+		// a forwarded message can bring more clicks than it had recipients,
+		// a proportion cannot be above one
+		r[i].Successes = min(r[i].Successes, r[i].Trials)
+
+		if r[i].Trials > 0 {
+			r[i].Rate = float64(r[i].Successes) / float64(r[i].Trials)
+		}
+
+		successes[i], trials[i] = r[i].Successes, r[i].Trials
+		res.SampleReached = res.SampleReached && r[i].Trials >= e.MinSample && r[i].Trials > 0
+	}
+
+	if len(r) == 0 {
+		return res
+	}
+
+	control := r[0]
+	r[0].Control = true
+	r[0].PValue = 1
+
+	for i := 1; i < len(r); i++ {
+		r[i].Z, r[i].PValue = ZTest(control.Successes, control.Trials, r[i].Successes, r[i].Trials)
+
+		if control.Rate > 0 {
+			r[i].Lift = r[i].Rate/control.Rate - 1
+		}
+	}
+
+	res.ChiSquared, res.DF, res.PValue = ChiSquared(successes, trials)
+
+	leader, runnerUp := -1, -1
+
+	for i := range r {
+		switch {
+		case leader < 0 || r[i].Rate > r[leader].Rate:
+			leader, runnerUp = i, leader
+		case runnerUp < 0 || r[i].Rate > r[runnerUp].Rate:
+			runnerUp = i
+		}
+	}
+
+	if r[leader].Trials == 0 {
+		return res
+	}
+
+	res.Leader = r[leader].Key
+
+	if runnerUp < 0 {
+		return res
+	}
+
+	alpha := 1 - e.Confidence
+	_, p := ZTest(r[runnerUp].Successes, r[runnerUp].Trials, r[leader].Successes, r[leader].Trials)
+
+	res.Significant = res.SampleReached && r[leader].Rate > r[runnerUp].Rate && res.PValue < alpha && p < alpha
+
+	return res
+}
+
+// GetResults counts deliveries, clicks and claims of every variant of the
+// campaign's experiment and tests them
+func (s *service) GetResults(campaignID string) (Results, error) {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return Results{}, err
+	}
+
+	if campaign.Experiment == nil {
+		return Results{}, fmt.Errorf("%w: the campaign has no experiment", ErrNotFound)
+	}
+
+	return results(s.db, campaign)
+}
+
+func results(db database.Database, campaign models.Campaign) (Results, error) {
+	e := *campaign.Experiment
+	since := e.StartedAt
+
+	deliveries, err := countDeliveries(db, campaign.ID, since)
+
+	if err != nil {
+		return Results{}, err
+	}
+
+	clicks, err := countClicks(db, campaign.ID, since)
+
+	if err != nil {
+		return Results{}, err
+	}
+
+	claims, err := countClaims(db, campaign.ID, since)
+
+	if err != nil {
+		return Results{}, err
+	}
+
+	r := []VariantResult{}
+
+	for _, v := range e.Variants {
+		r = append(r, VariantResult{
+			Key:        v.Key,
+			Name:       v.Name,
+			Weight:     v.Weight,
+			Deliveries: deliveries[v.Key],
+			Clicks:     clicks[v.Key],
+			Claims:     claims[v.Key],
+		})
+	}
+
+	return Evaluate(e, r), nil
+}
+
+// countDeliveries counts the texts and emails of each variant that reached
+// the provider since the experiment started. Not every provider reports
+// delivery so sent ones count.
+func countDeliveries(db database.Database, campaignID string, since time.Time) (map[string]int64, error) {
+	counts := map[string]int64{}
+
+	for collection, statuses := range map[models.Collections]bson.A{
+		models.SMSMessagesCollection:   {models.SMSStatusSent, models.SMSStatusDelivered},
+		models.EmailMessagesCollection: {models.EmailStatusSent, models.EmailStatusDelivered},
+	} {
+		err := count(db, collection, counts, []bson.M{
+			{"$match": bson.M{
+				"campaign_id": campaignID,
+				"variant":     bson.M{"$exists": true},
+				"status":      bson.M{"$in": statuses},
+				"sent_at":     bson.M{"$gte": since},
+			}},
+			{"$group": bson.M{"_id": "$variant", "count": bson.M{"$sum": 1}}},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return counts, nil
+}
+
+// countClicks counts the people of each variant who clicked, a contact or
+// anonymous visitor clicking twice counts once
+func countClicks(db database.Database, campaignID string, since time.Time) (map[string]int64, error) {
+	counts := map[string]int64{}
+
+	err := count(db, models.ClicksCollection, counts, []bson.M{
+		{"$match": bson.M{
+			"campaign_id": campaignID,
+			"variant":     bson.M{"$exists": true},
+			"bot":         false,
+			"clicked_at":  bson.M{"$gte": since},
+		}},
+		{"$group": bson.M{"_id": bson.M{
+			"variant": "$variant",
+			"who":     bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$contact_id", ""}}, "$contact_id", "$visitor"}},
+		}}},
+		{"$group": bson.M{"_id": "$_id.variant", "count": bson.M{"$sum": 1}}},
+	})
+
+	return counts, err
+}
+
+// countClaims counts the claims of each variant that were not rejected
+func countClaims(db database.Database, campaignID string, since time.Time) (map[string]int64, error) {
+	counts := map[string]int64{}
+
+	err := count(db, models.ClaimsCollection, counts, []bson.M{
+		{"$match": bson.M{
+			"campaign_id": campaignID,
+			"variant":     bson.M{"$exists": true},
+			"status":      bson.M{"$ne": models.ClaimStatusRejected},
+			"created_at":  bson.M{"$gte": since},
+		}},
+		{"$group": bson.M{"_id": "$variant", "count": bson.M{"$sum": 1}}},
+	})
+
+	return counts, err
+}
+
+func count(db database.Database, collection models.Collections, counts map[string]int64, pipeline []bson.M) error {
+	rows := []variantCount{}
+
+	db.SetCollection(collection)
+
+	err := db.AggregateMany(pipeline, &rows)
+
+	if err != nil {
+		slog.Error("Error counting experiment results", "collection", collection, "error", err)
+
+		return errors.New("error getting experiment results")
+	}
+
+	for _, row := range rows {
+		counts[row.Key] += row.Count
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package experimentservice
+
+import (
+	"math"
+)
+
+// ZTest compares the proportions x1/n1 and x2/n2 with a two-proportion z
+// test on the pooled proportion. z is positive when the second is higher,
+// p is two-sided. Samples without trials have z 0 and p 1.
+func ZTest(x1, n1, x2, n2 int64) (z, p float64) {
+	if n1 <= 0 || n2 <= 0 {
+		return 0, 1
+	}
+
+	p1, p2 := float64(x1)/float64(n1), float64(x2)/float64(n2)
+	pooled := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+
+	if se == 0 {
+		return 0, 1
+	}
+
+	z = (p2 - p1) / se
+
+	return z, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// ChiSquared tests whether the proportions successes[i]/trials[i] differ
+// with Pearson's chi-squared test on the k x 2 table of successes and
+// failures. Samples without trials are left out, df is k-1 of the rest.
+func ChiSquared(successes, trials []int64) (chi2 float64, df int, p float64) {
+	var total, hits float64
+	k := 0
+
+	for i, n := range trials {
+		if n <= 0 {
+			continue
+		}
+
+		total += float64(n)
+		hits += float64(successes[i])
+		k++
+	}
+
+	if k < 2 || hits == 0 || hits == total {
+		return 0, max(k-1, 0), 1
+	}
+
+	for i, n := range trials {
+		if n <= 0 {
+			continue
+		}
+
+		expected := float64(n) * hits / total
+		observed := float64(successes[i])
+
+		chi2 += (observed-expected)*(observed-expected)/expected +
+			(observed-expected)*(observed-expected)/(float64(n)-expected)
+	}
+
+	df = k - 1
+
+	return chi2, df, ChiSquaredSurvival(chi2, df)
+}
+
+// ChiSquaredSurvival is the probability of a chi-squared value of at least
+// x with df degrees of freedom
+func ChiSquaredSurvival(x float64, df int) float64 {
+	if x <= 0 || df <= 0 {
+		return 1
+	}
+
+	return gammaQ(float64(df)/2, x/2)
+}
+
+// gammaQ is the regularized upper incomplete gamma function, by its series
+// below a+1 and its continued fraction above as in Numerical Recipes
+func gammaQ(a, x float64) float64 {
+	const (
+		iterations = 500
+		epsilon    = 1e-14
+		tiny       = 1e-300
+	)
+
+	lg, _ := math.Lgamma(a)
+	front := math.Exp(-x + a*math.Log(x) - lg)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+
+		for n := 1; n < iterations; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+
+			if math.Abs(term) < math.Abs(sum)*epsilon {
+				break
+			}
+		}
+
+		return math.Max(0, 1-sum*front)
+	}
+
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+
+	for n := 1; n < iterations; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+
+		d = an*d + b
+
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+
+		c = b + an/c
+
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		delta := d * c
+		h *= delta
+
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+
+	return math.Min(1, front*h)
+}
@@ -0,0 +1,397 @@
+package goalservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxEventsPerRequest caps a single metric ingestion batch
+const MaxEventsPerRequest = 1000
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+var metricPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+type Service interface {
+	CreateGoal(campaignID string, g models.Goal) (models.Goal, error)
+	GetGoals(campaignID string) ([]models.Goal, error)
+	UpdateGoal(campaignID, goalID string, g models.Goal) error
+	DeleteGoal(campaignID, goalID string) error
+	RecordMetrics(campaignID string, events []models.MetricEvent) (int, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// MetricStats is the aggregate of one metric's events
+type MetricStats struct {
+	Total float64   `bson:"total"`
+	First time.Time `bson:"first"`
+}
+
+func ValidateGoal(g models.Goal) error {
+	if g.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+
+	if !metricPattern.MatchString(g.Metric) {
+		return fmt.Errorf("%w: metric must start with a letter and only contain lower case letters, digits and underscores", ErrInvalid)
+	}
+
+	switch g.Type {
+	case models.GoalTypeCount:
+		if g.Denominator != "" {
+			return fmt.Errorf("%w: denominator is only allowed on rate goals", ErrInvalid)
+		}
+	case models.GoalTypeRate:
+		if !metricPattern.MatchString(g.Denominator) {
+			return fmt.Errorf("%w: rate goals need a denominator metric", ErrInvalid)
+		}
+
+		if g.Target > 100 {
+			return fmt.Errorf("%w: rate targets are percentages and must not be more than 100", ErrInvalid)
+		}
+	default:
+		return fmt.Errorf("%w: type must be count or rate", ErrInvalid)
+	}
+
+	if g.Target <= 0 {
+		return fmt.Errorf("%w: target must be greater than 0", ErrInvalid)
+	}
+
+	if g.Deadline.IsZero() {
+		return fmt.Errorf("%w: deadline is required", ErrInvalid)
+	}
+
+	return nil
+}
+
+// Progress computes how far g is given the metric totals. Count goals are
+// projected forward from the average daily rate since start.
+func Progress(g models.Goal, stats map[string]MetricStats, start, now time.Time) *models.GoalProgress {
+	p := &models.GoalProgress{}
+
+	if g.Type == models.GoalTypeRate {
+		if den := stats[g.Denominator].Total; den > 0 {
+			p.Current = stats[g.Metric].Total * 100 / den
+		}
+
+		p.PercentComplete = p.Current * 100 / g.Target
+		p.Completed = p.Current >= g.Target
+		p.OnTrack = p.Completed
+
+		return p
+	}
+
+	metric := stats[g.Metric]
+
+	p.Current = metric.Total
+	p.PercentComplete = p.Current * 100 / g.Target
+
+	if p.Current >= g.Target {
+		p.Completed = true
+		p.OnTrack = true
+
+		return p
+	}
+
+	if start.IsZero() || start.After(now) {
+		start = metric.First
+	}
+
+	days := now.Sub(start).Hours() / 24
+
+	if start.IsZero() || days <= 0 || p.Current <= 0 {
+		return p
+	}
+
+	p.RunRatePerDay = p.Current / days
+
+	remainingDays := (g.Target - p.Current) / p.RunRatePerDay
+	projected := now.Add(time.Duration(remainingDays * 24 * float64(time.Hour)))
+
+	p.ProjectedCompletion = &projected
+	p.OnTrack = !projected.After(g.Deadline)
+
+	return p
+}
+
+func (s *service) CreateGoal(campaignID string, g models.Goal) (models.Goal, error) {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return g, err
+	}
+
+	if err := ValidateGoal(g); err != nil {
+		return g, err
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	g.ID = objid.Hex()
+	g.CampaignID = campaign.ID
+	g.CreatedBy = campaign.CreatedBy
+	g.CreatedAt = now
+	g.UpdatedAt = now
+
+	s.db.SetCollection(models.GoalsCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":         objid,
+		"campaign_id": g.CampaignID,
+		"name":        g.Name,
+		"type":        g.Type,
+		"metric":      g.Metric,
+		"denominator": g.Denominator,
+		"target":      g.Target,
+		"deadline":    g.Deadline,
+		"created_by":  g.CreatedBy,
+		"created_at":  g.CreatedAt,
+		"updated_at":  g.UpdatedAt,
+	})
+
+	if err != nil {
+		slog.Error("Error creating goal", "error", err)
+
+		return g, errors.New("error creating goal")
+	}
+
+	return g, nil
+}
+
+// GetGoals returns the campaign goals with their progress
+func (s *service) GetGoals(campaignID string) ([]models.Goal, error) {
+	goals := []models.Goal{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return goals, err
+	}
+
+	s.db.SetCollection(models.GoalsCollection)
+
+	err = s.db.FindMany(bson.M{"campaign_id": campaign.ID}, &goals)
+
+	if err != nil {
+		slog.Error("Error getting goals", "error", err)
+
+		return goals, errors.New("error getting goals")
+	}
+
+	if len(goals) == 0 {
+		return goals, nil
+	}
+
+	result := []struct {
+		Metric      string `bson:"_id"`
+		MetricStats `bson:",inline"`
+	}{}
+
+	s.db.SetCollection(models.MetricEventsCollection)
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"campaign_id": campaign.ID}},
+		{"$group": bson.M{
+			"_id":   "$metric",
+			"total": bson.M{"$sum": "$value"},
+			"first": bson.M{"$min": "$occurred_at"},
+		}},
+	}, &result)
+
+	if err != nil {
+		slog.Error("Error aggregating metrics", "error", err)
+
+		return goals, errors.New("error getting goals")
+	}
+
+	stats := map[string]MetricStats{}
+
+	for _, r := range result {
+		stats[r.Metric] = r.MetricStats
+	}
+
+	now := time.Now()
+
+	for i := range goals {
+		goals[i].Progress = Progress(goals[i], stats, campaign.StartDate, now)
+	}
+
+	return goals, nil
+}
+
+func (s *service) UpdateGoal(campaignID, goalID string, g models.Goal) error {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return err
+	}
+
+	if err := ValidateGoal(g); err != nil {
+		return err
+	}
+
+	objid, err := primitive.ObjectIDFromHex(goalID)
+
+	if err != nil {
+		return fmt.Errorf("%w: invalid goal id: %s", ErrNotFound, goalID)
+	}
+
+	s.db.SetCollection(models.GoalsCollection)
+
+	count, err := s.db.CountDocuments(bson.M{"_id": objid, "campaign_id": campaign.ID})
+
+	if err != nil || count == 0 {
+		return fmt.Errorf("%w: no goals with id: %s found", ErrNotFound, goalID)
+	}
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "campaign_id": campaign.ID}, bson.M{
+		"name":        g.Name,
+		"type":        g.Type,
+		"metric":      g.Metric,
+		"denominator": g.Denominator,
+		"target":      g.Target,
+		"deadline":    g.Deadline,
+		"updated_at":  time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error updating goal", "error", err)
+
+		return fmt.Errorf("could not update goal with id: %s", goalID)
+	}
+
+	return nil
+}
+
+func (s *service) DeleteGoal(campaignID, goalID string) error {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return err
+	}
+
+	objid, err := primitive.ObjectIDFromHex(goalID)
+
+	if err != nil {
+		return fmt.Errorf("%w: invalid goal id: %s", ErrNotFound, goalID)
+	}
+
+	s.db.SetCollection(models.GoalsCollection)
+
+	err = s.db.DeleteOne(bson.M{"_id": objid, "campaign_id": campaign.ID})
+
+	if err != nil {
+		slog.Error("Error deleting goal", "error", err)
+
+		return fmt.Errorf("could not delete goal with id: %s", goalID)
+	}
+
+	return nil
+}
+
+// RecordMetrics stores a batch of metric events. Value defaults to 1 and
+// OccurredAt to now so a bare {"metric": "claims"} counts one claim.
+func (s *service) RecordMetrics(campaignID string, events []models.MetricEvent) (int, error) {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(events) == 0 {
+		return 0, fmt.Errorf("%w: at least one event is required", ErrInvalid)
+	}
+
+	if len(events) > MaxEventsPerRequest {
+		return 0, fmt.Errorf("%w: at most %d events are accepted per request", ErrInvalid, MaxEventsPerRequest)
+	}
+
+	now := time.Now().Local()
+	documents := make([]interface{}, 0, len(events))
+
+	for _, e := range events {
+		if !metricPattern.MatchString(e.Metric) {
+			return 0, fmt.Errorf("%w: invalid metric name %q", ErrInvalid, e.Metric)
+		}
+
+		if e.Value == 0 {
+			e.Value = 1
+		}
+
+		if e.OccurredAt.IsZero() {
+			e.OccurredAt = now
+		}
+
+		documents = append(documents, bson.M{
+			"campaign_id": campaign.ID,
+			"metric":      e.Metric,
+			"value":       e.Value,
+			"occurred_at": e.OccurredAt.Local(),
+			"created_at":  now,
+		})
+	}
+
+	s.db.SetCollection(models.MetricEventsCollection)
+
+	if err := s.db.InsertMany(documents); err != nil {
+		slog.Error("Error recording metrics", "error", err)
+
+		return 0, errors.New("error recording metrics")
+	}
+
+	return len(documents), nil
+}
+
+func (s *service) findCampaign(id string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return campaign, fmt.Errorf("%w: invalid campaign id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &campaign)
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	return campaign, nil
+}
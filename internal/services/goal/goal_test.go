@@ -0,0 +1,51 @@
+package goalservice
+
+import (
+	"campaign/internal/models"
+	"testing"
+	"time"
+)
+
+func TestProgressCount(t *testing.T) {
+	now := time.Date(2024, 8, 11, 0, 0, 0, 0, time.UTC)
+	start := now.AddDate(0, 0, -10)
+
+	goal := models.Goal{Type: models.GoalTypeCount, Metric: "claims", Target: 1000, Deadline: now.AddDate(0, 0, 30)}
+	stats := map[string]MetricStats{"claims": {Total: 250, First: start}}
+
+	p := Progress(goal, stats, start, now)
+
+	if p.PercentComplete != 25 {
+		t.Errorf("expected 25 percent complete; got %v", p.PercentComplete)
+	}
+
+	if p.RunRatePerDay != 25 {
+		t.Errorf("expected run rate of 25 per day; got %v", p.RunRatePerDay)
+	}
+
+	// 750 remaining at 25 a day
+	want := now.AddDate(0, 0, 30)
+
+	if p.ProjectedCompletion == nil || !p.ProjectedCompletion.Equal(want) {
+		t.Errorf("expected projected completion %v; got %v", want, p.ProjectedCompletion)
+	}
+
+	if !p.OnTrack {
+		t.Error("expected goal to be on track")
+	}
+}
+
+func TestProgressRate(t *testing.T) {
+	goal := models.Goal{Type: models.GoalTypeRate, Metric: "signups", Denominator: "visits", Target: 5}
+	stats := map[string]MetricStats{"signups": {Total: 30}, "visits": {Total: 1000}}
+
+	p := Progress(goal, stats, time.Time{}, time.Now())
+
+	if p.Current != 3 {
+		t.Errorf("expected current rate of 3 percent; got %v", p.Current)
+	}
+
+	if p.Completed || p.ProjectedCompletion != nil {
+		t.Errorf("expected incomplete rate goal without projection; got %+v", p)
+	}
+}
@@ -0,0 +1,181 @@
+package jobservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+type JobFilter struct {
+	Type   string
+	Status string
+	Page   int
+	Limit  int
+}
+
+type JobPage struct {
+	Jobs  []models.Job `json:"jobs"`
+	Total int64        `json:"total"`
+	Page  int          `json:"page"`
+	Limit int          `json:"limit"`
+}
+
+type Service interface {
+	GetJobs(f JobFilter) (JobPage, error)
+	GetJobByID(id string) (models.Job, error)
+	RetryJob(id string) (models.Job, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// GetJobs lists the user's jobs, newest first
+func (s *service) GetJobs(f JobFilter) (JobPage, error) {
+	page := JobPage{Jobs: []models.Job{}}
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		return page, err
+	}
+
+	if f.Page < 1 {
+		f.Page = 1
+	}
+
+	if f.Limit < 1 {
+		f.Limit = DefaultPageSize
+	}
+
+	f.Limit = min(f.Limit, MaxPageSize)
+
+	filter := bson.M{"created_by": user.Sub}
+
+	if f.Type != "" {
+		filter["type"] = f.Type
+	}
+
+	if f.Status != "" {
+		filter["status"] = f.Status
+	}
+
+	s.db.SetCollection(models.JobsCollection)
+
+	page.Total, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting jobs", "error", err)
+
+		return page, errors.New("error getting jobs")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((f.Page - 1) * f.Limit)).
+		SetLimit(int64(f.Limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &page.Jobs)
+
+	if err != nil {
+		slog.Error("Error getting jobs", "error", err)
+
+		return page, errors.New("error getting jobs")
+	}
+
+	page.Page = f.Page
+	page.Limit = f.Limit
+
+	return page, nil
+}
+
+func (s *service) GetJobByID(id string) (models.Job, error) {
+	job := models.Job{}
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		return job, err
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return job, fmt.Errorf("%w: no jobs with id: %s found", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.JobsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &job)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return job, fmt.Errorf("%w: no jobs with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting job", "error", err)
+
+		return job, errors.New("error getting job")
+	}
+
+	return job, nil
+}
+
+// RetryJob takes a dead-lettered job off the dead letter queue and runs it
+// again with a fresh set of attempts
+func (s *service) RetryJob(id string) (models.Job, error) {
+	job, err := s.GetJobByID(id)
+
+	if err != nil {
+		return job, err
+	}
+
+	if job.Status != models.JobStatusDead {
+		return job, fmt.Errorf("%w: only dead jobs can be retried", ErrInvalid)
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(job.ID)
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.JobsCollection)
+
+	err = s.db.FindOneAndUpdate(bson.M{"_id": objid, "status": models.JobStatusDead}, bson.M{
+		"$set":   bson.M{"status": models.JobStatusQueued, "attempts": 0, "run_at": now, "updated_at": now},
+		"$unset": bson.M{"finished_at": ""},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After), &job)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return job, fmt.Errorf("%w: only dead jobs can be retried", ErrInvalid)
+	}
+
+	if err != nil {
+		slog.Error("Error retrying job", "error", err)
+
+		return job, errors.New("error retrying job")
+	}
+
+	return job, nil
+}
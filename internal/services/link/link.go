@@ -0,0 +1,508 @@
+package linkservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// CodeLength is the length of generated codes, 62^7 is enough that
+	// guessing a live one is impractical
+	CodeLength   = 7
+	MaxURLLength = 2048
+
+	// codeAttempts is how often a code is regenerated when it is taken
+	codeAttempts = 5
+)
+
+const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+type LinkRequest struct {
+	URL  string      `json:"url"`
+	Name string      `json:"name"`
+	UTM  *models.UTM `json:"utm"`
+}
+
+type Service interface {
+	CreateLink(campaignID string, req LinkRequest) (models.Link, error)
+	GetLinks(campaignID string) ([]models.Link, error)
+	UpdateLink(campaignID, linkID string, req LinkRequest) (models.Link, error)
+	DeleteLink(campaignID, linkID string) error
+	GetLinkStats(campaignID, linkID string) (LinkStats, error)
+	GetClickStats(campaignID string) (ClickStats, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// NormalizeLink trims req and checks its url is an absolute http(s) url
+func NormalizeLink(req LinkRequest) (LinkRequest, error) {
+	req.URL = strings.TrimSpace(req.URL)
+	req.Name = strings.TrimSpace(req.Name)
+
+	if req.URL == "" {
+		return req, fmt.Errorf("%w: url is required", ErrInvalid)
+	}
+
+	if len(req.URL) > MaxURLLength {
+		return req, fmt.Errorf("%w: url must be at most %d characters", ErrInvalid, MaxURLLength)
+	}
+
+	u, err := url.Parse(req.URL)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return req, fmt.Errorf("%w: url must be an absolute http or https url", ErrInvalid)
+	}
+
+	if req.UTM != nil {
+		utm := models.UTM{
+			Source:   strings.TrimSpace(req.UTM.Source),
+			Medium:   strings.TrimSpace(req.UTM.Medium),
+			Campaign: strings.TrimSpace(req.UTM.Campaign),
+			Term:     strings.TrimSpace(req.UTM.Term),
+			Content:  strings.TrimSpace(req.UTM.Content),
+		}
+
+		req.UTM = &utm
+
+		if utm == (models.UTM{}) {
+			req.UTM = nil
+		}
+	}
+
+	return req, nil
+}
+
+// NewCode returns a random base62 code
+func NewCode() (string, error) {
+	code := make([]byte, CodeLength)
+	max := big.NewInt(int64(len(alphabet)))
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		code[i] = alphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+func (s *service) CreateLink(campaignID string, req LinkRequest) (models.Link, error) {
+	link := models.Link{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return link, err
+	}
+
+	req, err = NormalizeLink(req)
+
+	if err != nil {
+		return link, err
+	}
+
+	now := time.Now().Local()
+
+	link = models.Link{
+		URL:        req.URL,
+		Name:       req.Name,
+		CampaignID: campaign.ID,
+		UTM:        req.UTM,
+		CreatedBy:  campaign.CreatedBy,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	s.db.SetCollection(models.LinksCollection)
+
+	for attempt := 0; attempt < codeAttempts; attempt++ {
+		objid := primitive.NewObjectID()
+		link.ID = objid.Hex()
+
+		link.Code, err = NewCode()
+
+		if err != nil {
+			slog.Error("Error generating link code", "error", err)
+
+			return link, errors.New("error creating link")
+		}
+
+		err = s.db.InsertOne(bson.M{
+			"_id":         objid,
+			"code":        link.Code,
+			"url":         link.URL,
+			"name":        link.Name,
+			"campaign_id": link.CampaignID,
+			"utm":         link.UTM,
+			"created_by":  link.CreatedBy,
+			"created_at":  link.CreatedAt,
+			"updated_at":  link.UpdatedAt,
+		})
+
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		slog.Error("Error creating link", "error", err)
+
+		return link, errors.New("error creating link")
+	}
+
+	link.ShortURL = ShortURL(link.Code)
+
+	return link, nil
+}
+
+// GetLinks lists the campaign links, newest first, with their click counts
+func (s *service) GetLinks(campaignID string) ([]models.Link, error) {
+	links := []models.Link{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return links, err
+	}
+
+	s.db.SetCollection(models.LinksCollection)
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"campaign_id": campaign.ID, "created_by": campaign.CreatedBy}},
+		{"$sort": bson.M{"created_at": -1}},
+		{"$lookup": bson.M{
+			"from": string(models.ClicksCollection),
+			"let":  bson.M{"id": bson.M{"$toString": "$_id"}},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$link_id", "$$id"}},
+					bson.M{"$eq": bson.A{"$bot", false}},
+				}}}},
+				bson.M{"$count": "n"},
+			},
+			"as": "clicks",
+		}},
+		{"$set": bson.M{"_id": bson.M{"$toString": "$_id"}, "clicks": bson.M{"$ifNull": bson.A{bson.M{"$first": "$clicks.n"}, 0}}}},
+	}, &links)
+
+	if err != nil {
+		slog.Error("Error getting links", "error", err)
+
+		return links, errors.New("error getting links")
+	}
+
+	for i := range links {
+		links[i].ShortURL = ShortURL(links[i].Code)
+	}
+
+	return links, nil
+}
+
+// UpdateLink changes where a link goes, links already sent follow the change
+func (s *service) UpdateLink(campaignID, linkID string, req LinkRequest) (models.Link, error) {
+	link, err := s.findLink(campaignID, linkID)
+
+	if err != nil {
+		return link, err
+	}
+
+	req, err = NormalizeLink(req)
+
+	if err != nil {
+		return link, err
+	}
+
+	link.URL = req.URL
+	link.Name = req.Name
+	link.UTM = req.UTM
+	link.UpdatedAt = time.Now().Local()
+
+	objid, _ := primitive.ObjectIDFromHex(link.ID)
+
+	s.db.SetCollection(models.LinksCollection)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": link.CreatedBy}, bson.M{
+		"url":        link.URL,
+		"name":       link.Name,
+		"utm":        link.UTM,
+		"updated_at": link.UpdatedAt,
+	})
+
+	if err != nil {
+		slog.Error("Error updating link", "error", err)
+
+		return link, errors.New("error updating link")
+	}
+
+	link.ShortURL = ShortURL(link.Code)
+
+	return link, nil
+}
+
+// DeleteLink stops a link from redirecting, its clicks are kept for the
+// campaign totals
+func (s *service) DeleteLink(campaignID, linkID string) error {
+	link, err := s.findLink(campaignID, linkID)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(link.ID)
+
+	s.db.SetCollection(models.LinksCollection)
+
+	err = s.db.DeleteOne(bson.M{"_id": objid, "created_by": link.CreatedBy})
+
+	if err != nil {
+		slog.Error("Error deleting link", "error", err)
+
+		return errors.New("error deleting link")
+	}
+
+	return nil
+}
+
+func (s *service) findLink(campaignID, linkID string) (models.Link, error) {
+	link := models.Link{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return link, err
+	}
+
+	objid, err := primitive.ObjectIDFromHex(linkID)
+
+	if err != nil {
+		return link, fmt.Errorf("%w: no links with id: %s found", ErrNotFound, linkID)
+	}
+
+	s.db.SetCollection(models.LinksCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "campaign_id": campaign.ID, "created_by": campaign.CreatedBy}, &link)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return link, fmt.Errorf("%w: no links with id: %s found", ErrNotFound, linkID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting link", "error", err)
+
+		return link, errors.New("error getting link")
+	}
+
+	link.ID = objid.Hex()
+
+	return link, nil
+}
+
+func (s *service) findCampaign(id string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	campaign.ID = objid.Hex()
+	campaign.CreatedBy = user.Sub
+
+	return campaign, nil
+}
+
+// Resolve finds the link a code redirects to
+func Resolve(db database.Database, code string) (models.Link, error) {
+	link := models.Link{}
+
+	if len(code) != CodeLength {
+		return link, fmt.Errorf("%w: no links with code: %s found", ErrNotFound, code)
+	}
+
+	db.SetCollection(models.LinksCollection)
+
+	err := db.FindOne(bson.M{"code": code}, &link)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return link, fmt.Errorf("%w: no links with code: %s found", ErrNotFound, code)
+	}
+
+	if err != nil {
+		slog.Error("Error getting link", "error", err)
+
+		return link, errors.New("error getting link")
+	}
+
+	return link, nil
+}
+
+// Ensure returns the campaign's link of kind, creating it or pointing it at
+// dest with utm when they changed. Its code never changes so anything printed
+// with it keeps working.
+func Ensure(db database.Database, campaign models.Campaign, kind, dest string, utm *models.UTM) (models.Link, error) {
+	link := models.Link{}
+	filter := bson.M{"campaign_id": campaign.ID, "created_by": campaign.CreatedBy, "kind": kind}
+
+	for attempt := 0; attempt < codeAttempts; attempt++ {
+		db.SetCollection(models.LinksCollection)
+
+		err := db.FindOne(filter, &link)
+
+		if err == nil {
+			return follow(db, link, dest, utm)
+		}
+
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Error("Error getting link", "error", err)
+
+			return link, errors.New("error getting link")
+		}
+
+		now := time.Now().Local()
+		objid := primitive.NewObjectID()
+
+		code, err := NewCode()
+
+		if err != nil {
+			slog.Error("Error generating link code", "error", err)
+
+			return link, errors.New("error creating link")
+		}
+
+		link = models.Link{
+			ID:         objid.Hex(),
+			Code:       code,
+			URL:        dest,
+			CampaignID: campaign.ID,
+			UTM:        utm,
+			Kind:       kind,
+			CreatedBy:  campaign.CreatedBy,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+
+		err = db.InsertOne(bson.M{
+			"_id":         objid,
+			"code":        link.Code,
+			"url":         link.URL,
+			"campaign_id": link.CampaignID,
+			"utm":         link.UTM,
+			"kind":        link.Kind,
+			"created_by":  link.CreatedBy,
+			"created_at":  link.CreatedAt,
+			"updated_at":  link.UpdatedAt,
+		})
+
+		// a duplicate is either the code or a link of kind made meanwhile,
+		// looking it up again tells them apart
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+
+		if err != nil {
+			slog.Error("Error creating link", "error", err)
+
+			return link, errors.New("error creating link")
+		}
+
+		link.ShortURL = ShortURL(link.Code)
+
+		return link, nil
+	}
+
+	slog.Error("Error creating link", "kind", kind, "error", "codes taken")
+
+	return link, errors.New("error creating link")
+}
+
+// follow points link at dest with utm when it is not already
+func follow(db database.Database, link models.Link, dest string, utm *models.UTM) (models.Link, error) {
+	objid, _ := primitive.ObjectIDFromHex(link.ID)
+	link.ID = objid.Hex()
+	link.ShortURL = ShortURL(link.Code)
+
+	if link.URL == dest && sameUTM(link.UTM, utm) {
+		return link, nil
+	}
+
+	link.URL = dest
+	link.UTM = utm
+	link.UpdatedAt = time.Now().Local()
+
+	db.SetCollection(models.LinksCollection)
+
+	err := db.UpdateOne(bson.M{"_id": objid, "created_by": link.CreatedBy}, bson.M{
+		"url":        link.URL,
+		"utm":        link.UTM,
+		"updated_at": link.UpdatedAt,
+	})
+
+	if err != nil {
+		slog.Error("Error updating link", "error", err)
+
+		return link, errors.New("error updating link")
+	}
+
+	return link, nil
+}
+
+func sameUTM(a, b *models.UTM) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
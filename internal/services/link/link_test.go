@@ -0,0 +1,137 @@
+package linkservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLink(t *testing.T) {
+	req, err := NormalizeLink(LinkRequest{URL: " https://example.com/offer ", UTM: &models.UTM{Source: " "}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.URL != "https://example.com/offer" || req.UTM != nil {
+		t.Errorf("expected a trimmed url and no empty utm; got %+v", req)
+	}
+
+	for _, u := range []string{"", "example.com", "javascript:alert(1)", "ftp://example.com", "https://"} {
+		if _, err := NormalizeLink(LinkRequest{URL: u}); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %q to be invalid; got %v", u, err)
+		}
+	}
+}
+
+func TestNewCode(t *testing.T) {
+	seen := map[string]bool{}
+
+	for i := 0; i < 100; i++ {
+		code, err := NewCode()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(code) != CodeLength || strings.Trim(code, alphabet) != "" {
+			t.Fatalf("unexpected code %q", code)
+		}
+
+		if seen[code] {
+			t.Fatalf("expected unique codes; got %q twice", code)
+		}
+
+		seen[code] = true
+	}
+}
+
+func TestDestination(t *testing.T) {
+	link := models.Link{
+		URL: "https://example.com/offer?utm_source=flyer&ref=1",
+		UTM: &models.UTM{Source: "sms", Medium: "text", Campaign: "summer sale"},
+	}
+
+	u, err := url.Parse(Destination(link))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := u.Query()
+
+	if query.Get("utm_source") != "flyer" {
+		t.Errorf("expected the url utm_source to win; got %q", query.Get("utm_source"))
+	}
+
+	if query.Get("utm_medium") != "text" || query.Get("utm_campaign") != "summer sale" || query.Get("ref") != "1" {
+		t.Errorf("expected utm parameters added to the url; got %q", u.RawQuery)
+	}
+
+	if query.Has("utm_term") {
+		t.Errorf("expected empty utm fields to be left out; got %q", u.RawQuery)
+	}
+
+	link.UTM = nil
+
+	if got := Destination(link); got != link.URL {
+		t.Errorf("expected the url unchanged without utm; got %q", got)
+	}
+}
+
+func TestRef(t *testing.T) {
+	contactID := "65f1c2a9e4b0a1b2c3d4e5f6"
+	ref := SignRef("AbC1234", contactID)
+
+	if got := ParseRef("AbC1234", ref); got != contactID {
+		t.Errorf("expected the ref to round trip; got %q", got)
+	}
+
+	if got := ParseRef("XyZ9876", ref); got != "" {
+		t.Errorf("expected a ref for another code to be ignored; got %q", got)
+	}
+
+	if got := ParseRef("AbC1234", "garbage"); got != "" {
+		t.Errorf("expected a malformed ref to be ignored; got %q", got)
+	}
+
+	if got := TrackedURL("AbC1234", "not-an-id"); strings.Contains(got, "?c=") {
+		t.Errorf("expected no ref without a contact; got %q", got)
+	}
+
+	if got := TrackedURL("AbC1234", contactID); !strings.HasSuffix(got, RedirectPath+"AbC1234?c="+ref) {
+		t.Errorf("unexpected tracked url %q", got)
+	}
+}
+
+func TestIsBot(t *testing.T) {
+	cases := map[string]bool{
+		"":                          true,
+		"Googlebot/2.1":             true,
+		"WhatsApp/2.23.20.0":        true,
+		"facebookexternalhit/1.1":   true,
+		"curl/8.4.0":                true,
+		"Mozilla/5.0 (iPhone; CPU)": false,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36": false,
+	}
+
+	for ua, expected := range cases {
+		if got := IsBot(ua); got != expected {
+			t.Errorf("IsBot(%q) expected %v; got %v", ua, expected, got)
+		}
+	}
+}
+
+func TestSameUTM(t *testing.T) {
+	a := &models.UTM{Source: "qr", Medium: "offline"}
+
+	if !sameUTM(a, &models.UTM{Source: "qr", Medium: "offline"}) || !sameUTM(nil, nil) {
+		t.Error("expected equal utm to be the same")
+	}
+
+	if sameUTM(a, nil) || sameUTM(a, &models.UTM{Source: "qr"}) {
+		t.Error("expected different utm not to be the same")
+	}
+}
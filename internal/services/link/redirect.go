@@ -0,0 +1,284 @@
+package linkservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	experimentservice "campaign/internal/services/experiment"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	linkSigningSecret = os.Getenv("LINK_SIGNING_SECRET")
+	publicBaseURL     = os.Getenv("PUBLIC_BASE_URL")
+)
+
+// RedirectPath is the route prefix short links are served from
+const RedirectPath = "/r/"
+
+// ClickMetric is the goal metric every human click is recorded under
+const ClickMetric = "clicks"
+
+// refMACLength is how many bytes of the HMAC a contact ref carries, enough
+// that forging a ref for another contact is impractical
+const refMACLength = 8
+
+// bots are user agent fragments of crawlers and link previewers, mail
+// scanners and chat apps fetch links before, or instead of, a person
+var bots = []string{
+	"bot", "crawler", "spider", "preview", "facebookexternalhit", "slurp",
+	"whatsapp", "telegram", "skype", "bingpreview", "proofpoint", "mimecast",
+	"barracuda", "curl/", "wget/", "python-requests", "go-http-client", "headless",
+}
+
+// Visit is what the redirect knows about the person following a link
+type Visit struct {
+	Ref       string
+	UserAgent string
+	Referrer  string
+	IP        string
+}
+
+func secret() []byte {
+	if linkSigningSecret != "" {
+		return []byte(linkSigningSecret)
+	}
+
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+func refMAC(code string, id []byte) []byte {
+	h := hmac.New(sha256.New, secret())
+	h.Write([]byte(code))
+	h.Write(id)
+
+	return h.Sum(nil)[:refMACLength]
+}
+
+// ShortURL is the public url of a code
+func ShortURL(code string) string {
+	return strings.TrimSuffix(publicBaseURL, "/") + RedirectPath + code
+}
+
+// TrackedURL is the short url of code as sent to one contact, the click is
+// attributed to them. Without a contact id it is the plain short url.
+func TrackedURL(code, contactID string) string {
+	ref := SignRef(code, contactID)
+
+	if ref == "" {
+		return ShortURL(code)
+	}
+
+	return ShortURL(code) + "?c=" + ref
+}
+
+// SignRef encodes a contact id for one code. Refs are bound to the code so
+// a ref copied onto another link is ignored.
+func SignRef(code, contactID string) string {
+	objid, err := primitive.ObjectIDFromHex(contactID)
+
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(append(objid[:], refMAC(code, objid[:])...))
+}
+
+// ParseRef returns the contact id of a ref signed for code, "" when it is
+// missing or does not verify
+func ParseRef(code, ref string) string {
+	data, err := base64.RawURLEncoding.DecodeString(ref)
+
+	if err != nil || len(data) != len(primitive.ObjectID{})+refMACLength {
+		return ""
+	}
+
+	id, mac := data[:len(primitive.ObjectID{})], data[len(primitive.ObjectID{}):]
+
+	if !hmac.Equal(mac, refMAC(code, id)) {
+		return ""
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// Destination is the link url with its UTM parameters added. Parameters
+// already in the url win, a marketer who typed them meant them.
+func Destination(link models.Link) string {
+	if link.UTM == nil {
+		return link.URL
+	}
+
+	u, err := url.Parse(link.URL)
+
+	if err != nil {
+		return link.URL
+	}
+
+	query := u.Query()
+
+	for key, value := range map[string]string{
+		"utm_source":   link.UTM.Source,
+		"utm_medium":   link.UTM.Medium,
+		"utm_campaign": link.UTM.Campaign,
+		"utm_term":     link.UTM.Term,
+		"utm_content":  link.UTM.Content,
+	} {
+		if value != "" && !query.Has(key) {
+			query.Set(key, value)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// IsBot tells crawlers and link previewers from people by their user agent,
+// an empty one is counted as a bot
+func IsBot(userAgent string) bool {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+
+	if ua == "" {
+		return true
+	}
+
+	for _, b := range bots {
+		if strings.Contains(ua, b) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// visitor tells anonymous visitors apart without storing their address
+func visitor(v Visit) string {
+	sum := sha256.Sum256([]byte(v.IP + "|" + v.UserAgent))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// variant is the experiment variant of the contact who clicked or, for
+// anonymous visitors, of the visitor. A click is still recorded when the
+// campaign cannot be read, without a variant.
+func variant(db database.Database, click models.Click) string {
+	campaign := models.Campaign{}
+	objid, _ := primitive.ObjectIDFromHex(click.CampaignID)
+
+	db.SetCollection(models.CampaignsCollection)
+
+	if err := db.FindOne(bson.M{"_id": objid}, &campaign); err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Error("Error getting campaign of click", "error", err)
+		}
+
+		return ""
+	}
+
+	if click.ContactID != "" {
+		return experimentservice.Assign(campaign, click.ContactID)
+	}
+
+	return experimentservice.Assign(campaign, click.Visitor)
+}
+
+// RecordClick stores a visit to link. Clicks by people also count toward
+// the campaign clicks metric, set the contact last_click_at activity and
+// are counted under their experiment variant.
+func RecordClick(db database.Database, link models.Link, v Visit) (models.Click, error) {
+	now := time.Now().Local()
+	objid := primitive.NewObjectID()
+
+	click := models.Click{
+		ID:         objid.Hex(),
+		LinkID:     link.ID,
+		Code:       link.Code,
+		CampaignID: link.CampaignID,
+		ContactID:  ParseRef(link.Code, v.Ref),
+		Visitor:    visitor(v),
+		UserAgent:  v.UserAgent,
+		Referrer:   v.Referrer,
+		Bot:        IsBot(v.UserAgent),
+		CreatedBy:  link.CreatedBy,
+		ClickedAt:  now,
+	}
+
+	doc := bson.M{
+		"_id":         objid,
+		"link_id":     click.LinkID,
+		"code":        click.Code,
+		"campaign_id": click.CampaignID,
+		"contact_id":  click.ContactID,
+		"visitor":     click.Visitor,
+		"user_agent":  click.UserAgent,
+		"referrer":    click.Referrer,
+		"bot":         click.Bot,
+		"created_by":  click.CreatedBy,
+		"clicked_at":  click.ClickedAt,
+	}
+
+	if !click.Bot {
+		click.Variant = variant(db, click)
+	}
+
+	if click.Variant != "" {
+		doc["variant"] = click.Variant
+	}
+
+	db.SetCollection(models.ClicksCollection)
+
+	err := db.InsertOne(doc)
+
+	if err != nil {
+		slog.Error("Error recording click", "error", err)
+
+		return click, errors.New("error recording click")
+	}
+
+	if click.Bot {
+		return click, nil
+	}
+
+	db.SetCollection(models.MetricEventsCollection)
+
+	err = db.InsertOne(bson.M{
+		"campaign_id": click.CampaignID,
+		"metric":      ClickMetric,
+		"value":       1.0,
+		"occurred_at": now,
+		"created_at":  now,
+	})
+
+	if err != nil {
+		slog.Error("Error recording click metric", "error", err)
+	}
+
+	if click.ContactID == "" {
+		return click, nil
+	}
+
+	contactID, _ := primitive.ObjectIDFromHex(click.ContactID)
+
+	db.SetCollection(models.ContactsCollection)
+
+	err = db.UpdateOne(bson.M{"_id": contactID, "created_by": click.CreatedBy}, bson.M{"activity.last_click_at": now})
+
+	if err != nil {
+		slog.Error("Error updating contact activity", "error", err)
+	}
+
+	return click, nil
+}
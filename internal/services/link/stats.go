@@ -0,0 +1,238 @@
+package linkservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// LinkStats counts the clicks on one link. Clicks and UniqueClicks leave
+// out bots, a unique click is one per contact or, for clicks without one,
+// per anonymous visitor.
+type LinkStats struct {
+	LinkID       string        `json:"link_id"`
+	Code         string        `json:"code"`
+	URL          string        `json:"url"`
+	Name         string        `json:"name,omitempty"`
+	Clicks       int64         `json:"clicks"`
+	UniqueClicks int64         `json:"unique_clicks"`
+	BotClicks    int64         `json:"bot_clicks"`
+	FirstClickAt *time.Time    `json:"first_click_at,omitempty"`
+	LastClickAt  *time.Time    `json:"last_click_at,omitempty"`
+	Daily        []DailyClicks `json:"daily,omitempty"`
+}
+
+// DailyClicks are the clicks on one UTC day, "2006-01-02"
+type DailyClicks struct {
+	Date         string `json:"date"`
+	Clicks       int64  `json:"clicks"`
+	UniqueClicks int64  `json:"unique_clicks"`
+}
+
+// ClickStats sums the clicks of a campaign. ClickThroughRate is the share
+// of sent sms and email messages whose contact clicked a link.
+type ClickStats struct {
+	CampaignID       string      `json:"campaign_id"`
+	Sent             int64       `json:"sent"`
+	Clicks           int64       `json:"clicks"`
+	UniqueClicks     int64       `json:"unique_clicks"`
+	BotClicks        int64       `json:"bot_clicks"`
+	ContactsClicked  int64       `json:"contacts_clicked"`
+	ClickThroughRate float64     `json:"click_through_rate"`
+	Links            []LinkStats `json:"links"`
+}
+
+type clickGroup struct {
+	ID       string    `bson:"_id"`
+	Clicks   int64     `bson:"clicks"`
+	Unique   []string  `bson:"unique"`
+	Contacts []string  `bson:"contacts"`
+	Bots     int64     `bson:"bots"`
+	First    time.Time `bson:"first"`
+	Last     time.Time `bson:"last"`
+}
+
+// groupClicks is the $group stage that clickGroup decodes
+func groupClicks(id interface{}) bson.M {
+	human := bson.M{"$eq": bson.A{"$bot", false}}
+
+	return bson.M{"$group": bson.M{
+		"_id":    id,
+		"clicks": bson.M{"$sum": bson.M{"$cond": bson.A{human, 1, 0}}},
+		"bots":   bson.M{"$sum": bson.M{"$cond": bson.A{human, 0, 1}}},
+		"unique": bson.M{"$addToSet": bson.M{"$cond": bson.A{
+			human,
+			bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$contact_id", ""}}, "$contact_id", bson.M{"$concat": bson.A{"v:", "$visitor"}}}},
+			"$$REMOVE",
+		}}},
+		"contacts": bson.M{"$addToSet": bson.M{"$cond": bson.A{
+			bson.M{"$and": bson.A{human, bson.M{"$gt": bson.A{"$contact_id", ""}}}},
+			"$contact_id",
+			"$$REMOVE",
+		}}},
+		"first": bson.M{"$min": "$clicked_at"},
+		"last":  bson.M{"$max": "$clicked_at"},
+	}}
+}
+
+func (g clickGroup) stats(link models.Link) LinkStats {
+	stats := LinkStats{
+		LinkID:       link.ID,
+		Code:         link.Code,
+		URL:          link.URL,
+		Name:         link.Name,
+		Clicks:       g.Clicks,
+		UniqueClicks: int64(len(g.Unique)),
+		BotClicks:    g.Bots,
+	}
+
+	if !g.First.IsZero() {
+		first, last := g.First.Local(), g.Last.Local()
+		stats.FirstClickAt, stats.LastClickAt = &first, &last
+	}
+
+	return stats
+}
+
+func (s *service) GetLinkStats(campaignID, linkID string) (LinkStats, error) {
+	link, err := s.findLink(campaignID, linkID)
+
+	if err != nil {
+		return LinkStats{}, err
+	}
+
+	groups := []clickGroup{}
+
+	s.db.SetCollection(models.ClicksCollection)
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"link_id": link.ID}},
+		groupClicks(nil),
+	}, &groups)
+
+	if err != nil {
+		slog.Error("Error counting clicks", "error", err)
+
+		return LinkStats{}, errors.New("error getting link stats")
+	}
+
+	total := clickGroup{}
+
+	if len(groups) > 0 {
+		total = groups[0]
+	}
+
+	stats := total.stats(link)
+	stats.Daily = []DailyClicks{}
+
+	days := []clickGroup{}
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"link_id": link.ID, "bot": false}},
+		groupClicks(bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$clicked_at"}}),
+		{"$sort": bson.M{"_id": 1}},
+	}, &days)
+
+	if err != nil {
+		slog.Error("Error counting daily clicks", "error", err)
+
+		return stats, errors.New("error getting link stats")
+	}
+
+	for _, d := range days {
+		stats.Daily = append(stats.Daily, DailyClicks{Date: d.ID, Clicks: d.Clicks, UniqueClicks: int64(len(d.Unique))})
+	}
+
+	return stats, nil
+}
+
+func (s *service) GetClickStats(campaignID string) (ClickStats, error) {
+	stats := ClickStats{CampaignID: campaignID, Links: []LinkStats{}}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return stats, err
+	}
+
+	for _, collection := range []models.Collections{models.SMSMessagesCollection, models.EmailMessagesCollection} {
+		s.db.SetCollection(collection)
+
+		sent, err := s.db.CountDocuments(bson.M{"campaign_id": campaign.ID, "sent_at": bson.M{"$ne": nil}})
+
+		if err != nil {
+			slog.Error("Error counting sent messages", "collection", collection, "error", err)
+
+			return stats, errors.New("error getting click stats")
+		}
+
+		stats.Sent += sent
+	}
+
+	links := []models.Link{}
+
+	s.db.SetCollection(models.LinksCollection)
+
+	err = s.db.FindMany(bson.M{"campaign_id": campaign.ID, "created_by": campaign.CreatedBy}, &links)
+
+	if err != nil {
+		slog.Error("Error getting links", "error", err)
+
+		return stats, errors.New("error getting click stats")
+	}
+
+	groups := []clickGroup{}
+
+	s.db.SetCollection(models.ClicksCollection)
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"campaign_id": campaign.ID}},
+		groupClicks("$link_id"),
+	}, &groups)
+
+	if err != nil {
+		slog.Error("Error counting clicks", "error", err)
+
+		return stats, errors.New("error getting click stats")
+	}
+
+	byLink := map[string]clickGroup{}
+
+	for _, g := range groups {
+		byLink[g.ID] = g
+		stats.Clicks += g.Clicks
+		stats.BotClicks += g.Bots
+	}
+
+	for _, link := range links {
+		stats.Links = append(stats.Links, byLink[link.ID].stats(link))
+	}
+
+	// a contact clicking two links is one unique click for the campaign
+	totals := []clickGroup{}
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"campaign_id": campaign.ID, "bot": false}},
+		groupClicks(nil),
+	}, &totals)
+
+	if err != nil {
+		slog.Error("Error counting unique clicks", "error", err)
+
+		return stats, errors.New("error getting click stats")
+	}
+
+	if len(totals) > 0 {
+		stats.UniqueClicks = int64(len(totals[0].Unique))
+		stats.ContactsClicked = int64(len(totals[0].Contacts))
+	}
+
+	if stats.Sent > 0 {
+		stats.ClickThroughRate = float64(stats.ContactsClicked) / float64(stats.Sent)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,154 @@
+package pointsservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ledgerDB keeps the ledger in memory. Count is what a stale count of
+// today's entries returns, the slot index is enforced on insert.
+type ledgerDB struct {
+	collection models.Collections
+	ledger     []bson.M
+	count      int64
+	failTally  bool
+	totals     []mongo.WriteModel
+}
+
+func (l *ledgerDB) SetCollection(collection models.Collections) {
+	l.collection = collection
+}
+
+func (l *ledgerDB) InsertOne(document bson.M) error {
+	for _, doc := range l.ledger {
+		if _, ok := document["slot"]; ok && doc["day"] == document["day"] && doc["slot"] == document["slot"] {
+			return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+		}
+	}
+
+	l.ledger = append(l.ledger, document)
+
+	return nil
+}
+
+func (l *ledgerDB) CountDocuments(filter bson.M) (int64, error) { return l.count, nil }
+
+func (l *ledgerDB) BulkWrite(writes []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	if l.failTally {
+		l.failTally = false
+
+		return nil, errors.New("totals unavailable")
+	}
+
+	l.totals = writes
+
+	return &mongo.BulkWriteResult{}, nil
+}
+
+func (l *ledgerDB) AggregateMany(pipeline []bson.M, result interface{}) error {
+	sum := int64(0)
+
+	for _, doc := range l.ledger {
+		sum += doc["points"].(int64)
+	}
+
+	data, err := bson.Marshal(bson.M{"sums": bson.A{bson.M{"points": sum}}})
+
+	if err != nil {
+		return err
+	}
+
+	raw := bson.Raw(data)
+
+	return raw.Lookup("sums").Unmarshal(result)
+}
+
+func (l *ledgerDB) InsertMany(documents []interface{}) error { return errors.ErrUnsupported }
+
+func (l *ledgerDB) FindOne(filter bson.M, result interface{}) error { return mongo.ErrNoDocuments }
+
+func (l *ledgerDB) FindMany(filter bson.M, result interface{}) error { return errors.ErrUnsupported }
+
+func (l *ledgerDB) FindManyWithOptions(filter bson.M, opts *options.FindOptions, result interface{}) error {
+	return errors.ErrUnsupported
+}
+
+func (l *ledgerDB) UpdateOne(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (l *ledgerDB) UpdateOneRaw(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (l *ledgerDB) UpdateManyRaw(filter bson.M, update bson.M) error { return errors.ErrUnsupported }
+
+func (l *ledgerDB) FindOneAndUpdate(filter bson.M, update bson.M, opts *options.FindOneAndUpdateOptions, result interface{}) error {
+	return errors.ErrUnsupported
+}
+
+func (l *ledgerDB) DeleteOne(filter bson.M) error { return errors.ErrUnsupported }
+
+func limitedCampaign() models.Campaign {
+	return models.Campaign{ID: "c1", Points: &models.PointsSettings{
+		Enabled: true,
+		Actions: []models.PointAction{{Action: "share", Points: 5, DailyLimit: 2}},
+	}}
+}
+
+func TestCreditDailyLimit(t *testing.T) {
+	db := &ledgerDB{}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := limitedCampaign()
+
+	// both credits counted no entries yet, the second finds slot 0 taken
+	for i := 0; i < 2; i++ {
+		if _, err := Credit(db, c, models.PointsEntry{UserID: "u1", Action: "share", Points: 5}, now); err != nil {
+			t.Fatalf("expected credit %d to be within the limit; got %v", i+1, err)
+		}
+	}
+
+	if db.ledger[0]["slot"] != int64(0) || db.ledger[1]["slot"] != int64(1) {
+		t.Errorf("expected the credits to take slots 0 and 1; got %v and %v", db.ledger[0]["slot"], db.ledger[1]["slot"])
+	}
+
+	if _, err := Credit(db, c, models.PointsEntry{UserID: "u1", Action: "share", Points: 5}, now); !errors.Is(err, ErrLimitReached) {
+		t.Errorf("expected a third credit to be refused; got %v", err)
+	}
+
+	if len(db.ledger) != 2 {
+		t.Errorf("expected two entries; got %d", len(db.ledger))
+	}
+
+	if _, err := Credit(db, c, models.PointsEntry{UserID: "u1", Action: "share", Points: 5}, now.AddDate(0, 0, 1)); err != nil {
+		t.Errorf("expected the limit to reset the next day; got %v", err)
+	}
+}
+
+func TestCreditRebuildsTotals(t *testing.T) {
+	db := &ledgerDB{}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	c := limitedCampaign()
+
+	if _, err := Credit(db, c, models.PointsEntry{UserID: "u1", Action: "share", Points: 5}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	db.failTally = true
+
+	if _, err := Credit(db, c, models.PointsEntry{UserID: "u1", Action: "share", Points: 5}, now); err != nil {
+		t.Fatalf("expected the totals to be rebuilt; got %v", err)
+	}
+
+	if len(db.totals) != 3 {
+		t.Fatalf("expected every period to be rebuilt; got %d writes", len(db.totals))
+	}
+
+	update := db.totals[0].(*mongo.UpdateOneModel).Update.(bson.M)
+
+	if points := update["$set"].(bson.M)["points"]; points != int64(10) {
+		t.Errorf("expected the total to be set to the ledger's 10 points; got %v", points)
+	}
+}
@@ -0,0 +1,322 @@
+package pointsservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultLeaderboardSize = 10
+	MaxLeaderboardSize     = 100
+)
+
+// Leaderboard ranks the participants of a campaign in one period. Me is the
+// current user's standing, nil when they have no points in the period.
+type Leaderboard struct {
+	CampaignID   string     `json:"campaign_id"`
+	Period       string     `json:"period"`
+	Key          string     `json:"key"`
+	Since        *time.Time `json:"since,omitempty"`
+	Participants int64      `json:"participants"`
+	Page         int        `json:"page"`
+	Limit        int        `json:"limit"`
+	Standings    []Standing `json:"standings"`
+	Me           *Standing  `json:"me"`
+}
+
+// Standing is a user's place on a leaderboard. Ranks are unique: equal
+// scores are split by who reached the score first, then by user id.
+type Standing struct {
+	Rank      int64     `json:"rank"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Points    int64     `json:"points"`
+	ReachedAt time.Time `json:"reached_at"`
+}
+
+// Since is when the period containing t started in loc, zero for all time
+func Since(period string, t time.Time, loc *time.Location) (time.Time, error) {
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	switch period {
+	case models.LeaderboardDaily:
+		return midnight, nil
+	case models.LeaderboardWeekly:
+		// weeks start on Monday like ISO weeks
+		days := (int(t.Weekday()) + 6) % 7
+
+		return midnight.AddDate(0, 0, -days), nil
+	case models.LeaderboardAllTime:
+		return time.Time{}, nil
+	}
+
+	return time.Time{}, fmt.Errorf("%w: period must be daily, weekly or all_time", ErrInvalid)
+}
+
+// Key names the period containing t, totals are stored under it
+func Key(period string, t time.Time, loc *time.Location) (string, error) {
+	t = t.In(loc)
+
+	switch period {
+	case models.LeaderboardDaily:
+		return "day:" + t.Format(time.DateOnly), nil
+	case models.LeaderboardWeekly:
+		year, week := t.ISOWeek()
+
+		return fmt.Sprintf("week:%d-W%02d", year, week), nil
+	case models.LeaderboardAllTime:
+		return "all", nil
+	}
+
+	return "", fmt.Errorf("%w: period must be daily, weekly or all_time", ErrInvalid)
+}
+
+// ahead matches the totals ranked above t
+func ahead(t models.PointsTotal) bson.M {
+	return bson.M{
+		"campaign_id": t.CampaignID,
+		"period":      t.Period,
+		"$or": bson.A{
+			bson.M{"points": bson.M{"$gt": t.Points}},
+			bson.M{"points": t.Points, "reached_at": bson.M{"$lt": t.ReachedAt}},
+			bson.M{"points": t.Points, "reached_at": t.ReachedAt, "user_id": bson.M{"$lt": t.UserID}},
+		},
+	}
+}
+
+// Rank is userID's standing in the period key of the campaign. It counts
+// the totals ahead on the leaderboard index instead of reading them, nil
+// when the user has no points in the period.
+func Rank(db database.Database, campaignID, key, userID string) (*Standing, error) {
+	total := models.PointsTotal{}
+
+	db.SetCollection(models.PointsTotalsCollection)
+
+	err := db.FindOne(bson.M{"campaign_id": campaignID, "period": key, "user_id": userID}, &total)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := db.CountDocuments(ahead(total))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Standing{Rank: n + 1, UserID: userID, Points: total.Points, ReachedAt: total.ReachedAt}, nil
+}
+
+func (s *service) GetLeaderboard(campaignID, period string, page, limit int) (Leaderboard, error) {
+	board := Leaderboard{CampaignID: campaignID, Period: period, Standings: []Standing{}}
+
+	if board.Period == "" {
+		board.Period = models.LeaderboardAllTime
+	}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return board, errors.New("error getting leaderboard")
+	}
+
+	campaign, err := s.findCampaign(campaignID, false)
+
+	if err != nil {
+		return board, err
+	}
+
+	now := time.Now()
+	loc := Location(campaign)
+
+	if board.Key, err = Key(board.Period, now, loc); err != nil {
+		return board, err
+	}
+
+	if since, _ := Since(board.Period, now, loc); !since.IsZero() {
+		board.Since = &since
+	}
+
+	if limit <= 0 {
+		limit = DefaultLeaderboardSize
+	}
+
+	if limit > MaxLeaderboardSize {
+		limit = MaxLeaderboardSize
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+
+	board.Page, board.Limit = page, limit
+
+	filter := bson.M{"campaign_id": campaign.ID, "period": board.Key}
+
+	s.db.SetCollection(models.PointsTotalsCollection)
+
+	board.Participants, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting leaderboard", "error", err)
+
+		return board, errors.New("error getting leaderboard")
+	}
+
+	totals := []models.PointsTotal{}
+	skip := int64((page - 1) * limit)
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "points", Value: -1}, {Key: "reached_at", Value: 1}, {Key: "user_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(int64(limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &totals)
+
+	if err != nil {
+		slog.Error("Error getting leaderboard", "error", err)
+
+		return board, errors.New("error getting leaderboard")
+	}
+
+	for i, t := range totals {
+		board.Standings = append(board.Standings, Standing{
+			Rank:      skip + int64(i) + 1,
+			UserID:    t.UserID,
+			Points:    t.Points,
+			ReachedAt: t.ReachedAt,
+		})
+	}
+
+	board.Me, err = Rank(s.db, campaign.ID, board.Key, user.Sub)
+
+	if err != nil {
+		slog.Error("Error ranking user", "error", err)
+
+		return board, errors.New("error getting leaderboard")
+	}
+
+	if err := s.name(board.Standings, board.Me); err != nil {
+		slog.Error("Error getting leaderboard names", "error", err)
+
+		return board, errors.New("error getting leaderboard")
+	}
+
+	return board, nil
+}
+
+// GetRank is the current user's standing, rank 0 when they have no points
+// in the period
+func (s *service) GetRank(campaignID, period string) (Standing, error) {
+	standing := Standing{}
+
+	if period == "" {
+		period = models.LeaderboardAllTime
+	}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return standing, errors.New("error getting rank")
+	}
+
+	standing.UserID = user.Sub
+
+	campaign, err := s.findCampaign(campaignID, false)
+
+	if err != nil {
+		return standing, err
+	}
+
+	key, err := Key(period, time.Now(), Location(campaign))
+
+	if err != nil {
+		return standing, err
+	}
+
+	me, err := Rank(s.db, campaign.ID, key, user.Sub)
+
+	if err != nil {
+		slog.Error("Error ranking user", "error", err)
+
+		return standing, errors.New("error getting rank")
+	}
+
+	if me != nil {
+		standing = *me
+	}
+
+	if err := s.name(nil, &standing); err != nil {
+		slog.Error("Error getting user name", "error", err)
+
+		return standing, errors.New("error getting rank")
+	}
+
+	return standing, nil
+}
+
+// name fills in the names of the users on a page of standings and of me
+func (s *service) name(standings []Standing, me *Standing) error {
+	ids := bson.A{}
+
+	for _, st := range standings {
+		if objid, err := primitive.ObjectIDFromHex(st.UserID); err == nil {
+			ids = append(ids, objid)
+		}
+	}
+
+	if me != nil {
+		if objid, err := primitive.ObjectIDFromHex(me.UserID); err == nil {
+			ids = append(ids, objid)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	users := []models.User{}
+
+	s.db.SetCollection(models.UsersCollection)
+
+	err := s.db.FindManyWithOptions(bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"name": 1}), &users)
+
+	if err != nil {
+		return err
+	}
+
+	names := map[string]string{}
+
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+
+	for i := range standings {
+		standings[i].Name = names[standings[i].UserID]
+	}
+
+	if me != nil {
+		me.Name = names[me.UserID]
+	}
+
+	return nil
+}
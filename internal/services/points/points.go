@@ -0,0 +1,661 @@
+package pointsservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	MaxActions         = 50
+	MaxReferenceLength = 128
+	MaxNoteLength      = 500
+
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+
+	// recentEntries is how much of the ledger a balance shows
+	recentEntries = 20
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid points request")
+
+	// ErrUnavailable is returned for campaigns that are not giving points
+	ErrUnavailable = errors.New("campaign is not giving points")
+
+	// ErrLimitReached is returned once a user earned an action as often as
+	// it allows in a day
+	ErrLimitReached = errors.New("daily limit reached for this action")
+)
+
+var actionPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+type Service interface {
+	Award(campaignID string, req AwardRequest) (models.PointsEntry, error)
+	GetLedger(campaignID string, f LedgerFilter) (LedgerPage, error)
+	GetBalance(campaignID string) (Balance, error)
+	GetLeaderboard(campaignID, period string, page, limit int) (Leaderboard, error)
+	GetRank(campaignID, period string) (Standing, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// AwardRequest credits a user for an action of the campaign. Points is only
+// read for adjustments, actions are worth what the campaign says.
+type AwardRequest struct {
+	UserID    string `json:"user_id"`
+	Action    string `json:"action"`
+	Reference string `json:"reference"`
+	Points    int64  `json:"points"`
+	Note      string `json:"note"`
+}
+
+type LedgerFilter struct {
+	UserID string
+	Action string
+	Page   int
+	Limit  int
+}
+
+type LedgerPage struct {
+	Entries []models.PointsEntry `json:"entries"`
+	Total   int64                `json:"total"`
+	Page    int                  `json:"page"`
+	Limit   int                  `json:"limit"`
+}
+
+// Balance is a user's points on a campaign, summed from the ledger
+type Balance struct {
+	CampaignID string               `json:"campaign_id"`
+	UserID     string               `json:"user_id"`
+	Points     int64                `json:"points"`
+	Entries    int64                `json:"entries"`
+	Recent     []models.PointsEntry `json:"recent"`
+}
+
+// Normalize checks the actions of p and the zone its leaderboards use
+func Normalize(p *models.PointsSettings) (*models.PointsSettings, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	if len(p.Actions) > MaxActions {
+		return nil, fmt.Errorf("%w: a campaign must not have more than %d point actions", ErrInvalid, MaxActions)
+	}
+
+	seen := map[string]bool{}
+
+	for i, a := range p.Actions {
+		a.Action = strings.ToLower(strings.TrimSpace(a.Action))
+		a.Description = strings.TrimSpace(a.Description)
+
+		if !actionPattern.MatchString(a.Action) {
+			return nil, fmt.Errorf("%w: action names are up to 64 letters, digits, dots, dashes or underscores", ErrInvalid)
+		}
+
+		if a.Action == models.PointsActionReferral || a.Action == models.PointsActionAdjustment {
+			return nil, fmt.Errorf("%w: %s is a reserved action", ErrInvalid, a.Action)
+		}
+
+		if seen[a.Action] {
+			return nil, fmt.Errorf("%w: action %s is listed more than once", ErrInvalid, a.Action)
+		}
+
+		if a.Points == 0 {
+			return nil, fmt.Errorf("%w: action %s must be worth some points", ErrInvalid, a.Action)
+		}
+
+		if a.DailyLimit < 0 {
+			return nil, fmt.Errorf("%w: action %s must not have a negative daily limit", ErrInvalid, a.Action)
+		}
+
+		seen[a.Action] = true
+		p.Actions[i] = a
+	}
+
+	if p.Actions == nil {
+		p.Actions = []models.PointAction{}
+	}
+
+	p.TimeZone = strings.TrimSpace(p.TimeZone)
+
+	if _, err := time.LoadLocation(p.TimeZone); err != nil {
+		return nil, fmt.Errorf("%w: unknown time zone %s", ErrInvalid, p.TimeZone)
+	}
+
+	return p, nil
+}
+
+// Enabled tells whether c gives points
+func Enabled(c models.Campaign) bool {
+	return c.Points != nil && c.Points.Enabled
+}
+
+// Open tells whether c gives points for actions at now. Adjustments are
+// taken after a campaign ends so mistakes can still be put right.
+func Open(c models.Campaign, now time.Time) error {
+	if !Enabled(c) {
+		return fmt.Errorf("%w: campaign has no points", ErrUnavailable)
+	}
+
+	if c.Status != models.CampaignStatusActive {
+		return ErrUnavailable
+	}
+
+	if !c.EndDate.IsZero() && now.After(c.EndDate) {
+		return fmt.Errorf("%w: campaign has ended", ErrUnavailable)
+	}
+
+	return nil
+}
+
+// Action looks up what action is worth on c
+func Action(c models.Campaign, action string) (models.PointAction, bool) {
+	if c.Points == nil {
+		return models.PointAction{}, false
+	}
+
+	for _, a := range c.Points.Actions {
+		if a.Action == action {
+			return a, true
+		}
+	}
+
+	return models.PointAction{}, false
+}
+
+// Location is the zone the leaderboards of c roll over in
+func Location(c models.Campaign) *time.Location {
+	if c.Points == nil || c.Points.TimeZone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(c.Points.TimeZone)
+
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// Credit appends e to the ledger of c and adds it to the leaderboards. An
+// entry with a reference is only credited once, crediting it again returns
+// the first entry. Configured actions are held to their daily limit.
+func Credit(db database.Database, c models.Campaign, e models.PointsEntry, now time.Time) (models.PointsEntry, error) {
+	e.CampaignID = c.ID
+	e.CreatedBy = c.CreatedBy
+	e.CreatedAt = now
+
+	if e.Reference != "" {
+		existing, err := referenced(db, e)
+
+		if err == nil {
+			return existing, nil
+		}
+
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Error("Error getting points entry", "error", err)
+
+			return e, errors.New("error crediting points")
+		}
+	}
+
+	id := primitive.NewObjectID()
+	e.ID = id.Hex()
+
+	doc := bson.M{
+		"_id":         id,
+		"campaign_id": e.CampaignID,
+		"user_id":     e.UserID,
+		"action":      e.Action,
+		"points":      e.Points,
+		"created_by":  e.CreatedBy,
+		"created_at":  e.CreatedAt,
+	}
+
+	if e.Reference != "" {
+		doc["reference"] = e.Reference
+	}
+
+	if e.Note != "" {
+		doc["note"] = e.Note
+	}
+
+	// an action with a daily limit takes one of that day's numbered slots,
+	// the unique index on them keeps concurrent credits within the limit.
+	// Today's entries only tell where to start looking for a free one.
+	limit, slot := int64(0), int64(0)
+
+	if action, ok := Action(c, e.Action); ok && action.DailyLimit > 0 {
+		since, _ := Since(models.LeaderboardDaily, now, Location(c))
+		day, _ := Key(models.LeaderboardDaily, now, Location(c))
+
+		db.SetCollection(models.PointsLedgerCollection)
+
+		n, err := db.CountDocuments(bson.M{
+			"campaign_id": c.ID,
+			"user_id":     e.UserID,
+			"action":      e.Action,
+			"created_at":  bson.M{"$gte": since},
+		})
+
+		if err != nil {
+			slog.Error("Error counting points entries", "error", err)
+
+			return e, errors.New("error crediting points")
+		}
+
+		limit, slot = action.DailyLimit, n
+		doc["day"] = day
+	}
+
+	for {
+		if limit > 0 {
+			if slot >= limit {
+				return e, fmt.Errorf("%w: %s can be earned %d time(s) a day", ErrLimitReached, e.Action, limit)
+			}
+
+			doc["slot"] = slot
+		}
+
+		db.SetCollection(models.PointsLedgerCollection)
+
+		err := db.InsertOne(doc)
+
+		if err == nil {
+			break
+		}
+
+		if !mongo.IsDuplicateKeyError(err) {
+			slog.Error("Error adding points entry", "error", err)
+
+			return e, errors.New("error crediting points")
+		}
+
+		// a concurrent credit of the same reference won
+		if e.Reference != "" {
+			existing, err := referenced(db, e)
+
+			if err == nil {
+				return existing, nil
+			}
+
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				slog.Error("Error getting points entry", "error", err)
+
+				return e, errors.New("error crediting points")
+			}
+		}
+
+		if limit == 0 {
+			slog.Error("Error adding points entry", "error", err)
+
+			return e, errors.New("error crediting points")
+		}
+
+		// a concurrent credit took the slot
+		slot++
+	}
+
+	// the ledger is the record, totals that could not be added to are
+	// summed from it again
+	if err := tally(db, c, e); err != nil {
+		slog.Error("Error adding points to leaderboards", "entry", e.ID, "error", err)
+
+		if err := rebuild(db, c, e.UserID, now); err != nil {
+			slog.Error("Error rebuilding leaderboards", "user", e.UserID, "error", err)
+
+			return e, errors.New("points were credited but the leaderboards could not be updated")
+		}
+	}
+
+	return e, nil
+}
+
+func referenced(db database.Database, e models.PointsEntry) (models.PointsEntry, error) {
+	existing := models.PointsEntry{}
+
+	db.SetCollection(models.PointsLedgerCollection)
+
+	err := db.FindOne(bson.M{
+		"campaign_id": e.CampaignID,
+		"user_id":     e.UserID,
+		"action":      e.Action,
+		"reference":   e.Reference,
+	}, &existing)
+
+	return existing, err
+}
+
+// tally adds e to the user's total in every leaderboard period it falls in
+func tally(db database.Database, c models.Campaign, e models.PointsEntry) error {
+	writes := []mongo.WriteModel{}
+
+	for _, period := range []string{models.LeaderboardDaily, models.LeaderboardWeekly, models.LeaderboardAllTime} {
+		key, _ := Key(period, e.CreatedAt, Location(c))
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"campaign_id": c.ID, "period": key, "user_id": e.UserID}).
+			SetUpdate(bson.M{
+				"$inc": bson.M{"points": e.Points},
+				"$max": bson.M{"reached_at": e.CreatedAt},
+			}).
+			SetUpsert(true))
+	}
+
+	db.SetCollection(models.PointsTotalsCollection)
+
+	_, err := db.BulkWrite(writes)
+
+	return err
+}
+
+// rebuild sets the user's totals in the periods containing now to the sum
+// of their ledger entries. A credit tallied between the sum and the write
+// is counted again, so it is only used when tally failed.
+func rebuild(db database.Database, c models.Campaign, userID string, now time.Time) error {
+	writes := []mongo.WriteModel{}
+
+	for _, period := range []string{models.LeaderboardDaily, models.LeaderboardWeekly, models.LeaderboardAllTime} {
+		since, _ := Since(period, now, Location(c))
+		key, _ := Key(period, now, Location(c))
+
+		sums := []struct {
+			Points    int64     `bson:"points"`
+			ReachedAt time.Time `bson:"reached_at"`
+		}{}
+
+		db.SetCollection(models.PointsLedgerCollection)
+
+		err := db.AggregateMany([]bson.M{
+			{"$match": bson.M{"campaign_id": c.ID, "user_id": userID, "created_at": bson.M{"$gte": since}}},
+			{"$group": bson.M{"_id": nil, "points": bson.M{"$sum": "$points"}, "reached_at": bson.M{"$max": "$created_at"}}},
+		}, &sums)
+
+		if err != nil {
+			return err
+		}
+
+		if len(sums) == 0 {
+			continue
+		}
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"campaign_id": c.ID, "period": key, "user_id": userID}).
+			SetUpdate(bson.M{"$set": bson.M{"points": sums[0].Points, "reached_at": sums[0].ReachedAt}}).
+			SetUpsert(true))
+	}
+
+	if len(writes) == 0 {
+		return nil
+	}
+
+	db.SetCollection(models.PointsTotalsCollection)
+
+	_, err := db.BulkWrite(writes)
+
+	return err
+}
+
+// Award credits a user for an action on one of the owner's campaigns
+func (s *service) Award(campaignID string, req AwardRequest) (models.PointsEntry, error) {
+	entry := models.PointsEntry{}
+
+	campaign, err := s.findCampaign(campaignID, true)
+
+	if err != nil {
+		return entry, err
+	}
+
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	req.Reference = strings.TrimSpace(req.Reference)
+	req.Note = strings.TrimSpace(req.Note)
+
+	if len(req.Reference) > MaxReferenceLength {
+		return entry, fmt.Errorf("%w: reference must be at most %d characters", ErrInvalid, MaxReferenceLength)
+	}
+
+	if len(req.Note) > MaxNoteLength {
+		return entry, fmt.Errorf("%w: note must be at most %d characters", ErrInvalid, MaxNoteLength)
+	}
+
+	points := req.Points
+
+	switch req.Action {
+	case models.PointsActionAdjustment:
+		if !Enabled(campaign) {
+			return entry, fmt.Errorf("%w: campaign has no points", ErrUnavailable)
+		}
+
+		if points == 0 {
+			return entry, fmt.Errorf("%w: an adjustment must add or take away points", ErrInvalid)
+		}
+	case models.PointsActionReferral:
+		return entry, fmt.Errorf("%w: referral points are given when a referral signs up", ErrInvalid)
+	default:
+		action, ok := Action(campaign, req.Action)
+
+		if !ok {
+			return entry, fmt.Errorf("%w: campaign has no action %q", ErrInvalid, req.Action)
+		}
+
+		if points != 0 {
+			return entry, fmt.Errorf("%w: points are only given for adjustments, %s is worth %d", ErrInvalid, action.Action, action.Points)
+		}
+
+		if err := Open(campaign, time.Now()); err != nil {
+			return entry, err
+		}
+
+		points = action.Points
+	}
+
+	userID, err := primitive.ObjectIDFromHex(req.UserID)
+
+	if err != nil {
+		return entry, fmt.Errorf("%w: no users with id: %s found", ErrNotFound, req.UserID)
+	}
+
+	s.db.SetCollection(models.UsersCollection)
+
+	n, err := s.db.CountDocuments(bson.M{"_id": userID})
+
+	if err != nil {
+		slog.Error("Error getting user", "error", err)
+
+		return entry, errors.New("error crediting points")
+	}
+
+	if n == 0 {
+		return entry, fmt.Errorf("%w: no users with id: %s found", ErrNotFound, req.UserID)
+	}
+
+	return Credit(s.db, campaign, models.PointsEntry{
+		UserID:    req.UserID,
+		Action:    req.Action,
+		Points:    points,
+		Reference: req.Reference,
+		Note:      req.Note,
+	}, time.Now().Local())
+}
+
+func (s *service) GetLedger(campaignID string, f LedgerFilter) (LedgerPage, error) {
+	page := LedgerPage{Entries: []models.PointsEntry{}}
+
+	campaign, err := s.findCampaign(campaignID, true)
+
+	if err != nil {
+		return page, err
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageSize
+	}
+
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+
+	page.Page, page.Limit = f.Page, f.Limit
+
+	filter := bson.M{"campaign_id": campaign.ID}
+
+	if f.UserID != "" {
+		filter["user_id"] = f.UserID
+	}
+
+	if f.Action != "" {
+		filter["action"] = strings.ToLower(f.Action)
+	}
+
+	s.db.SetCollection(models.PointsLedgerCollection)
+
+	page.Total, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting points entries", "error", err)
+
+		return page, errors.New("error getting points ledger")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64((f.Page - 1) * f.Limit)).
+		SetLimit(int64(f.Limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &page.Entries)
+
+	if err != nil {
+		slog.Error("Error getting points entries", "error", err)
+
+		return page, errors.New("error getting points ledger")
+	}
+
+	return page, nil
+}
+
+// GetBalance sums the user's ledger on the campaign
+func (s *service) GetBalance(campaignID string) (Balance, error) {
+	balance := Balance{CampaignID: campaignID, Recent: []models.PointsEntry{}}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return balance, errors.New("error getting points")
+	}
+
+	balance.UserID = user.Sub
+
+	campaign, err := s.findCampaign(campaignID, false)
+
+	if err != nil {
+		return balance, err
+	}
+
+	filter := bson.M{"campaign_id": campaign.ID, "user_id": user.Sub}
+	sums := []struct {
+		Points  int64 `bson:"points"`
+		Entries int64 `bson:"entries"`
+	}{}
+
+	s.db.SetCollection(models.PointsLedgerCollection)
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": filter},
+		{"$group": bson.M{"_id": nil, "points": bson.M{"$sum": "$points"}, "entries": bson.M{"$sum": 1}}},
+	}, &sums)
+
+	if err != nil {
+		slog.Error("Error summing points", "error", err)
+
+		return balance, errors.New("error getting points")
+	}
+
+	if len(sums) > 0 {
+		balance.Points, balance.Entries = sums[0].Points, sums[0].Entries
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(recentEntries)
+
+	err = s.db.FindManyWithOptions(filter, opts, &balance.Recent)
+
+	if err != nil {
+		slog.Error("Error getting points entries", "error", err)
+
+		return balance, errors.New("error getting points")
+	}
+
+	return balance, nil
+}
+
+// findCampaign gets a campaign with points. Participants see any such
+// campaign, owned limits it to the user's own.
+func (s *service) findCampaign(id string, owned bool) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	filter := bson.M{"_id": objid}
+
+	if owned {
+		filter["created_by"] = user.Sub
+	} else {
+		filter["points.enabled"] = true
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(filter, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	return campaign, nil
+}
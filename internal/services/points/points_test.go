@@ -0,0 +1,124 @@
+package pointsservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	p, err := Normalize(&models.PointsSettings{
+		Enabled:  true,
+		TimeZone: " Africa/Accra ",
+		Actions:  []models.PointAction{{Action: " Daily_Check-In ", Points: 5, DailyLimit: 1}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Actions[0].Action != "daily_check-in" || p.TimeZone != "Africa/Accra" {
+		t.Errorf("expected the action and zone to be normalized; got %+v", p)
+	}
+
+	invalid := map[string]models.PointsSettings{
+		"reserved action":   {Actions: []models.PointAction{{Action: "referral", Points: 5}}},
+		"action twice":      {Actions: []models.PointAction{{Action: "share", Points: 5}, {Action: "SHARE", Points: 1}}},
+		"worthless action":  {Actions: []models.PointAction{{Action: "share"}}},
+		"spaces in action":  {Actions: []models.PointAction{{Action: "share post", Points: 5}}},
+		"negative limit":    {Actions: []models.PointAction{{Action: "share", Points: 5, DailyLimit: -1}}},
+		"unknown time zone": {TimeZone: "Mars/Olympus"},
+	}
+
+	for name, p := range invalid {
+		if _, err := Normalize(&p); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %s to be invalid; got %v", name, err)
+		}
+	}
+}
+
+func TestAction(t *testing.T) {
+	campaign := models.Campaign{Points: &models.PointsSettings{Actions: []models.PointAction{{Action: "share", Points: 5}}}}
+
+	if a, ok := Action(campaign, "share"); !ok || a.Points != 5 {
+		t.Errorf("expected share to be worth 5; got %+v", a)
+	}
+
+	if _, ok := Action(campaign, "like"); ok {
+		t.Error("expected an unlisted action to be unknown")
+	}
+
+	if _, ok := Action(models.Campaign{}, "share"); ok {
+		t.Error("expected a campaign without points to have no actions")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	campaign := models.Campaign{Status: models.CampaignStatusActive, Points: &models.PointsSettings{Enabled: true}}
+
+	if err := Open(campaign, now); err != nil {
+		t.Errorf("expected an active campaign to give points; got %v", err)
+	}
+
+	campaign.EndDate = now.Add(-time.Hour)
+
+	if err := Open(campaign, now); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected an ended campaign not to give points; got %v", err)
+	}
+
+	campaign.Points.Enabled = false
+	campaign.EndDate = time.Time{}
+
+	if err := Open(campaign, now); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected a campaign with points disabled not to give points; got %v", err)
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	lagos, err := time.LoadLocation("Africa/Lagos")
+
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+
+	// Sunday 23:30 UTC is already Monday in Lagos
+	at := time.Date(2024, 6, 2, 23, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		period string
+		loc    *time.Location
+		key    string
+		since  time.Time
+	}{
+		{models.LeaderboardDaily, time.UTC, "day:2024-06-02", time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{models.LeaderboardDaily, lagos, "day:2024-06-03", time.Date(2024, 6, 3, 0, 0, 0, 0, lagos)},
+		{models.LeaderboardWeekly, time.UTC, "week:2024-W22", time.Date(2024, 5, 27, 0, 0, 0, 0, time.UTC)},
+		{models.LeaderboardWeekly, lagos, "week:2024-W23", time.Date(2024, 6, 3, 0, 0, 0, 0, lagos)},
+		{models.LeaderboardAllTime, time.UTC, "all", time.Time{}},
+	}
+
+	for _, c := range cases {
+		key, err := Key(c.period, at, c.loc)
+
+		if err != nil || key != c.key {
+			t.Errorf("expected %s in %s to be %s; got %s, %v", c.period, c.loc, c.key, key, err)
+		}
+
+		since, err := Since(c.period, at, c.loc)
+
+		if err != nil || !since.Equal(c.since) {
+			t.Errorf("expected %s in %s to start at %s; got %s, %v", c.period, c.loc, c.since, since, err)
+		}
+	}
+
+	// the first days of January can belong to the last week of the year
+	if key, _ := Key(models.LeaderboardWeekly, time.Date(2021, 1, 2, 12, 0, 0, 0, time.UTC), time.UTC); key != "week:2020-W53" {
+		t.Errorf("expected ISO week years; got %s", key)
+	}
+
+	if _, err := Key("monthly", at, time.UTC); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected an unknown period to be invalid; got %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package qrservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	bannerservice "campaign/internal/services/banner"
+	campaignservice "campaign/internal/services/campaign"
+	linkservice "campaign/internal/services/link"
+	"campaign/internal/storage"
+	"campaign/internal/utils/imaging"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	LevelLow      = "L"
+	LevelMedium   = "M"
+	LevelQuartile = "Q"
+	LevelHigh     = "H"
+
+	// MinSize keeps codes scannable once printed, MaxSize bounds the work
+	// of one request
+	MinSize     = 128
+	MaxSize     = 4096
+	DefaultSize = 512
+
+	// logoSourceWidth is the smallest banner variant worth drawing as a logo
+	logoSourceWidth = 256
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrInvalid     = errors.New("invalid request")
+	ErrUnavailable = errors.New("qr code unavailable")
+)
+
+var contentTypes = map[string]string{
+	FormatPNG: "image/png",
+	FormatSVG: "image/svg+xml",
+}
+
+// Options says how a QR code is drawn. LinkID encodes one of the campaign's
+// links instead of its landing page, Logo draws the campaign banner in the
+// middle of the code.
+type Options struct {
+	Format string
+	Size   int
+	Level  string
+	Logo   bool
+	LinkID string
+}
+
+// QR is a rendered code and the short link it encodes
+type QR struct {
+	Data        []byte
+	ContentType string
+	Filename    string
+	Link        models.Link
+}
+
+type Service interface {
+	GetQR(campaignID string, o Options) (QR, error)
+}
+
+type service struct {
+	ctx   context.Context
+	db    database.Database
+	store storage.BlobStore
+}
+
+func NewService(ctx context.Context, db database.Database, store storage.BlobStore) Service {
+	return &service{ctx: ctx, db: db, store: store}
+}
+
+// Normalize fills in defaults and checks o. A logo hides part of the code
+// so it raises the error correction level to H when it is lower than Q.
+func Normalize(o Options) (Options, error) {
+	o.Format = strings.ToLower(strings.TrimSpace(o.Format))
+	o.Level = strings.ToUpper(strings.TrimSpace(o.Level))
+	o.LinkID = strings.TrimSpace(o.LinkID)
+
+	if o.Format == "" {
+		o.Format = FormatPNG
+	}
+
+	if _, ok := contentTypes[o.Format]; !ok {
+		return o, fmt.Errorf("%w: format must be %s or %s", ErrInvalid, FormatPNG, FormatSVG)
+	}
+
+	if o.Size == 0 {
+		o.Size = DefaultSize
+	}
+
+	if o.Size < MinSize || o.Size > MaxSize {
+		return o, fmt.Errorf("%w: size must be between %d and %d pixels", ErrInvalid, MinSize, MaxSize)
+	}
+
+	if o.Level == "" {
+		o.Level = LevelMedium
+	}
+
+	if _, ok := levels[o.Level]; !ok {
+		return o, fmt.Errorf("%w: level must be one of L, M, Q or H", ErrInvalid)
+	}
+
+	if o.Logo && (o.Level == LevelLow || o.Level == LevelMedium) {
+		o.Level = LevelHigh
+	}
+
+	return o, nil
+}
+
+// GetQR renders a QR code of the campaign's tracked link. Scans are clicks
+// on that link so they show up in the campaign's click stats.
+func (s *service) GetQR(campaignID string, o Options) (QR, error) {
+	qr := QR{}
+
+	o, err := Normalize(o)
+
+	if err != nil {
+		return qr, err
+	}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return qr, err
+	}
+
+	if o.LinkID != "" {
+		qr.Link, err = s.findLink(campaign, o.LinkID)
+	} else {
+		qr.Link, err = s.pageLink(campaign)
+	}
+
+	if err != nil {
+		return qr, err
+	}
+
+	if !strings.HasPrefix(qr.Link.ShortURL, "http") {
+		slog.Error("Error generating qr code", "error", "PUBLIC_BASE_URL is not set")
+
+		return qr, errors.New("error generating qr code")
+	}
+
+	var logo image.Image
+
+	if o.Logo {
+		logo, err = s.logo(campaign)
+
+		if err != nil {
+			return qr, err
+		}
+	}
+
+	qr.Data, err = Render(qr.Link.ShortURL, o, logo)
+
+	if err != nil {
+		slog.Error("Error generating qr code", "error", err)
+
+		return qr, errors.New("error generating qr code")
+	}
+
+	name := campaign.Slug
+
+	if name == "" {
+		name = campaign.ID
+	}
+
+	qr.ContentType = contentTypes[o.Format]
+	qr.Filename = name + "-qr." + o.Format
+
+	return qr, nil
+}
+
+// pageLink is the campaign's qr link, it redirects to the landing page with
+// utm_source=qr so scans can be told from other visits
+func (s *service) pageLink(campaign models.Campaign) (models.Link, error) {
+	if campaign.Slug == "" {
+		return models.Link{}, fmt.Errorf("%w: the campaign has no landing page, set its slug first", ErrUnavailable)
+	}
+
+	return linkservice.Ensure(s.db, campaign, models.LinkKindQR, campaignservice.PageURL(campaign.Slug), &models.UTM{
+		Source:   "qr",
+		Medium:   "offline",
+		Campaign: campaign.Slug,
+	})
+}
+
+func (s *service) findLink(campaign models.Campaign, linkID string) (models.Link, error) {
+	link := models.Link{}
+
+	objid, err := primitive.ObjectIDFromHex(linkID)
+
+	if err != nil {
+		return link, fmt.Errorf("%w: no links with id: %s found", ErrNotFound, linkID)
+	}
+
+	s.db.SetCollection(models.LinksCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "campaign_id": campaign.ID, "created_by": campaign.CreatedBy}, &link)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return link, fmt.Errorf("%w: no links with id: %s found", ErrNotFound, linkID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting link", "error", err)
+
+		return link, errors.New("error getting link")
+	}
+
+	link.ID = objid.Hex()
+	link.ShortURL = linkservice.ShortURL(link.Code)
+
+	return link, nil
+}
+
+// logo reads the campaign banner, from its smallest variant that is still
+// sharp enough
+func (s *service) logo(campaign models.Campaign) (image.Image, error) {
+	if campaign.Banner == nil {
+		return nil, fmt.Errorf("%w: the campaign has no banner to use as a logo", ErrUnavailable)
+	}
+
+	key, width := campaign.Banner.Key, campaign.Banner.Width
+
+	for _, v := range campaign.Banner.Variants {
+		if v.Width >= logoSourceWidth && v.Width < width {
+			key, width = v.Key, v.Width
+		}
+	}
+
+	obj, err := s.store.Get(s.ctx, key)
+
+	if err != nil {
+		slog.Error("Error reading banner", "key", key, "error", err)
+
+		return nil, errors.New("error reading logo")
+	}
+
+	defer obj.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(obj.Body, bannerservice.MaxBannerSize+1))
+
+	if err != nil {
+		slog.Error("Error reading banner", "key", key, "error", err)
+
+		return nil, errors.New("error reading logo")
+	}
+
+	contentType, err := imaging.Sniff(data)
+
+	if err != nil {
+		slog.Error("Error reading banner", "key", key, "error", err)
+
+		return nil, errors.New("error reading logo")
+	}
+
+	img, err := imaging.Decode(data, contentType)
+
+	if err != nil {
+		slog.Error("Error decoding banner", "key", key, "error", err)
+
+		return nil, errors.New("error reading logo")
+	}
+
+	return img, nil
+}
+
+func (s *service) findCampaign(id string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	campaign.ID = objid.Hex()
+	campaign.CreatedBy = user.Sub
+
+	return campaign, nil
+}
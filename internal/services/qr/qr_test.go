@@ -0,0 +1,143 @@
+package qrservice
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	o, err := Normalize(Options{Format: " SVG ", Level: "q"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o.Format != FormatSVG || o.Level != LevelQuartile || o.Size != DefaultSize {
+		t.Errorf("expected svg at level Q and the default size; got %+v", o)
+	}
+
+	if o, _ := Normalize(Options{Logo: true}); o.Level != LevelHigh || o.Format != FormatPNG {
+		t.Errorf("expected a logo to raise the level to H; got %+v", o)
+	}
+
+	if o, _ := Normalize(Options{Logo: true, Level: LevelQuartile}); o.Level != LevelQuartile {
+		t.Errorf("expected level Q to be kept with a logo; got %+v", o)
+	}
+
+	invalid := map[string]Options{
+		"unknown format": {Format: "gif"},
+		"too small":      {Size: MinSize - 1},
+		"too large":      {Size: MaxSize + 1},
+		"unknown level":  {Level: "X"},
+	}
+
+	for name, o := range invalid {
+		if _, err := Normalize(o); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %s to be invalid; got %v", name, err)
+		}
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	o, _ := Normalize(Options{Size: 300})
+
+	data, err := Render("https://example.com/r/AbC1234", o, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 300 {
+		t.Errorf("expected a 300px code; got %v", b)
+	}
+
+	// the quiet zone around the code is white
+	if r, g, b, _ := img.At(0, 0).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+		t.Errorf("expected a white corner; got %v", img.At(0, 0))
+	}
+}
+
+func TestRenderLogo(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 40, 20))
+
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 20; y++ {
+			logo.Set(x, y, color.RGBA{R: 0xff, A: 0xff})
+		}
+	}
+
+	o, _ := Normalize(Options{Size: 500, Logo: true})
+
+	data, err := Render("https://example.com/r/AbC1234", o, logo)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, g, b, _ := img.At(250, 250).RGBA(); r < 0xf000 || g > 0x1000 || b > 0x1000 {
+		t.Errorf("expected the logo in the middle; got %v", img.At(250, 250))
+	}
+
+	svg, err := Render("https://example.com/r/AbC1234", Options{Format: FormatSVG, Size: 500, Level: LevelHigh}, logo)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(svg), `href="data:image/png;base64,`) {
+		t.Error("expected the logo to be embedded in the svg")
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	data, err := Render("https://example.com/r/AbC1234", Options{Format: FormatSVG, Size: 400, Level: LevelMedium}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := string(data)
+
+	for _, want := range []string{`<svg xmlns="http://www.w3.org/2000/svg" width="400" height="400"`, `<path fill="#000" d="M`, "</svg>"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("expected the svg to contain %q; got %s", want, svg)
+		}
+	}
+
+	if strings.Contains(svg, "<image") {
+		t.Error("expected no logo without one")
+	}
+}
+
+func TestFit(t *testing.T) {
+	cases := []struct {
+		src, box, want image.Rectangle
+	}{
+		{image.Rect(0, 0, 200, 100), image.Rect(10, 10, 110, 110), image.Rect(10, 35, 110, 85)},
+		{image.Rect(0, 0, 50, 100), image.Rect(0, 0, 100, 100), image.Rect(25, 0, 75, 100)},
+		{image.Rect(0, 0, 30, 30), image.Rect(0, 0, 60, 60), image.Rect(0, 0, 60, 60)},
+	}
+
+	for _, c := range cases {
+		if got := fit(c.src, c.box); got != c.want {
+			t.Errorf("expected %v fitted in %v to be %v; got %v", c.src, c.box, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package qrservice
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/draw"
+)
+
+// logoShare is the part of the code's width the logo box takes. A fifth of
+// the width hides about 4% of the modules, well within what levels Q and H
+// recover.
+const logoShare = 5
+
+// logoPadding is the white margin around the logo in modules
+const logoPadding = 1
+
+// svgLogoWidth is the width the logo embedded in svg codes is scaled to
+const svgLogoWidth = 256
+
+var levels = map[string]qrcode.RecoveryLevel{
+	LevelLow:      qrcode.Low,
+	LevelMedium:   qrcode.Medium,
+	LevelQuartile: qrcode.High,
+	LevelHigh:     qrcode.Highest,
+}
+
+// Render encodes content as a QR code in the format, size and error
+// correction level of o, with logo in its middle when it is not nil
+func Render(content string, o Options, logo image.Image) ([]byte, error) {
+	q, err := qrcode.New(content, levels[o.Level])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Format == FormatSVG {
+		return renderSVG(q.Bitmap(), o.Size, logo)
+	}
+
+	return renderPNG(q, o.Size, logo)
+}
+
+func renderPNG(q *qrcode.QRCode, size int, logo image.Image) ([]byte, error) {
+	var img image.Image = q.Image(size)
+
+	if logo != nil {
+		modules := len(q.Bitmap())
+		canvas := image.NewRGBA(img.Bounds())
+		draw.Draw(canvas, canvas.Bounds(), img, image.Point{}, draw.Src)
+
+		side := canvas.Bounds().Dx()
+		box := side / logoShare
+		pad := logoPadding * side / modules
+		at := (side - box) / 2
+
+		draw.Draw(canvas, image.Rect(at-pad, at-pad, at+box+pad, at+box+pad), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(canvas, fit(logo.Bounds(), image.Rect(at, at, at+box, at+box)), logo, logo.Bounds(), draw.Over, nil)
+
+		img = canvas
+	}
+
+	buf := bytes.Buffer{}
+
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderSVG draws each row's runs of dark modules as one path, the code
+// scales to any print size without blurring
+func renderSVG(bitmap [][]bool, size int, logo image.Image) ([]byte, error) {
+	modules := len(bitmap)
+	path := strings.Builder{}
+
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+
+			start := x
+
+			for x < len(row) && row[x] {
+				x++
+			}
+
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="%s"/>`, modules, modules, path.String())
+
+	if logo != nil {
+		data := bytes.Buffer{}
+
+		if err := png.Encode(&data, resize(logo, svgLogoWidth)); err != nil {
+			return nil, err
+		}
+
+		box := float64(modules) / logoShare
+		at := (float64(modules) - box) / 2
+
+		fmt.Fprintf(&buf, `<rect x="%g" y="%g" width="%g" height="%g" fill="#fff"/>`, at-logoPadding, at-logoPadding, box+2*logoPadding, box+2*logoPadding)
+		fmt.Fprintf(&buf, `<image x="%g" y="%g" width="%g" height="%g" preserveAspectRatio="xMidYMid meet" href="data:image/png;base64,%s"/>`, at, at, box, box, base64.StdEncoding.EncodeToString(data.Bytes()))
+	}
+
+	buf.WriteString("</svg>\n")
+
+	return buf.Bytes(), nil
+}
+
+// fit is the largest rectangle with the aspect ratio of src centred in box
+func fit(src, box image.Rectangle) image.Rectangle {
+	w, h := box.Dx(), box.Dy()
+
+	if src.Dx()*h > src.Dy()*w {
+		h = max(1, src.Dy()*w/src.Dx())
+	} else {
+		w = max(1, src.Dx()*h/src.Dy())
+	}
+
+	at := box.Min.Add(image.Pt((box.Dx()-w)/2, (box.Dy()-h)/2))
+
+	return image.Rectangle{Min: at, Max: at.Add(image.Pt(w, h))}
+}
+
+// resize scales img to fit a square of side, smaller images are kept
+func resize(img image.Image, side int) image.Image {
+	b := img.Bounds()
+
+	if b.Dx() <= side && b.Dy() <= side {
+		return img
+	}
+
+	r := fit(b, image.Rect(0, 0, side, side))
+	dst := image.NewRGBA(r)
+	draw.CatmullRom.Scale(dst, r, img, b, draw.Over, nil)
+
+	return dst
+}
@@ -0,0 +1,296 @@
+package receiptservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxReceiptsPerRequest caps a single callback batch
+const MaxReceiptsPerRequest = 500
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+// Receipt is a delivery status callback as providers post it. EventID makes
+// retried callbacks idempotent, without one it is derived from the rest.
+type Receipt struct {
+	EventID    string    `json:"event_id"`
+	MessageID  string    `json:"message_id"`
+	Status     string    `json:"status"`
+	ErrorCode  string    `json:"error_code"`
+	Reason     string    `json:"reason"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Result counts how a batch of receipts was processed. Pending receipts
+// name a message whose send has not been recorded yet.
+type Result struct {
+	Recorded   int `json:"recorded"`
+	Duplicates int `json:"duplicates"`
+	Pending    int `json:"pending"`
+}
+
+func validateReceipt(r Receipt) (Receipt, error) {
+	r.EventID = strings.TrimSpace(r.EventID)
+	r.MessageID = strings.Trim(strings.TrimSpace(r.MessageID), "<>")
+	r.Status = strings.ToLower(strings.TrimSpace(r.Status))
+	r.ErrorCode = strings.TrimSpace(r.ErrorCode)
+
+	switch r.Status {
+	case models.ReceiptDelivered, models.ReceiptFailed, models.ReceiptUndeliverable:
+	default:
+		return r, fmt.Errorf("%w: status must be delivered, failed or undeliverable", ErrInvalid)
+	}
+
+	if r.MessageID == "" {
+		return r, fmt.Errorf("%w: message_id is required", ErrInvalid)
+	}
+
+	if r.OccurredAt.IsZero() {
+		r.OccurredAt = time.Now()
+	}
+
+	if r.EventID == "" {
+		sum := sha256.Sum256([]byte(strings.Join([]string{
+			r.MessageID, r.Status, r.ErrorCode, r.OccurredAt.UTC().Format(time.RFC3339Nano),
+		}, "|")))
+
+		r.EventID = hex.EncodeToString(sum[:])
+	}
+
+	return r, nil
+}
+
+// Record stores receipts from provider and applies each to its message once.
+// A receipt is only applied when it is newer than the last one applied, so
+// out of order callbacks do not undo a later status.
+func Record(db database.Database, channel, provider string, receipts []Receipt) (Result, error) {
+	result := Result{}
+
+	if len(receipts) == 0 {
+		return result, fmt.Errorf("%w: at least one receipt is required", ErrInvalid)
+	}
+
+	if len(receipts) > MaxReceiptsPerRequest {
+		return result, fmt.Errorf("%w: at most %d receipts are accepted per request", ErrInvalid, MaxReceiptsPerRequest)
+	}
+
+	for i := range receipts {
+		r, err := validateReceipt(receipts[i])
+
+		if err != nil {
+			return result, fmt.Errorf("receipt %d: %w", i, err)
+		}
+
+		receipts[i] = r
+	}
+
+	for _, r := range receipts {
+		objid := primitive.NewObjectID()
+		receipt := models.DeliveryReceipt{
+			ID:         objid.Hex(),
+			Channel:    channel,
+			Provider:   provider,
+			EventID:    r.EventID,
+			MessageID:  r.MessageID,
+			Status:     r.Status,
+			ErrorCode:  r.ErrorCode,
+			Reason:     r.Reason,
+			OccurredAt: r.OccurredAt.Local(),
+			CreatedAt:  time.Now().Local(),
+		}
+
+		db.SetCollection(models.DeliveryReceiptsCollection)
+
+		err := db.InsertOne(bson.M{
+			"_id":         objid,
+			"channel":     receipt.Channel,
+			"provider":    receipt.Provider,
+			"event_id":    receipt.EventID,
+			"message_id":  receipt.MessageID,
+			"status":      receipt.Status,
+			"error_code":  receipt.ErrorCode,
+			"reason":      receipt.Reason,
+			"occurred_at": receipt.OccurredAt,
+			"applied":     false,
+			"created_at":  receipt.CreatedAt,
+		})
+
+		if mongo.IsDuplicateKeyError(err) {
+			result.Duplicates++
+			continue
+		}
+
+		if err != nil {
+			slog.Error("Error storing delivery receipt", "error", err)
+
+			return result, errors.New("error recording receipts")
+		}
+
+		applied, err := apply(db, receipt)
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Recorded++
+
+		if !applied {
+			result.Pending++
+		}
+	}
+
+	return result, nil
+}
+
+// ApplyPending applies receipts that arrived for a message before its send
+// was recorded, dispatchers call it right after recording a send
+func ApplyPending(db database.Database, channel, provider, messageID string) error {
+	if messageID == "" {
+		return nil
+	}
+
+	pending := []models.DeliveryReceipt{}
+
+	db.SetCollection(models.DeliveryReceiptsCollection)
+
+	err := db.FindManyWithOptions(bson.M{
+		"channel":    channel,
+		"provider":   provider,
+		"message_id": messageID,
+		"applied":    false,
+	}, options.Find().SetSort(bson.D{{Key: "occurred_at", Value: 1}}), &pending)
+
+	if err != nil {
+		slog.Error("Error getting pending receipts", "error", err)
+
+		return errors.New("error applying receipts")
+	}
+
+	for _, r := range pending {
+		if _, err := apply(db, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply moves the message r refers to into the reported status. It reports
+// false when the message is not known yet, r then stays pending.
+func apply(db database.Database, r models.DeliveryReceipt) (bool, error) {
+	collection := models.SMSMessagesCollection
+	filter := bson.M{"provider": r.Provider, "provider_message_id": r.MessageID}
+	statuses := []string{models.SMSStatusSent, models.SMSStatusDelivered, models.SMSStatusFailed, models.SMSStatusUndeliverable}
+
+	if r.Channel == models.ChannelEmail {
+		collection = models.EmailMessagesCollection
+		filter = bson.M{"provider": r.Provider, "message_id": r.MessageID}
+
+		// a bounce or complaint outranks any receipt
+		statuses = []string{models.EmailStatusSent, models.EmailStatusDelivered, models.EmailStatusFailed, models.EmailStatusUndeliverable}
+	}
+
+	set := bson.M{
+		"status":     r.Status,
+		"error_code": r.ErrorCode,
+		"last_error": r.Reason,
+		"receipt_at": r.OccurredAt,
+		"updated_at": time.Now().Local(),
+	}
+
+	if r.Status == models.ReceiptDelivered {
+		set["delivered_at"] = r.OccurredAt
+	}
+
+	current := bson.M{
+		"status": bson.M{"$in": statuses},
+		"$or": []bson.M{
+			{"receipt_at": bson.M{"$exists": false}},
+			{"receipt_at": bson.M{"$lte": r.OccurredAt}},
+		},
+	}
+
+	for k, v := range filter {
+		current[k] = v
+	}
+
+	message := struct {
+		CampaignID string `bson:"campaign_id"`
+		ContactID  string `bson:"contact_id"`
+		CreatedBy  string `bson:"created_by"`
+	}{}
+
+	db.SetCollection(collection)
+
+	err := db.FindOneAndUpdate(current, bson.M{"$set": set}, nil, &message)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// a message that exists has a newer receipt or was bounced, this one is spent
+		err = db.FindOne(filter, &message)
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+	} else if err == nil && r.Status == models.ReceiptUndeliverable {
+		err = markUndeliverable(db, r, message.ContactID, message.CreatedBy)
+	}
+
+	if err != nil {
+		slog.Error("Error applying delivery receipt", "error", err)
+
+		return false, errors.New("error applying receipts")
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(r.ID)
+
+	db.SetCollection(models.DeliveryReceiptsCollection)
+
+	err = db.UpdateOne(bson.M{"_id": objid}, bson.M{"applied": true, "campaign_id": message.CampaignID})
+
+	if err != nil {
+		slog.Error("Error updating delivery receipt", "error", err)
+
+		return false, errors.New("error applying receipts")
+	}
+
+	return true, nil
+}
+
+// markUndeliverable flags the contact so later sends on the channel skip it
+func markUndeliverable(db database.Database, r models.DeliveryReceipt, contactID, createdBy string) error {
+	field := "sms_undeliverable"
+
+	if r.Channel == models.ChannelEmail {
+		field = "email_undeliverable"
+	}
+
+	reason := r.Reason
+
+	if reason == "" {
+		reason = r.ErrorCode
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(contactID)
+
+	db.SetCollection(models.ContactsCollection)
+
+	return db.UpdateOne(bson.M{"_id": objid, "created_by": createdBy}, bson.M{
+		field:        models.Undeliverable{Type: models.ReceiptUndeliverable, Reason: reason, At: r.OccurredAt},
+		"updated_at": time.Now().Local(),
+	})
+}
@@ -0,0 +1,53 @@
+package receiptservice
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateReceipt(t *testing.T) {
+	r, err := validateReceipt(Receipt{MessageID: " <abc@mail.example.com> ", Status: "Delivered"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.MessageID != "abc@mail.example.com" || r.Status != "delivered" {
+		t.Errorf("expected the message id and status to be normalized; got %q %q", r.MessageID, r.Status)
+	}
+
+	if r.OccurredAt.IsZero() || r.EventID == "" {
+		t.Errorf("expected occurred_at and event_id to be filled in; got %v %q", r.OccurredAt, r.EventID)
+	}
+
+	if _, err := validateReceipt(Receipt{MessageID: "abc", Status: "opened"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected an unknown status to be invalid; got %v", err)
+	}
+
+	if _, err := validateReceipt(Receipt{Status: "failed"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected a missing message id to be invalid; got %v", err)
+	}
+}
+
+func TestValidateReceiptEventID(t *testing.T) {
+	at := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	first, _ := validateReceipt(Receipt{MessageID: "abc", Status: "failed", ErrorCode: "30003", OccurredAt: at})
+	retried, _ := validateReceipt(Receipt{MessageID: "abc", Status: "failed", ErrorCode: "30003", OccurredAt: at})
+	later, _ := validateReceipt(Receipt{MessageID: "abc", Status: "delivered", OccurredAt: at.Add(time.Minute)})
+
+	if first.EventID != retried.EventID {
+		t.Errorf("expected a retried callback to keep its event id; got %q and %q", first.EventID, retried.EventID)
+	}
+
+	if first.EventID == later.EventID {
+		t.Error("expected a different receipt to get a different event id")
+	}
+
+	given, _ := validateReceipt(Receipt{EventID: "evt_1", MessageID: "abc", Status: "failed", OccurredAt: at})
+
+	if given.EventID != "evt_1" {
+		t.Errorf("expected the provider event id to be kept; got %q", given.EventID)
+	}
+}
@@ -0,0 +1,172 @@
+package receiptservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxErrorCodes is how many of the most frequent error codes are reported
+const maxErrorCodes = 10
+
+type ErrorCount struct {
+	Code  string `json:"code"`
+	Count int64  `json:"count"`
+}
+
+// ChannelStats summarises the messages of one channel. Sent counts messages
+// that left, whatever receipt came back since, and DeliveryRate is the share
+// of those confirmed delivered. Deferred messages wait for the campaign send
+// window to open for their recipient.
+type ChannelStats struct {
+	Total        int64            `json:"total"`
+	Counts       map[string]int64 `json:"counts"`
+	Deferred     int64            `json:"deferred"`
+	Sent         int64            `json:"sent"`
+	Delivered    int64            `json:"delivered"`
+	DeliveryRate float64          `json:"delivery_rate"`
+	ErrorCodes   []ErrorCount     `json:"error_codes"`
+}
+
+type DeliveryStats struct {
+	CampaignID string       `json:"campaign_id"`
+	SMS        ChannelStats `json:"sms"`
+	Email      ChannelStats `json:"email"`
+}
+
+type Service interface {
+	GetDeliveryStats(campaignID string) (DeliveryStats, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+func (s *service) GetDeliveryStats(campaignID string) (DeliveryStats, error) {
+	stats := DeliveryStats{CampaignID: campaignID}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return stats, errors.New("error getting delivery stats")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(campaignID)
+
+	if err != nil {
+		return stats, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &models.Campaign{})
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return stats, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return stats, errors.New("error getting delivery stats")
+	}
+
+	if stats.SMS, err = s.channelStats(models.SMSMessagesCollection, campaignID, models.SMSStatusDelivered, models.SMSStatusDeferred); err != nil {
+		return stats, err
+	}
+
+	if stats.Email, err = s.channelStats(models.EmailMessagesCollection, campaignID, models.EmailStatusDelivered, models.EmailStatusDeferred); err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+func (s *service) channelStats(collection models.Collections, campaignID, delivered, deferred string) (ChannelStats, error) {
+	stats := ChannelStats{Counts: map[string]int64{}, ErrorCodes: []ErrorCount{}}
+
+	groups := []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+		Sent   int64  `bson:"sent"`
+	}{}
+
+	s.db.SetCollection(collection)
+
+	err := s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"campaign_id": campaignID}},
+		{"$group": bson.M{
+			"_id":   "$status",
+			"count": bson.M{"$sum": 1},
+			"sent":  bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$ifNull": bson.A{"$sent_at", false}}, 1, 0}}},
+		}},
+	}, &groups)
+
+	if err != nil {
+		slog.Error("Error counting messages", "collection", collection, "error", err)
+
+		return stats, errors.New("error getting delivery stats")
+	}
+
+	for _, g := range groups {
+		stats.Counts[g.Status] = g.Count
+		stats.Total += g.Count
+		stats.Sent += g.Sent
+	}
+
+	stats.Delivered = stats.Counts[delivered]
+	stats.Deferred = stats.Counts[deferred]
+
+	if stats.Sent > 0 {
+		stats.DeliveryRate = float64(stats.Delivered) / float64(stats.Sent)
+	}
+
+	codes := []struct {
+		Code  string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}{}
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": bson.M{"campaign_id": campaignID, "error_code": bson.M{"$nin": bson.A{nil, ""}}}},
+		{"$group": bson.M{"_id": "$error_code", "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.M{"count": -1}},
+		{"$limit": maxErrorCodes},
+	}, &codes)
+
+	if err != nil {
+		slog.Error("Error counting error codes", "collection", collection, "error", err)
+
+		return stats, errors.New("error getting delivery stats")
+	}
+
+	for _, c := range codes {
+		stats.ErrorCodes = append(stats.ErrorCodes, ErrorCount{Code: c.Code, Count: c.Count})
+	}
+
+	// ties in the aggregation come back in any order
+	sort.SliceStable(stats.ErrorCodes, func(i, j int) bool {
+		if stats.ErrorCodes[i].Count != stats.ErrorCodes[j].Count {
+			return stats.ErrorCodes[i].Count > stats.ErrorCodes[j].Count
+		}
+
+		return stats.ErrorCodes[i].Code < stats.ErrorCodes[j].Code
+	})
+
+	return stats, nil
+}
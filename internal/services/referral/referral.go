@@ -0,0 +1,508 @@
+package referralservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	pointsservice "campaign/internal/services/points"
+	riskservice "campaign/internal/services/risk"
+	"campaign/internal/utils/jwt"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// MaxLevels bounds how far up the chain of referrers rewards are paid
+	MaxLevels = 5
+
+	CodeLength = 8
+
+	// codeAlphabet leaves out 0, 1, I and O, codes are shared by word of
+	// mouth
+	codeAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid referral")
+
+	// ErrUnavailable is returned for campaigns that are not taking referrals
+	ErrUnavailable = errors.New("campaign is not taking referrals")
+)
+
+type Service interface {
+	GetCode(campaignID string) (models.ReferralCode, error)
+	GetCodes() ([]models.ReferralCode, error)
+	GetReport(campaignID string) (Report, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// Normalize checks the reward rules of r and sorts them by level
+func Normalize(r *models.ReferralSettings) (*models.ReferralSettings, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	seen := map[int]bool{}
+
+	for i, rule := range r.Rewards {
+		if rule.Level < 1 || rule.Level > MaxLevels {
+			return nil, fmt.Errorf("%w: reward levels must be between 1 and %d", ErrInvalid, MaxLevels)
+		}
+
+		if seen[rule.Level] {
+			return nil, fmt.Errorf("%w: level %d is rewarded more than once", ErrInvalid, rule.Level)
+		}
+
+		if rule.Amount <= 0 {
+			return nil, fmt.Errorf("%w: level %d must reward a positive amount", ErrInvalid, rule.Level)
+		}
+
+		seen[rule.Level] = true
+		r.Rewards[i].Description = strings.TrimSpace(rule.Description)
+	}
+
+	if r.Rewards == nil {
+		r.Rewards = []models.ReferralRewardRule{}
+	}
+
+	slices.SortFunc(r.Rewards, func(a, b models.ReferralRewardRule) int { return a.Level - b.Level })
+
+	return r, nil
+}
+
+// NormalizeCode upper cases code and drops the spaces and dashes people add
+// when they copy it
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// NewCode returns a random referral code
+func NewCode() (string, error) {
+	code := make([]byte, CodeLength)
+	max := big.NewInt(int64(len(codeAlphabet)))
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		code[i] = codeAlphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// Open tells whether c takes referrals at now
+func Open(c models.Campaign, now time.Time) error {
+	if c.Referrals == nil || !c.Referrals.Enabled {
+		return fmt.Errorf("%w: campaign has no referral programme", ErrUnavailable)
+	}
+
+	if c.Status != models.CampaignStatusActive {
+		return ErrUnavailable
+	}
+
+	if !c.EndDate.IsZero() && now.After(c.EndDate) {
+		return fmt.Errorf("%w: campaign has ended", ErrUnavailable)
+	}
+
+	return nil
+}
+
+// Rewards pays the rules of the campaign out to chain, the referrer at
+// index i being level i+1
+func Rewards(rules []models.ReferralRewardRule, chain []string) []models.ReferralReward {
+	rewards := []models.ReferralReward{}
+
+	for _, rule := range rules {
+		if rule.Level > len(chain) {
+			continue
+		}
+
+		rewards = append(rewards, models.ReferralReward{
+			Level:       rule.Level,
+			UserID:      chain[rule.Level-1],
+			Amount:      rule.Amount,
+			Description: rule.Description,
+		})
+	}
+
+	return rewards
+}
+
+// SameIdentity tells whether a and b are likely the same person: the same
+// msisdn or the same inbox behind their emails
+func SameIdentity(a, b models.User) bool {
+	if a.ID != "" && a.ID == b.ID {
+		return true
+	}
+
+	if a.Msisdn != "" && a.Msisdn == b.Msisdn {
+		return true
+	}
+
+	key := riskservice.EmailKey(a.Email)
+
+	return key != "" && key == riskservice.EmailKey(b.Email)
+}
+
+// levels is how far up the chain a campaign pays
+func levels(c models.Campaign) int {
+	n := 1
+
+	for _, rule := range c.Referrals.Rewards {
+		n = max(n, rule.Level)
+	}
+
+	return n
+}
+
+// GetCode returns the user's code for the campaign, creating it the first
+// time
+func (s *service) GetCode(campaignID string) (models.ReferralCode, error) {
+	code := models.ReferralCode{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return code, errors.New("error getting referral code")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(campaignID)
+
+	if err != nil {
+		return code, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	campaign := models.Campaign{}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return code, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return code, errors.New("error getting referral code")
+	}
+
+	filter := bson.M{"campaign_id": campaign.ID, "user_id": user.Sub}
+
+	s.db.SetCollection(models.ReferralCodesCollection)
+
+	err = s.db.FindOne(filter, &code)
+
+	if err == nil {
+		return code, nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error getting referral code", "error", err)
+
+		return code, errors.New("error getting referral code")
+	}
+
+	if err := Open(campaign, time.Now()); err != nil {
+		return code, err
+	}
+
+	// a duplicate is either a code that is taken, so another is tried, or
+	// a code made for the user by a concurrent request
+	for attempt := 0; attempt < 3; attempt++ {
+		value, err := NewCode()
+
+		if err != nil {
+			slog.Error("Error generating referral code", "error", err)
+
+			return code, errors.New("error getting referral code")
+		}
+
+		now := time.Now().Local()
+
+		s.db.SetCollection(models.ReferralCodesCollection)
+
+		err = s.db.InsertOne(bson.M{
+			"campaign_id": campaign.ID,
+			"user_id":     user.Sub,
+			"code":        value,
+			"referrals":   0,
+			"earned":      0,
+			"created_at":  now,
+			"updated_at":  now,
+		})
+
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			slog.Error("Error creating referral code", "error", err)
+
+			return code, errors.New("error getting referral code")
+		}
+
+		err = s.db.FindOne(filter, &code)
+
+		if err == nil {
+			return code, nil
+		}
+
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Error("Error getting referral code", "error", err)
+
+			return code, errors.New("error getting referral code")
+		}
+	}
+
+	return code, errors.New("error getting referral code")
+}
+
+// GetCodes lists the user's codes across campaigns with what they earned
+func (s *service) GetCodes() ([]models.ReferralCode, error) {
+	codes := []models.ReferralCode{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return codes, errors.New("error getting referral codes")
+	}
+
+	s.db.SetCollection(models.ReferralCodesCollection)
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	err = s.db.FindManyWithOptions(bson.M{"user_id": user.Sub}, opts, &codes)
+
+	if err != nil {
+		slog.Error("Error getting referral codes", "error", err)
+
+		return codes, errors.New("error getting referral codes")
+	}
+
+	return codes, nil
+}
+
+// Attribution is the referral of a signup, worked out before the account is
+// created so a bad code fails the signup rather than being dropped
+type Attribution struct {
+	Campaign models.Campaign
+	Code     models.ReferralCode
+	Chain    []string
+}
+
+// Resolve looks up code for signup. Signing up with a code of one's own, or
+// of anyone up its chain, is refused.
+func Resolve(db database.Database, code string, signup models.User) (Attribution, error) {
+	a := Attribution{}
+
+	db.SetCollection(models.ReferralCodesCollection)
+
+	err := db.FindOne(bson.M{"code": NormalizeCode(code)}, &a.Code)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return a, fmt.Errorf("%w: unknown referral code", ErrInvalid)
+	}
+
+	if err != nil {
+		slog.Error("Error getting referral code", "error", err)
+
+		return a, errors.New("error checking referral code")
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(a.Code.CampaignID)
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err = db.FindOne(bson.M{"_id": objid}, &a.Campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return a, fmt.Errorf("%w: unknown referral code", ErrInvalid)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return a, errors.New("error checking referral code")
+	}
+
+	if err := Open(a.Campaign, time.Now()); err != nil {
+		return a, fmt.Errorf("%w: %s", ErrInvalid, err.Error())
+	}
+
+	a.Chain, err = chain(db, a.Campaign, a.Code.UserID)
+
+	if err != nil {
+		slog.Error("Error getting referral chain", "error", err)
+
+		return a, errors.New("error checking referral code")
+	}
+
+	referrers := []models.User{}
+	ids := bson.A{}
+
+	for _, id := range a.Chain {
+		if objid, err := primitive.ObjectIDFromHex(id); err == nil {
+			ids = append(ids, objid)
+		}
+	}
+
+	db.SetCollection(models.UsersCollection)
+
+	err = db.FindManyWithOptions(bson.M{"_id": bson.M{"$in": ids}}, options.Find(), &referrers)
+
+	if err != nil {
+		slog.Error("Error getting referrers", "error", err)
+
+		return a, errors.New("error checking referral code")
+	}
+
+	for _, referrer := range referrers {
+		if SameIdentity(referrer, signup) {
+			return a, fmt.Errorf("%w: you cannot sign up with your own referral code", ErrInvalid)
+		}
+	}
+
+	return a, nil
+}
+
+// chain walks up from referrerID through the referrals of the campaign, as
+// far as it pays rewards
+func chain(db database.Database, c models.Campaign, referrerID string) ([]string, error) {
+	ids := []string{referrerID}
+
+	for len(ids) < levels(c) {
+		referral := models.Referral{}
+
+		db.SetCollection(models.ReferralsCollection)
+
+		err := db.FindOne(bson.M{"campaign_id": c.ID, "user_id": ids[len(ids)-1]}, &referral)
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+
+		if err != nil {
+			return ids, err
+		}
+
+		if slices.Contains(ids, referral.ReferrerID) {
+			break
+		}
+
+		ids = append(ids, referral.ReferrerID)
+	}
+
+	return ids, nil
+}
+
+// Record saves a's referral for the account just created as userID and
+// credits the referrers' codes
+func Record(db database.Database, a Attribution, userID string) (models.Referral, error) {
+	id := primitive.NewObjectID()
+
+	referral := models.Referral{
+		ID:         id.Hex(),
+		CampaignID: a.Campaign.ID,
+		Code:       a.Code.Code,
+		ReferrerID: a.Code.UserID,
+		UserID:     userID,
+		Chain:      a.Chain,
+		Rewards:    Rewards(a.Campaign.Referrals.Rewards, a.Chain),
+		CreatedBy:  a.Campaign.CreatedBy,
+		CreatedAt:  time.Now().Local(),
+	}
+
+	db.SetCollection(models.ReferralsCollection)
+
+	err := db.InsertOne(bson.M{
+		"_id":         id,
+		"campaign_id": referral.CampaignID,
+		"code":        referral.Code,
+		"referrer_id": referral.ReferrerID,
+		"user_id":     referral.UserID,
+		"chain":       referral.Chain,
+		"rewards":     referral.Rewards,
+		"created_by":  referral.CreatedBy,
+		"created_at":  referral.CreatedAt,
+	})
+
+	if err != nil {
+		slog.Error("Error recording referral", "error", err)
+
+		return referral, errors.New("error recording referral")
+	}
+
+	db.SetCollection(models.ReferralCodesCollection)
+
+	err = db.UpdateOneRaw(bson.M{"_id": codeID(a.Code)}, bson.M{
+		"$inc": bson.M{"referrals": 1},
+		"$set": bson.M{"updated_at": referral.CreatedAt},
+	})
+
+	if err != nil {
+		slog.Error("Error counting referral", "code", a.Code.Code, "error", err)
+	}
+
+	for _, reward := range referral.Rewards {
+		db.SetCollection(models.ReferralCodesCollection)
+
+		err = db.UpdateOneRaw(bson.M{"campaign_id": referral.CampaignID, "user_id": reward.UserID}, bson.M{
+			"$inc": bson.M{"earned": reward.Amount},
+			"$set": bson.M{"updated_at": referral.CreatedAt},
+		})
+
+		if err != nil {
+			slog.Error("Error crediting referral reward", "user", reward.UserID, "level", reward.Level, "error", err)
+		}
+
+		if !pointsservice.Enabled(a.Campaign) {
+			continue
+		}
+
+		_, err = pointsservice.Credit(db, a.Campaign, models.PointsEntry{
+			UserID:    reward.UserID,
+			Action:    models.PointsActionReferral,
+			Points:    reward.Amount,
+			Reference: referral.ID,
+			Note:      fmt.Sprintf("level %d referral", reward.Level),
+		}, referral.CreatedAt)
+
+		if err != nil {
+			slog.Error("Error crediting referral points", "user", reward.UserID, "level", reward.Level, "error", err)
+		}
+	}
+
+	return referral, nil
+}
+
+func codeID(c models.ReferralCode) primitive.ObjectID {
+	objid, _ := primitive.ObjectIDFromHex(c.ID)
+
+	return objid
+}
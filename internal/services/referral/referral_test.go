@@ -0,0 +1,141 @@
+package referralservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T) {
+	r, err := Normalize(&models.ReferralSettings{Enabled: true, Rewards: []models.ReferralRewardRule{
+		{Level: 2, Amount: 50},
+		{Level: 1, Amount: 100, Description: " Friend joined "},
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Rewards[0].Level != 1 || r.Rewards[1].Level != 2 {
+		t.Errorf("expected rewards sorted by level; got %+v", r.Rewards)
+	}
+
+	if r.Rewards[0].Description != "Friend joined" {
+		t.Errorf("expected the description to be trimmed; got %q", r.Rewards[0].Description)
+	}
+
+	invalid := map[string][]models.ReferralRewardRule{
+		"level zero":      {{Level: 0, Amount: 10}},
+		"level too deep":  {{Level: MaxLevels + 1, Amount: 10}},
+		"level twice":     {{Level: 1, Amount: 10}, {Level: 1, Amount: 20}},
+		"negative amount": {{Level: 1, Amount: -10}},
+	}
+
+	for name, rewards := range invalid {
+		if _, err := Normalize(&models.ReferralSettings{Rewards: rewards}); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %s to be invalid; got %v", name, err)
+		}
+	}
+}
+
+func TestNewCode(t *testing.T) {
+	code, err := NewCode()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(code) != CodeLength || strings.Trim(code, codeAlphabet) != "" {
+		t.Errorf("expected %d characters of the code alphabet; got %q", CodeLength, code)
+	}
+
+	if NormalizeCode(" abcd-2345 ") != "ABCD2345" {
+		t.Errorf("expected codes to be matched ignoring case, spaces and dashes")
+	}
+}
+
+func TestRewards(t *testing.T) {
+	rules := []models.ReferralRewardRule{{Level: 1, Amount: 100}, {Level: 2, Amount: 20}, {Level: 3, Amount: 5}}
+
+	rewards := Rewards(rules, []string{"bob", "ama"})
+
+	if len(rewards) != 2 {
+		t.Fatalf("expected only the levels with a referrer to be paid; got %+v", rewards)
+	}
+
+	if rewards[0].UserID != "bob" || rewards[0].Amount != 100 || rewards[1].UserID != "ama" || rewards[1].Amount != 20 {
+		t.Errorf("expected the direct referrer to earn level 1; got %+v", rewards)
+	}
+}
+
+func TestSameIdentity(t *testing.T) {
+	referrer := models.User{ID: "1", Email: "ama.mensah@gmail.com", Msisdn: "233241234567"}
+
+	same := map[string]models.User{
+		"same msisdn":     {Email: "other@example.com", Msisdn: "233241234567"},
+		"gmail alias":     {Email: "amamensah+promo@googlemail.com", Msisdn: "233201111111"},
+		"same account id": {ID: "1"},
+	}
+
+	for name, signup := range same {
+		if !SameIdentity(referrer, signup) {
+			t.Errorf("expected %s to be a self referral", name)
+		}
+	}
+
+	if SameIdentity(referrer, models.User{Email: "kofi@gmail.com", Msisdn: "233201111111"}) {
+		t.Error("expected someone else not to be a self referral")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	campaign := models.Campaign{Status: models.CampaignStatusActive, Referrals: &models.ReferralSettings{Enabled: true}}
+
+	if err := Open(campaign, now); err != nil {
+		t.Errorf("expected an active programme to be open; got %v", err)
+	}
+
+	campaign.EndDate = now.Add(-time.Hour)
+
+	if err := Open(campaign, now); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected an ended campaign to be closed; got %v", err)
+	}
+
+	if err := Open(models.Campaign{Status: models.CampaignStatusActive}, now); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected a campaign without a programme to be closed; got %v", err)
+	}
+}
+
+func TestTree(t *testing.T) {
+	at := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	codes := []models.ReferralCode{
+		{UserID: "ama", Code: "AAAA", Earned: 120},
+		{UserID: "bob", Code: "BBBB", Earned: 100},
+	}
+
+	referrals := []models.Referral{
+		{UserID: "bob", ReferrerID: "ama", CreatedAt: at},
+		{UserID: "eve", ReferrerID: "ama", CreatedAt: at.Add(time.Hour)},
+		{UserID: "kofi", ReferrerID: "bob", CreatedAt: at.Add(2 * time.Hour)},
+	}
+
+	tree := Tree(codes, referrals, map[string]string{"ama": "Ama"})
+
+	if len(tree) != 1 || tree[0].UserID != "ama" || tree[0].Name != "Ama" {
+		t.Fatalf("expected ama to be the only root; got %+v", tree)
+	}
+
+	ama := tree[0]
+
+	if len(ama.Referred) != 2 || ama.Referred[0].UserID != "bob" || ama.Referred[1].UserID != "eve" {
+		t.Fatalf("expected ama's referrals in signup order; got %+v", ama.Referred)
+	}
+
+	if bob := ama.Referred[0]; len(bob.Referred) != 1 || bob.Referred[0].UserID != "kofi" || bob.Code != "BBBB" {
+		t.Errorf("expected kofi under bob; got %+v", bob)
+	}
+}
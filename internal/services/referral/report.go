@@ -0,0 +1,259 @@
+package referralservice
+
+import (
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxReportSize bounds the referrals drawn in a report's tree, the totals
+// always cover the whole campaign
+const MaxReportSize = 5000
+
+// Report is a campaign owner's view of their referral programme
+type Report struct {
+	CampaignID string        `json:"campaign_id"`
+	Codes      int64         `json:"codes"`
+	Referrals  int64         `json:"referrals"`
+	Earned     int64         `json:"earned"`
+	Levels     []LevelReport `json:"levels"`
+	Tree       []*Node       `json:"tree"`
+	Truncated  bool          `json:"truncated"`
+}
+
+// LevelReport totals the rewards paid at one level
+type LevelReport struct {
+	Level   int   `json:"level"`
+	Rewards int64 `json:"rewards"`
+	Amount  int64 `json:"amount"`
+}
+
+// Node is a user in the referral tree with the people they brought in
+type Node struct {
+	UserID   string     `json:"user_id"`
+	Name     string     `json:"name"`
+	Code     string     `json:"code,omitempty"`
+	Earned   int64      `json:"earned"`
+	JoinedAt *time.Time `json:"joined_at,omitempty"`
+	Referred []*Node    `json:"referred"`
+}
+
+func (s *service) GetReport(campaignID string) (Report, error) {
+	report := Report{CampaignID: campaignID, Levels: []LevelReport{}, Tree: []*Node{}}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return report, errors.New("error getting referral report")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(campaignID)
+
+	if err != nil {
+		return report, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &models.Campaign{})
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return report, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, campaignID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return report, errors.New("error getting referral report")
+	}
+
+	filter := bson.M{"campaign_id": campaignID}
+
+	s.db.SetCollection(models.ReferralCodesCollection)
+
+	report.Codes, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting referral codes", "error", err)
+
+		return report, errors.New("error getting referral report")
+	}
+
+	s.db.SetCollection(models.ReferralsCollection)
+
+	report.Referrals, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting referrals", "error", err)
+
+		return report, errors.New("error getting referral report")
+	}
+
+	levels := []LevelReport{}
+
+	s.db.SetCollection(models.ReferralsCollection)
+
+	err = s.db.AggregateMany([]bson.M{
+		{"$match": filter},
+		{"$unwind": "$rewards"},
+		{"$group": bson.M{
+			"_id":     "$rewards.level",
+			"rewards": bson.M{"$sum": 1},
+			"amount":  bson.M{"$sum": "$rewards.amount"},
+		}},
+		{"$project": bson.M{"_id": 0, "level": "$_id", "rewards": 1, "amount": 1}},
+		{"$sort": bson.M{"level": 1}},
+	}, &levels)
+
+	if err != nil {
+		slog.Error("Error totalling referral rewards", "error", err)
+
+		return report, errors.New("error getting referral report")
+	}
+
+	report.Levels = levels
+
+	for _, l := range levels {
+		report.Earned += l.Amount
+	}
+
+	codes := []models.ReferralCode{}
+	referrals := []models.Referral{}
+
+	s.db.SetCollection(models.ReferralCodesCollection)
+
+	err = s.db.FindManyWithOptions(filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(MaxReportSize), &codes)
+
+	if err != nil {
+		slog.Error("Error getting referral codes", "error", err)
+
+		return report, errors.New("error getting referral report")
+	}
+
+	s.db.SetCollection(models.ReferralsCollection)
+
+	err = s.db.FindManyWithOptions(filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(MaxReportSize), &referrals)
+
+	if err != nil {
+		slog.Error("Error getting referrals", "error", err)
+
+		return report, errors.New("error getting referral report")
+	}
+
+	report.Truncated = report.Codes > int64(len(codes)) || report.Referrals > int64(len(referrals))
+
+	names, err := s.names(codes, referrals)
+
+	if err != nil {
+		slog.Error("Error getting referral names", "error", err)
+
+		return report, errors.New("error getting referral report")
+	}
+
+	report.Tree = Tree(codes, referrals, names)
+
+	return report, nil
+}
+
+func (s *service) names(codes []models.ReferralCode, referrals []models.Referral) (map[string]string, error) {
+	names := map[string]string{}
+	ids := bson.A{}
+	seen := map[string]bool{}
+
+	add := func(id string) {
+		if objid, err := primitive.ObjectIDFromHex(id); err == nil && !seen[id] {
+			seen[id] = true
+			ids = append(ids, objid)
+		}
+	}
+
+	for _, c := range codes {
+		add(c.UserID)
+	}
+
+	for _, r := range referrals {
+		add(r.UserID)
+		add(r.ReferrerID)
+	}
+
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	users := []models.User{}
+
+	s.db.SetCollection(models.UsersCollection)
+
+	err := s.db.FindManyWithOptions(bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"name": 1}), &users)
+
+	if err != nil {
+		return names, err
+	}
+
+	for _, u := range users {
+		names[u.ID] = u.Name
+	}
+
+	return names, nil
+}
+
+// Tree arranges the code holders and referred users of a campaign under
+// whoever referred them. The roots are people who joined the programme
+// without a referral, children keep the order they signed up in.
+func Tree(codes []models.ReferralCode, referrals []models.Referral, names map[string]string) []*Node {
+	nodes := map[string]*Node{}
+	order := []string{}
+	referred := map[string]bool{}
+
+	node := func(id string) *Node {
+		if n, ok := nodes[id]; ok {
+			return n
+		}
+
+		n := &Node{UserID: id, Name: names[id], Referred: []*Node{}}
+		nodes[id] = n
+		order = append(order, id)
+
+		return n
+	}
+
+	for _, c := range codes {
+		n := node(c.UserID)
+		n.Code = c.Code
+		n.Earned = c.Earned
+	}
+
+	for _, r := range referrals {
+		if r.UserID == r.ReferrerID || referred[r.UserID] {
+			continue
+		}
+
+		n := node(r.UserID)
+		joined := r.CreatedAt
+		n.JoinedAt = &joined
+		referred[r.UserID] = true
+
+		parent := node(r.ReferrerID)
+		parent.Referred = append(parent.Referred, n)
+	}
+
+	roots := []*Node{}
+
+	for _, id := range order {
+		if !referred[id] {
+			roots = append(roots, nodes[id])
+		}
+	}
+
+	return roots
+}
@@ -0,0 +1,112 @@
+package riskservice
+
+// disposableDomains are throwaway inbox providers, subdomains of them are
+// matched too. The list is bundled so checks do not depend on a lookup
+// service being up.
+var disposableDomains = map[string]bool{
+	"0-mail.com":               true,
+	"10minutemail.com":         true,
+	"10minutemail.net":         true,
+	"20minutemail.com":         true,
+	"33mail.com":               true,
+	"anonbox.net":              true,
+	"anonymbox.com":            true,
+	"burnermail.io":            true,
+	"byom.de":                  true,
+	"correotemporal.org":       true,
+	"crazymailing.com":         true,
+	"discard.email":            true,
+	"discardmail.com":          true,
+	"disposablemail.com":       true,
+	"dispostable.com":          true,
+	"dropmail.me":              true,
+	"email-temp.com":           true,
+	"emailfake.com":            true,
+	"emailondeck.com":          true,
+	"emltmp.com":               true,
+	"fakeinbox.com":            true,
+	"fakemail.fr":              true,
+	"fakemail.net":             true,
+	"fakemailgenerator.com":    true,
+	"getairmail.com":           true,
+	"getnada.com":              true,
+	"grr.la":                   true,
+	"guerrillamail.biz":        true,
+	"guerrillamail.com":        true,
+	"guerrillamail.de":         true,
+	"guerrillamail.info":       true,
+	"guerrillamail.net":        true,
+	"guerrillamail.org":        true,
+	"guerrillamail.pl":         true,
+	"guerrillamailblock.com":   true,
+	"harakirimail.com":         true,
+	"inboxbear.com":            true,
+	"inboxkitten.com":          true,
+	"incognitomail.org":        true,
+	"jetable.org":              true,
+	"linshiyouxiang.net":       true,
+	"luxusmail.org":            true,
+	"mail-temp.com":            true,
+	"mail.tm":                  true,
+	"mailcatch.com":            true,
+	"maildrop.cc":              true,
+	"mailforspam.com":          true,
+	"mailinator.com":           true,
+	"mailinator.net":           true,
+	"mailinator2.com":          true,
+	"mailnesia.com":            true,
+	"mailnull.com":             true,
+	"mailpoof.com":             true,
+	"mailsac.com":              true,
+	"mintemail.com":            true,
+	"moakt.com":                true,
+	"mohmal.com":               true,
+	"mytemp.email":             true,
+	"mytrashmail.com":          true,
+	"nada.email":               true,
+	"no-spam.ws":               true,
+	"nowmymail.com":            true,
+	"owlymail.com":             true,
+	"pokemail.net":             true,
+	"sharklasers.com":          true,
+	"spam4.me":                 true,
+	"spambog.com":              true,
+	"spambox.us":               true,
+	"spamdecoy.net":            true,
+	"spamex.com":               true,
+	"spamgourmet.com":          true,
+	"spamthisplease.com":       true,
+	"temp-mail.io":             true,
+	"temp-mail.org":            true,
+	"tempail.com":              true,
+	"tempemail.co":             true,
+	"tempinbox.com":            true,
+	"tempmail.dev":             true,
+	"tempmail.net":             true,
+	"tempmailaddress.com":      true,
+	"tempmailo.com":            true,
+	"tempr.email":              true,
+	"thisisnotmyrealemail.com": true,
+	"throwawaymail.com":        true,
+	"tmail.ws":                 true,
+	"tmails.net":               true,
+	"tmpmail.net":              true,
+	"tmpmail.org":              true,
+	"trash-mail.com":           true,
+	"trashmail.com":            true,
+	"trashmail.de":             true,
+	"trashmail.net":            true,
+	"trbvm.com":                true,
+	"wegwerfmail.de":           true,
+	"yopmail.com":              true,
+	"yopmail.fr":               true,
+	"yopmail.net":              true,
+	"zetmail.com":              true,
+}
+
+// aliasDomains ignore dots in the local part, so j.doe and jdoe are the
+// same inbox
+var aliasDomains = map[string]string{
+	"gmail.com":      "gmail.com",
+	"googlemail.com": "gmail.com",
+}
@@ -0,0 +1,224 @@
+package riskservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/email"
+	"campaign/internal/models"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// DefaultHoldAbove holds claims scoring above it for review when the
+	// campaign sets no threshold
+	DefaultHoldAbove = 50
+
+	MaxScore = 100
+
+	// PrefixHidden is how many trailing digits of an msisdn are dropped to
+	// get its prefix, numbers bought in bulk tend to be consecutive
+	PrefixHidden = 4
+)
+
+// velocity scores a count of recent claims sharing a value: the highest
+// tier reached applies
+type velocity struct {
+	Signal string
+	Field  string
+	Window time.Duration
+	Tiers  []tier
+}
+
+type tier struct {
+	Count int64
+	Score int
+}
+
+var velocities = []velocity{
+	{Signal: models.RiskIPVelocity, Field: "ip", Window: time.Hour, Tiers: []tier{{5, 20}, {20, 40}}},
+	{Signal: models.RiskDeviceVelocity, Field: "device_id", Window: 24 * time.Hour, Tiers: []tier{{1, 30}, {5, 50}}},
+	{Signal: models.RiskPrefixVelocity, Field: "msisdn_prefix", Window: time.Hour, Tiers: []tier{{10, 25}}},
+}
+
+const (
+	disposableScore = 30
+	duplicateScore  = 35
+)
+
+// HoldAbove is the score above which claims on c are held for review
+func HoldAbove(c models.Campaign) int {
+	if c.Claims != nil && c.Claims.HoldAbove > 0 {
+		return c.Claims.HoldAbove
+	}
+
+	return DefaultHoldAbove
+}
+
+// Disposable reports whether address is at a throwaway inbox provider
+func Disposable(address string) bool {
+	domain := email.Domain(address)
+
+	for domain != "" {
+		if disposableDomains[domain] {
+			return true
+		}
+
+		_, parent, found := strings.Cut(domain, ".")
+
+		if !found {
+			break
+		}
+
+		domain = parent
+	}
+
+	return false
+}
+
+// EmailKey is the inbox behind address: lower cased, without a +tag and
+// without dots for providers that ignore them. Two addresses with the same
+// key reach the same person.
+func EmailKey(address string) string {
+	local, domain, found := strings.Cut(strings.ToLower(strings.TrimSpace(address)), "@")
+
+	if !found || local == "" || domain == "" {
+		return ""
+	}
+
+	local, _, _ = strings.Cut(local, "+")
+
+	if canonical, ok := aliasDomains[domain]; ok {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = canonical
+	}
+
+	return local + "@" + domain
+}
+
+// MsisdnPrefix is msisdn without its last PrefixHidden digits
+func MsisdnPrefix(msisdn string) string {
+	if len(msisdn) <= PrefixHidden {
+		return ""
+	}
+
+	return msisdn[:len(msisdn)-PrefixHidden]
+}
+
+// Assess scores claim against the other claims on its campaign. The counts
+// include claims still being processed so a burst is caught as it happens.
+func Assess(db database.Database, claim models.Claim, now time.Time) (models.Risk, error) {
+	risk := models.Risk{Signals: []models.RiskSignal{}}
+	self, _ := primitive.ObjectIDFromHex(claim.ID)
+
+	values := map[string]string{
+		"ip":            claim.IP,
+		"device_id":     claim.DeviceID,
+		"msisdn_prefix": claim.MsisdnPrefix,
+	}
+
+	db.SetCollection(models.ClaimsCollection)
+
+	for _, v := range velocities {
+		if values[v.Field] == "" {
+			continue
+		}
+
+		n, err := db.CountDocuments(bson.M{
+			"campaign_id": claim.CampaignID,
+			"_id":         bson.M{"$ne": self},
+			v.Field:       values[v.Field],
+			"created_at":  bson.M{"$gte": now.Add(-v.Window)},
+		})
+
+		if err != nil {
+			return risk, err
+		}
+
+		if score := v.score(n); score > 0 {
+			risk.Signals = append(risk.Signals, models.RiskSignal{
+				Type:   v.Signal,
+				Score:  score,
+				Detail: fmt.Sprintf("%d other claim(s) from this %s in the last %s", n, strings.ReplaceAll(v.Field, "_", " "), v.Window),
+			})
+		}
+	}
+
+	if claim.Email != "" && Disposable(claim.Email) {
+		risk.Signals = append(risk.Signals, models.RiskSignal{
+			Type:   models.RiskDisposableEmail,
+			Score:  disposableScore,
+			Detail: email.Domain(claim.Email) + " is a disposable email provider",
+		})
+	}
+
+	duplicates, err := duplicates(db, claim, self)
+
+	if err != nil {
+		return risk, err
+	}
+
+	if duplicates > 0 {
+		risk.Signals = append(risk.Signals, models.RiskSignal{
+			Type:   models.RiskDuplicateIdentity,
+			Score:  duplicateScore,
+			Detail: fmt.Sprintf("%d other claim(s) share this device or inbox under another msisdn or email", duplicates),
+		})
+	}
+
+	for _, s := range risk.Signals {
+		risk.Score += s.Score
+	}
+
+	risk.Score = min(risk.Score, MaxScore)
+
+	return risk, nil
+}
+
+func (v velocity) score(n int64) int {
+	score := 0
+
+	for _, t := range v.Tiers {
+		if n >= t.Count {
+			score = t.Score
+		}
+	}
+
+	return score
+}
+
+// duplicates counts claims on the campaign that came from the same device
+// or inbox as claim but under another msisdn or email, the same person
+// claiming as several people
+func duplicates(db database.Database, claim models.Claim, self primitive.ObjectID) (int64, error) {
+	same := bson.A{}
+
+	if claim.DeviceID != "" {
+		same = append(same, bson.M{"device_id": claim.DeviceID})
+	}
+
+	if claim.EmailKey != "" {
+		same = append(same, bson.M{"email_key": claim.EmailKey})
+	}
+
+	if len(same) == 0 {
+		return 0, nil
+	}
+
+	db.SetCollection(models.ClaimsCollection)
+
+	return db.CountDocuments(bson.M{
+		"campaign_id": claim.CampaignID,
+		"_id":         bson.M{"$ne": self},
+		"$and": bson.A{
+			bson.M{"$or": same},
+			bson.M{"$or": bson.A{
+				bson.M{"msisdn": bson.M{"$ne": claim.Msisdn}},
+				bson.M{"email": bson.M{"$ne": claim.Email}},
+			}},
+		},
+	})
+}
@@ -0,0 +1,70 @@
+package riskservice
+
+import (
+	"campaign/internal/models"
+	"testing"
+)
+
+func TestDisposable(t *testing.T) {
+	cases := map[string]bool{
+		"ama@mailinator.com":         true,
+		"ama@MAILINATOR.com":         true,
+		"ama@inbox.mailinator.com":   true,
+		"ama@gmail.com":              false,
+		"ama@notmailinator.com":      false,
+		"ama@mailinator.com.example": false,
+		"not an email":               false,
+	}
+
+	for address, want := range cases {
+		if got := Disposable(address); got != want {
+			t.Errorf("expected Disposable(%q) to be %v", address, want)
+		}
+	}
+}
+
+func TestEmailKey(t *testing.T) {
+	cases := map[string]string{
+		"Ama.Mensah+promo@Gmail.com": "amamensah@gmail.com",
+		"ama.mensah@googlemail.com":  "amamensah@gmail.com",
+		"ama.mensah+x@example.com":   "ama.mensah@example.com",
+		"@example.com":               "",
+		"ama":                        "",
+	}
+
+	for address, want := range cases {
+		if got := EmailKey(address); got != want {
+			t.Errorf("expected EmailKey(%q) to be %q; got %q", address, want, got)
+		}
+	}
+}
+
+func TestMsisdnPrefix(t *testing.T) {
+	if prefix := MsisdnPrefix("233241234567"); prefix != "23324123" {
+		t.Errorf("expected the last %d digits to be dropped; got %q", PrefixHidden, prefix)
+	}
+
+	if prefix := MsisdnPrefix("1234"); prefix != "" {
+		t.Errorf("expected a number too short to have a prefix; got %q", prefix)
+	}
+}
+
+func TestVelocityScore(t *testing.T) {
+	v := velocity{Tiers: []tier{{5, 20}, {20, 40}}}
+
+	for n, want := range map[int64]int{0: 0, 4: 0, 5: 20, 19: 20, 20: 40, 100: 40} {
+		if got := v.score(n); got != want {
+			t.Errorf("expected %d claims to score %d; got %d", n, want, got)
+		}
+	}
+}
+
+func TestHoldAbove(t *testing.T) {
+	if hold := HoldAbove(models.Campaign{}); hold != DefaultHoldAbove {
+		t.Errorf("expected the default threshold; got %d", hold)
+	}
+
+	if hold := HoldAbove(models.Campaign{Claims: &models.ClaimSettings{HoldAbove: 70}}); hold != 70 {
+		t.Errorf("expected the campaign's threshold; got %d", hold)
+	}
+}
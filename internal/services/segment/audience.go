@@ -0,0 +1,129 @@
+package segmentservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AudienceFilter builds the contacts query for a campaign audience, the union
+// of its lists and segments. It returns nil when the campaign has neither.
+func AudienceFilter(db database.Database, c models.Campaign, now time.Time) (bson.M, error) {
+	clauses := bson.A{}
+
+	if len(c.AudienceListIDs) > 0 {
+		clauses = append(clauses, bson.M{"list_ids": bson.M{"$in": c.AudienceListIDs}})
+	}
+
+	if len(c.AudienceSegmentIDs) > 0 {
+		ids := []primitive.ObjectID{}
+
+		for _, id := range c.AudienceSegmentIDs {
+			if objid, err := primitive.ObjectIDFromHex(id); err == nil {
+				ids = append(ids, objid)
+			}
+		}
+
+		segments := []models.Segment{}
+
+		db.SetCollection(models.SegmentsCollection)
+
+		err := db.FindMany(bson.M{"_id": bson.M{"$in": ids}, "created_by": c.CreatedBy}, &segments)
+
+		if err != nil {
+			slog.Error("Error getting audience segments", "error", err)
+
+			return nil, errors.New("error resolving audience")
+		}
+
+		for _, sg := range segments {
+			query, err := Compile(sg.Rule, now)
+
+			if err != nil {
+				slog.Error("Error compiling segment rule", "segment", sg.ID, "error", err)
+
+				return nil, err
+			}
+
+			clauses = append(clauses, query)
+		}
+	}
+
+	if len(clauses) == 0 {
+		return nil, nil
+	}
+
+	return bson.M{"created_by": c.CreatedBy, "$or": clauses}, nil
+}
+
+// SnapshotAudience copies the contacts the campaign audience resolves to at
+// now into audience_members so later sends are not affected by list edits or
+// contacts moving in and out of segments. It is a no-op once taken.
+func SnapshotAudience(db database.Database, c models.Campaign, now time.Time) (*models.AudienceSnapshot, error) {
+	if c.AudienceSnapshot != nil {
+		return c.AudienceSnapshot, nil
+	}
+
+	snapshot := &models.AudienceSnapshot{TakenAt: now.Local()}
+
+	filter, err := AudienceFilter(db, c, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if filter != nil {
+		db.SetCollection(models.ContactsCollection)
+
+		err = db.AggregateMany([]bson.M{
+			{"$match": filter},
+			{"$project": bson.M{
+				"_id":         0,
+				"campaign_id": c.ID,
+				"contact_id":  bson.M{"$toString": "$_id"},
+				"created_at":  snapshot.TakenAt,
+			}},
+			{"$merge": bson.M{
+				"into":           string(models.AudienceMembersCollection),
+				"on":             bson.A{"campaign_id", "contact_id"},
+				"whenMatched":    "keepExisting",
+				"whenNotMatched": "insert",
+			}},
+		}, &[]bson.M{})
+
+		if err != nil {
+			slog.Error("Error snapshotting audience", "campaign", c.ID, "error", err)
+
+			return nil, errors.New("error snapshotting audience")
+		}
+
+		db.SetCollection(models.AudienceMembersCollection)
+
+		snapshot.ContactCount, err = db.CountDocuments(bson.M{"campaign_id": c.ID})
+
+		if err != nil {
+			slog.Error("Error counting audience snapshot", "campaign", c.ID, "error", err)
+
+			return nil, errors.New("error snapshotting audience")
+		}
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(c.ID)
+
+	db.SetCollection(models.CampaignsCollection)
+
+	err = db.UpdateOne(bson.M{"_id": objid}, bson.M{"audience_snapshot": snapshot})
+
+	if err != nil {
+		slog.Error("Error saving audience snapshot", "campaign", c.ID, "error", err)
+
+		return nil, errors.New("error snapshotting audience")
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,251 @@
+package segmentservice
+
+import (
+	"campaign/internal/models"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// MaxRuleDepth and MaxRuleConditions bound the size of a compiled query
+	MaxRuleDepth      = 5
+	MaxRuleConditions = 50
+)
+
+var fieldPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+var relativePattern = regexp.MustCompile(`^(\d{1,4})\s*([hdwmy])(\s+ago)?$`)
+
+// contactFields maps rule fields to contact document paths
+var contactFields = map[string]string{
+	"name":          "name",
+	"email":         "email",
+	"msisdn":        "msisdn",
+	"list":          "list_ids",
+	"email_consent": "consent.email",
+	"sms_consent":   "consent.sms",
+	"created_at":    "created_at",
+	"updated_at":    "updated_at",
+}
+
+// operators maps the accepted operator spellings to their canonical name
+var operators = map[string]string{
+	"eq": "eq", "=": "eq",
+	"neq": "neq", "!=": "neq",
+	"gt": "gt", ">": "gt",
+	"gte": "gte", ">=": "gte",
+	"lt": "lt", "<": "lt",
+	"lte": "lte", "<=": "lte",
+	"in":       "in",
+	"nin":      "nin",
+	"contains": "contains",
+	"exists":   "exists",
+}
+
+// fieldPath resolves a rule field to a document path. Unknown fields ending
+// in _at are activity timestamps e.g. last_claim_at, anything else is a
+// contact attribute e.g. country. Both may also be given with their prefix.
+func fieldPath(field string) (path string, isDate bool, err error) {
+	if path, ok := contactFields[field]; ok {
+		return path, strings.HasSuffix(field, "_at"), nil
+	}
+
+	prefix, name, found := strings.Cut(field, ".")
+
+	if !found {
+		name = field
+		prefix = "attributes"
+
+		if strings.HasSuffix(field, "_at") {
+			prefix = "activity"
+		}
+	}
+
+	if (prefix != "attributes" && prefix != "activity") || !fieldPattern.MatchString(name) {
+		return "", false, fmt.Errorf("%w: unknown field %q", ErrInvalid, field)
+	}
+
+	return prefix + "." + name, prefix == "activity", nil
+}
+
+// parseTime reads an absolute date or a relative one like "30d ago",
+// relative units are h, d, w, m (30 days) and y (365 days).
+func parseTime(value interface{}, now time.Time) (time.Time, error) {
+	s, ok := value.(string)
+
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: date values must be strings", ErrInvalid)
+	}
+
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if m := relativePattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+
+		unit := map[string]time.Duration{
+			"h": time.Hour,
+			"d": 24 * time.Hour,
+			"w": 7 * 24 * time.Hour,
+			"m": 30 * 24 * time.Hour,
+			"y": 365 * 24 * time.Hour,
+		}[m[2]]
+
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: invalid date %q, use YYYY-MM-DD, RFC 3339 or a relative value like 30d ago", ErrInvalid, s)
+}
+
+// Compile turns a rule tree into a contacts query. Relative dates are
+// resolved against now so the same rule matches a moving window.
+func Compile(rule models.SegmentRule, now time.Time) (bson.M, error) {
+	conditions := 0
+
+	return compile(rule, now, 1, &conditions)
+}
+
+func compile(rule models.SegmentRule, now time.Time, depth int, conditions *int) (bson.M, error) {
+	if depth > MaxRuleDepth {
+		return nil, fmt.Errorf("%w: rules must not be nested more than %d levels", ErrInvalid, MaxRuleDepth)
+	}
+
+	if rule.Combinator != "" || len(rule.Rules) > 0 {
+		return compileGroup(rule, now, depth, conditions)
+	}
+
+	*conditions++
+
+	if *conditions > MaxRuleConditions {
+		return nil, fmt.Errorf("%w: a segment must not have more than %d conditions", ErrInvalid, MaxRuleConditions)
+	}
+
+	return compileCondition(rule, now)
+}
+
+func compileGroup(rule models.SegmentRule, now time.Time, depth int, conditions *int) (bson.M, error) {
+	combinator := strings.ToLower(rule.Combinator)
+
+	if combinator == "" {
+		combinator = "and"
+	}
+
+	if combinator != "and" && combinator != "or" {
+		return nil, fmt.Errorf("%w: combinator must be and or or", ErrInvalid)
+	}
+
+	if len(rule.Rules) == 0 {
+		return nil, fmt.Errorf("%w: a rule group must have at least one rule", ErrInvalid)
+	}
+
+	clauses := bson.A{}
+
+	for _, r := range rule.Rules {
+		clause, err := compile(r, now, depth+1, conditions)
+
+		if err != nil {
+			return nil, err
+		}
+
+		clauses = append(clauses, clause)
+	}
+
+	return bson.M{"$" + combinator: clauses}, nil
+}
+
+func compileCondition(rule models.SegmentRule, now time.Time) (bson.M, error) {
+	path, isDate, err := fieldPath(rule.Field)
+
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := operators[strings.ToLower(rule.Operator)]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown operator %q on %s", ErrInvalid, rule.Operator, rule.Field)
+	}
+
+	switch op {
+	case "exists":
+		exists, ok := rule.Value.(bool)
+
+		if !ok {
+			return nil, fmt.Errorf("%w: exists takes true or false", ErrInvalid)
+		}
+
+		return bson.M{path: bson.M{"$exists": exists}}, nil
+	case "contains":
+		s, ok := rule.Value.(string)
+
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%w: contains takes a non empty string", ErrInvalid)
+		}
+
+		return bson.M{path: primitive.Regex{Pattern: regexp.QuoteMeta(s), Options: "i"}}, nil
+	case "in", "nin":
+		values, ok := rule.Value.([]interface{})
+
+		// rules read back from mongo hold arrays as primitive.A
+		if a, isA := rule.Value.(primitive.A); isA {
+			values, ok = a, true
+		}
+
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("%w: %s takes a non empty array", ErrInvalid, op)
+		}
+
+		resolved := bson.A{}
+
+		for _, v := range values {
+			v, err := conditionValue(v, isDate, now)
+
+			if err != nil {
+				return nil, err
+			}
+
+			resolved = append(resolved, v)
+		}
+
+		return bson.M{path: bson.M{"$" + op: resolved}}, nil
+	}
+
+	value, err := conditionValue(rule.Value, isDate, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "eq":
+		return bson.M{path: value}, nil
+	case "neq":
+		return bson.M{path: bson.M{"$ne": value}}, nil
+	}
+
+	return bson.M{path: bson.M{"$" + op: value}}, nil
+}
+
+func conditionValue(value interface{}, isDate bool, now time.Time) (interface{}, error) {
+	if isDate {
+		return parseTime(value, now)
+	}
+
+	switch v := value.(type) {
+	case string, bool, float64, int, int32, int64, nil:
+		return v, nil
+	}
+
+	return nil, fmt.Errorf("%w: values must be strings, numbers or booleans", ErrInvalid)
+}
@@ -0,0 +1,115 @@
+package segmentservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCompile(t *testing.T) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	// country = GH AND last_claim_at > 30d ago
+	rule := models.SegmentRule{
+		Combinator: "and",
+		Rules: []models.SegmentRule{
+			{Field: "country", Operator: "=", Value: "GH"},
+			{Field: "last_claim_at", Operator: ">", Value: "30d ago"},
+		},
+	}
+
+	got, err := Compile(rule, now)
+
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	want := bson.M{"$and": bson.A{
+		bson.M{"attributes.country": "GH"},
+		bson.M{"activity.last_claim_at": bson.M{"$gt": now.AddDate(0, 0, -30)}},
+	}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v; got %v", want, got)
+	}
+}
+
+func TestCompileConditions(t *testing.T) {
+	now := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule models.SegmentRule
+		want bson.M
+	}{
+		{
+			models.SegmentRule{Field: "sms_consent", Operator: "eq", Value: true},
+			bson.M{"consent.sms": true},
+		},
+		{
+			models.SegmentRule{Field: "list", Operator: "in", Value: primitive.A{"a", "b"}},
+			bson.M{"list_ids": bson.M{"$in": bson.A{"a", "b"}}},
+		},
+		{
+			models.SegmentRule{Field: "attributes.city", Operator: "contains", Value: "ac.c"},
+			bson.M{"attributes.city": primitive.Regex{Pattern: `ac\.c`, Options: "i"}},
+		},
+		{
+			models.SegmentRule{Field: "created_at", Operator: "lt", Value: "2024-01-01"},
+			bson.M{"created_at": bson.M{"$lt": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		},
+		{
+			models.SegmentRule{Combinator: "or", Rules: []models.SegmentRule{
+				{Field: "email", Operator: "exists", Value: true},
+				{Field: "age", Operator: ">=", Value: float64(18)},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"email": bson.M{"$exists": true}},
+				bson.M{"attributes.age": bson.M{"$gte": float64(18)}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Compile(tt.rule, now)
+
+		if err != nil {
+			t.Errorf("expected no error for %+v; got %v", tt.rule, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expected %v; got %v", tt.want, got)
+		}
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	nested := models.SegmentRule{Field: "country", Operator: "eq", Value: "GH"}
+
+	for i := 0; i < MaxRuleDepth; i++ {
+		nested = models.SegmentRule{Combinator: "and", Rules: []models.SegmentRule{nested}}
+	}
+
+	tests := []models.SegmentRule{
+		{},
+		{Combinator: "xor", Rules: []models.SegmentRule{{Field: "country", Operator: "eq", Value: "GH"}}},
+		{Field: "$where", Operator: "eq", Value: "1"},
+		{Field: "password.hash", Operator: "eq", Value: "1"},
+		{Field: "country", Operator: "regex", Value: ".*"},
+		{Field: "country", Operator: "eq", Value: map[string]interface{}{"$ne": nil}},
+		{Field: "last_claim_at", Operator: "gt", Value: "last tuesday"},
+		{Field: "list", Operator: "in", Value: "a"},
+		nested,
+	}
+
+	for _, tt := range tests {
+		if _, err := Compile(tt, time.Now()); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected invalid error for %+v; got %v", tt, err)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package segmentservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultSampleSize = 10
+	MaxSampleSize     = 100
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+// Preview is the audience a rule resolves to right now
+type Preview struct {
+	Count  int64            `json:"count"`
+	Sample []models.Contact `json:"sample"`
+	Query  bson.M           `json:"query"`
+}
+
+type Service interface {
+	CreateSegment(sg models.Segment) (models.Segment, error)
+	GetSegments() ([]models.Segment, error)
+	GetSegmentByID(id string) (models.Segment, error)
+	UpdateSegment(id string, sg models.Segment) error
+	DeleteSegment(id string) error
+	Preview(rule models.SegmentRule, sampleSize int) (Preview, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+func validateSegment(sg models.Segment) error {
+	if strings.TrimSpace(sg.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+
+	_, err := Compile(sg.Rule, time.Now())
+
+	return err
+}
+
+func (s *service) CreateSegment(sg models.Segment) (models.Segment, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return sg, errors.New("error creating segment")
+	}
+
+	if err := validateSegment(sg); err != nil {
+		return sg, err
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.SegmentsCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":         objid,
+		"name":        strings.TrimSpace(sg.Name),
+		"description": sg.Description,
+		"rule":        sg.Rule,
+		"created_by":  user.Sub,
+		"created_at":  now,
+		"updated_at":  now,
+	})
+
+	if err != nil {
+		slog.Error("Error creating segment", "error", err)
+
+		return sg, errors.New("error creating segment")
+	}
+
+	sg.ID = objid.Hex()
+	sg.Name = strings.TrimSpace(sg.Name)
+	sg.CreatedBy = user.Sub
+	sg.CreatedAt = now
+	sg.UpdatedAt = now
+
+	return sg, nil
+}
+
+func (s *service) GetSegments() ([]models.Segment, error) {
+	segments := []models.Segment{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return segments, errors.New("error getting segments")
+	}
+
+	s.db.SetCollection(models.SegmentsCollection)
+
+	err = s.db.FindMany(bson.M{"created_by": user.Sub}, &segments)
+
+	if err != nil {
+		slog.Error("Error getting segments", "error", err)
+
+		return segments, errors.New("error getting segments")
+	}
+
+	return segments, nil
+}
+
+// GetSegmentByID also counts the contacts currently in the segment
+func (s *service) GetSegmentByID(id string) (models.Segment, error) {
+	segment := models.Segment{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return segment, errors.New("error getting segment")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return segment, fmt.Errorf("%w: invalid segment id: %s", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.SegmentsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &segment)
+
+	if err != nil {
+		slog.Error("Error getting segment", "error", err)
+
+		return segment, fmt.Errorf("%w: no segments with id: %s found", ErrNotFound, id)
+	}
+
+	query, err := Compile(segment.Rule, time.Now())
+
+	if err != nil {
+		slog.Error("Error compiling segment rule", "error", err)
+
+		return segment, nil
+	}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	segment.ContactCount, err = s.db.CountDocuments(bson.M{"$and": bson.A{bson.M{"created_by": user.Sub}, query}})
+
+	if err != nil {
+		slog.Error("Error counting segment contacts", "error", err)
+	}
+
+	return segment, nil
+}
+
+func (s *service) UpdateSegment(id string, sg models.Segment) error {
+	existing, err := s.GetSegmentByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := validateSegment(sg); err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	s.db.SetCollection(models.SegmentsCollection)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": existing.CreatedBy}, bson.M{
+		"name":        strings.TrimSpace(sg.Name),
+		"description": sg.Description,
+		"rule":        sg.Rule,
+		"updated_at":  time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error updating segment", "error", err)
+
+		return fmt.Errorf("could not update segment with id: %s", id)
+	}
+
+	return nil
+}
+
+// DeleteSegment also removes the segment from campaign audiences.
+// Audiences already snapshotted are not affected.
+func (s *service) DeleteSegment(id string) error {
+	existing, err := s.GetSegmentByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	s.db.SetCollection(models.SegmentsCollection)
+
+	err = s.db.DeleteOne(bson.M{"_id": objid, "created_by": existing.CreatedBy})
+
+	if err != nil {
+		slog.Error("Error deleting segment", "error", err)
+
+		return fmt.Errorf("could not delete segment with id: %s", id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.UpdateManyRaw(bson.M{"created_by": existing.CreatedBy, "audience_segment_ids": id}, bson.M{
+		"$pull": bson.M{"audience_segment_ids": id},
+	})
+
+	if err != nil {
+		slog.Error("Error removing segment from campaign audiences", "error", err)
+	}
+
+	return nil
+}
+
+// Preview resolves rule without saving it, returning the matching count,
+// a sample of contacts and the compiled query.
+func (s *service) Preview(rule models.SegmentRule, sampleSize int) (Preview, error) {
+	preview := Preview{Sample: []models.Contact{}}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return preview, errors.New("error previewing segment")
+	}
+
+	query, err := Compile(rule, time.Now())
+
+	if err != nil {
+		return preview, err
+	}
+
+	if sampleSize < 1 {
+		sampleSize = DefaultSampleSize
+	}
+
+	sampleSize = min(sampleSize, MaxSampleSize)
+
+	filter := bson.M{"$and": bson.A{bson.M{"created_by": user.Sub}, query}}
+
+	s.db.SetCollection(models.ContactsCollection)
+
+	preview.Count, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting segment contacts", "error", err)
+
+		return preview, errors.New("error previewing segment")
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(sampleSize))
+
+	err = s.db.FindManyWithOptions(filter, opts, &preview.Sample)
+
+	if err != nil {
+		slog.Error("Error sampling segment contacts", "error", err)
+
+		return preview, errors.New("error previewing segment")
+	}
+
+	preview.Query = query
+
+	return preview, nil
+}
@@ -0,0 +1,373 @@
+package smsservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/queue"
+	"campaign/internal/sendwindow"
+	experimentservice "campaign/internal/services/experiment"
+	receiptservice "campaign/internal/services/receipt"
+	suppressionservice "campaign/internal/services/suppression"
+	templateservice "campaign/internal/services/template"
+	"campaign/internal/sms"
+	"campaign/internal/utils"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DispatchJob delivers one batch, its payload holds the batch_id
+const DispatchJob = "sms.dispatch"
+
+// Dispatcher delivers queued messages through a provider. Each message is
+// claimed atomically so several dispatchers can share a batch, failures that
+// are not permanent are re-queued with exponential backoff.
+type Dispatcher struct {
+	db       *mongo.Database
+	provider sms.SMSProvider
+
+	Workers     int
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// idle is how long a worker sleeps when every remaining message is waiting on a retry
+	idle time.Duration
+}
+
+func NewDispatcher(db *mongo.Database, provider sms.SMSProvider) *Dispatcher {
+	return &Dispatcher{
+		db:          db,
+		provider:    provider,
+		Workers:     4,
+		MaxAttempts: 5,
+		BaseBackoff: 30 * time.Second,
+		MaxBackoff:  30 * time.Minute,
+		idle:        time.Second,
+	}
+}
+
+// Handle runs a DispatchJob. Messages left sending by an earlier run of the
+// job were interrupted, they are queued again and may be sent twice.
+func (d *Dispatcher) Handle(ctx context.Context, job models.Job) error {
+	batchID, _ := job.Payload["batch_id"].(string)
+
+	if batchID == "" {
+		return queue.Permanent(errors.New("batch_id is required"))
+	}
+
+	dbM := database.NewDatabaseService(ctx, d.db, models.SMSMessagesCollection)
+
+	err := dbM.UpdateManyRaw(bson.M{"batch_id": batchID, "status": models.SMSStatusSending}, bson.M{
+		"$set": bson.M{"status": models.SMSStatusQueued, "updated_at": time.Now().Local()},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := d.Run(ctx, batchID); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return d.resume(ctx, batchID)
+}
+
+// Run delivers the batch and returns once no message in it is due before
+// MaxBackoff has passed, messages deferred past that are left to resume
+func (d *Dispatcher) Run(ctx context.Context, batchID string) error {
+	campaign, err := d.campaign(ctx, batchID)
+
+	if err != nil {
+		slog.Error("Error getting campaign", "batch", batchID, "error", err)
+
+		return err
+	}
+
+	renderer := templateservice.NewRenderer(d.db)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < d.Workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			d.work(ctx, batchID, campaign, renderer)
+		}()
+	}
+
+	wg.Wait()
+
+	slog.Info("SMS batch dispatched", "batch", batchID)
+
+	return nil
+}
+
+// campaign is the campaign the batch belongs to, its send window and
+// experiment are read once per run so a change applies from the next one
+func (d *Dispatcher) campaign(ctx context.Context, batchID string) (models.Campaign, error) {
+	message := models.SMSMessage{}
+	dbM := database.NewDatabaseService(ctx, d.db, models.SMSMessagesCollection)
+
+	err := dbM.FindOne(bson.M{"batch_id": batchID}, &message)
+
+	campaign := models.Campaign{}
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return campaign, nil
+	}
+
+	if err != nil {
+		return campaign, err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(message.CampaignID)
+
+	dbM.SetCollection(models.CampaignsCollection)
+
+	err = dbM.FindOne(bson.M{"_id": objid}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.Campaign{}, nil
+	}
+
+	return campaign, err
+}
+
+// resume queues another DispatchJob for when the earliest message left in
+// the batch is due, rather than holding a worker until a window opens
+func (d *Dispatcher) resume(ctx context.Context, batchID string) error {
+	pending := []models.SMSMessage{}
+	dbM := database.NewDatabaseService(ctx, d.db, models.SMSMessagesCollection)
+
+	err := dbM.FindManyWithOptions(bson.M{
+		"batch_id": batchID,
+		"status":   bson.M{"$in": bson.A{models.SMSStatusQueued, models.SMSStatusDeferred}},
+	}, options.Find().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetLimit(1), &pending)
+
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+
+	message := pending[0]
+
+	job, err := queue.New(d.db).Enqueue(ctx, DispatchJob, map[string]interface{}{"batch_id": batchID}, queue.Options{
+		RunAt:     message.NextAttemptAt,
+		CreatedBy: message.CreatedBy,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("SMS batch resumes later", "batch", batchID, "job", job.ID, "at", job.RunAt)
+
+	return nil
+}
+
+func (d *Dispatcher) work(ctx context.Context, batchID string, campaign models.Campaign, renderer *templateservice.Renderer) {
+	dbM := database.NewDatabaseService(ctx, d.db, models.SMSMessagesCollection)
+
+	for ctx.Err() == nil {
+		claimed, err := d.next(ctx, dbM, batchID, campaign, renderer)
+
+		if err != nil {
+			slog.Error("Error dispatching sms", "batch", batchID, "error", err)
+		}
+
+		if claimed {
+			continue
+		}
+
+		dbM.SetCollection(models.SMSMessagesCollection)
+
+		pending, err := dbM.CountDocuments(bson.M{
+			"batch_id":        batchID,
+			"status":          bson.M{"$in": bson.A{models.SMSStatusQueued, models.SMSStatusDeferred}},
+			"next_attempt_at": bson.M{"$lte": time.Now().Add(d.MaxBackoff).Local()},
+		})
+
+		if err != nil || pending == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(d.idle):
+		}
+	}
+}
+
+// next claims and sends one due message, it reports false when none was due
+func (d *Dispatcher) next(ctx context.Context, dbM database.Database, batchID string, campaign models.Campaign, renderer *templateservice.Renderer) (bool, error) {
+	message := models.SMSMessage{}
+	now := time.Now().Local()
+
+	dbM.SetCollection(models.SMSMessagesCollection)
+
+	err := dbM.FindOneAndUpdate(bson.M{
+		"batch_id":        batchID,
+		"status":          bson.M{"$in": bson.A{models.SMSStatusQueued, models.SMSStatusDeferred}},
+		"next_attempt_at": bson.M{"$lte": now},
+	}, bson.M{
+		"$set": bson.M{"status": models.SMSStatusSending, "provider": d.provider.Name(), "updated_at": now},
+		"$inc": bson.M{"attempts": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After), &message)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	update := bson.M{"updated_at": time.Now().Local()}
+	result := sms.Result{}
+
+	// the number may have opted out since the batch was queued, a failed
+	// lookup is retried like a failed send
+	suppressed, err := suppressionservice.IsSuppressed(dbM, message.CreatedBy, models.ChannelSMS, message.To)
+
+	if suppressed {
+		return true, d.skip(message.ID)
+	}
+
+	loc := sendwindow.Location(campaign.SendWindow, message.TimeZone, message.To)
+
+	if at := sendwindow.Next(campaign.SendWindow, loc, now); at.After(now) {
+		return true, d.postpone(message.ID, at)
+	}
+
+	vary(campaign, &message, update)
+
+	if err == nil && message.TemplateID != "" {
+		err = d.render(ctx, renderer, &message, update)
+	}
+
+	if err == nil {
+		result, err = d.provider.Send(ctx, sms.Message{To: message.To, From: message.From, Body: message.Body})
+	}
+
+	switch {
+	case err == nil:
+		sentAt := time.Now().Local()
+
+		update["status"] = models.SMSStatusSent
+		update["provider_message_id"] = result.ProviderMessageID
+		update["sent_at"] = sentAt
+		update["last_error"] = ""
+	case sms.IsPermanent(err) || message.Attempts >= d.MaxAttempts:
+		update["status"] = models.SMSStatusFailed
+		update["last_error"] = err.Error()
+	default:
+		update["status"] = models.SMSStatusQueued
+		update["last_error"] = err.Error()
+		update["next_attempt_at"] = time.Now().Add(utils.Backoff(message.Attempts, d.BaseBackoff, d.MaxBackoff)).Local()
+	}
+
+	// the send already happened, record it even if the batch was cancelled
+	record := database.NewDatabaseService(context.Background(), d.db, models.SMSMessagesCollection)
+
+	objid, _ := primitive.ObjectIDFromHex(message.ID)
+
+	if err := record.UpdateOne(bson.M{"_id": objid}, update); err != nil {
+		return true, err
+	}
+
+	// a fast provider may have called back before the send was recorded
+	if err == nil {
+		if err := receiptservice.ApplyPending(record, models.ChannelSMS, d.provider.Name(), result.ProviderMessageID); err != nil {
+			slog.Error("Error applying pending receipts", "message", message.ID, "error", err)
+		}
+	}
+
+	return true, nil
+}
+
+// skip marks a message to a suppressed number as never to be sent
+func (d *Dispatcher) skip(id string) error {
+	record := database.NewDatabaseService(context.Background(), d.db, models.SMSMessagesCollection)
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	return record.UpdateOne(bson.M{"_id": objid}, bson.M{
+		"status":     models.SMSStatusSuppressed,
+		"last_error": "recipient is suppressed",
+		"updated_at": time.Now().Local(),
+	})
+}
+
+// postpone defers a message until the send window opens for its recipient,
+// the claim that found it outside the window is not an attempt
+func (d *Dispatcher) postpone(id string, at time.Time) error {
+	record := database.NewDatabaseService(context.Background(), d.db, models.SMSMessagesCollection)
+
+	objid, _ := primitive.ObjectIDFromHex(id)
+
+	return record.UpdateOneRaw(bson.M{"_id": objid}, bson.M{
+		"$set": bson.M{"status": models.SMSStatusDeferred, "next_attempt_at": at.Local(), "updated_at": time.Now().Local()},
+		"$inc": bson.M{"attempts": -1},
+	})
+}
+
+// vary gives the message the text of its contact's experiment variant, when
+// the variant has one it replaces the batch text or template
+func vary(campaign models.Campaign, message *models.SMSMessage, update bson.M) {
+	message.Variant = experimentservice.Assign(campaign, message.ContactID)
+
+	if message.Variant == "" {
+		return
+	}
+
+	update["variant"] = message.Variant
+
+	v, ok := experimentservice.Variant(campaign, message.Variant)
+
+	if !ok || v.SMSBody == "" {
+		return
+	}
+
+	message.Body = v.SMSBody
+	message.TemplateID = ""
+	message.Encoding, message.Segments = sms.Segments(message.Body)
+
+	update["body"] = message.Body
+	update["encoding"] = message.Encoding
+	update["segments"] = message.Segments
+}
+
+// render fills in the message template for its contact. A template that
+// fails to execute will not on retry either, lookups may.
+func (d *Dispatcher) render(ctx context.Context, renderer *templateservice.Renderer, message *models.SMSMessage, update bson.M) error {
+	rendered, err := renderer.Render(ctx, message.TemplateID, message.CampaignID, message.ContactID)
+
+	if errors.Is(err, templateservice.ErrInvalid) {
+		return errors.Join(sms.ErrPermanent, err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	message.Body = rendered.Body
+	message.Encoding, message.Segments = sms.Segments(message.Body)
+
+	update["body"] = message.Body
+	update["encoding"] = message.Encoding
+	update["segments"] = message.Segments
+
+	return nil
+}
@@ -0,0 +1,371 @@
+package spendservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrInvalidSpend     = errors.New("invalid spend entry")
+)
+
+type Service interface {
+	RecordSpend(campaignID string, e models.SpendEntry) (models.SpendEntry, []models.BudgetAlert, error)
+	GetSpend(campaignID string) ([]models.SpendEntry, error)
+	GetAlerts(campaignID string) ([]models.BudgetAlert, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// RecordSpend appends e to the ledger then checks the campaign budget. Alerts
+// for every threshold crossed are returned and the campaign is paused once the
+// total budget is used up.
+func (s *service) RecordSpend(campaignID string, e models.SpendEntry) (models.SpendEntry, []models.BudgetAlert, error) {
+	alerts := []models.BudgetAlert{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return e, alerts, err
+	}
+
+	if e.Amount == 0 {
+		return e, alerts, fmt.Errorf("%w: amount is required", ErrInvalidSpend)
+	}
+
+	e.Currency = strings.ToUpper(e.Currency)
+
+	if campaign.Budget != nil && campaign.Budget.Currency != "" {
+		if e.Currency == "" {
+			e.Currency = campaign.Budget.Currency
+		}
+
+		if e.Currency != campaign.Budget.Currency {
+			return e, alerts, fmt.Errorf("%w: currency must be %s", ErrInvalidSpend, campaign.Budget.Currency)
+		}
+	}
+
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+
+	objid := primitive.NewObjectID()
+
+	e.ID = objid.Hex()
+	e.CampaignID = campaignID
+	e.CreatedBy = campaign.CreatedBy
+	e.CreatedAt = time.Now().Local()
+	e.OccurredAt = e.OccurredAt.Local()
+
+	s.db.SetCollection(models.SpendCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":         objid,
+		"campaign_id": e.CampaignID,
+		"amount":      e.Amount,
+		"currency":    e.Currency,
+		"description": e.Description,
+		"occurred_at": e.OccurredAt,
+		"created_by":  e.CreatedBy,
+		"created_at":  e.CreatedAt,
+	})
+
+	if err != nil {
+		slog.Error("Error recording spend", "error", err)
+
+		return e, alerts, errors.New("error recording spend")
+	}
+
+	if campaign.Budget == nil || campaign.Budget.Total <= 0 {
+		return e, alerts, nil
+	}
+
+	summaries, err := Summarize(s.db, []models.Campaign{campaign})
+
+	if err != nil {
+		slog.Error("Error summarizing spend", "error", err)
+
+		return e, alerts, nil
+	}
+
+	alerts = s.checkBudget(campaign, summaries[campaignID])
+
+	return e, alerts, nil
+}
+
+// BudgetCheck is what a spend summary calls for: the alerts to raise and
+// whether the campaign is paused
+type BudgetCheck struct {
+	Alerts []models.BudgetAlert
+	Pause  bool
+}
+
+// CheckBudget decides the alerts and pause for spend on campaign c at now.
+// Every alert the spend is past is returned, each carries the fields its
+// unique index is on so one already raised is not stored again. Only an
+// active campaign is paused when its budget is used up.
+func CheckBudget(c models.Campaign, spend models.SpendSummary, now time.Time) BudgetCheck {
+	check := BudgetCheck{Alerts: []models.BudgetAlert{}}
+	budget := c.Budget
+
+	if budget == nil || budget.Total <= 0 {
+		return check
+	}
+
+	alert := func(alertType string, threshold int, spent int64, day string) models.BudgetAlert {
+		return models.BudgetAlert{
+			CampaignID:  c.ID,
+			Type:        alertType,
+			Threshold:   threshold,
+			BudgetTotal: budget.Total,
+			Spent:       spent,
+			Day:         day,
+			CreatedBy:   c.CreatedBy,
+		}
+	}
+
+	for _, threshold := range budget.AlertThresholds {
+		if spend.PercentUsed >= float64(threshold) {
+			check.Alerts = append(check.Alerts, alert(models.BudgetAlertThreshold, threshold, spend.Total, ""))
+		}
+	}
+
+	if budget.DailyCap > 0 && spend.Today >= budget.DailyCap {
+		check.Alerts = append(check.Alerts, alert(models.BudgetAlertDailyCap, 0, spend.Today, now.Local().Format("2006-01-02")))
+	}
+
+	if spend.Total < budget.Total {
+		return check
+	}
+
+	check.Alerts = append(check.Alerts, alert(models.BudgetAlertExhausted, 100, spend.Total, ""))
+	check.Pause = c.Status == models.CampaignStatusActive
+
+	return check
+}
+
+func (s *service) checkBudget(c models.Campaign, spend models.SpendSummary) []models.BudgetAlert {
+	alerts := []models.BudgetAlert{}
+	check := CheckBudget(c, spend, time.Now())
+
+	for _, alert := range check.Alerts {
+		if alert, ok := s.raiseAlert(alert); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+
+	if !check.Pause {
+		return alerts
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(c.ID)
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err := s.db.UpdateOne(bson.M{"_id": objid, "status": models.CampaignStatusActive}, bson.M{
+		"status":        models.CampaignStatusPaused,
+		"paused_reason": models.PausedReasonBudgetExhausted,
+		"updated_at":    time.Now().Local(),
+	})
+
+	if err != nil {
+		slog.Error("Error pausing campaign", "error", err, "campaign", c.ID)
+	}
+
+	return alerts
+}
+
+// raiseAlert stores an alert unless the same one was already raised
+func (s *service) raiseAlert(alert models.BudgetAlert) (models.BudgetAlert, bool) {
+	objid := primitive.NewObjectID()
+
+	alert.ID = objid.Hex()
+	alert.CreatedAt = time.Now().Local()
+
+	s.db.SetCollection(models.BudgetAlertsCollection)
+
+	err := s.db.InsertOne(bson.M{
+		"_id":          objid,
+		"campaign_id":  alert.CampaignID,
+		"type":         alert.Type,
+		"threshold":    alert.Threshold,
+		"budget_total": alert.BudgetTotal,
+		"spent":        alert.Spent,
+		"day":          alert.Day,
+		"created_by":   alert.CreatedBy,
+		"created_at":   alert.CreatedAt,
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return alert, false
+	}
+
+	if err != nil {
+		slog.Error("Error storing budget alert", "error", err)
+
+		return alert, false
+	}
+
+	slog.Warn("Campaign budget alert", "campaign", alert.CampaignID, "type", alert.Type, "threshold", alert.Threshold, "spent", alert.Spent, "budget", alert.BudgetTotal)
+
+	return alert, true
+}
+
+func (s *service) GetSpend(campaignID string) ([]models.SpendEntry, error) {
+	entries := []models.SpendEntry{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return entries, err
+	}
+
+	s.db.SetCollection(models.SpendCollection)
+
+	err = s.db.FindMany(bson.M{"campaign_id": campaign.ID}, &entries)
+
+	if err != nil {
+		slog.Error("Error getting spend", "error", err)
+
+		return entries, errors.New("error getting spend")
+	}
+
+	return entries, nil
+}
+
+func (s *service) GetAlerts(campaignID string) ([]models.BudgetAlert, error) {
+	alerts := []models.BudgetAlert{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return alerts, err
+	}
+
+	s.db.SetCollection(models.BudgetAlertsCollection)
+
+	err = s.db.FindMany(bson.M{"campaign_id": campaign.ID}, &alerts)
+
+	if err != nil {
+		slog.Error("Error getting budget alerts", "error", err)
+
+		return alerts, errors.New("error getting budget alerts")
+	}
+
+	return alerts, nil
+}
+
+func (s *service) findCampaign(id string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		slog.Error("Error converting id to object id", "error", err)
+
+		return campaign, fmt.Errorf("%w: invalid campaign id: %s", ErrCampaignNotFound, id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &campaign)
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrCampaignNotFound, id)
+	}
+
+	return campaign, nil
+}
+
+// Summarize aggregates the spend ledger for campaigns in a single query.
+// Campaigns without spend get a zero summary.
+func Summarize(db database.Database, campaigns []models.Campaign) (map[string]models.SpendSummary, error) {
+	summaries := map[string]models.SpendSummary{}
+
+	if len(campaigns) == 0 {
+		return summaries, nil
+	}
+
+	ids := make([]string, len(campaigns))
+
+	for i, c := range campaigns {
+		ids[i] = c.ID
+	}
+
+	now := time.Now().Local()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	result := []struct {
+		CampaignID string `bson:"_id"`
+		Total      int64  `bson:"total"`
+		Today      int64  `bson:"today"`
+	}{}
+
+	db.SetCollection(models.SpendCollection)
+
+	err := db.AggregateMany([]bson.M{
+		{"$match": bson.M{"campaign_id": bson.M{"$in": ids}}},
+		{"$group": bson.M{
+			"_id":   "$campaign_id",
+			"total": bson.M{"$sum": "$amount"},
+			"today": bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$gte": bson.A{"$occurred_at", startOfDay}}, "$amount", 0},
+			}},
+		}},
+	}, &result)
+
+	if err != nil {
+		return summaries, err
+	}
+
+	totals := map[string]models.SpendSummary{}
+
+	for _, r := range result {
+		totals[r.CampaignID] = models.SpendSummary{Total: r.Total, Today: r.Today}
+	}
+
+	for _, c := range campaigns {
+		summaries[c.ID] = Summary(c.Budget, totals[c.ID])
+	}
+
+	return summaries, nil
+}
+
+// Summary fills in what is left of budget and how much of it is used
+func Summary(budget *models.Budget, spend models.SpendSummary) models.SpendSummary {
+	if budget != nil && budget.Total > 0 {
+		spend.Remaining = max(budget.Total-spend.Total, 0)
+		spend.PercentUsed = float64(spend.Total) * 100 / float64(budget.Total)
+	}
+
+	return spend
+}
@@ -0,0 +1,120 @@
+package spendservice
+
+import (
+	"campaign/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSummary(t *testing.T) {
+	budget := &models.Budget{Total: 1000}
+
+	s := Summary(budget, models.SpendSummary{Total: 250, Today: 50})
+
+	if s.Remaining != 750 || s.PercentUsed != 25 || s.Today != 50 {
+		t.Errorf("expected 750 remaining at 25 percent; got %+v", s)
+	}
+
+	if s := Summary(budget, models.SpendSummary{Total: 1200}); s.Remaining != 0 || s.PercentUsed != 120 {
+		t.Errorf("expected nothing remaining at 120 percent; got %+v", s)
+	}
+
+	if s := Summary(nil, models.SpendSummary{Total: 1200}); s.Remaining != 0 || s.PercentUsed != 0 {
+		t.Errorf("expected no budget figures without a budget; got %+v", s)
+	}
+}
+
+// alertKey is what the campaign_alert unique index is on
+type alertKey struct {
+	Type        string
+	Threshold   int
+	BudgetTotal int64
+	Day         string
+}
+
+func keys(alerts []models.BudgetAlert) []alertKey {
+	k := []alertKey{}
+
+	for _, a := range alerts {
+		k = append(k, alertKey{a.Type, a.Threshold, a.BudgetTotal, a.Day})
+	}
+
+	return k
+}
+
+func TestCheckBudget(t *testing.T) {
+	now := time.Date(2024, 8, 11, 15, 0, 0, 0, time.Local)
+	budget := &models.Budget{Total: 1000, DailyCap: 200, AlertThresholds: []int{50, 80}}
+	active := models.Campaign{ID: "c1", Status: models.CampaignStatusActive, Budget: budget}
+
+	tests := map[string]struct {
+		campaign models.Campaign
+		total    int64
+		today    int64
+		alerts   []alertKey
+		pause    bool
+	}{
+		"under every threshold": {active, 490, 10, []alertKey{}, false},
+		"at the first threshold": {active, 500, 10, []alertKey{
+			{models.BudgetAlertThreshold, 50, 1000, ""},
+		}, false},
+		"past both thresholds": {active, 850, 10, []alertKey{
+			{models.BudgetAlertThreshold, 50, 1000, ""},
+			{models.BudgetAlertThreshold, 80, 1000, ""},
+		}, false},
+		"daily cap reached": {active, 300, 200, []alertKey{
+			{models.BudgetAlertDailyCap, 0, 1000, "2024-08-11"},
+		}, false},
+		"exhausted": {active, 1000, 10, []alertKey{
+			{models.BudgetAlertThreshold, 50, 1000, ""},
+			{models.BudgetAlertThreshold, 80, 1000, ""},
+			{models.BudgetAlertExhausted, 100, 1000, ""},
+		}, true},
+		"exhausted while paused": {models.Campaign{ID: "c1", Status: models.CampaignStatusPaused, Budget: budget}, 1200, 0, []alertKey{
+			{models.BudgetAlertThreshold, 50, 1000, ""},
+			{models.BudgetAlertThreshold, 80, 1000, ""},
+			{models.BudgetAlertExhausted, 100, 1000, ""},
+		}, false},
+		"no budget": {models.Campaign{ID: "c1", Status: models.CampaignStatusActive}, 5000, 5000, []alertKey{}, false},
+	}
+
+	for name, tt := range tests {
+		spend := Summary(tt.campaign.Budget, models.SpendSummary{Total: tt.total, Today: tt.today})
+		check := CheckBudget(tt.campaign, spend, now)
+
+		if got := keys(check.Alerts); !reflect.DeepEqual(got, tt.alerts) {
+			t.Errorf("%s: expected alerts %v; got %v", name, tt.alerts, got)
+		}
+
+		if check.Pause != tt.pause {
+			t.Errorf("%s: expected pause %v; got %v", name, tt.pause, check.Pause)
+		}
+	}
+}
+
+func TestCheckBudgetDeduplication(t *testing.T) {
+	now := time.Date(2024, 8, 11, 15, 0, 0, 0, time.Local)
+	c := models.Campaign{ID: "c1", Status: models.CampaignStatusActive, Budget: &models.Budget{Total: 1000, DailyCap: 100, AlertThresholds: []int{50}}}
+
+	first := keys(CheckBudget(c, Summary(c.Budget, models.SpendSummary{Total: 600, Today: 100}), now).Alerts)
+	again := keys(CheckBudget(c, Summary(c.Budget, models.SpendSummary{Total: 700, Today: 150}), now).Alerts)
+
+	// more spend past the same threshold on the same day is the same alert
+	if !reflect.DeepEqual(first, again) {
+		t.Errorf("expected the same alerts to be raised again and dropped by the index; got %v and %v", first, again)
+	}
+
+	tomorrow := keys(CheckBudget(c, Summary(c.Budget, models.SpendSummary{Total: 800, Today: 100}), now.AddDate(0, 0, 1)).Alerts)
+
+	if tomorrow[1].Day != "2024-08-12" || tomorrow[0] != first[0] {
+		t.Errorf("expected only the daily cap alert to fire again the next day; got %v", tomorrow)
+	}
+
+	c.Budget = &models.Budget{Total: 1100, AlertThresholds: []int{50}}
+	raised := keys(CheckBudget(c, Summary(c.Budget, models.SpendSummary{Total: 600}), now).Alerts)
+
+	if raised[0] == first[0] {
+		t.Errorf("expected a raised budget to re-arm the threshold alert; got %v", raised)
+	}
+}
@@ -0,0 +1,135 @@
+package suppressionservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	KeywordStop  = "stop"
+	KeywordStart = "start"
+	KeywordHelp  = "help"
+)
+
+// keywords maps the carrier standard opt-out, opt-in and help words
+var keywords = map[string]string{
+	"STOP":        KeywordStop,
+	"STOPALL":     KeywordStop,
+	"UNSUBSCRIBE": KeywordStop,
+	"CANCEL":      KeywordStop,
+	"END":         KeywordStop,
+	"QUIT":        KeywordStop,
+	"START":       KeywordStart,
+	"UNSTOP":      KeywordStart,
+	"YES":         KeywordStart,
+	"HELP":        KeywordHelp,
+	"INFO":        KeywordHelp,
+}
+
+var replies = map[string]string{
+	KeywordStop:  envOr("SMS_STOP_REPLY", "You have been unsubscribed and will receive no more messages. Reply START to resubscribe."),
+	KeywordStart: envOr("SMS_START_REPLY", "You have been resubscribed. Reply STOP to unsubscribe."),
+	KeywordHelp:  envOr("SMS_HELP_REPLY", "Reply STOP to unsubscribe or START to resubscribe."),
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+// Inbound is a text a provider received from a contact
+type Inbound struct {
+	MessageID string `json:"message_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Text      string `json:"text"`
+}
+
+// InboundResult tells what a text asked for. Reply is sent back to the
+// sender, Accounts counts the accounts that had texted the number.
+type InboundResult struct {
+	Keyword  string `json:"keyword,omitempty"`
+	Accounts int    `json:"accounts"`
+	Reply    string `json:"reply,omitempty"`
+}
+
+// Keyword returns the keyword text is, only a text that is nothing but the
+// keyword counts so a conversation mentioning "stop" is not an opt-out
+func Keyword(text string) string {
+	word := strings.ToUpper(strings.Trim(strings.TrimSpace(text), ".!"))
+
+	return keywords[word]
+}
+
+// HandleInbound acts on STOP, START and HELP texts. A number that opts out
+// is suppressed for every account that has texted it, as the sender can
+// not tell which of them a shared sender id belongs to.
+func HandleInbound(db database.Database, in Inbound) (InboundResult, error) {
+	result := InboundResult{Keyword: Keyword(in.Text)}
+
+	from := utils.NormalizeMsisdn(in.From)
+
+	if from == "" {
+		return result, fmt.Errorf("%w: from is required", ErrInvalid)
+	}
+
+	if result.Keyword == "" {
+		return result, nil
+	}
+
+	result.Reply = replies[result.Keyword]
+
+	if result.Keyword == KeywordHelp {
+		return result, nil
+	}
+
+	accounts := []struct {
+		CreatedBy string `bson:"_id"`
+	}{}
+
+	db.SetCollection(models.SMSMessagesCollection)
+
+	err := db.AggregateMany([]bson.M{
+		{"$match": bson.M{"to": from}},
+		{"$group": bson.M{"_id": "$created_by"}},
+	}, &accounts)
+
+	if err != nil {
+		slog.Error("Error getting accounts for inbound sms", "error", err)
+
+		return result, errors.New("error handling inbound message")
+	}
+
+	for _, a := range accounts {
+		if result.Keyword == KeywordStop {
+			_, err = Suppress(db, models.Suppression{
+				Channel:   models.ChannelSMS,
+				Address:   from,
+				Reason:    models.SuppressionReasonStop,
+				Source:    "sms",
+				CreatedBy: a.CreatedBy,
+			})
+		} else {
+			err = Resubscribe(db, a.CreatedBy, models.ChannelSMS, from)
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		result.Accounts++
+	}
+
+	return result, nil
+}
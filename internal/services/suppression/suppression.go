@@ -0,0 +1,335 @@
+package suppressionservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+type SuppressionFilter struct {
+	Channel string
+	Query   string
+	Page    int
+	Limit   int
+}
+
+type SuppressionPage struct {
+	Suppressions []models.Suppression `json:"suppressions"`
+	Total        int64                `json:"total"`
+	Page         int                  `json:"page"`
+	Limit        int                  `json:"limit"`
+}
+
+type SuppressionRequest struct {
+	Channel string `json:"channel"`
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+}
+
+type Service interface {
+	GetSuppressions(f SuppressionFilter) (SuppressionPage, error)
+	AddSuppression(req SuppressionRequest) (models.Suppression, error)
+	RemoveSuppression(id string) error
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// NormalizeAddress puts an email address or msisdn in the form contacts
+// store it in so suppressions match them
+func NormalizeAddress(channel, address string) (string, error) {
+	switch channel {
+	case models.ChannelEmail:
+		address = utils.NormalizeEmail(address)
+
+		if _, err := mail.ParseAddress(address); err != nil || address == "" {
+			return "", fmt.Errorf("%w: %q is not a valid email address", ErrInvalid, address)
+		}
+	case models.ChannelSMS:
+		address = utils.NormalizeMsisdn(address)
+
+		if len(address) < 8 || len(address) > 15 {
+			return "", fmt.Errorf("%w: msisdn must have between 8 and 15 digits", ErrInvalid)
+		}
+	default:
+		return "", fmt.Errorf("%w: channel must be sms or email", ErrInvalid)
+	}
+
+	return address, nil
+}
+
+// GetSuppressions lists the user's suppressions, newest first. Query
+// matches the start of the address.
+func (s *service) GetSuppressions(f SuppressionFilter) (SuppressionPage, error) {
+	page := SuppressionPage{Suppressions: []models.Suppression{}}
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		return page, err
+	}
+
+	if f.Page < 1 {
+		f.Page = 1
+	}
+
+	if f.Limit < 1 {
+		f.Limit = DefaultPageSize
+	}
+
+	f.Limit = min(f.Limit, MaxPageSize)
+
+	filter := bson.M{"created_by": user.Sub}
+
+	if f.Channel != "" {
+		filter["channel"] = f.Channel
+	}
+
+	if q := strings.ToLower(strings.TrimSpace(f.Query)); q != "" {
+		filter["address"] = bson.M{"$regex": "^" + regexp.QuoteMeta(q)}
+	}
+
+	s.db.SetCollection(models.SuppressionsCollection)
+
+	page.Total, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting suppressions", "error", err)
+
+		return page, errors.New("error getting suppressions")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(int64((f.Page - 1) * f.Limit)).
+		SetLimit(int64(f.Limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &page.Suppressions)
+
+	if err != nil {
+		slog.Error("Error getting suppressions", "error", err)
+
+		return page, errors.New("error getting suppressions")
+	}
+
+	page.Page = f.Page
+	page.Limit = f.Limit
+
+	return page, nil
+}
+
+// AddSuppression suppresses an address by hand, adding one that is already
+// suppressed returns the existing entry
+func (s *service) AddSuppression(req SuppressionRequest) (models.Suppression, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		return models.Suppression{}, err
+	}
+
+	req.Channel = strings.ToLower(strings.TrimSpace(req.Channel))
+	address, err := NormalizeAddress(req.Channel, req.Address)
+
+	if err != nil {
+		return models.Suppression{}, err
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+
+	if reason == "" {
+		reason = models.SuppressionReasonManual
+	}
+
+	return Suppress(s.db, models.Suppression{
+		Channel:   req.Channel,
+		Address:   address,
+		Reason:    reason,
+		Source:    "api",
+		CreatedBy: user.Sub,
+	})
+}
+
+// RemoveSuppression lets sends reach the address again. Contact consent is
+// left as it is, it has to be given again.
+func (s *service) RemoveSuppression(id string) error {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		return err
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return fmt.Errorf("%w: no suppressions with id: %s found", ErrNotFound, id)
+	}
+
+	filter := bson.M{"_id": objid, "created_by": user.Sub}
+
+	s.db.SetCollection(models.SuppressionsCollection)
+
+	err = s.db.FindOne(filter, &models.Suppression{})
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: no suppressions with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting suppression", "error", err)
+
+		return errors.New("error removing suppression")
+	}
+
+	if err := s.db.DeleteOne(filter); err != nil {
+		slog.Error("Error deleting suppression", "error", err)
+
+		return errors.New("error removing suppression")
+	}
+
+	return nil
+}
+
+// Suppress adds sup unless its address is already suppressed for the account
+// and withdraws the channel consent of every contact holding the address.
+// It returns the entry that is in effect.
+func Suppress(db database.Database, sup models.Suppression) (models.Suppression, error) {
+	result := models.Suppression{}
+	now := time.Now().Local()
+
+	db.SetCollection(models.SuppressionsCollection)
+
+	err := db.FindOneAndUpdate(bson.M{
+		"created_by": sup.CreatedBy,
+		"channel":    sup.Channel,
+		"address":    sup.Address,
+	}, bson.M{
+		"$setOnInsert": bson.M{
+			"_id":         primitive.NewObjectID(),
+			"reason":      sup.Reason,
+			"source":      sup.Source,
+			"campaign_id": sup.CampaignID,
+			"created_at":  now,
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After), &result)
+
+	if err != nil {
+		slog.Error("Error storing suppression", "error", err)
+
+		return result, errors.New("error suppressing address")
+	}
+
+	if err := setConsent(db, sup.CreatedBy, sup.Channel, sup.Address, false); err != nil {
+		slog.Error("Error withdrawing consent", "error", err)
+
+		return result, errors.New("error suppressing address")
+	}
+
+	return result, nil
+}
+
+// Resubscribe undoes a STOP the contact sent and gives consent on the
+// channel again. Suppressions made by hand or by link are left alone.
+func Resubscribe(db database.Database, createdBy, channel, address string) error {
+	filter := bson.M{"created_by": createdBy, "channel": channel, "address": address, "reason": models.SuppressionReasonStop}
+
+	db.SetCollection(models.SuppressionsCollection)
+
+	n, err := db.CountDocuments(filter)
+
+	if err == nil && n > 0 {
+		err = db.DeleteOne(filter)
+	}
+
+	if err != nil {
+		slog.Error("Error deleting suppression", "error", err)
+
+		return errors.New("error resubscribing address")
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	if err := setConsent(db, createdBy, channel, address, true); err != nil {
+		slog.Error("Error restoring consent", "error", err)
+
+		return errors.New("error resubscribing address")
+	}
+
+	return nil
+}
+
+func setConsent(db database.Database, createdBy, channel, address string, consent bool) error {
+	field := "msisdn"
+
+	if channel == models.ChannelEmail {
+		field = "email"
+	}
+
+	db.SetCollection(models.ContactsCollection)
+
+	return db.UpdateManyRaw(bson.M{"created_by": createdBy, field: address}, bson.M{
+		"$set": bson.M{"consent." + channel: consent, "updated_at": time.Now().Local()},
+	})
+}
+
+// IsSuppressed reports whether the account suppressed address on channel,
+// dispatchers check it right before each send
+func IsSuppressed(db database.Database, createdBy, channel, address string) (bool, error) {
+	db.SetCollection(models.SuppressionsCollection)
+
+	n, err := db.CountDocuments(bson.M{"created_by": createdBy, "channel": channel, "address": address})
+
+	return n > 0, err
+}
+
+// Exclude returns aggregation stages that drop documents whose field holds
+// an address the account suppressed on channel
+func Exclude(createdBy, channel, field string) []bson.M {
+	return []bson.M{
+		{"$lookup": bson.M{
+			"from": string(models.SuppressionsCollection),
+			"let":  bson.M{"address": "$" + field},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{
+					"created_by": createdBy,
+					"channel":    channel,
+					"$expr":      bson.M{"$eq": bson.A{"$address", "$$address"}},
+				}},
+				bson.M{"$limit": 1},
+				bson.M{"$project": bson.M{"_id": 1}},
+			},
+			"as": "suppressed",
+		}},
+		{"$match": bson.M{"suppressed": bson.M{"$size": 0}}},
+	}
+}
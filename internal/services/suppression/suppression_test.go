@@ -0,0 +1,92 @@
+package suppressionservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestToken(t *testing.T) {
+	token := SignToken(Token{CreatedBy: "u1", Channel: models.ChannelEmail, Address: "ama@example.com", CampaignID: "c1"})
+
+	parsed, err := ParseToken(token)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.CreatedBy != "u1" || parsed.Address != "ama@example.com" || parsed.CampaignID != "c1" {
+		t.Errorf("expected the token to round trip; got %+v", parsed)
+	}
+
+	forged := SignToken(Token{CreatedBy: "u1", Channel: models.ChannelEmail, Address: "kofi@example.com"})
+	payload, _, _ := strings.Cut(forged, ".")
+	_, signature, _ := strings.Cut(token, ".")
+
+	if _, err := ParseToken(payload + "." + signature); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected a swapped payload to be rejected; got %v", err)
+	}
+
+	if _, err := ParseToken("garbage"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected a malformed token to be rejected; got %v", err)
+	}
+}
+
+func TestListUnsubscribeHeaders(t *testing.T) {
+	headers := ListUnsubscribeHeaders(Token{CreatedBy: "u1", Channel: models.ChannelEmail, Address: "ama@example.com"})
+
+	if headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("expected the one-click header; got %q", headers["List-Unsubscribe-Post"])
+	}
+
+	link := headers["List-Unsubscribe"]
+
+	if !strings.HasPrefix(link, "<") || !strings.HasSuffix(link, ">") || !strings.Contains(link, UnsubscribePath) {
+		t.Errorf("expected an unsubscribe url in angle brackets; got %q", link)
+	}
+}
+
+func TestKeyword(t *testing.T) {
+	cases := map[string]string{
+		"STOP":             KeywordStop,
+		" stop! ":          KeywordStop,
+		"Unsubscribe":      KeywordStop,
+		"start":            KeywordStart,
+		"HELP":             KeywordHelp,
+		"please stop this": "",
+		"thanks":           "",
+	}
+
+	for text, expected := range cases {
+		if got := Keyword(text); got != expected {
+			t.Errorf("Keyword(%q) expected %q; got %q", text, expected, got)
+		}
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	address, err := NormalizeAddress(models.ChannelEmail, " Ama@Example.COM ")
+
+	if err != nil || address != "ama@example.com" {
+		t.Errorf("expected a lower cased address; got %q %v", address, err)
+	}
+
+	if _, err := NormalizeAddress(models.ChannelSMS, "12"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected a short msisdn to be invalid; got %v", err)
+	}
+
+	if _, err := NormalizeAddress("fax", "123"); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected an unknown channel to be invalid; got %v", err)
+	}
+}
+
+func TestMask(t *testing.T) {
+	if got := mask("ama@example.com"); got != "a**@example.com" {
+		t.Errorf("unexpected masked email %q", got)
+	}
+
+	if got := mask("233241234567"); got != "*********567" {
+		t.Errorf("unexpected masked msisdn %q", got)
+	}
+}
@@ -0,0 +1,166 @@
+package suppressionservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var (
+	unsubscribeSecret = os.Getenv("UNSUBSCRIBE_SECRET")
+	publicBaseURL     = os.Getenv("PUBLIC_BASE_URL")
+)
+
+// UnsubscribePath is the route prefix unsubscribe links are served from
+const UnsubscribePath = "/api/unsubscribe/"
+
+// Token identifies what an unsubscribe link opts out of. Links do not
+// expire, an old email must still be able to unsubscribe.
+type Token struct {
+	CreatedBy  string `json:"o"`
+	Channel    string `json:"c"`
+	Address    string `json:"a"`
+	CampaignID string `json:"m,omitempty"`
+}
+
+// Unsubscription describes a token to the person about to use it
+type Unsubscription struct {
+	Channel    string `json:"channel"`
+	Address    string `json:"address"`
+	Suppressed bool   `json:"suppressed"`
+}
+
+func secret() []byte {
+	if unsubscribeSecret != "" {
+		return []byte(unsubscribeSecret)
+	}
+
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+func mac(payload string) string {
+	h := hmac.New(sha256.New, secret())
+	h.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// SignToken encodes t as "<payload>.<signature>", both base64url
+func SignToken(t Token) string {
+	data, _ := json.Marshal(t)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+
+	return payload + "." + mac(payload)
+}
+
+// ParseToken checks the signature of token and decodes it
+func ParseToken(token string) (Token, error) {
+	t := Token{}
+	payload, signature, ok := strings.Cut(token, ".")
+
+	if !ok || !hmac.Equal([]byte(signature), []byte(mac(payload))) {
+		return t, fmt.Errorf("%w: unsubscribe link is invalid", ErrInvalid)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+
+	if err == nil {
+		err = json.Unmarshal(data, &t)
+	}
+
+	if err != nil || t.CreatedBy == "" || t.Address == "" {
+		return t, fmt.Errorf("%w: unsubscribe link is invalid", ErrInvalid)
+	}
+
+	return t, nil
+}
+
+// UnsubscribeURL is the link that opts the token address out
+func UnsubscribeURL(t Token) string {
+	return strings.TrimSuffix(publicBaseURL, "/") + UnsubscribePath + SignToken(t)
+}
+
+// ListUnsubscribeHeaders are the RFC 8058 headers that let mail clients
+// unsubscribe with one click, a POST to the link
+func ListUnsubscribeHeaders(t Token) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + UnsubscribeURL(t) + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// LookupToken tells whether the token address is already suppressed, the
+// address is masked as anyone holding the link can see it
+func LookupToken(db database.Database, token string) (Unsubscription, error) {
+	t, err := ParseToken(token)
+
+	if err != nil {
+		return Unsubscription{}, err
+	}
+
+	suppressed, err := IsSuppressed(db, t.CreatedBy, t.Channel, t.Address)
+
+	if err != nil {
+		slog.Error("Error getting suppression", "error", err)
+
+		return Unsubscription{}, errors.New("error getting unsubscribe link")
+	}
+
+	return Unsubscription{Channel: t.Channel, Address: mask(t.Address), Suppressed: suppressed}, nil
+}
+
+// Unsubscribe suppresses the token address, using a link twice is harmless
+func Unsubscribe(db database.Database, token string) (Unsubscription, error) {
+	t, err := ParseToken(token)
+
+	if err != nil {
+		return Unsubscription{}, err
+	}
+
+	address, err := NormalizeAddress(t.Channel, t.Address)
+
+	if err != nil {
+		return Unsubscription{}, err
+	}
+
+	_, err = Suppress(db, models.Suppression{
+		Channel:    t.Channel,
+		Address:    address,
+		Reason:     models.SuppressionReasonUnsubscribe,
+		Source:     "link",
+		CampaignID: t.CampaignID,
+		CreatedBy:  t.CreatedBy,
+	})
+
+	if err != nil {
+		return Unsubscription{}, err
+	}
+
+	return Unsubscription{Channel: t.Channel, Address: mask(address), Suppressed: true}, nil
+}
+
+// mask keeps the first character and the domain of an email address and the
+// last three digits of an msisdn
+func mask(address string) string {
+	if local, domain, ok := strings.Cut(address, "@"); ok {
+		if len(local) > 1 {
+			local = local[:1] + strings.Repeat("*", len(local)-1)
+		}
+
+		return local + "@" + domain
+	}
+
+	if len(address) <= 3 {
+		return address
+	}
+
+	return strings.Repeat("*", len(address)-3) + address[len(address)-3:]
+}
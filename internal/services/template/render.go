@@ -0,0 +1,347 @@
+package templateservice
+
+import (
+	"bytes"
+	"campaign/internal/models"
+	linkservice "campaign/internal/services/link"
+	suppressionservice "campaign/internal/services/suppression"
+	"fmt"
+	htmltemplate "html/template"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Rendered is a template filled in for one contact. Body is the sms text or
+// the email html, Text is the plain email part.
+type Rendered struct {
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+	Text    string `json:"text,omitempty"`
+}
+
+// funcs are available in every template e.g. {{default "there" .contact.first_name}}.
+// {{link "CODE"}} is the short link of a campaign link, Render attributes
+// its clicks to the contact.
+var funcs = map[string]interface{}{
+	"link": linkservice.ShortURL,
+	"default": func(def string, v interface{}) string {
+		if s := fmt.Sprint(v); v != nil && s != "" {
+			return s
+		}
+
+		return def
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"date": func(layout string, v interface{}) string {
+		t, ok := v.(time.Time)
+
+		if !ok || t.IsZero() {
+			return ""
+		}
+
+		return t.Format(layout)
+	},
+}
+
+// contactVariables and campaignVariables are always defined, attributes and
+// custom fields only when the key is known or a default is given
+var (
+	contactVariables  = []string{"id", "name", "first_name", "last_name", "email", "msisdn", "unsubscribe_url"}
+	campaignVariables = []string{"name", "description", "start_date", "end_date"}
+)
+
+// parts are the template sources of t with their names, in render order
+func parts(t models.Template) map[string]string {
+	p := map[string]string{"body": t.Body}
+
+	if t.Channel == models.TemplateChannelEmail {
+		p["subject"] = t.Subject
+		p["text"] = t.Text
+	}
+
+	return p
+}
+
+func parseText(name, src string) (*texttemplate.Template, error) {
+	return texttemplate.New(name).Funcs(funcs).Option("missingkey=zero").Parse(src)
+}
+
+func parseHTML(name, src string) (*htmltemplate.Template, error) {
+	return htmltemplate.New(name).Funcs(funcs).Option("missingkey=zero").Parse(src)
+}
+
+// Parse checks every part of t and returns the variables it uses, sorted.
+// Variables wrapped in default are reported in defaulted.
+func Parse(t models.Template) (variables []string, defaulted map[string]bool, err error) {
+	seen := map[string]bool{}
+	defaulted = map[string]bool{}
+
+	for name, src := range parts(t) {
+		if src == "" {
+			continue
+		}
+
+		tmpl, err := parseText(name, src)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s: %s", ErrInvalid, name, err)
+		}
+
+		if t.Channel == models.TemplateChannelEmail && name == "body" {
+			if _, err := parseHTML(name, src); err != nil {
+				return nil, nil, fmt.Errorf("%w: %s: %s", ErrInvalid, name, err)
+			}
+		}
+
+		walk(tmpl.Tree.Root, false, seen, defaulted)
+	}
+
+	for v := range seen {
+		variables = append(variables, v)
+	}
+
+	slices.Sort(variables)
+
+	return variables, defaulted, nil
+}
+
+// walk collects the fields used under n, they are addressed from the root
+// of the data e.g. .contact.name
+func walk(n parse.Node, inDefault bool, seen, defaulted map[string]bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, c := range n.Nodes {
+			walk(c, inDefault, seen, defaulted)
+		}
+	case *parse.ActionNode:
+		walk(n.Pipe, inDefault, seen, defaulted)
+	case *parse.IfNode:
+		walk(n.Pipe, true, seen, defaulted)
+		walk(n.List, inDefault, seen, defaulted)
+		walk(n.ElseList, inDefault, seen, defaulted)
+	case *parse.RangeNode:
+		walk(n.Pipe, inDefault, seen, defaulted)
+		walk(n.List, inDefault, seen, defaulted)
+		walk(n.ElseList, inDefault, seen, defaulted)
+	case *parse.WithNode:
+		walk(n.Pipe, true, seen, defaulted)
+		walk(n.List, inDefault, seen, defaulted)
+		walk(n.ElseList, inDefault, seen, defaulted)
+	case *parse.TemplateNode:
+		walk(n.Pipe, inDefault, seen, defaulted)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+
+		for _, c := range n.Cmds {
+			walk(c, inDefault, seen, defaulted)
+		}
+	case *parse.CommandNode:
+		isDefault := inDefault
+
+		if len(n.Args) > 0 {
+			if id, ok := n.Args[0].(*parse.IdentifierNode); ok && id.Ident == "default" {
+				isDefault = true
+			}
+		}
+
+		for _, a := range n.Args {
+			walk(a, isDefault, seen, defaulted)
+		}
+	case *parse.FieldNode:
+		path := strings.Join(n.Ident, ".")
+		seen[path] = true
+
+		if inDefault {
+			defaulted[path] = true
+		}
+	}
+}
+
+// Undefined lists the variables of t that may render empty: unknown ones and
+// attributes or custom fields without a default. customFields holds the
+// campaign custom field keys of the template owner.
+func Undefined(t models.Template, customFields map[string]bool) ([]string, error) {
+	variables, defaulted, err := Parse(t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	undefined := []string{}
+
+	for _, v := range variables {
+		if defaulted[v] || t.Defaults[v] != "" || known(v, customFields) {
+			continue
+		}
+
+		undefined = append(undefined, v)
+	}
+
+	return undefined, nil
+}
+
+func known(v string, customFields map[string]bool) bool {
+	scope, field, _ := strings.Cut(v, ".")
+
+	switch scope {
+	case "contact":
+		return slices.Contains(contactVariables, field)
+	case "campaign":
+		if key, ok := strings.CutPrefix(field, "custom_fields."); ok {
+			return customFields[key]
+		}
+
+		return slices.Contains(campaignVariables, field)
+	}
+
+	return false
+}
+
+// Data is what a template is rendered against for a contact and campaign.
+// contact.unsubscribe_url opts the contact email address out, it is empty
+// for contacts without one.
+func Data(contact models.Contact, campaign models.Campaign) map[string]interface{} {
+	first, last, _ := strings.Cut(strings.TrimSpace(contact.Name), " ")
+
+	attributes := map[string]interface{}{}
+
+	for k, v := range contact.Attributes {
+		attributes[k] = v
+	}
+
+	customFields := map[string]interface{}{}
+
+	for k, v := range campaign.CustomFields {
+		customFields[k] = v
+	}
+
+	unsubscribeURL := ""
+
+	if contact.Email != "" {
+		unsubscribeURL = suppressionservice.UnsubscribeURL(suppressionservice.Token{
+			CreatedBy:  contact.CreatedBy,
+			Channel:    models.ChannelEmail,
+			Address:    contact.Email,
+			CampaignID: campaign.ID,
+		})
+	}
+
+	return map[string]interface{}{
+		"contact": map[string]interface{}{
+			"id":              contact.ID,
+			"name":            contact.Name,
+			"first_name":      first,
+			"last_name":       strings.TrimSpace(last),
+			"email":           contact.Email,
+			"msisdn":          contact.Msisdn,
+			"unsubscribe_url": unsubscribeURL,
+			"attributes":      attributes,
+		},
+		"campaign": map[string]interface{}{
+			"name":          campaign.Name,
+			"description":   campaign.Description,
+			"start_date":    campaign.StartDate,
+			"end_date":      campaign.EndDate,
+			"custom_fields": customFields,
+		},
+	}
+}
+
+// Render fills in t for data. Variables that are missing or empty take their
+// default, or render empty. The email body is html escaped, sms text and
+// subjects are plain text.
+func Render(t models.Template, data map[string]interface{}) (Rendered, error) {
+	rendered := Rendered{}
+	variables, _, err := Parse(t)
+
+	if err != nil {
+		return rendered, err
+	}
+
+	for _, v := range variables {
+		fill(data, strings.Split(v, "."), t.Defaults[v])
+	}
+
+	for name, src := range parts(t) {
+		if src == "" {
+			continue
+		}
+
+		out := bytes.Buffer{}
+
+		if t.Channel == models.TemplateChannelEmail && name == "body" {
+			tmpl, _ := parseHTML(name, src)
+			err = tmpl.Funcs(tracked(data)).Execute(&out, data)
+		} else {
+			tmpl, _ := parseText(name, src)
+			err = tmpl.Funcs(tracked(data)).Execute(&out, data)
+		}
+
+		if err != nil {
+			return rendered, fmt.Errorf("%w: %s: %s", ErrInvalid, name, err)
+		}
+
+		switch name {
+		case "subject":
+			rendered.Subject = strings.Join(strings.Fields(out.String()), " ")
+		case "text":
+			rendered.Text = out.String()
+		default:
+			rendered.Body = out.String()
+		}
+	}
+
+	return rendered, nil
+}
+
+// tracked overrides the link func so short links carry the contact of data
+func tracked(data map[string]interface{}) map[string]interface{} {
+	contactID := ""
+
+	if contact, ok := data["contact"].(map[string]interface{}); ok {
+		contactID, _ = contact["id"].(string)
+	}
+
+	return map[string]interface{}{
+		"link": func(code string) string {
+			return linkservice.TrackedURL(code, contactID)
+		},
+	}
+}
+
+// fill sets path in data to def when it is missing or empty, so templates
+// never print "<no value>"
+func fill(data map[string]interface{}, path []string, def string) {
+	m := data
+
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]interface{})
+
+		if !ok {
+			if _, exists := m[key]; exists {
+				return
+			}
+
+			next = map[string]interface{}{}
+			m[key] = next
+		}
+
+		m = next
+	}
+
+	last := path[len(path)-1]
+
+	if v, ok := m[last]; !ok || v == nil || v == "" {
+		m[last] = def
+	}
+}
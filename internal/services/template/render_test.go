@@ -0,0 +1,163 @@
+package templateservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseVariables(t *testing.T) {
+	tmpl := models.Template{
+		Channel: models.TemplateChannelEmail,
+		Subject: "Hi {{.contact.first_name}}",
+		Body:    `<p>{{default "friend" .contact.attributes.nickname}} {{if .campaign.custom_fields.region}}in {{.campaign.custom_fields.region}}{{end}}</p>`,
+		Text:    "{{upper .campaign.name}}",
+	}
+
+	variables, defaulted, err := Parse(tmpl)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"campaign.custom_fields.region", "campaign.name", "contact.attributes.nickname", "contact.first_name"}
+
+	if !slices.Equal(variables, expected) {
+		t.Errorf("expected %v; got %v", expected, variables)
+	}
+
+	if !defaulted["contact.attributes.nickname"] || !defaulted["campaign.custom_fields.region"] {
+		t.Errorf("expected default and if guards to count as defaults; got %v", defaulted)
+	}
+
+	if defaulted["contact.first_name"] {
+		t.Error("expected a bare variable not to count as defaulted")
+	}
+}
+
+func TestParseRejectsBadSyntax(t *testing.T) {
+	_, _, err := Parse(models.Template{Channel: models.TemplateChannelSMS, Body: "Hi {{.contact.name"})
+
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected an unclosed action to be invalid; got %v", err)
+	}
+
+	_, _, err = Parse(models.Template{Channel: models.TemplateChannelSMS, Body: "{{shout .contact.name}}"})
+
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected an unknown function to be invalid; got %v", err)
+	}
+}
+
+func TestUndefined(t *testing.T) {
+	tmpl := models.Template{
+		Channel: models.TemplateChannelSMS,
+		Body:    "{{.contact.name}} {{.contact.attributes.tier}} {{.contact.attributes.city}} {{.campaign.custom_fields.code}} {{.campaign.custom_fields.promo}} {{.contact.nme}}",
+		Defaults: map[string]string{
+			"contact.attributes.city": "Accra",
+		},
+	}
+
+	undefined, err := Undefined(tmpl, map[string]bool{"code": true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"campaign.custom_fields.promo", "contact.attributes.tier", "contact.nme"}
+
+	if !slices.Equal(undefined, expected) {
+		t.Errorf("expected %v; got %v", expected, undefined)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tmpl := models.Template{
+		Channel: models.TemplateChannelEmail,
+		Subject: "Hello {{.contact.first_name}}\r\nBcc: x@example.com",
+		Body:    "<p>Hi {{.contact.first_name}}, {{.contact.attributes.note}} ends {{date \"2 Jan\" .campaign.end_date}}</p>",
+		Text:    "Hi {{.contact.first_name}} from {{.contact.attributes.city}}, code {{.campaign.custom_fields.code}}",
+		Defaults: map[string]string{
+			"contact.attributes.city": "Accra",
+		},
+	}
+
+	contact := models.Contact{
+		Name:       "Ama Mensah",
+		Attributes: map[string]interface{}{"note": "<script>alert(1)</script>"},
+	}
+
+	campaign := models.Campaign{
+		Name:    "Easter",
+		EndDate: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	rendered, err := Render(tmpl, Data(contact, campaign))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered.Subject != "Hello Ama Bcc: x@example.com" {
+		t.Errorf("expected the subject on a single line; got %q", rendered.Subject)
+	}
+
+	if strings.Contains(rendered.Body, "<script>") || !strings.Contains(rendered.Body, "&lt;script&gt;") {
+		t.Errorf("expected the html body to be escaped; got %q", rendered.Body)
+	}
+
+	if !strings.Contains(rendered.Body, "ends 1 Apr") {
+		t.Errorf("expected the end date to be formatted; got %q", rendered.Body)
+	}
+
+	if rendered.Text != "Hi Ama from Accra, code " {
+		t.Errorf("expected defaults and empty values in the text part; got %q", rendered.Text)
+	}
+}
+
+func TestRenderSMSIsPlainText(t *testing.T) {
+	tmpl := models.Template{
+		Channel: models.TemplateChannelSMS,
+		Body:    "Hi {{default \"there\" .contact.first_name}} & welcome to {{.campaign.name}}",
+	}
+
+	rendered, err := Render(tmpl, Data(models.Contact{}, models.Campaign{Name: "Tom & Jerry"}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered.Body != "Hi there & welcome to Tom & Jerry" {
+		t.Errorf("unexpected body %q", rendered.Body)
+	}
+}
+
+func TestRenderLinkIsTrackedPerContact(t *testing.T) {
+	tmpl := models.Template{
+		Channel: models.TemplateChannelSMS,
+		Body:    `Shop now {{link "AbC1234"}}`,
+	}
+
+	rendered, err := Render(tmpl, Data(models.Contact{ID: "65f1c2a9e4b0a1b2c3d4e5f6"}, models.Campaign{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(rendered.Body, "/r/AbC1234?c=") {
+		t.Errorf("expected a short link with the contact ref; got %q", rendered.Body)
+	}
+
+	rendered, err = Render(tmpl, Data(models.Contact{}, models.Campaign{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(rendered.Body, "/r/AbC1234") {
+		t.Errorf("expected a plain short link without a contact; got %q", rendered.Body)
+	}
+}
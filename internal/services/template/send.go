@@ -0,0 +1,133 @@
+package templateservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ForSend loads the template a campaign send uses and rejects it when it is
+// for another channel or has variables that may render empty
+func ForSend(db database.Database, userID, id, channel string) (models.Template, error) {
+	t, err := FindTemplate(db, userID, id)
+
+	if errors.Is(err, ErrNotFound) {
+		return t, fmt.Errorf("%w: template %s not found", ErrInvalid, id)
+	}
+
+	if err != nil {
+		return t, err
+	}
+
+	if t.Channel != channel {
+		return t, fmt.Errorf("%w: template %s is for %s", ErrInvalid, t.Name, t.Channel)
+	}
+
+	keys, err := CustomFieldKeys(db, userID)
+
+	if err != nil {
+		return t, err
+	}
+
+	return t, checkDefined(t, keys)
+}
+
+// Renderer renders templates per message for a dispatcher. Templates and
+// campaigns are loaded once per renderer, contacts on every call.
+type Renderer struct {
+	db *mongo.Database
+
+	mu        sync.Mutex
+	templates map[string]models.Template
+	campaigns map[string]models.Campaign
+}
+
+func NewRenderer(db *mongo.Database) *Renderer {
+	return &Renderer{
+		db:        db,
+		templates: map[string]models.Template{},
+		campaigns: map[string]models.Campaign{},
+	}
+}
+
+// Render fills in a template for one contact of a campaign
+func (r *Renderer) Render(ctx context.Context, templateID, campaignID, contactID string) (Rendered, error) {
+	dbM := database.NewDatabaseService(ctx, r.db, models.TemplatesCollection)
+
+	t, campaign, err := r.cached(dbM, templateID, campaignID)
+
+	if err != nil {
+		return Rendered{}, err
+	}
+
+	contact := models.Contact{}
+	objid, _ := primitive.ObjectIDFromHex(contactID)
+
+	dbM.SetCollection(models.ContactsCollection)
+
+	err = dbM.FindOne(bson.M{"_id": objid}, &contact)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Rendered{}, fmt.Errorf("%w: contact %s no longer exists", ErrInvalid, contactID)
+	}
+
+	if err != nil {
+		return Rendered{}, fmt.Errorf("error getting contact %s: %w", contactID, err)
+	}
+
+	return Render(t, Data(contact, campaign))
+}
+
+func (r *Renderer) cached(dbM database.Database, templateID, campaignID string) (models.Template, models.Campaign, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.templates[templateID]
+
+	if !ok {
+		objid, _ := primitive.ObjectIDFromHex(templateID)
+
+		dbM.SetCollection(models.TemplatesCollection)
+
+		err := dbM.FindOne(bson.M{"_id": objid}, &t)
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return t, models.Campaign{}, fmt.Errorf("%w: template %s no longer exists", ErrInvalid, templateID)
+		}
+
+		if err != nil {
+			return t, models.Campaign{}, fmt.Errorf("error getting template %s: %w", templateID, err)
+		}
+
+		r.templates[templateID] = t
+	}
+
+	campaign, ok := r.campaigns[campaignID]
+
+	if !ok {
+		objid, _ := primitive.ObjectIDFromHex(campaignID)
+
+		dbM.SetCollection(models.CampaignsCollection)
+
+		err := dbM.FindOne(bson.M{"_id": objid}, &campaign)
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return t, campaign, fmt.Errorf("%w: campaign %s no longer exists", ErrInvalid, campaignID)
+		}
+
+		if err != nil {
+			return t, campaign, fmt.Errorf("error getting campaign %s: %w", campaignID, err)
+		}
+
+		r.campaigns[campaignID] = campaign
+	}
+
+	return t, campaign, nil
+}
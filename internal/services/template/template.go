@@ -0,0 +1,605 @@
+package templateservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/sms"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxTemplateSize caps each part of a template, in bytes
+const MaxTemplateSize = 512 << 10
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("already exists")
+	ErrInvalid  = errors.New("invalid request")
+)
+
+// PreviewRequest picks what a template is rendered against. Without a
+// contact the user's first contact is used, without a campaign only
+// defaults fill the campaign variables.
+type PreviewRequest struct {
+	ContactID  string          `json:"contact_id"`
+	Contact    *models.Contact `json:"contact"`
+	CampaignID string          `json:"campaign_id"`
+}
+
+type Preview struct {
+	Rendered  Rendered `json:"rendered"`
+	Variables []string `json:"variables"`
+	Undefined []string `json:"undefined"`
+	Encoding  string   `json:"encoding,omitempty"`
+	Segments  int      `json:"segments,omitempty"`
+}
+
+// TestRequest renders a template for a sample contact and sends it to the
+// signed in user. Email tests need a sender identity.
+type TestRequest struct {
+	PreviewRequest
+	SenderIdentityID string `json:"sender_identity_id"`
+}
+
+// TestMessage is a rendered test ready to hand to a provider
+type TestMessage struct {
+	Channel  string                 `json:"channel"`
+	To       string                 `json:"to"`
+	From     *models.SenderIdentity `json:"from,omitempty"`
+	Rendered Rendered               `json:"rendered"`
+}
+
+type Service interface {
+	CreateTemplate(t models.Template) (models.Template, error)
+	GetTemplates(channel string) ([]models.Template, error)
+	GetTemplateByID(id string) (models.Template, error)
+	UpdateTemplate(id string, t models.Template) error
+	DeleteTemplate(id string) error
+	Preview(t models.Template, req PreviewRequest) (Preview, error)
+	TestMessage(id string, req TestRequest) (TestMessage, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+// NormalizeTemplate trims and checks t and records the variables it uses
+func NormalizeTemplate(t models.Template) (models.Template, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Channel = strings.ToLower(strings.TrimSpace(t.Channel))
+	t.Subject = strings.TrimSpace(t.Subject)
+
+	if t.Name == "" {
+		return t, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+
+	if t.Channel != models.TemplateChannelSMS && t.Channel != models.TemplateChannelEmail {
+		return t, fmt.Errorf("%w: channel must be sms or email", ErrInvalid)
+	}
+
+	if strings.TrimSpace(t.Body) == "" {
+		return t, fmt.Errorf("%w: body is required", ErrInvalid)
+	}
+
+	if t.Channel == models.TemplateChannelEmail && t.Subject == "" {
+		return t, fmt.Errorf("%w: subject is required for email templates", ErrInvalid)
+	}
+
+	if t.Channel == models.TemplateChannelSMS {
+		t.Subject, t.Text = "", ""
+	}
+
+	for _, part := range []string{t.Subject, t.Body, t.Text} {
+		if len(part) > MaxTemplateSize {
+			return t, fmt.Errorf("%w: templates are limited to %d bytes per part", ErrInvalid, MaxTemplateSize)
+		}
+	}
+
+	defaults := map[string]string{}
+
+	for k, v := range t.Defaults {
+		if k = strings.Trim(strings.TrimSpace(k), "."); k != "" {
+			defaults[k] = v
+		}
+	}
+
+	t.Defaults = defaults
+
+	variables, _, err := Parse(t)
+
+	if err != nil {
+		return t, err
+	}
+
+	t.Variables = variables
+
+	if t.Variables == nil {
+		t.Variables = []string{}
+	}
+
+	return t, nil
+}
+
+func (s *service) CreateTemplate(t models.Template) (models.Template, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return t, errors.New("error creating template")
+	}
+
+	t, err = NormalizeTemplate(t)
+
+	if err != nil {
+		return t, err
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.TemplatesCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":        objid,
+		"name":       t.Name,
+		"channel":    t.Channel,
+		"subject":    t.Subject,
+		"body":       t.Body,
+		"text":       t.Text,
+		"defaults":   t.Defaults,
+		"variables":  t.Variables,
+		"created_by": user.Sub,
+		"created_at": now,
+		"updated_at": now,
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return t, fmt.Errorf("%w: a template named %s already exists", ErrExists, t.Name)
+	}
+
+	if err != nil {
+		slog.Error("Error creating template", "error", err)
+
+		return t, errors.New("error creating template")
+	}
+
+	t.ID = objid.Hex()
+	t.CreatedBy = user.Sub
+	t.CreatedAt = now
+	t.UpdatedAt = now
+
+	return t, nil
+}
+
+func (s *service) GetTemplates(channel string) ([]models.Template, error) {
+	templates := []models.Template{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return templates, errors.New("error getting templates")
+	}
+
+	filter := bson.M{"created_by": user.Sub}
+
+	if channel != "" {
+		filter["channel"] = channel
+	}
+
+	s.db.SetCollection(models.TemplatesCollection)
+
+	err = s.db.FindManyWithOptions(filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}), &templates)
+
+	if err != nil {
+		slog.Error("Error getting templates", "error", err)
+
+		return templates, errors.New("error getting templates")
+	}
+
+	return templates, nil
+}
+
+func (s *service) GetTemplateByID(id string) (models.Template, error) {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return models.Template{}, errors.New("error getting template")
+	}
+
+	return FindTemplate(s.db, user.Sub, id)
+}
+
+func (s *service) UpdateTemplate(id string, t models.Template) error {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return errors.New("error updating template")
+	}
+
+	existing, err := FindTemplate(s.db, user.Sub, id)
+
+	if err != nil {
+		return err
+	}
+
+	t, err = NormalizeTemplate(t)
+
+	if err != nil {
+		return err
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(existing.ID)
+
+	s.db.SetCollection(models.TemplatesCollection)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": user.Sub}, bson.M{
+		"name":       t.Name,
+		"channel":    t.Channel,
+		"subject":    t.Subject,
+		"body":       t.Body,
+		"text":       t.Text,
+		"defaults":   t.Defaults,
+		"variables":  t.Variables,
+		"updated_at": time.Now().Local(),
+	})
+
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: a template named %s already exists", ErrExists, t.Name)
+	}
+
+	if err != nil {
+		slog.Error("Error updating template", "error", err)
+
+		return errors.New("error updating template")
+	}
+
+	return nil
+}
+
+// DeleteTemplate removes a template that no campaign uses
+func (s *service) DeleteTemplate(id string) error {
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return errors.New("error deleting template")
+	}
+
+	existing, err := FindTemplate(s.db, user.Sub, id)
+
+	if err != nil {
+		return err
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	count, err := s.db.CountDocuments(bson.M{"created_by": user.Sub, "template_ids": existing.ID})
+
+	if err != nil {
+		slog.Error("Error checking template usage", "error", err)
+
+		return errors.New("error deleting template")
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%w: template is used by %d campaigns", ErrInvalid, count)
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(existing.ID)
+
+	s.db.SetCollection(models.TemplatesCollection)
+
+	if err := s.db.DeleteOne(bson.M{"_id": objid, "created_by": user.Sub}); err != nil {
+		slog.Error("Error deleting template", "error", err)
+
+		return errors.New("error deleting template")
+	}
+
+	return nil
+}
+
+// Preview renders t, saved or not, against a sample contact and campaign and
+// lists the variables that would render empty
+func (s *service) Preview(t models.Template, req PreviewRequest) (Preview, error) {
+	preview := Preview{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return preview, errors.New("error previewing template")
+	}
+
+	t, err = NormalizeTemplate(t)
+
+	if err != nil {
+		return preview, err
+	}
+
+	contact, campaign, err := s.sample(user.Sub, req)
+
+	if err != nil {
+		return preview, err
+	}
+
+	keys, err := CustomFieldKeys(s.db, user.Sub)
+
+	if err != nil {
+		return preview, err
+	}
+
+	preview.Undefined, err = Undefined(t, keys)
+
+	if err != nil {
+		return preview, err
+	}
+
+	preview.Rendered, err = Render(t, Data(contact, campaign))
+
+	if err != nil {
+		return preview, err
+	}
+
+	preview.Variables = t.Variables
+
+	if t.Channel == models.TemplateChannelSMS {
+		preview.Encoding, preview.Segments = sms.Segments(preview.Rendered.Body)
+	}
+
+	return preview, nil
+}
+
+// TestMessage renders a saved template for the user's own address or number
+func (s *service) TestMessage(id string, req TestRequest) (TestMessage, error) {
+	message := TestMessage{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return message, errors.New("error sending test")
+	}
+
+	t, err := FindTemplate(s.db, user.Sub, id)
+
+	if err != nil {
+		return message, err
+	}
+
+	me := models.User{}
+	objid, _ := primitive.ObjectIDFromHex(user.Sub)
+
+	s.db.SetCollection(models.UsersCollection)
+
+	if err := s.db.FindOne(bson.M{"_id": objid}, &me); err != nil {
+		slog.Error("Error getting user", "error", err)
+
+		return message, errors.New("error sending test")
+	}
+
+	message.Channel = t.Channel
+	message.To = me.Email
+
+	if t.Channel == models.TemplateChannelSMS {
+		message.To = me.Phone
+	}
+
+	if message.To == "" {
+		return message, fmt.Errorf("%w: your account has no %s address to send a test to", ErrInvalid, t.Channel)
+	}
+
+	if t.Channel == models.TemplateChannelEmail {
+		identity := models.SenderIdentity{}
+		identityID, _ := primitive.ObjectIDFromHex(req.SenderIdentityID)
+
+		s.db.SetCollection(models.SenderIdentitiesCollection)
+
+		err := s.db.FindOne(bson.M{"_id": identityID, "created_by": user.Sub}, &identity)
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return message, fmt.Errorf("%w: sender identity not found", ErrInvalid)
+		}
+
+		if err != nil {
+			slog.Error("Error getting sender identity", "error", err)
+
+			return message, errors.New("error sending test")
+		}
+
+		message.From = &identity
+	}
+
+	contact, campaign, err := s.sample(user.Sub, req.PreviewRequest)
+
+	if err != nil {
+		return message, err
+	}
+
+	message.Rendered, err = Render(t, Data(contact, campaign))
+
+	if err != nil {
+		return message, err
+	}
+
+	if t.Channel == models.TemplateChannelEmail {
+		message.Rendered.Subject = "[Test] " + message.Rendered.Subject
+	}
+
+	return message, nil
+}
+
+// sample loads the contact and campaign a preview renders against
+func (s *service) sample(userID string, req PreviewRequest) (models.Contact, models.Campaign, error) {
+	contact := models.Contact{}
+	campaign := models.Campaign{}
+
+	switch {
+	case req.Contact != nil:
+		contact = *req.Contact
+	case req.ContactID != "":
+		objid, _ := primitive.ObjectIDFromHex(req.ContactID)
+
+		s.db.SetCollection(models.ContactsCollection)
+
+		err := s.db.FindOne(bson.M{"_id": objid, "created_by": userID}, &contact)
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return contact, campaign, fmt.Errorf("%w: no contacts with id: %s found", ErrNotFound, req.ContactID)
+		}
+
+		if err != nil {
+			slog.Error("Error getting contact", "error", err)
+
+			return contact, campaign, errors.New("error previewing template")
+		}
+	default:
+		s.db.SetCollection(models.ContactsCollection)
+
+		err := s.db.FindOne(bson.M{"created_by": userID}, &contact)
+
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			slog.Error("Error getting contact", "error", err)
+
+			return contact, campaign, errors.New("error previewing template")
+		}
+	}
+
+	if req.CampaignID == "" {
+		return contact, campaign, nil
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(req.CampaignID)
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err := s.db.FindOne(bson.M{"_id": objid, "created_by": userID}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return contact, campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, req.CampaignID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return contact, campaign, errors.New("error previewing template")
+	}
+
+	return contact, campaign, nil
+}
+
+// FindTemplate loads a template owned by userID
+func FindTemplate(db database.Database, userID, id string) (models.Template, error) {
+	t := models.Template{}
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return t, fmt.Errorf("%w: no templates with id: %s found", ErrNotFound, id)
+	}
+
+	db.SetCollection(models.TemplatesCollection)
+
+	err = db.FindOne(bson.M{"_id": objid, "created_by": userID}, &t)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return t, fmt.Errorf("%w: no templates with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting template", "error", err)
+
+		return t, errors.New("error getting template")
+	}
+
+	return t, nil
+}
+
+// CustomFieldKeys are the campaign custom fields userID has defined
+func CustomFieldKeys(db database.Database, userID string) (map[string]bool, error) {
+	fields := []models.CustomField{}
+	keys := map[string]bool{}
+
+	db.SetCollection(models.CustomFieldsCollection)
+
+	if err := db.FindMany(bson.M{"created_by": userID}, &fields); err != nil {
+		slog.Error("Error getting custom fields", "error", err)
+
+		return keys, errors.New("error getting custom fields")
+	}
+
+	for _, f := range fields {
+		keys[f.Key] = true
+	}
+
+	return keys, nil
+}
+
+// ValidateCampaignTemplates checks the templates a campaign uses before it
+// goes live, a template with variables that may render empty is rejected
+func ValidateCampaignTemplates(db database.Database, userID string, templateIDs []string) error {
+	if len(templateIDs) == 0 {
+		return nil
+	}
+
+	keys, err := CustomFieldKeys(db, userID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, id := range templateIDs {
+		t, err := FindTemplate(db, userID, id)
+
+		if errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("%w: template %s not found", ErrInvalid, id)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err := checkDefined(t, keys); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkDefined(t models.Template, customFields map[string]bool) error {
+	undefined, err := Undefined(t, customFields)
+
+	if err != nil {
+		return err
+	}
+
+	if len(undefined) > 0 {
+		return fmt.Errorf("%w: template %s uses undefined variables %s, define them or give them a default", ErrInvalid, t.Name, strings.Join(undefined, ", "))
+	}
+
+	return nil
+}
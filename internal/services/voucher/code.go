@@ -0,0 +1,199 @@
+package voucherservice
+
+import (
+	"campaign/internal/models"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultAlphabet leaves out 0, 1, I and O which are misread on print
+	DefaultAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	DefaultLength   = 8
+
+	MinLength     = 4
+	MaxLength     = 32
+	MaxCodeLength = 64
+
+	// headroom is how many times more codes the alphabet and length must
+	// allow than the pool holds, so codes stay hard to guess and random
+	// generation rarely collides
+	headroom = 1000
+)
+
+var (
+	alphabetPattern = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+	prefixPattern   = regexp.MustCompile(`^[0-9A-Za-z-]{0,16}$`)
+	codePattern     = regexp.MustCompile(`^[\x21-\x7e]+$`)
+)
+
+// NormalizePool fills in the generation defaults of p and checks them
+func NormalizePool(p models.CodePool) (models.CodePool, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Source = strings.ToLower(strings.TrimSpace(p.Source))
+
+	if p.Name == "" {
+		return p, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+
+	if p.Source == "" {
+		p.Source = models.CodePoolSourceGenerated
+	}
+
+	switch p.Source {
+	case models.CodePoolSourceUploaded:
+		p.Prefix, p.Alphabet, p.Length, p.CheckDigit = "", "", 0, false
+
+		return p, nil
+	case models.CodePoolSourceGenerated:
+	default:
+		return p, fmt.Errorf("%w: source must be generated or uploaded", ErrInvalid)
+	}
+
+	p.Prefix = strings.ToUpper(strings.TrimSpace(p.Prefix))
+
+	if !prefixPattern.MatchString(p.Prefix) {
+		return p, fmt.Errorf("%w: prefix must be at most 16 letters, digits or dashes", ErrInvalid)
+	}
+
+	if p.Alphabet == "" {
+		p.Alphabet = DefaultAlphabet
+	}
+
+	p.Alphabet = strings.ToUpper(p.Alphabet)
+
+	if !alphabetPattern.MatchString(p.Alphabet) || len(p.Alphabet) < 2 {
+		return p, fmt.Errorf("%w: alphabet must be at least 2 letters or digits", ErrInvalid)
+	}
+
+	for i := range p.Alphabet {
+		if strings.IndexByte(p.Alphabet, p.Alphabet[i]) != i {
+			return p, fmt.Errorf("%w: alphabet has %q more than once", ErrInvalid, p.Alphabet[i])
+		}
+	}
+
+	if p.Length == 0 {
+		p.Length = DefaultLength
+	}
+
+	if p.Length < MinLength || p.Length > MaxLength {
+		return p, fmt.Errorf("%w: length must be between %d and %d", ErrInvalid, MinLength, MaxLength)
+	}
+
+	return p, nil
+}
+
+// Capacity is how many codes a generated pool may hold
+func Capacity(p models.CodePool) float64 {
+	return math.Pow(float64(len(p.Alphabet)), float64(p.Length)) / headroom
+}
+
+// NewCode returns a random code of a generated pool: the prefix, Length
+// characters and, with CheckDigit, one more that catches typos
+func NewCode(p models.CodePool) (string, error) {
+	body := make([]byte, p.Length)
+	max := big.NewInt(int64(len(p.Alphabet)))
+
+	for i := range body {
+		n, err := rand.Int(rand.Reader, max)
+
+		if err != nil {
+			return "", err
+		}
+
+		body[i] = p.Alphabet[n.Int64()]
+	}
+
+	code := string(body)
+
+	if p.CheckDigit {
+		check, _ := CheckCharacter(p.Alphabet, code)
+		code += string(check)
+	}
+
+	return p.Prefix + code, nil
+}
+
+// CheckCharacter is the Luhn mod N check character of body over alphabet,
+// false when body has characters outside it
+func CheckCharacter(alphabet, body string) (byte, bool) {
+	n := len(alphabet)
+	factor := 2
+	sum := 0
+
+	for i := len(body) - 1; i >= 0; i-- {
+		point := strings.IndexByte(alphabet, body[i])
+
+		if point < 0 {
+			return 0, false
+		}
+
+		addend := factor * point
+		sum += addend/n + addend%n
+
+		factor = 3 - factor
+	}
+
+	return alphabet[(n-sum%n)%n], true
+}
+
+// NormalizeCode is code as it is stored in p. Generated codes are matched
+// without case, spaces or dashes after the prefix, uploaded ones as given.
+func NormalizeCode(p models.CodePool, code string) string {
+	code = strings.TrimSpace(code)
+
+	if p.Source != models.CodePoolSourceGenerated {
+		return code
+	}
+
+	code = strings.ToUpper(code)
+	body, hasPrefix := strings.CutPrefix(code, p.Prefix)
+
+	if !hasPrefix {
+		return strings.NewReplacer(" ", "", "-", "").Replace(code)
+	}
+
+	return p.Prefix + strings.NewReplacer(" ", "", "-", "").Replace(body)
+}
+
+// Valid tells whether code could belong to p, without looking it up. The
+// check character rejects most typos before they reach the database.
+func Valid(p models.CodePool, code string) bool {
+	if code == "" || len(code) > MaxCodeLength || !codePattern.MatchString(code) {
+		return false
+	}
+
+	if p.Source != models.CodePoolSourceGenerated {
+		return true
+	}
+
+	body, ok := strings.CutPrefix(code, p.Prefix)
+
+	if !ok {
+		return false
+	}
+
+	length := p.Length
+
+	if p.CheckDigit {
+		length++
+	}
+
+	if len(body) != length {
+		return false
+	}
+
+	if !p.CheckDigit {
+		_, ok := CheckCharacter(p.Alphabet, body)
+
+		return ok
+	}
+
+	check, ok := CheckCharacter(p.Alphabet, body[:len(body)-1])
+
+	return ok && check == body[len(body)-1]
+}
@@ -0,0 +1,109 @@
+package voucherservice
+
+import (
+	"campaign/internal/models"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePool(t *testing.T) {
+	pool, err := NormalizePool(models.CodePool{Name: " Summer ", Prefix: "sum-"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pool.Source != models.CodePoolSourceGenerated || pool.Alphabet != DefaultAlphabet || pool.Length != DefaultLength || pool.Prefix != "SUM-" {
+		t.Errorf("expected generation defaults; got %+v", pool)
+	}
+
+	uploaded, err := NormalizePool(models.CodePool{Name: "Partner", Source: "uploaded", Alphabet: "AB", Length: 3})
+
+	if err != nil || uploaded.Alphabet != "" || uploaded.Length != 0 {
+		t.Errorf("expected an uploaded pool to drop generation settings; got %+v %v", uploaded, err)
+	}
+
+	invalid := []models.CodePool{
+		{},
+		{Name: "x", Source: "minted"},
+		{Name: "x", Alphabet: "AAB"},
+		{Name: "x", Alphabet: "A"},
+		{Name: "x", Alphabet: "AB-"},
+		{Name: "x", Length: 2},
+		{Name: "x", Prefix: "has space"},
+	}
+
+	for _, p := range invalid {
+		if _, err := NormalizePool(p); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %+v to be invalid; got %v", p, err)
+		}
+	}
+}
+
+func TestCheckCharacter(t *testing.T) {
+	// over decimal digits Luhn mod N is the Luhn algorithm
+	if check, ok := CheckCharacter("0123456789", "7992739871"); !ok || check != '3' {
+		t.Errorf("expected check digit 3; got %q %v", check, ok)
+	}
+
+	if _, ok := CheckCharacter("0123456789", "12A"); ok {
+		t.Error("expected characters outside the alphabet to be refused")
+	}
+}
+
+func TestNewCodeIsValid(t *testing.T) {
+	pool, _ := NormalizePool(models.CodePool{Name: "x", Prefix: "GH", CheckDigit: true})
+
+	for i := 0; i < 50; i++ {
+		code, err := NewCode(pool)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(code, "GH") || len(code) != 2+DefaultLength+1 {
+			t.Fatalf("unexpected code %q", code)
+		}
+
+		if !Valid(pool, code) {
+			t.Fatalf("expected %q to be valid", code)
+		}
+
+		// any single substitution is caught by the check character
+		body := []byte(code)
+		pos := 2 + i%DefaultLength
+		next := strings.IndexByte(pool.Alphabet, body[pos]) + 1
+		body[pos] = pool.Alphabet[next%len(pool.Alphabet)]
+
+		if Valid(pool, string(body)) {
+			t.Fatalf("expected the typo %q of %q to be caught", body, code)
+		}
+	}
+}
+
+func TestNormalizeCode(t *testing.T) {
+	generated := models.CodePool{Source: models.CodePoolSourceGenerated, Prefix: "SUM-"}
+
+	if got := NormalizeCode(generated, " sum-abcd-efgh "); got != "SUM-ABCDEFGH" {
+		t.Errorf("expected the prefix kept and the body cleaned; got %q", got)
+	}
+
+	uploaded := models.CodePool{Source: models.CodePoolSourceUploaded}
+
+	if got := NormalizeCode(uploaded, " aBc-1 "); got != "aBc-1" {
+		t.Errorf("expected an uploaded code kept as given; got %q", got)
+	}
+
+	if Valid(uploaded, "has space") || Valid(uploaded, "") || !Valid(uploaded, "aBc-1") {
+		t.Error("unexpected uploaded code validation")
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	pool := models.CodePool{Alphabet: "0123456789", Length: 4}
+
+	if Capacity(pool) != 10 {
+		t.Errorf("expected 10 codes for 4 digits; got %v", Capacity(pool))
+	}
+}
@@ -0,0 +1,319 @@
+package voucherservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// KeyPrefix starts every redemption key so they are recognisable in logs
+// and secret scanners
+const KeyPrefix = "rk_"
+
+var (
+	// ErrSoldOut is returned when the campaign has code pools but no codes
+	// left to issue
+	ErrSoldOut = errors.New("no codes left")
+
+	// ErrUnauthorized is returned for a missing or unknown redemption key
+	ErrUnauthorized = errors.New("invalid redemption key")
+
+	// ErrNotRedeemable is returned for codes that were never issued, were
+	// voided or were already redeemed
+	ErrNotRedeemable = errors.New("code cannot be redeemed")
+)
+
+// Redemption is what a partner sees of a code
+type Redemption struct {
+	Code       string     `json:"code"`
+	Status     string     `json:"status"`
+	PoolName   string     `json:"pool_name"`
+	IssuedAt   *time.Time `json:"issued_at,omitempty"`
+	RedeemedAt *time.Time `json:"redeemed_at,omitempty"`
+	Location   string     `json:"location,omitempty"`
+}
+
+func newKey() (key, hash string, err error) {
+	b := make([]byte, 24)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	key = KeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return key, hashKey(key), nil
+}
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Issue gives claim the oldest available code of its campaign. The code is
+// taken with a single conditional update so no code goes to two claims.
+// Campaigns without code pools issue nothing and return an empty voucher.
+func Issue(db database.Database, claim models.Claim) (models.Voucher, error) {
+	voucher := models.Voucher{}
+	now := time.Now().Local()
+
+	db.SetCollection(models.VouchersCollection)
+
+	// a retried issue for the same claim gets the code it already has
+	err := db.FindOne(bson.M{"claim_id": claim.ID}, &voucher)
+
+	if err == nil {
+		return voucher, nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error getting issued code", "error", err)
+
+		return voucher, errors.New("error issuing code")
+	}
+
+	err = db.FindOneAndUpdate(
+		bson.M{"campaign_id": claim.CampaignID, "status": models.VoucherStatusAvailable},
+		bson.M{"$set": bson.M{
+			"status":     models.VoucherStatusIssued,
+			"claim_id":   claim.ID,
+			"contact_id": claim.ContactID,
+			"issued_at":  now,
+		}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}}).SetReturnDocument(options.After),
+		&voucher,
+	)
+
+	if err == nil {
+		return voucher, nil
+	}
+
+	// claim_id is unique, another worker issued a code to the claim first
+	if mongo.IsDuplicateKeyError(err) {
+		db.SetCollection(models.VouchersCollection)
+
+		if err := db.FindOne(bson.M{"claim_id": claim.ID}, &voucher); err == nil {
+			return voucher, nil
+		}
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		slog.Error("Error issuing code", "error", err)
+
+		return voucher, errors.New("error issuing code")
+	}
+
+	db.SetCollection(models.CodePoolsCollection)
+
+	pools, err := db.CountDocuments(bson.M{"campaign_id": claim.CampaignID})
+
+	if err != nil {
+		slog.Error("Error counting code pools", "error", err)
+
+		return voucher, errors.New("error issuing code")
+	}
+
+	if pools > 0 {
+		return voucher, ErrSoldOut
+	}
+
+	return models.Voucher{}, nil
+}
+
+// Unissue puts back a code whose claim was never saved, nobody has seen it
+func Unissue(db database.Database, voucherID string) {
+	objid, err := primitive.ObjectIDFromHex(voucherID)
+
+	if err != nil {
+		return
+	}
+
+	db.SetCollection(models.VouchersCollection)
+
+	err = db.UpdateOneRaw(bson.M{"_id": objid, "status": models.VoucherStatusIssued}, bson.M{
+		"$set":   bson.M{"status": models.VoucherStatusAvailable},
+		"$unset": bson.M{"claim_id": "", "contact_id": "", "issued_at": ""},
+	})
+
+	if err != nil {
+		slog.Error("Error returning code to its pool", "voucher", voucherID, "error", err)
+	}
+}
+
+// Void stops the code of a rejected claim from being redeemed. It is not
+// put back as the claimant has already seen it.
+func Void(db database.Database, voucherID string) {
+	objid, err := primitive.ObjectIDFromHex(voucherID)
+
+	if err != nil {
+		return
+	}
+
+	db.SetCollection(models.VouchersCollection)
+
+	err = db.UpdateOneRaw(bson.M{"_id": objid, "status": models.VoucherStatusIssued}, bson.M{
+		"$set": bson.M{"status": models.VoucherStatusVoid},
+	})
+
+	if err != nil {
+		slog.Error("Error voiding code", "voucher", voucherID, "error", err)
+	}
+}
+
+// PoolByKey finds the pool a redemption key belongs to
+func PoolByKey(db database.Database, key string) (models.CodePool, error) {
+	pool := models.CodePool{}
+	key = strings.TrimSpace(key)
+
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return pool, ErrUnauthorized
+	}
+
+	db.SetCollection(models.CodePoolsCollection)
+
+	err := db.FindOne(bson.M{"key_hash": hashKey(key)}, &pool)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return pool, ErrUnauthorized
+	}
+
+	if err != nil {
+		slog.Error("Error getting code pool", "error", err)
+
+		return pool, errors.New("error getting code pool")
+	}
+
+	return pool, nil
+}
+
+func redemption(pool models.CodePool, v models.Voucher) Redemption {
+	return Redemption{
+		Code:       v.Code,
+		Status:     v.Status,
+		PoolName:   pool.Name,
+		IssuedAt:   v.IssuedAt,
+		RedeemedAt: v.RedeemedAt,
+		Location:   v.Location,
+	}
+}
+
+// Lookup tells a partner whether a code of their pool can be redeemed
+func Lookup(db database.Database, key, code string) (Redemption, error) {
+	pool, err := PoolByKey(db, key)
+
+	if err != nil {
+		return Redemption{}, err
+	}
+
+	voucher, err := find(db, pool, code)
+
+	if err != nil {
+		return Redemption{}, err
+	}
+
+	return redemption(pool, voucher), nil
+}
+
+// Redeem marks an issued code of the key's pool as used and fulfils its
+// claim. Only one of two concurrent redemptions of a code succeeds.
+func Redeem(db database.Database, key, code, location string) (Redemption, error) {
+	pool, err := PoolByKey(db, key)
+
+	if err != nil {
+		return Redemption{}, err
+	}
+
+	voucher, err := find(db, pool, code)
+
+	if err != nil {
+		return Redemption{}, err
+	}
+
+	switch voucher.Status {
+	case models.VoucherStatusIssued:
+	case models.VoucherStatusAvailable:
+		return redemption(pool, voucher), fmt.Errorf("%w: code has not been issued", ErrNotRedeemable)
+	default:
+		return redemption(pool, voucher), fmt.Errorf("%w: code is %s", ErrNotRedeemable, voucher.Status)
+	}
+
+	now := time.Now().Local()
+	objid, _ := primitive.ObjectIDFromHex(voucher.ID)
+
+	db.SetCollection(models.VouchersCollection)
+
+	err = db.FindOneAndUpdate(
+		bson.M{"_id": objid, "status": models.VoucherStatusIssued},
+		bson.M{"$set": bson.M{
+			"status":      models.VoucherStatusRedeemed,
+			"redeemed_at": now,
+			"location":    strings.TrimSpace(location),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+		&voucher,
+	)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return redemption(pool, voucher), fmt.Errorf("%w: code was redeemed at the same time", ErrNotRedeemable)
+	}
+
+	if err != nil {
+		slog.Error("Error redeeming code", "error", err)
+
+		return Redemption{}, errors.New("error redeeming code")
+	}
+
+	if claimID, err := primitive.ObjectIDFromHex(voucher.ClaimID); err == nil {
+		db.SetCollection(models.ClaimsCollection)
+
+		err = db.UpdateOne(
+			bson.M{"_id": claimID, "status": models.ClaimStatusApproved},
+			bson.M{"status": models.ClaimStatusFulfilled, "updated_at": now},
+		)
+
+		if err != nil {
+			slog.Error("Error fulfilling claim", "claim", voucher.ClaimID, "error", err)
+		}
+	}
+
+	return redemption(pool, voucher), nil
+}
+
+func find(db database.Database, pool models.CodePool, code string) (models.Voucher, error) {
+	voucher := models.Voucher{}
+	code = NormalizeCode(pool, code)
+
+	if !Valid(pool, code) {
+		return voucher, fmt.Errorf("%w: %s is not a valid code", ErrNotFound, code)
+	}
+
+	db.SetCollection(models.VouchersCollection)
+
+	err := db.FindOne(bson.M{"pool_id": pool.ID, "code": code}, &voucher)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return voucher, fmt.Errorf("%w: no codes %s found", ErrNotFound, code)
+	}
+
+	if err != nil {
+		slog.Error("Error getting code", "error", err)
+
+		return voucher, errors.New("error getting code")
+	}
+
+	return voucher, nil
+}
@@ -0,0 +1,620 @@
+package voucherservice
+
+import (
+	"campaign/internal/database"
+	"campaign/internal/models"
+	"campaign/internal/utils/jwt"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+
+	// MaxCodesPerRequest bounds one generate or upload call
+	MaxCodesPerRequest = 100000
+
+	// writeBatchSize is how many codes go to the database per bulk write
+	writeBatchSize = 1000
+
+	// generateRounds is how often codes that collided are generated again
+	generateRounds = 3
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrInvalid  = errors.New("invalid request")
+	ErrInUse    = errors.New("code pool has issued codes")
+)
+
+type VoucherFilter struct {
+	Status string
+	Page   int
+	Limit  int
+}
+
+type VoucherPage struct {
+	Vouchers []models.Voucher `json:"vouchers"`
+	Total    int64            `json:"total"`
+	Page     int              `json:"page"`
+	Limit    int              `json:"limit"`
+}
+
+// AddResult reports codes added to a pool. Duplicates were already in the
+// pool or repeated in the request, Invalid codes were empty, too long or
+// had spaces or control characters.
+type AddResult struct {
+	Added      int64 `json:"added"`
+	Duplicates int64 `json:"duplicates"`
+	Invalid    int64 `json:"invalid"`
+}
+
+type Service interface {
+	CreatePool(campaignID string, p models.CodePool) (models.CodePool, error)
+	GetPools(campaignID string) ([]models.CodePool, error)
+	GetPool(campaignID, poolID string) (models.CodePool, error)
+	DeletePool(campaignID, poolID string) error
+	RotateKey(campaignID, poolID string) (models.CodePool, error)
+	GenerateCodes(campaignID, poolID string, count int) (AddResult, error)
+	UploadCodes(campaignID, poolID string, codes []string) (AddResult, error)
+	GetVouchers(campaignID, poolID string, f VoucherFilter) (VoucherPage, error)
+}
+
+type service struct {
+	ctx context.Context
+	db  database.Database
+}
+
+func NewService(ctx context.Context, db database.Database) Service {
+	return &service{ctx: ctx, db: db}
+}
+
+func (s *service) CreatePool(campaignID string, p models.CodePool) (models.CodePool, error) {
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return p, err
+	}
+
+	p, err = NormalizePool(p)
+
+	if err != nil {
+		return p, err
+	}
+
+	key, hash, err := newKey()
+
+	if err != nil {
+		slog.Error("Error generating redemption key", "error", err)
+
+		return p, errors.New("error creating code pool")
+	}
+
+	objid := primitive.NewObjectID()
+	now := time.Now().Local()
+
+	p.ID = objid.Hex()
+	p.CampaignID = campaign.ID
+	p.KeyHash = hash
+	p.RedemptionKey = key
+	p.Counts = &models.VoucherCounts{}
+	p.CreatedBy = campaign.CreatedBy
+	p.CreatedAt = now
+	p.UpdatedAt = now
+
+	s.db.SetCollection(models.CodePoolsCollection)
+
+	err = s.db.InsertOne(bson.M{
+		"_id":         objid,
+		"campaign_id": p.CampaignID,
+		"name":        p.Name,
+		"source":      p.Source,
+		"prefix":      p.Prefix,
+		"alphabet":    p.Alphabet,
+		"length":      p.Length,
+		"check_digit": p.CheckDigit,
+		"key_hash":    p.KeyHash,
+		"created_by":  p.CreatedBy,
+		"created_at":  p.CreatedAt,
+		"updated_at":  p.UpdatedAt,
+	})
+
+	if err != nil {
+		slog.Error("Error creating code pool", "error", err)
+
+		return p, errors.New("error creating code pool")
+	}
+
+	return p, nil
+}
+
+// GetPools lists the campaign code pools, oldest first as codes are issued
+// in that order, with their counts
+func (s *service) GetPools(campaignID string) ([]models.CodePool, error) {
+	pools := []models.CodePool{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return pools, err
+	}
+
+	s.db.SetCollection(models.CodePoolsCollection)
+
+	err = s.db.FindManyWithOptions(
+		bson.M{"campaign_id": campaign.ID, "created_by": campaign.CreatedBy},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}),
+		&pools,
+	)
+
+	if err != nil {
+		slog.Error("Error getting code pools", "error", err)
+
+		return pools, errors.New("error getting code pools")
+	}
+
+	counts, err := Counts(s.db, bson.M{"campaign_id": campaign.ID}, "$pool_id")
+
+	if err != nil {
+		return pools, err
+	}
+
+	for i := range pools {
+		c := counts[pools[i].ID]
+		pools[i].Counts = &c
+	}
+
+	return pools, nil
+}
+
+func (s *service) GetPool(campaignID, poolID string) (models.CodePool, error) {
+	pool, err := s.findPool(campaignID, poolID)
+
+	if err != nil {
+		return pool, err
+	}
+
+	counts, err := Counts(s.db, bson.M{"pool_id": pool.ID}, "$pool_id")
+
+	if err != nil {
+		return pool, err
+	}
+
+	c := counts[pool.ID]
+	pool.Counts = &c
+
+	return pool, nil
+}
+
+// DeletePool removes a pool that has not issued any codes, with its codes
+func (s *service) DeletePool(campaignID, poolID string) error {
+	pool, err := s.findPool(campaignID, poolID)
+
+	if err != nil {
+		return err
+	}
+
+	s.db.SetCollection(models.VouchersCollection)
+
+	issued, err := s.db.CountDocuments(bson.M{"pool_id": pool.ID, "status": bson.M{"$ne": models.VoucherStatusAvailable}})
+
+	if err != nil {
+		slog.Error("Error counting issued codes", "error", err)
+
+		return errors.New("error deleting code pool")
+	}
+
+	if issued > 0 {
+		return fmt.Errorf("%w: %d codes were issued, the pool is kept for their redemption", ErrInUse, issued)
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(pool.ID)
+
+	s.db.SetCollection(models.CodePoolsCollection)
+
+	if err := s.db.DeleteOne(bson.M{"_id": objid, "created_by": pool.CreatedBy}); err != nil {
+		slog.Error("Error deleting code pool", "error", err)
+
+		return errors.New("error deleting code pool")
+	}
+
+	// the pool is gone so its codes can no longer be issued, a failure here
+	// only leaves unreachable documents behind
+	s.db.SetCollection(models.VouchersCollection)
+
+	_, err = s.db.BulkWrite([]mongo.WriteModel{
+		mongo.NewDeleteManyModel().SetFilter(bson.M{"pool_id": pool.ID, "status": models.VoucherStatusAvailable}),
+	})
+
+	if err != nil {
+		slog.Error("Error deleting codes", "pool", pool.ID, "error", err)
+	}
+
+	return nil
+}
+
+// RotateKey replaces the pool redemption key, the old one stops working
+func (s *service) RotateKey(campaignID, poolID string) (models.CodePool, error) {
+	pool, err := s.findPool(campaignID, poolID)
+
+	if err != nil {
+		return pool, err
+	}
+
+	key, hash, err := newKey()
+
+	if err != nil {
+		slog.Error("Error generating redemption key", "error", err)
+
+		return pool, errors.New("error rotating redemption key")
+	}
+
+	objid, _ := primitive.ObjectIDFromHex(pool.ID)
+	pool.UpdatedAt = time.Now().Local()
+
+	s.db.SetCollection(models.CodePoolsCollection)
+
+	err = s.db.UpdateOne(bson.M{"_id": objid, "created_by": pool.CreatedBy}, bson.M{"key_hash": hash, "updated_at": pool.UpdatedAt})
+
+	if err != nil {
+		slog.Error("Error rotating redemption key", "error", err)
+
+		return pool, errors.New("error rotating redemption key")
+	}
+
+	pool.KeyHash = hash
+	pool.RedemptionKey = key
+
+	return pool, nil
+}
+
+// GenerateCodes adds count random codes to a generated pool. Codes that
+// collide with existing ones are generated again a few times.
+func (s *service) GenerateCodes(campaignID, poolID string, count int) (AddResult, error) {
+	result := AddResult{}
+
+	pool, err := s.findPool(campaignID, poolID)
+
+	if err != nil {
+		return result, err
+	}
+
+	if pool.Source != models.CodePoolSourceGenerated {
+		return result, fmt.Errorf("%w: codes of an uploaded pool cannot be generated", ErrInvalid)
+	}
+
+	if count <= 0 || count > MaxCodesPerRequest {
+		return result, fmt.Errorf("%w: count must be between 1 and %d", ErrInvalid, MaxCodesPerRequest)
+	}
+
+	s.db.SetCollection(models.VouchersCollection)
+
+	existing, err := s.db.CountDocuments(bson.M{"pool_id": pool.ID})
+
+	if err != nil {
+		slog.Error("Error counting codes", "error", err)
+
+		return result, errors.New("error generating codes")
+	}
+
+	if float64(existing+int64(count)) > Capacity(pool) {
+		return result, fmt.Errorf("%w: the alphabet and length are too short for %d codes, use a longer length", ErrInvalid, existing+int64(count))
+	}
+
+	for round := 0; round < generateRounds && result.Added < int64(count); round++ {
+		codes := map[string]bool{}
+
+		for int64(len(codes)) < int64(count)-result.Added {
+			code, err := NewCode(pool)
+
+			if err != nil {
+				slog.Error("Error generating code", "error", err)
+
+				return result, errors.New("error generating codes")
+			}
+
+			codes[code] = true
+		}
+
+		batch := make([]string, 0, len(codes))
+
+		for code := range codes {
+			batch = append(batch, code)
+		}
+
+		added, err := s.insert(pool, batch)
+		result.Added += added
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// UploadCodes adds third party codes to an uploaded pool
+func (s *service) UploadCodes(campaignID, poolID string, codes []string) (AddResult, error) {
+	result := AddResult{}
+
+	pool, err := s.findPool(campaignID, poolID)
+
+	if err != nil {
+		return result, err
+	}
+
+	if pool.Source != models.CodePoolSourceUploaded {
+		return result, fmt.Errorf("%w: codes can only be uploaded to an uploaded pool", ErrInvalid)
+	}
+
+	if len(codes) == 0 || len(codes) > MaxCodesPerRequest {
+		return result, fmt.Errorf("%w: between 1 and %d codes are accepted per request", ErrInvalid, MaxCodesPerRequest)
+	}
+
+	seen := map[string]bool{}
+	batch := []string{}
+
+	for _, code := range codes {
+		code = NormalizeCode(pool, code)
+
+		if !Valid(pool, code) {
+			result.Invalid++
+
+			continue
+		}
+
+		if seen[code] {
+			result.Duplicates++
+
+			continue
+		}
+
+		seen[code] = true
+		batch = append(batch, code)
+	}
+
+	added, err := s.insert(pool, batch)
+	result.Added = added
+	result.Duplicates += int64(len(batch)) - added
+
+	return result, err
+}
+
+// insert writes codes to the pool in unordered batches, codes already in
+// the pool fail on the unique index and are not counted
+func (s *service) insert(pool models.CodePool, codes []string) (int64, error) {
+	added := int64(0)
+	now := time.Now().Local()
+
+	s.db.SetCollection(models.VouchersCollection)
+
+	for start := 0; start < len(codes); start += writeBatchSize {
+		end := min(start+writeBatchSize, len(codes))
+		writes := make([]mongo.WriteModel, 0, end-start)
+
+		for _, code := range codes[start:end] {
+			writes = append(writes, mongo.NewInsertOneModel().SetDocument(bson.M{
+				"_id":         primitive.NewObjectID(),
+				"pool_id":     pool.ID,
+				"campaign_id": pool.CampaignID,
+				"code":        code,
+				"status":      models.VoucherStatusAvailable,
+				"created_by":  pool.CreatedBy,
+				"created_at":  now,
+			}))
+		}
+
+		res, err := s.db.BulkWrite(writes)
+
+		if res != nil {
+			added += res.InsertedCount
+		}
+
+		if err != nil && !onlyDuplicates(err) {
+			slog.Error("Error adding codes", "pool", pool.ID, "error", err)
+
+			return added, errors.New("error adding codes")
+		}
+	}
+
+	return added, nil
+}
+
+func onlyDuplicates(err error) bool {
+	bulk := mongo.BulkWriteException{}
+
+	if !errors.As(err, &bulk) || bulk.WriteConcernError != nil {
+		return false
+	}
+
+	for _, e := range bulk.WriteErrors {
+		if !mongo.IsDuplicateKeyError(e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *service) GetVouchers(campaignID, poolID string, f VoucherFilter) (VoucherPage, error) {
+	page := VoucherPage{Vouchers: []models.Voucher{}}
+
+	pool, err := s.findPool(campaignID, poolID)
+
+	if err != nil {
+		return page, err
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = DefaultPageSize
+	}
+
+	if f.Limit > MaxPageSize {
+		f.Limit = MaxPageSize
+	}
+
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+
+	page.Page, page.Limit = f.Page, f.Limit
+
+	filter := bson.M{"pool_id": pool.ID}
+
+	if f.Status != "" {
+		filter["status"] = strings.ToLower(f.Status)
+	}
+
+	s.db.SetCollection(models.VouchersCollection)
+
+	page.Total, err = s.db.CountDocuments(filter)
+
+	if err != nil {
+		slog.Error("Error counting codes", "error", err)
+
+		return page, errors.New("error getting codes")
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(int64((f.Page - 1) * f.Limit)).
+		SetLimit(int64(f.Limit))
+
+	err = s.db.FindManyWithOptions(filter, opts, &page.Vouchers)
+
+	if err != nil {
+		slog.Error("Error getting codes", "error", err)
+
+		return page, errors.New("error getting codes")
+	}
+
+	return page, nil
+}
+
+// Counts tallies the codes matching filter by status, grouped by the
+// field expression group e.g. "$pool_id"
+func Counts(db database.Database, filter bson.M, group string) (map[string]models.VoucherCounts, error) {
+	counts := map[string]models.VoucherCounts{}
+
+	groups := []struct {
+		ID struct {
+			Group  string `bson:"group"`
+			Status string `bson:"status"`
+		} `bson:"_id"`
+		Count int64 `bson:"count"`
+	}{}
+
+	db.SetCollection(models.VouchersCollection)
+
+	err := db.AggregateMany([]bson.M{
+		{"$match": filter},
+		{"$group": bson.M{"_id": bson.M{"group": group, "status": "$status"}, "count": bson.M{"$sum": 1}}},
+	}, &groups)
+
+	if err != nil {
+		slog.Error("Error counting codes", "error", err)
+
+		return counts, errors.New("error counting codes")
+	}
+
+	for _, g := range groups {
+		c := counts[g.ID.Group]
+		c.Total += g.Count
+
+		switch g.ID.Status {
+		case models.VoucherStatusAvailable:
+			c.Available += g.Count
+		case models.VoucherStatusIssued:
+			c.Issued += g.Count
+		case models.VoucherStatusRedeemed:
+			c.Redeemed += g.Count
+		case models.VoucherStatusVoid:
+			c.Void += g.Count
+		}
+
+		counts[g.ID.Group] = c
+	}
+
+	return counts, nil
+}
+
+func (s *service) findPool(campaignID, poolID string) (models.CodePool, error) {
+	pool := models.CodePool{}
+
+	campaign, err := s.findCampaign(campaignID)
+
+	if err != nil {
+		return pool, err
+	}
+
+	objid, err := primitive.ObjectIDFromHex(poolID)
+
+	if err != nil {
+		return pool, fmt.Errorf("%w: no code pools with id: %s found", ErrNotFound, poolID)
+	}
+
+	s.db.SetCollection(models.CodePoolsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "campaign_id": campaign.ID, "created_by": campaign.CreatedBy}, &pool)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return pool, fmt.Errorf("%w: no code pools with id: %s found", ErrNotFound, poolID)
+	}
+
+	if err != nil {
+		slog.Error("Error getting code pool", "error", err)
+
+		return pool, errors.New("error getting code pool")
+	}
+
+	pool.ID = objid.Hex()
+
+	return pool, nil
+}
+
+func (s *service) findCampaign(id string) (models.Campaign, error) {
+	campaign := models.Campaign{}
+
+	user, err := jwt.GetAuthContext(s.ctx)
+
+	if err != nil {
+		slog.Error("Error getting auth context", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	objid, err := primitive.ObjectIDFromHex(id)
+
+	if err != nil {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	s.db.SetCollection(models.CampaignsCollection)
+
+	err = s.db.FindOne(bson.M{"_id": objid, "created_by": user.Sub}, &campaign)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return campaign, fmt.Errorf("%w: no campaigns with id: %s found", ErrNotFound, id)
+	}
+
+	if err != nil {
+		slog.Error("Error getting campaign", "error", err)
+
+		return campaign, errors.New("error getting campaign")
+	}
+
+	campaign.ID = objid.Hex()
+	campaign.CreatedBy = user.Sub
+
+	return campaign, nil
+}
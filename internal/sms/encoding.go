@@ -0,0 +1,95 @@
+package sms
+
+import "unicode/utf16"
+
+const (
+	EncodingGSM7 = "GSM-7"
+	EncodingUCS2 = "UCS-2"
+)
+
+// gsm7Basic is the GSM 03.38 default alphabet, each character is one septet
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsm7Extension characters are sent as an escape plus a septet
+const gsm7Extension = "\f^{}\\[~]|€"
+
+var gsm7Septets = func() map[rune]int {
+	m := map[rune]int{}
+
+	for _, r := range gsm7Basic {
+		m[r] = 1
+	}
+
+	for _, r := range gsm7Extension {
+		m[r] = 2
+	}
+
+	return m
+}()
+
+// Segments returns the encoding a body needs and how many message parts it is
+// sent as. A single GSM-7 part holds 160 septets and a single UCS-2 part 70
+// UTF-16 code units, concatenated parts lose room to the UDH header.
+func Segments(body string) (encoding string, segments int) {
+	if body == "" {
+		return EncodingGSM7, 0
+	}
+
+	if widths, ok := gsm7Widths(body); ok {
+		return EncodingGSM7, parts(widths, 160, 153)
+	}
+
+	widths := []int{}
+
+	for _, r := range body {
+		widths = append(widths, len(utf16.Encode([]rune{r})))
+	}
+
+	return EncodingUCS2, parts(widths, 70, 67)
+}
+
+// gsm7Widths returns the septets each character takes or false when body
+// has a character outside the GSM-7 alphabet
+func gsm7Widths(body string) ([]int, bool) {
+	widths := []int{}
+
+	for _, r := range body {
+		septets, ok := gsm7Septets[r]
+
+		if !ok {
+			return nil, false
+		}
+
+		widths = append(widths, septets)
+	}
+
+	return widths, true
+}
+
+// parts packs characters of the given widths into message parts. An escaped
+// GSM-7 character or a UTF-16 surrogate pair is never split across parts.
+func parts(widths []int, single, multi int) int {
+	total := 0
+
+	for _, w := range widths {
+		total += w
+	}
+
+	if total <= single {
+		return 1
+	}
+
+	n, used := 1, 0
+
+	for _, w := range widths {
+		if used+w > multi {
+			n++
+			used = 0
+		}
+
+		used += w
+	}
+
+	return n
+}
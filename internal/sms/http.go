@@ -0,0 +1,96 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type HTTPConfig struct {
+	URL    string
+	APIKey string
+	Client *http.Client
+}
+
+// HTTPProvider posts messages as json to a gateway:
+//
+//	POST <URL> {"from": "...", "to": "...", "text": "..."}
+//	Authorization: Bearer <APIKey>
+//
+// and reads the gateway message id from {"message_id": "..."}.
+type HTTPProvider struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func NewHTTPProvider(cfg HTTPConfig) *HTTPProvider {
+	client := cfg.Client
+
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+
+	return &HTTPProvider{url: cfg.URL, apiKey: cfg.APIKey, client: client}
+}
+
+func (p *HTTPProvider) Name() string {
+	return "http"
+}
+
+func (p *HTTPProvider) Send(ctx context.Context, m Message) (Result, error) {
+	body, err := json.Marshal(map[string]string{
+		"from": m.From,
+		"to":   m.To,
+		"text": m.Body,
+	})
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+
+	if err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	res, err := p.client.Do(req)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	defer res.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+
+	// throttling and gateway errors are worth retrying, other rejections are not
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return Result{}, fmt.Errorf("gateway returned %d: %s", res.StatusCode, bytes.TrimSpace(data))
+	}
+
+	if res.StatusCode >= 300 {
+		return Result{}, fmt.Errorf("%w: gateway returned %d: %s", ErrPermanent, res.StatusCode, bytes.TrimSpace(data))
+	}
+
+	out := struct {
+		MessageID string `json:"message_id"`
+	}{}
+
+	if err := json.Unmarshal(data, &out); err != nil {
+		return Result{}, fmt.Errorf("invalid gateway response: %w", err)
+	}
+
+	return Result{ProviderMessageID: out.MessageID}, nil
+}
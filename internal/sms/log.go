@@ -0,0 +1,71 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LogProvider does not deliver anything. It appends each message as a json
+// line to a file, or logs it when no path is set, for local development.
+type LogProvider struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewLogProvider(path string) *LogProvider {
+	return &LogProvider{path: path}
+}
+
+func (p *LogProvider) Name() string {
+	return "log"
+}
+
+func (p *LogProvider) Send(ctx context.Context, m Message) (Result, error) {
+	id := primitive.NewObjectID().Hex()
+
+	if p.path == "" {
+		slog.Info("SMS", "id", id, "from", m.From, "to", m.To, "body", m.Body)
+
+		return Result{ProviderMessageID: id}, nil
+	}
+
+	line, err := json.Marshal(map[string]string{
+		"id":      id,
+		"from":    m.From,
+		"to":      m.To,
+		"body":    m.Body,
+		"sent_at": time.Now().Format(time.RFC3339),
+	})
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+		return Result{}, err
+	}
+
+	f, err := os.OpenFile(p.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return Result{}, err
+	}
+
+	return Result{ProviderMessageID: id}, nil
+}
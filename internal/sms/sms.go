@@ -0,0 +1,92 @@
+package sms
+
+import (
+	"campaign/internal/webhook"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+// ErrPermanent marks a send failure that will not succeed on retry,
+// e.g. an invalid number or a rejected sender id
+var ErrPermanent = errors.New("permanent sms failure")
+
+var (
+	driver   = os.Getenv("SMS_DRIVER")
+	senderID = os.Getenv("SMS_SENDER_ID")
+	logPath  = os.Getenv("SMS_LOG_PATH")
+
+	httpURL    = os.Getenv("SMS_HTTP_URL")
+	httpAPIKey = os.Getenv("SMS_HTTP_API_KEY")
+
+	// rateLimit is the most messages per second sent through the provider
+	rateLimit, _ = strconv.Atoi(os.Getenv("SMS_RATE_LIMIT"))
+
+	// webhookSecret signs delivery receipts posted back by the gateway
+	webhookSecret = os.Getenv("SMS_WEBHOOK_SECRET")
+)
+
+type Message struct {
+	To   string
+	From string
+	Body string
+}
+
+type Result struct {
+	ProviderMessageID string
+}
+
+// SMSProvider sends a single message through a gateway. Errors wrapping
+// ErrPermanent are not retried, any other error is.
+type SMSProvider interface {
+	Name() string
+	Send(ctx context.Context, m Message) (Result, error)
+}
+
+// New returns the provider configured through SMS_DRIVER, throttled to
+// SMS_RATE_LIMIT messages per second. "http" posts to a gateway, anything
+// else appends messages to a log file.
+func New() SMSProvider {
+	var provider SMSProvider
+
+	switch driver {
+	case "http":
+		slog.Info("Using http sms provider", "URL", httpURL)
+
+		provider = NewHTTPProvider(HTTPConfig{URL: httpURL, APIKey: httpAPIKey})
+	default:
+		slog.Info("Using log sms provider", "Path", logPath)
+
+		provider = NewLogProvider(logPath)
+	}
+
+	if rateLimit > 0 {
+		provider = Throttle(provider, rateLimit)
+	}
+
+	return provider
+}
+
+// SenderID is the default from address for outbound messages
+func SenderID() string {
+	return senderID
+}
+
+// ReceiptVerifier authenticates delivery receipts and inbound texts from
+// provider, they are signed with SMS_WEBHOOK_SECRET
+func ReceiptVerifier(provider string) (webhook.Verifier, bool) {
+	switch provider {
+	case "http", "log":
+		return webhook.HMACVerifier{Secret: webhookSecret}, true
+	}
+
+	return nil, false
+}
+
+func IsPermanent(err error) bool {
+	return errors.Is(err, ErrPermanent)
+}
@@ -0,0 +1,137 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSegments(t *testing.T) {
+	tests := []struct {
+		body     string
+		encoding string
+		segments int
+	}{
+		{"", EncodingGSM7, 0},
+		{"Hello", EncodingGSM7, 1},
+		{strings.Repeat("a", 160), EncodingGSM7, 1},
+		{strings.Repeat("a", 161), EncodingGSM7, 2},
+		{strings.Repeat("a", 306), EncodingGSM7, 2},
+		{strings.Repeat("a", 307), EncodingGSM7, 3},
+		// € is an escaped character and takes two septets
+		{strings.Repeat("€", 80), EncodingGSM7, 1},
+		{strings.Repeat("€", 81), EncodingGSM7, 2},
+		{strings.Repeat("a", 152) + "€" + "a", EncodingGSM7, 1},
+		// 306 septets would fit 2 parts but the escape is not split so the first part is one short
+		{strings.Repeat("a", 152) + "€" + strings.Repeat("a", 152), EncodingGSM7, 3},
+		{"Akwaaba ✓", EncodingUCS2, 1},
+		{strings.Repeat("ɛ", 70), EncodingUCS2, 1},
+		{strings.Repeat("ɛ", 71), EncodingUCS2, 2},
+		// emoji are surrogate pairs, two code units each
+		{strings.Repeat("🎉", 35), EncodingUCS2, 1},
+		{strings.Repeat("🎉", 36), EncodingUCS2, 2},
+	}
+
+	for _, tt := range tests {
+		encoding, segments := Segments(tt.body)
+
+		if encoding != tt.encoding || segments != tt.segments {
+			t.Errorf("expected %s in %d parts for %q; got %s in %d", tt.encoding, tt.segments, tt.body, encoding, segments)
+		}
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	received := map[string]string{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&received)
+
+		switch received["to"] {
+		case "233200000000":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": "invalid number"}`))
+		case "233300000000":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte(`{"message_id": "gw-1"}`))
+		}
+	}))
+	defer srv.Close()
+
+	p := NewHTTPProvider(HTTPConfig{URL: srv.URL, APIKey: "key"})
+
+	result, err := p.Send(context.Background(), Message{To: "233241234567", From: "Campaign", Body: "Hi"})
+
+	if err != nil {
+		t.Fatalf("expected no error; got %v", err)
+	}
+
+	if result.ProviderMessageID != "gw-1" {
+		t.Errorf("expected message id gw-1; got %q", result.ProviderMessageID)
+	}
+
+	if received["text"] != "Hi" || received["from"] != "Campaign" {
+		t.Errorf("unexpected request body %v", received)
+	}
+
+	_, err = p.Send(context.Background(), Message{To: "233200000000", Body: "Hi"})
+
+	if !IsPermanent(err) {
+		t.Errorf("expected a 400 to be permanent; got %v", err)
+	}
+
+	_, err = p.Send(context.Background(), Message{To: "233300000000", Body: "Hi"})
+
+	if err == nil || IsPermanent(err) {
+		t.Errorf("expected a 503 to be retryable; got %v", err)
+	}
+}
+
+func TestLogProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sms", "outbox.log")
+	p := NewLogProvider(path)
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.Send(context.Background(), Message{To: "233241234567", Body: "Hi"}); err != nil {
+			t.Fatalf("expected no error; got %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("expected 2 logged messages; got %d", lines)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	p := Throttle(NewLogProvider(filepath.Join(t.TempDir(), "outbox.log")), 50)
+	start := time.Now()
+
+	for i := 0; i < 6; i++ {
+		if _, err := p.Send(context.Background(), Message{To: "233241234567", Body: "Hi"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first send is immediate, the next five wait 20ms each
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected 6 sends at 50/s to take at least 100ms; took %v", elapsed)
+	}
+}
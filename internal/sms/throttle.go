@@ -0,0 +1,55 @@
+package sms
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// throttled spaces sends through a provider evenly so that no more than
+// perSecond messages start in any second, across all callers
+type throttled struct {
+	SMSProvider
+
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+func Throttle(p SMSProvider, perSecond int) SMSProvider {
+	return &throttled{SMSProvider: p, interval: time.Second / time.Duration(perSecond)}
+}
+
+func (t *throttled) Send(ctx context.Context, m Message) (Result, error) {
+	if err := t.wait(ctx); err != nil {
+		return Result{}, err
+	}
+
+	return t.SMSProvider.Send(ctx, m)
+}
+
+// wait reserves the next free slot and sleeps until it
+func (t *throttled) wait(ctx context.Context) error {
+	t.mu.Lock()
+
+	now := time.Now()
+	slot := t.next
+
+	if slot.Before(now) {
+		slot = now
+	}
+
+	t.next = slot.Add(t.interval)
+
+	t.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	FILES_SIGNING_SECRET = os.Getenv("FILES_SIGNING_SECRET")
+	PUBLIC_BASE_URL      = os.Getenv("PUBLIC_BASE_URL")
+
+	// DefaultURLTTL is how long urls returned by SignedURL stay valid
+	DefaultURLTTL = time.Hour
+)
+
+var (
+	ErrSignatureInvalid = errors.New("signature is invalid")
+	ErrSignatureExpired = errors.New("signature is expired")
+)
+
+// FilesPath is the route prefix download urls are served from
+const FilesPath = "/files/"
+
+func signingSecret() []byte {
+	if FILES_SIGNING_SECRET != "" {
+		return []byte(FILES_SIGNING_SECRET)
+	}
+
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+func signature(key string, expires int64) string {
+	h := hmac.New(sha256.New, signingSecret())
+	h.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SignURL returns a download url for key that is valid for ttl.
+func SignURL(key string, ttl time.Duration) string {
+	expires := time.Now().Add(ttl).Unix()
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", signature(key, expires))
+
+	return strings.TrimSuffix(PUBLIC_BASE_URL, "/") + FilesPath + awsEscape(key) + "?" + q.Encode()
+}
+
+// SignedURL is SignURL with DefaultURLTTL.
+func SignedURL(key string) string {
+	return SignURL(key, DefaultURLTTL)
+}
+
+// VerifySignature checks the expires and signature query parameters produced by SignURL.
+func VerifySignature(key, expires, sig string) (time.Time, error) {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+
+	if err != nil {
+		return time.Time{}, ErrSignatureInvalid
+	}
+
+	if !hmac.Equal([]byte(signature(key, exp)), []byte(sig)) {
+		return time.Time{}, ErrSignatureInvalid
+	}
+
+	t := time.Unix(exp, 0)
+
+	if time.Now().After(t) {
+		return t, ErrSignatureExpired
+	}
+
+	return t, nil
+}
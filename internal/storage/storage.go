@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	_ "github.com/joho/godotenv/autoload"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+var (
+	driver    = os.Getenv("STORAGE_DRIVER")
+	localPath = os.Getenv("STORAGE_LOCAL_PATH")
+
+	s3Endpoint  = os.Getenv("S3_ENDPOINT")
+	s3Region    = os.Getenv("S3_REGION")
+	s3Bucket    = os.Getenv("S3_BUCKET")
+	s3AccessKey = os.Getenv("S3_ACCESS_KEY")
+	s3SecretKey = os.Getenv("S3_SECRET_KEY")
+)
+
+// Object is a blob read back from a BlobStore.
+// The caller is responsible for closing Body.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+}
+
+// BlobStore stores opaque files under slash separated keys
+// e.g. campaigns/<id>/banner/<version>/original.png
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the blob store configured through STORAGE_DRIVER.
+// "s3" uses an S3 compatible bucket, anything else falls back to the local filesystem.
+func New() BlobStore {
+	switch driver {
+	case "s3":
+		slog.Info("Using s3 blob store", "Endpoint", s3Endpoint, "Bucket", s3Bucket)
+
+		return NewS3Store(S3Config{
+			Endpoint:  s3Endpoint,
+			Region:    s3Region,
+			Bucket:    s3Bucket,
+			AccessKey: s3AccessKey,
+			SecretKey: s3SecretKey,
+		})
+	default:
+		root := localPath
+		if root == "" {
+			root = "uploads"
+		}
+
+		slog.Info("Using local blob store", "Path", root)
+
+		return NewLocalStore(root)
+	}
+}
+
+// validKey rejects keys that could escape the store root or the bucket.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal in memory stand in for an S3 compatible service
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.objects[r.URL.Path] = body
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		body, ok := f.objects[r.URL.Path]
+
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", f.types[r.URL.Path])
+		_, _ = w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	key := "campaigns/1/banner/original.png"
+
+	if err := store.Put(ctx, key, bytes.NewReader([]byte("image")), 5, "image/png"); err != nil {
+		t.Fatalf("Put() returned error: %v", err)
+	}
+
+	obj, err := store.Get(ctx, key)
+
+	if err != nil {
+		t.Fatalf("Get() returned error: %v", err)
+	}
+
+	body, _ := io.ReadAll(obj.Body)
+	obj.Body.Close()
+
+	if string(body) != "image" {
+		t.Errorf("expected body to be image; got %s", body)
+	}
+
+	if obj.ContentType != "image/png" {
+		t.Errorf("expected content type image/png; got %s", obj.ContentType)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete() returned error: %v", err)
+	}
+
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete; got %v", err)
+	}
+
+	if err := store.Put(ctx, "../escape", bytes.NewReader(nil), 0, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey; got %v", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	testStore(t, NewLocalStore(t.TempDir()))
+}
+
+func TestS3Store(t *testing.T) {
+	server := httptest.NewServer(&fakeS3{objects: map[string][]byte{}, types: map[string]string{}})
+	defer server.Close()
+
+	testStore(t, NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "campaign",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}))
+}
+
+func TestSignURL(t *testing.T) {
+	FILES_SIGNING_SECRET = "secret"
+
+	u, err := url.Parse(SignURL("campaigns/1/banner/original.png", time.Minute))
+
+	if err != nil {
+		t.Fatalf("SignURL() returned an invalid url: %v", err)
+	}
+
+	key := strings.TrimPrefix(u.Path, FilesPath)
+	q := u.Query()
+
+	if _, err := VerifySignature(key, q.Get("expires"), q.Get("signature")); err != nil {
+		t.Errorf("expected signature to be valid; got %v", err)
+	}
+
+	if _, err := VerifySignature("campaigns/2/banner/original.png", q.Get("expires"), q.Get("signature")); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected signature for another key to be invalid; got %v", err)
+	}
+
+	u, _ = url.Parse(SignURL("campaigns/1/banner/original.png", -time.Minute))
+	q = u.Query()
+
+	if _, err := VerifySignature(key, q.Get("expires"), q.Get("signature")); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("expected signature to be expired; got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// MaxPixels guards against decompression bombs, a small file
+// can declare huge dimensions and exhaust memory when decoded.
+const MaxPixels = 40_000_000
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type. allowed types are png, jpeg, gif and webp")
+	ErrTooLarge        = errors.New("image dimensions are too large")
+)
+
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Variant is an encoded copy of an image
+type Variant struct {
+	Name        string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Size is a named maximum width a variant is scaled down to
+type Size struct {
+	Name     string
+	MaxWidth int
+}
+
+// Sniff detects the content type of data from its first bytes.
+// Only image types we can decode are accepted, the client supplied
+// content type is never trusted.
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+
+	if _, ok := extensions[contentType]; !ok {
+		return "", ErrUnsupportedType
+	}
+
+	return contentType, nil
+}
+
+// Extension returns the file extension for an image content type
+func Extension(contentType string) string {
+	return extensions[contentType]
+}
+
+// Decode checks the dimensions before decoding the full image.
+func Decode(data []byte, contentType string) (image.Image, error) {
+	decodeConfig, decode := decoders(contentType)
+
+	if decode == nil {
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, err := decodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, err := decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid image: %w", err)
+	}
+
+	return img, nil
+}
+
+// Dimensions reads the width and height from the image header only
+func Dimensions(data []byte, contentType string) (int, int, error) {
+	decodeConfig, _ := decoders(contentType)
+
+	if decodeConfig == nil {
+		return 0, 0, ErrUnsupportedType
+	}
+
+	cfg, err := decodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid image: %w", err)
+	}
+
+	return cfg.Width, cfg.Height, nil
+}
+
+func decoders(contentType string) (func(io.Reader) (image.Config, error), func(io.Reader) (image.Image, error)) {
+	switch contentType {
+	case "image/png":
+		return png.DecodeConfig, png.Decode
+	case "image/jpeg":
+		return jpeg.DecodeConfig, jpeg.Decode
+	case "image/gif":
+		return gif.DecodeConfig, gif.Decode
+	case "image/webp":
+		return webp.DecodeConfig, webp.Decode
+	}
+
+	return nil, nil
+}
+
+// Resize scales img down to maxWidth keeping the aspect ratio.
+// Images that are already narrower are returned as is.
+func Resize(img image.Image, maxWidth int) image.Image {
+	b := img.Bounds()
+
+	if b.Dx() <= maxWidth {
+		return img
+	}
+
+	height := b.Dy() * maxWidth / b.Dx()
+
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, maxWidth, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	return dst
+}
+
+// Variants renders every size in both a web safe format (jpeg, or png
+// when the source can be transparent) and webp.
+func Variants(img image.Image, sourceType string, sizes []Size) ([]Variant, error) {
+	variants := []Variant{}
+
+	for _, size := range sizes {
+		scaled := Resize(img, size.MaxWidth)
+		b := scaled.Bounds()
+
+		buf := bytes.Buffer{}
+		contentType := "image/jpeg"
+
+		var err error
+
+		if sourceType == "image/png" || sourceType == "image/gif" || sourceType == "image/webp" {
+			contentType = "image/png"
+			err = png.Encode(&buf, scaled)
+		} else {
+			err = jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, Variant{
+			Name:        size.Name,
+			ContentType: contentType,
+			Width:       b.Dx(),
+			Height:      b.Dy(),
+			Data:        buf.Bytes(),
+		})
+
+		webpBuf := bytes.Buffer{}
+
+		if err := nativewebp.Encode(&webpBuf, scaled, nil); err != nil {
+			return nil, err
+		}
+
+		variants = append(variants, Variant{
+			Name:        size.Name + "_webp",
+			ContentType: "image/webp",
+			Width:       b.Dx(),
+			Height:      b.Dy(),
+			Data:        webpBuf.Bytes(),
+		})
+	}
+
+	return variants, nil
+}
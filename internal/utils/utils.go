@@ -3,8 +3,15 @@ package utils
 import (
 	"encoding/json"
 	"log/slog"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
 )
 
+// DEFAULT_COUNTRY_CODE is prefixed to local msisdns that start with a 0
+var DEFAULT_COUNTRY_CODE = os.Getenv("DEFAULT_COUNTRY_CODE")
+
 type ApiResponse struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
@@ -25,3 +32,65 @@ func WrapInResponse(message string, data interface{}) []byte {
 
 	return b
 }
+
+// NormalizeTags lower cases, trims and de-duplicates tags
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		result = append(result, tag)
+	}
+
+	return result
+}
+
+// NormalizeEmail trims and lower cases an email address for de-duplication
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeMsisdn keeps only digits and turns local numbers (leading 0) into
+// international ones using DEFAULT_COUNTRY_CODE e.g. 0241234567 -> 233241234567
+func NormalizeMsisdn(msisdn string) string {
+	digits := strings.Builder{}
+
+	for _, r := range msisdn {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+
+	n := digits.String()
+
+	if strings.HasPrefix(n, "00") {
+		return n[2:]
+	}
+
+	if strings.HasPrefix(n, "0") && DEFAULT_COUNTRY_CODE != "" {
+		return DEFAULT_COUNTRY_CODE + n[1:]
+	}
+
+	return n
+}
+
+// Backoff is the wait before retry number attempt, doubling from base up to
+// max with up to 20% jitter so retries from one batch do not line up
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+
+	d = min(d, max)
+
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
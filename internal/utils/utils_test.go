@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	base, max := time.Second, 10*time.Second
+
+	for attempt, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: max} {
+		got := Backoff(attempt, base, max)
+
+		if got < want || got > want+want/5 {
+			t.Errorf("expected backoff for attempt %d between %v and %v; got %v", attempt, want, want+want/5, got)
+		}
+	}
+}
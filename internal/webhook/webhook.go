@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnauthorized is returned when a callback is unsigned or the signature
+// does not match
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Verifier authenticates a callback from a provider given its raw body
+type Verifier interface {
+	Verify(r *http.Request, body []byte) error
+}
+
+// SecretVerifier expects a shared secret in a header, for relays that can
+// not sign their requests
+type SecretVerifier struct {
+	Secret string
+	Header string
+}
+
+func (v SecretVerifier) Verify(r *http.Request, body []byte) error {
+	if v.Secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get(v.Header)), []byte(v.Secret)) != 1 {
+		return ErrUnauthorized
+	}
+
+	return nil
+}
+
+// HMACVerifier expects X-Signature to hold the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with Secret, where the timestamp is the unix
+// time in X-Signature-Timestamp. Old timestamps are rejected so a captured
+// callback can not be replayed later.
+type HMACVerifier struct {
+	Secret    string
+	Tolerance time.Duration
+}
+
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Signature-Timestamp"
+)
+
+func (v HMACVerifier) Verify(r *http.Request, body []byte) error {
+	if v.Secret == "" {
+		return ErrUnauthorized
+	}
+
+	ts := r.Header.Get(TimestampHeader)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+
+	if err != nil {
+		return ErrUnauthorized
+	}
+
+	tolerance := v.Tolerance
+
+	if tolerance == 0 {
+		tolerance = 5 * time.Minute
+	}
+
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return ErrUnauthorized
+	}
+
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(SignatureHeader), "sha256="))
+
+	if err != nil || !hmac.Equal(signature, Sign(v.Secret, ts, body)) {
+		return ErrUnauthorized
+	}
+
+	return nil
+}
+
+// Sign computes the signature HMACVerifier expects
+func Sign(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"encoding/hex"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHMACVerifier(t *testing.T) {
+	v := HMACVerifier{Secret: "s3cret"}
+	body := []byte(`{"message_id":"abc","status":"delivered"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set(TimestampHeader, ts)
+	r.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(Sign("s3cret", ts, body)))
+
+	if err := v.Verify(r, body); err != nil {
+		t.Errorf("expected a valid signature to verify; got %v", err)
+	}
+
+	if err := v.Verify(r, []byte(`{"message_id":"abc","status":"failed"}`)); err != ErrUnauthorized {
+		t.Errorf("expected a tampered body to be rejected; got %v", err)
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	r.Header.Set(TimestampHeader, old)
+	r.Header.Set(SignatureHeader, hex.EncodeToString(Sign("s3cret", old, body)))
+
+	if err := v.Verify(r, body); err != ErrUnauthorized {
+		t.Errorf("expected an old timestamp to be rejected; got %v", err)
+	}
+
+	if err := (HMACVerifier{}).Verify(r, body); err != ErrUnauthorized {
+		t.Errorf("expected a verifier without a secret to reject everything; got %v", err)
+	}
+}
+
+func TestSecretVerifier(t *testing.T) {
+	v := SecretVerifier{Secret: "s3cret", Header: "X-Webhook-Secret"}
+	r := httptest.NewRequest("POST", "/", nil)
+
+	if err := v.Verify(r, nil); err != ErrUnauthorized {
+		t.Errorf("expected a missing secret to be rejected; got %v", err)
+	}
+
+	r.Header.Set("X-Webhook-Secret", "s3cret")
+
+	if err := v.Verify(r, nil); err != nil {
+		t.Errorf("expected the secret to verify; got %v", err)
+	}
+}